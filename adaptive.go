@@ -0,0 +1,146 @@
+package merkle
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// WithAdaptiveWorkers makes Build vary the count of shards checksummed at
+// once, up to WithHashWorkers, by the throughput measured as it goes. So one
+// setting suits both a spinning disk, where more readers seek more, and a
+// fast disk or memory, where hashing is the bound.
+func WithAdaptiveWorkers() Option {
+	return func(o *options) {
+		o.given |= optAdaptiveWorkers
+		o.adaptive = true
+	}
+}
+
+const (
+	// adaptiveShards is the shards per worker, so the count at once can be
+	// changed a shard at a time
+	adaptiveShards = 8
+
+	// adaptiveTolerance is the change of throughput taken as no change
+	adaptiveTolerance = 0.05
+
+	// adaptiveIOWait is the share of the time of shards spent reading, over
+	// which fewer workers are tried when more do not help
+	adaptiveIOWait = 0.5
+)
+
+// workerLimiter limits the shards checksummed at once, stepping the limit up
+// or down after each window of shards by the throughput of the window
+type workerLimiter struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	max     int
+	limit   int
+	running int
+	step    int
+
+	// of the current window
+	start       time.Time
+	done        int
+	bytes       int64
+	read, total time.Duration
+	lastRate    float64
+}
+
+// newLimiter is a workerLimiter of the hash workers, or nil if they are not
+// adaptive
+func (o options) newLimiter() *workerLimiter {
+	if !o.adaptive {
+		return nil
+	}
+	l := &workerLimiter{max: o.hashWorkers, limit: (o.hashWorkers + 1) / 2, step: 1, start: time.Now()}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// shards is the count of shards per worker
+func (l *workerLimiter) shards() int {
+	if l == nil {
+		return 1
+	}
+	return adaptiveShards
+}
+
+// do calls fn with r, once fewer shards than the limit are being checksummed,
+// and times the reads of r and the whole of fn for a shard of length bytes. A
+// nil workerLimiter calls fn right away.
+func (l *workerLimiter) do(r io.ReaderAt, length int64, fn func(r io.ReaderAt)) {
+	if l == nil {
+		fn(r)
+		return
+	}
+	l.mu.Lock()
+	for l.running >= l.limit {
+		l.cond.Wait()
+	}
+	l.running++
+	l.mu.Unlock()
+
+	var (
+		tr    = &timedReaderAt{r: r}
+		start = time.Now()
+	)
+	fn(tr)
+	elapsed := time.Since(start)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	l.done++
+	l.bytes += length
+	l.read += tr.d
+	l.total += elapsed
+	if l.done >= 2*l.limit {
+		now := time.Now()
+		if secs := now.Sub(l.start).Seconds(); secs > 0 && l.total > 0 {
+			l.adjust(float64(l.bytes)/secs, float64(l.read)/float64(l.total))
+		}
+		l.start, l.done, l.bytes, l.read, l.total = now, 0, 0, 0, 0
+	}
+	l.cond.Broadcast()
+}
+
+// adjust steps the limit by the throughput of the last window, continuing a
+// step that raised it and reversing one that lowered it. Unchanged throughput
+// with the shards mostly waiting on reads steps down, as more readers are no
+// help to the disk.
+func (l *workerLimiter) adjust(rate, ioWait float64) {
+	switch {
+	case l.lastRate == 0:
+	case rate > l.lastRate*(1+adaptiveTolerance):
+	case rate < l.lastRate*(1-adaptiveTolerance):
+		l.step = -l.step
+	case ioWait > adaptiveIOWait:
+		l.step = -1
+	}
+	l.lastRate = rate
+	if next := l.limit + l.step; next < 1 || next > l.max {
+		l.step = -l.step
+	}
+	l.limit += l.step
+	if l.limit < 1 {
+		l.limit = 1
+	}
+	if l.limit > l.max {
+		l.limit = l.max
+	}
+}
+
+// timedReaderAt is the time spent in the ReadAt of r
+type timedReaderAt struct {
+	r io.ReaderAt
+	d time.Duration
+}
+
+func (tr *timedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	start := time.Now()
+	n, err := tr.r.ReadAt(p, off)
+	tr.d += time.Since(start)
+	return n, err
+}
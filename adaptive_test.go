@@ -0,0 +1,52 @@
+package merkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAdaptiveWorkers(t *testing.T) {
+	data := make([]byte, 16*1000+9)
+	for i := range data {
+		data[i] = byte(i * 31)
+	}
+	_, root, err := NewBuilder(DefaultHashMaker, 16).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{1, 3, 8} {
+		tree, sum, err := NewBuilder(DefaultHashMaker, 16, WithHashWorkers(workers), WithAdaptiveWorkers()).Build(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sum, root) || len(tree.Nodes) != 1001 {
+			t.Errorf("%d workers: expected the root of the data", workers)
+		}
+	}
+}
+
+func TestWorkerLimiterAdjust(t *testing.T) {
+	l := options{adaptive: true, hashWorkers: 4}.newLimiter()
+	if l.limit != 2 {
+		t.Fatalf("expected to start at half the workers, got %d", l.limit)
+	}
+	for _, c := range []struct {
+		rate, ioWait float64
+		limit        int
+	}{
+		{100, 0, 3}, // the first window steps up
+		{150, 0, 4}, // faster, so on up to the most
+		{160, 0, 3}, // bounded, so back down
+		{100, 0, 4}, // slower, so back up
+		{100, 0, 3}, // no change bounded at the most
+		{100, 0.9, 2},
+		{101, 0.9, 1}, // no change waiting on reads steps down
+		{101, 0.9, 2}, // bounded at the least
+		{50, 0.9, 1},  // slower, so back down
+	} {
+		l.adjust(c.rate, c.ioWait)
+		if l.limit != c.limit {
+			t.Fatalf("rate %v io wait %v: expected a limit of %d, got %d", c.rate, c.ioWait, c.limit, l.limit)
+		}
+	}
+}
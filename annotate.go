@@ -0,0 +1,88 @@
+package merkle
+
+import "errors"
+
+// MaxAnnotationLength is the most bytes of an annotation of a leaf
+const MaxAnnotationLength = 1 << 16
+
+// ErrNotAnnotated is for a leaf without an annotation
+var ErrNotAnnotated = errors.New("leaf is not annotated")
+
+// AnnotatedLeaf is the checksum of a leaf of block with annotation, small
+// application metadata as a record id or tags, which the checksum commits to
+// along with the block. The annotation is length prefixed, so the boundary of
+// it and the block is fixed.
+//
+// A tree is to be of annotated leaves throughout, as a leaf of a block alone
+// is not told apart from one of an annotation.
+func AnnotatedLeaf(hm HashMaker, annotation, block []byte) ([]byte, error) {
+	if len(annotation) > MaxAnnotationLength {
+		return nil, ErrLimitExceeded{Limit: "annotation bytes", Max: MaxAnnotationLength}
+	}
+	h := hm()
+	if _, err := h.Write(appendUvarint(nil, uint64(len(annotation)))); err != nil {
+		return nil, err
+	}
+	if _, err := h.Write(annotation); err != nil {
+		return nil, err
+	}
+	if _, err := h.Write(block); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// NewAnnotatedNode is NewNodeHashBlock, of the AnnotatedLeaf of block with
+// annotation. The annotation is kept with the node for TaggedProof, though
+// not by the serialized forms of a tree.
+func NewAnnotatedNode(hm HashMaker, annotation, block []byte) (*Node, error) {
+	sum, err := AnnotatedLeaf(hm, annotation, block)
+	if err != nil {
+		return nil, err
+	}
+	a := append([]byte{}, annotation...)
+	n := newLeaf(hm, sum)
+	n.sums.annotation = &a
+	return n, nil
+}
+
+// Annotation is the annotation of a node of NewAnnotatedNode, or nil
+func (n Node) Annotation() []byte {
+	if n.sums == nil || n.slot == noSlot || n.sums.annotation == nil {
+		return nil
+	}
+	return *n.sums.annotation
+}
+
+// TaggedProof is the Proof of an annotated leaf, carrying its annotation, so
+// the proof shows the annotation, as a record id, maps to the block
+type TaggedProof struct {
+	Proof      Proof
+	Annotation []byte
+}
+
+// TaggedProof returns the TaggedProof of the annotated leaf at index
+func (t *Tree) TaggedProof(index int) (TaggedProof, error) {
+	if index < 0 || index >= len(t.Nodes) {
+		return TaggedProof{}, ErrIndexOutOfRange{Index: index, Size: len(t.Nodes)}
+	}
+	annotation := t.Nodes[index].Annotation()
+	if annotation == nil {
+		return TaggedProof{}, ErrNotAnnotated
+	}
+	p, err := t.InclusionProof(index)
+	if err != nil {
+		return TaggedProof{}, err
+	}
+	return TaggedProof{Proof: p, Annotation: annotation}, nil
+}
+
+// VerifyTaggedProof checks that block, with the annotation of p, is the leaf
+// proven under root
+func VerifyTaggedProof(hm HashMaker, root []byte, p TaggedProof, block []byte) error {
+	leaf, err := AnnotatedLeaf(hm, p.Annotation, block)
+	if err != nil {
+		return err
+	}
+	return VerifyProof(hm, root, p.Proof, leaf)
+}
@@ -0,0 +1,62 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTaggedProof(t *testing.T) {
+	var (
+		tree    Tree
+		records [][]byte
+	)
+	for i := 0; i < 5; i++ {
+		record := []byte(fmt.Sprintf("record body %d", i))
+		n, err := NewAnnotatedNode(sha256.New, []byte(fmt.Sprintf("id-%d", i)), record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Append(n)
+		records = append(records, record)
+	}
+	root, err := tree.RootChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the interior nodes share the digests of a leaf, but not its annotation
+	if a := tree.Root().Left.Annotation(); a != nil {
+		t.Errorf("expected no annotation of an interior node, got %q", a)
+	}
+	if a := tree.Nodes[1].leafCopy().Annotation(); !bytes.Equal(a, []byte("id-1")) {
+		t.Errorf("expected the annotation of a copy of a leaf, got %q", a)
+	}
+
+	p, err := tree.TaggedProof(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p.Annotation, []byte("id-3")) {
+		t.Errorf("expected the annotation id-3, got %q", p.Annotation)
+	}
+	if err := VerifyTaggedProof(sha256.New, root, p, records[3]); err != nil {
+		t.Errorf("expected the record to verify, got %v", err)
+	}
+	if err := VerifyTaggedProof(sha256.New, root, p, records[2]); err == nil {
+		t.Error("expected another record to fail")
+	}
+	p.Annotation = []byte("id-4")
+	if err := VerifyTaggedProof(sha256.New, root, p, records[3]); err == nil {
+		t.Error("expected another annotation to fail")
+	}
+
+	plain, _ := SumOf(sha256.New, 64, []byte("no annotations"))
+	if _, err := plain.TaggedProof(0); err != ErrNotAnnotated {
+		t.Errorf("expected ErrNotAnnotated, got %v", err)
+	}
+	if _, err := AnnotatedLeaf(sha256.New, make([]byte, MaxAnnotationLength+1), nil); !errors.As(err, new(ErrLimitExceeded)) {
+		t.Errorf("expected ErrLimitExceeded, got %v", err)
+	}
+}
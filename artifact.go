@@ -0,0 +1,249 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Media types of trees packaged as OCI artifacts
+const (
+	// ArtifactType is the artifactType of the manifest of a tree
+	ArtifactType = "application/vnd.vbatts.merkle.tree.v1"
+
+	// MediaTypeTree is the media type of a tree blob, as from
+	// Tree.MarshalBinary
+	MediaTypeTree = "application/vnd.vbatts.merkle.tree.v1+binary"
+
+	mediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeEmpty    = "application/vnd.oci.empty.v1+json"
+)
+
+// emptyJSON is the blob of the empty config of an artifact
+var emptyJSON = []byte("{}")
+
+// Descriptor is an OCI content descriptor
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	Manifests []Descriptor `json:"manifests"`
+}
+
+func newDescriptor(mediaType string, blob []byte) Descriptor {
+	sum := sha256.Sum256(blob)
+	return Descriptor{MediaType: mediaType, Digest: digestString(sum[:]), Size: int64(len(blob))}
+}
+
+// PackTree returns the manifest of an OCI artifact of tree, with subject as
+// its subject (the blob the tree is of), and the blobs the manifest refers to
+// by their digest
+func PackTree(tree *Tree, subject Descriptor) ([]byte, map[string][]byte, error) {
+	blob, err := tree.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	annotations, err := LayerAnnotations(tree)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		config = newDescriptor(mediaTypeEmpty, emptyJSON)
+		layer  = newDescriptor(MediaTypeTree, blob)
+	)
+	manifest, err := json.Marshal(ociManifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeManifest,
+		ArtifactType:  ArtifactType,
+		Config:        config,
+		Layers:        []Descriptor{layer},
+		Subject:       &subject,
+		Annotations:   annotations,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return manifest, map[string][]byte{config.Digest: emptyJSON, layer.Digest: blob}, nil
+}
+
+// Registry is a minimal client of the OCI distribution API, for publishing
+// trees of blobs in a repository and fetching them through the referrers API.
+// Any authentication is left to the Client's transport.
+type Registry struct {
+	Client     *http.Client
+	BaseURL    string // like "https://registry.example.com"
+	Repository string // like "library/busybox"
+}
+
+func (reg *Registry) client() *http.Client {
+	if reg.Client == nil {
+		return http.DefaultClient
+	}
+	return reg.Client
+}
+
+func (reg *Registry) url(format string, args ...interface{}) string {
+	return strings.TrimRight(reg.BaseURL, "/") + "/v2/" + reg.Repository + fmt.Sprintf(format, args...)
+}
+
+// PushTree publishes tree as an artifact referring to subject, and returns
+// the descriptor of the artifact's manifest
+func (reg *Registry) PushTree(tree *Tree, subject Descriptor) (Descriptor, error) {
+	manifest, blobs, err := PackTree(tree, subject)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	for digest, blob := range blobs {
+		if err := reg.pushBlob(digest, blob); err != nil {
+			return Descriptor{}, err
+		}
+	}
+	desc := newDescriptor(mediaTypeManifest, manifest)
+	desc.ArtifactType = ArtifactType
+	req, err := http.NewRequest("PUT", reg.url("/manifests/%s", desc.Digest), bytes.NewReader(manifest))
+	if err != nil {
+		return Descriptor{}, err
+	}
+	req.Header.Set("Content-Type", mediaTypeManifest)
+	if _, err := reg.do(req, http.StatusCreated); err != nil {
+		return Descriptor{}, err
+	}
+	return desc, nil
+}
+
+// pushBlob is a monolithic upload of blob
+func (reg *Registry) pushBlob(digest string, blob []byte) error {
+	req, err := http.NewRequest("POST", reg.url("/blobs/uploads/"), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := reg.client().Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("starting upload: %s", resp.Status)
+	}
+	loc, err := resp.Location()
+	if err != nil {
+		return err
+	}
+	q := loc.Query()
+	q.Set("digest", digest)
+	loc.RawQuery = q.Encode()
+
+	req, err = http.NewRequest("PUT", loc.String(), bytes.NewReader(blob))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	_, err = reg.do(req, http.StatusCreated)
+	return err
+}
+
+// FetchTree finds the tree artifact referring to subject, and returns the
+// tree once its blobs match their digests and its root matches the root
+// annotated on the artifact. The subject itself can then be verified with
+// NewVerifyingReader.
+func (reg *Registry) FetchTree(subject Descriptor) (*Tree, error) {
+	body, err := reg.get(reg.url("/referrers/%s?artifactType=%s", subject.Digest, ArtifactType), "")
+	if err != nil {
+		return nil, err
+	}
+	var index ociIndex
+	if err := json.Unmarshal(body, &index); err != nil {
+		return nil, err
+	}
+	for _, desc := range index.Manifests {
+		if desc.ArtifactType != ArtifactType {
+			continue
+		}
+		manifest, err := reg.get(reg.url("/manifests/%s", desc.Digest), desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		var m ociManifest
+		if err := json.Unmarshal(manifest, &m); err != nil {
+			return nil, err
+		}
+		if len(m.Layers) != 1 || m.Layers[0].MediaType != MediaTypeTree {
+			return nil, fmt.Errorf("artifact %s is not a tree", desc.Digest)
+		}
+		blob, err := reg.get(reg.url("/blobs/%s", m.Layers[0].Digest), m.Layers[0].Digest)
+		if err != nil {
+			return nil, err
+		}
+		var tree Tree
+		if err := tree.UnmarshalBinary(blob); err != nil {
+			return nil, err
+		}
+		annotations, err := LayerAnnotations(&tree)
+		if err != nil {
+			return nil, err
+		}
+		if annotations[AnnotationRoot] != m.Annotations[AnnotationRoot] {
+			return nil, ErrAnnotationMismatch{Key: AnnotationRoot}
+		}
+		return &tree, nil
+	}
+	return nil, fmt.Errorf("no tree artifact refers to %s", subject.Digest)
+}
+
+// get fetches url, and checks the body against digest when it is not empty
+func (reg *Registry) get(url, digest string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaTypeManifest+", "+mediaTypeIndex)
+	body, err := reg.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	if digest != "" {
+		sum := sha256.Sum256(body)
+		if "sha256:"+hex.EncodeToString(sum[:]) != digest {
+			return nil, fmt.Errorf("content of %s does not match its digest", url)
+		}
+	}
+	return body, nil
+}
+
+func (reg *Registry) do(req *http.Request, status int) ([]byte, error) {
+	resp, err := reg.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != status {
+		return nil, fmt.Errorf("%s %s: %s", req.Method, req.URL, resp.Status)
+	}
+	return body, nil
+}
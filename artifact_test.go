@@ -0,0 +1,106 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRegistry is just enough of the OCI distribution API for a tree artifact
+type fakeRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+}
+
+func (fr *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/v2/test/repo")
+	switch {
+	case r.Method == "POST" && path == "/blobs/uploads/":
+		w.Header().Set("Location", "/v2/test/repo/blobs/uploads/1?state=x")
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == "PUT" && strings.HasPrefix(path, "/blobs/uploads/"):
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Query().Get("state") != "x" || r.URL.Query().Get("digest") != fmt.Sprintf("sha256:%x", sha256.Sum256(body)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fr.blobs[r.URL.Query().Get("digest")] = body
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "PUT" && strings.HasPrefix(path, "/manifests/"):
+		body, _ := ioutil.ReadAll(r.Body)
+		fr.manifests[strings.TrimPrefix(path, "/manifests/")] = body
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "GET" && strings.HasPrefix(path, "/manifests/"):
+		w.Write(fr.manifests[strings.TrimPrefix(path, "/manifests/")])
+	case r.Method == "GET" && strings.HasPrefix(path, "/blobs/"):
+		w.Write(fr.blobs[strings.TrimPrefix(path, "/blobs/")])
+	case r.Method == "GET" && strings.HasPrefix(path, "/referrers/"):
+		subject := strings.TrimPrefix(path, "/referrers/")
+		var index ociIndex
+		for digest, body := range fr.manifests {
+			var m ociManifest
+			json.Unmarshal(body, &m)
+			if m.Subject != nil && m.Subject.Digest == subject {
+				index.Manifests = append(index.Manifests, Descriptor{MediaType: m.MediaType, Digest: digest, ArtifactType: m.ArtifactType})
+			}
+		}
+		json.NewEncoder(w).Encode(index)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestTreeArtifact(t *testing.T) {
+	fr := &fakeRegistry{blobs: map[string][]byte{}, manifests: map[string][]byte{}}
+	srv := httptest.NewServer(fr)
+	defer srv.Close()
+
+	blob := bytes.Repeat([]byte("subject blob "), 1000)
+	tree, _, err := LayerTree(bytes.NewReader(blob), DefaultHashMaker, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := newDescriptor("application/octet-stream", blob)
+
+	reg := &Registry{BaseURL: srv.URL, Repository: "test/repo"}
+	desc, err := reg.PushTree(tree, subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.ArtifactType != ArtifactType {
+		t.Errorf("expected artifact type %q, got %q", ArtifactType, desc.ArtifactType)
+	}
+
+	got, err := reg.FetchTree(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(NewVerifyingReader(bytes.NewReader(blob), got)); err != nil {
+		t.Errorf("expected the subject to verify against the fetched tree: %s", err)
+	}
+
+	// tampering with the tree blob in the registry is caught
+	for digest, b := range fr.blobs {
+		if len(b) > len(emptyJSON) {
+			b[len(b)-1]++
+			fr.blobs[digest] = b
+		}
+	}
+	if _, err := reg.FetchTree(subject); err == nil {
+		t.Errorf("expected an error for a tampered tree blob")
+	}
+
+	if _, err := reg.FetchTree(newDescriptor("application/octet-stream", []byte("other"))); err == nil {
+		t.Errorf("expected an error for a subject without a tree")
+	}
+}
@@ -0,0 +1,117 @@
+package merkle
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrWriterClosed is returned for writes after Close
+var ErrWriterClosed = errors.New("writer is closed")
+
+// AsyncWriter writes to a hash on a background goroutine, through a bounded
+// queue, so producers can keep writing while hashing catches up. Writes block
+// only once the queue is full.
+//
+// The wrapped hash must not be used until Flush or Close has returned.
+type AsyncWriter struct {
+	w     io.Writer
+	queue chan asyncItem
+	done  chan struct{}
+
+	mu     sync.RWMutex // guards sending on queue against Close
+	closed bool
+
+	errMu sync.Mutex
+	err   error
+}
+
+type asyncItem struct {
+	buf     []byte
+	flushed chan struct{} // set for a Flush marker, rather than a write
+}
+
+// NewAsyncWriter starts writing to h in the background, with up to depth
+// writes queued
+func NewAsyncWriter(h HashTreeer, depth int) *AsyncWriter {
+	if depth < 1 {
+		depth = 1
+	}
+	aw := &AsyncWriter{
+		w:     h,
+		queue: make(chan asyncItem, depth),
+		done:  make(chan struct{}),
+	}
+	go aw.run()
+	return aw
+}
+
+func (aw *AsyncWriter) run() {
+	defer close(aw.done)
+	for item := range aw.queue {
+		if item.flushed != nil {
+			close(item.flushed)
+			continue
+		}
+		if aw.Err() != nil {
+			// discard the rest, the error is sticky
+			continue
+		}
+		if _, err := aw.w.Write(item.buf); err != nil {
+			aw.errMu.Lock()
+			aw.err = err
+			aw.errMu.Unlock()
+		}
+	}
+}
+
+// Err returns the first error from the background writes, if any
+func (aw *AsyncWriter) Err() error {
+	aw.errMu.Lock()
+	defer aw.errMu.Unlock()
+	return aw.err
+}
+
+// Write queues a copy of p to be hashed. An error from an earlier background
+// write is returned instead of queuing p.
+func (aw *AsyncWriter) Write(p []byte) (int, error) {
+	if err := aw.Err(); err != nil {
+		return 0, err
+	}
+	aw.mu.RLock()
+	defer aw.mu.RUnlock()
+	if aw.closed {
+		return 0, ErrWriterClosed
+	}
+	aw.queue <- asyncItem{buf: append([]byte{}, p...)}
+	return len(p), nil
+}
+
+// Flush waits for all queued writes to be hashed, and returns the first error
+// from them, if any
+func (aw *AsyncWriter) Flush() error {
+	aw.mu.RLock()
+	if aw.closed {
+		aw.mu.RUnlock()
+		<-aw.done
+		return aw.Err()
+	}
+	flushed := make(chan struct{})
+	aw.queue <- asyncItem{flushed: flushed}
+	aw.mu.RUnlock()
+	<-flushed
+	return aw.Err()
+}
+
+// Close waits for all queued writes to be hashed, and stops the background
+// goroutine. The first error from the writes is returned, if any.
+func (aw *AsyncWriter) Close() error {
+	aw.mu.Lock()
+	if !aw.closed {
+		aw.closed = true
+		close(aw.queue)
+	}
+	aw.mu.Unlock()
+	<-aw.done
+	return aw.Err()
+}
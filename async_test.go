@@ -0,0 +1,51 @@
+package merkle
+
+import (
+	"bytes"
+	"hash"
+	"testing"
+)
+
+func TestAsyncWriter(t *testing.T) {
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+	expected := NewHash(DefaultHashMaker, 10)
+	h := NewHash(DefaultHashMaker, 10)
+	aw := NewAsyncWriter(h, 2)
+	for i := 0; i < 20; i++ {
+		if _, err := expected.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := aw.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := aw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := h.Sum(nil), expected.Sum(nil); !bytes.Equal(got, exp) {
+		t.Errorf("expected sum %x; got %x", exp, got)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := aw.Write(msg); err != ErrWriterClosed {
+		t.Errorf("expected %q, got %v", ErrWriterClosed, err)
+	}
+}
+
+func TestAsyncWriterError(t *testing.T) {
+	h := NewHash(func() hash.Hash { return failingHash{DefaultHashMaker()} }, 10)
+	aw := NewAsyncWriter(h, 2)
+	if _, err := aw.Write(make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.Flush(); err == nil {
+		t.Errorf("expected an error from the background write")
+	}
+	if _, err := aw.Write(make([]byte, 100)); err == nil {
+		t.Errorf("expected the background error to be returned")
+	}
+	if err := aw.Close(); err == nil {
+		t.Errorf("expected an error from Close")
+	}
+}
@@ -0,0 +1,84 @@
+package merkle
+
+import (
+	"sync"
+	"time"
+)
+
+// AuditEvent is the outcome of a verification, for a security team's
+// pipeline of them
+type AuditEvent struct {
+	Kind     string        `json:"kind"`             // "blocks", "block", "proof", "partial" or "session"
+	Object   string        `json:"object,omitempty"` // of the expected tree, as SetObjectID
+	Root     []byte        `json:"root,omitempty"`   // verified against, if known
+	Index    int           `json:"index"`            // of the block or leaf, or -1 of a whole object
+	Verified bool          `json:"verified"`
+	Error    string        `json:"error,omitempty"`
+	Latency  time.Duration `json:"latency"`
+}
+
+// AuditSink receives the AuditEvents of every verification. It is called on
+// the goroutine verifying, so should hand the event off rather than block.
+type AuditSink interface {
+	Audit(AuditEvent)
+}
+
+// AuditSinkFunc is an AuditSink of a function
+type AuditSinkFunc func(AuditEvent)
+
+// Audit calls f
+func (f AuditSinkFunc) Audit(e AuditEvent) {
+	f(e)
+}
+
+var (
+	auditMu   sync.RWMutex
+	auditSink AuditSink
+)
+
+// SetAuditSink sets the sink of the AuditEvents of the verifications of the
+// package: of NewVerifyingReader, RangeFetcher, VerifyProof,
+// PartialTree.Verify and SessionVerifier. A nil sink, the default, emits none.
+func SetAuditSink(sink AuditSink) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	auditSink = sink
+}
+
+// auditing is the sink, or nil if there is none, so events are only put
+// together if they are wanted
+func auditing() AuditSink {
+	auditMu.RLock()
+	defer auditMu.RUnlock()
+	return auditSink
+}
+
+// audit sends the event of a verification begun at start, that ended in err
+func audit(sink AuditSink, e AuditEvent, start time.Time, err error) {
+	e.Latency = time.Since(start)
+	e.Verified = err == nil
+	if err != nil {
+		e.Error = err.Error()
+	}
+	sink.Audit(e)
+}
+
+// SetObjectID names the object t is the tree of, in the AuditEvents of
+// verifications against it
+func (t *Tree) SetObjectID(id string) {
+	t.object = id
+}
+
+// ObjectID is the name of the object t is the tree of, as SetObjectID
+func (t *Tree) ObjectID() string {
+	return t.object
+}
+
+// auditRoot is the root of t for an AuditEvent, if it has one
+func auditRoot(t *Tree) []byte {
+	root, err := t.RootChecksum()
+	if err != nil {
+		return nil
+	}
+	return root
+}
@@ -0,0 +1,55 @@
+package merkle
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+func TestAuditSink(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []AuditEvent
+	)
+	SetAuditSink(AuditSinkFunc(func(e AuditEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}))
+	defer SetAuditSink(nil)
+
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	tree, root, err := NewBuilder(DefaultHashMaker, 16).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.SetObjectID("blob")
+	if _, err := io.Copy(ioutil.Discard, NewVerifyingReader(bytes.NewReader(data), tree)); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := append([]byte{}, data...)
+	corrupt[40] ^= 1
+	if _, err := io.Copy(ioutil.Discard, NewVerifyingReader(bytes.NewReader(corrupt), tree)); err == nil {
+		t.Fatal("expected the corrupt block to fail")
+	}
+	p, err := tree.InclusionProof(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	VerifyProof(tree.hashMaker(), root, p, tree.Nodes[1].checksum())
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	if e := events[0]; e.Kind != "blocks" || e.Object != "blob" || !bytes.Equal(e.Root, root) || e.Index != -1 || !e.Verified {
+		t.Errorf("expected the blocks verified, got %+v", e)
+	}
+	if e := events[1]; e.Verified || e.Index != 2 || e.Error == "" {
+		t.Errorf("expected the third block to fail, got %+v", e)
+	}
+	if e := events[2]; e.Kind != "proof" || e.Index != 1 || !e.Verified {
+		t.Errorf("expected the proof verified, got %+v", e)
+	}
+}
@@ -0,0 +1,115 @@
+package merkle
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sync"
+)
+
+// AzureBlock is a block of an Azure block blob, by its ID and size, as listed
+// by Get Block List
+type AzureBlock struct {
+	Name string
+	Size int64
+}
+
+// AzureBlockList tracks the blocks staged for an Azure block blob, each as a
+// leaf, so the tree of the blob is built during the upload, and the staged
+// blocks are checked before the block list is committed. Stage is safe to call
+// from concurrent uploads.
+type AzureBlockList struct {
+	hm     HashMaker
+	mu     sync.Mutex
+	staged map[string]azureStaged
+	idLen  int
+}
+
+type azureStaged struct {
+	leaf *Node
+	size int64
+}
+
+// NewAzureBlockList returns an empty AzureBlockList
+func NewAzureBlockList(hm HashMaker) *AzureBlockList {
+	return &AzureBlockList{hm: hm, staged: map[string]azureStaged{}}
+}
+
+// AzureBlockID is a block ID for the block at index, of the same length for
+// every index as Azure requires
+func AzureBlockID(index int) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%010d", index)))
+}
+
+// Stage records the block uploaded with Put Block as id, replacing any block
+// staged with the same id
+func (bl *AzureBlockList) Stage(id string, block []byte) error {
+	if _, err := base64.StdEncoding.DecodeString(id); err != nil {
+		return fmt.Errorf("block ID %q is not base64", id)
+	}
+	leaf, err := NewNodeHashBlock(bl.hm, block)
+	if err != nil {
+		return err
+	}
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	if bl.idLen != 0 && len(id) != bl.idLen {
+		return fmt.Errorf("block ID %q is not of the same length as the others", id)
+	}
+	bl.idLen = len(id)
+	bl.staged[id] = azureStaged{leaf: leaf, size: int64(len(block))}
+	return nil
+}
+
+// VerifyStaged checks the uncommitted blocks listed by Get Block List against
+// the blocks staged, so every block of ids is staged with the expected size
+// before the block list is committed
+func (bl *AzureBlockList) VerifyStaged(ids []string, uncommitted []AzureBlock) error {
+	listed := map[string]int64{}
+	for _, b := range uncommitted {
+		listed[b.Name] = b.Size
+	}
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	for _, id := range ids {
+		s, ok := bl.staged[id]
+		if !ok {
+			return fmt.Errorf("block %q was not staged", id)
+		}
+		size, ok := listed[id]
+		if !ok {
+			return fmt.Errorf("block %q is not staged on the blob", id)
+		}
+		if size != s.size {
+			return fmt.Errorf("block %q is staged with %d bytes, expected %d", id, size, s.size)
+		}
+	}
+	return nil
+}
+
+// Commit returns the tree of the blob committed with the block list ids, with
+// a leaf per block in list order. When every block but the last is of the same
+// size, that is the BlockLength of the tree, or else it is 0.
+func (bl *AzureBlockList) Commit(ids []string) (*Tree, error) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	tree := &Tree{}
+	for i, id := range ids {
+		s, ok := bl.staged[id]
+		if !ok {
+			return nil, fmt.Errorf("block %q was not staged", id)
+		}
+		switch {
+		case i == 0:
+			tree.BlockLength = int(s.size)
+		case i == len(ids)-1 && s.size <= int64(tree.BlockLength):
+		case s.size != int64(tree.BlockLength):
+			tree.BlockLength = 0
+		}
+		tree.appendLeaf(s.leaf, int(s.size))
+		tree.length += s.size
+	}
+	for _, id := range ids {
+		delete(bl.staged, id)
+	}
+	return tree, nil
+}
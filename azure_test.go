@@ -0,0 +1,85 @@
+package merkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAzureBlockList(t *testing.T) {
+	data := bytes.Repeat([]byte("azure block blob "), 300)
+	var (
+		bl       = NewAzureBlockList(DefaultHashMaker)
+		ids      []string
+		listed   []AzureBlock
+		blockLen = 1024
+	)
+	for i := 0; i*blockLen < len(data); i++ {
+		end := (i + 1) * blockLen
+		if end > len(data) {
+			end = len(data)
+		}
+		id := AzureBlockID(i)
+		if err := bl.Stage(id, data[i*blockLen:end]); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		listed = append(listed, AzureBlock{Name: id, Size: int64(end - i*blockLen)})
+	}
+
+	if err := bl.VerifyStaged(ids, listed); err != nil {
+		t.Fatal(err)
+	}
+	short := append([]AzureBlock{}, listed...)
+	short[1].Size--
+	if err := bl.VerifyStaged(ids, short); err == nil {
+		t.Errorf("expected an error for a block staged with another size")
+	}
+	if err := bl.VerifyStaged(ids, listed[1:]); err == nil {
+		t.Errorf("expected an error for a block missing from the blob")
+	}
+
+	tree, err := bl.Commit(ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, root, err := NewBuilder(DefaultHashMaker, blockLen).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tree.RootChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, root) || tree.BlockLength != blockLen || tree.TotalLength() != expected.TotalLength() {
+		t.Errorf("expected the tree of the whole blob, got root %x, block length %d", got, tree.BlockLength)
+	}
+	if _, err := bl.Commit(ids); err == nil {
+		t.Errorf("expected committed blocks to no longer be staged")
+	}
+}
+
+func TestAzureBlockListIDs(t *testing.T) {
+	bl := NewAzureBlockList(DefaultHashMaker)
+	if err := bl.Stage("not base64!", []byte("a")); err == nil {
+		t.Errorf("expected an error for an invalid block ID")
+	}
+	if err := bl.Stage(AzureBlockID(0), []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bl.Stage("YWJj", []byte("b")); err == nil {
+		t.Errorf("expected an error for a block ID of another length")
+	}
+	if err := bl.Stage(AzureBlockID(1), []byte("bc")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bl.Stage(AzureBlockID(2), []byte("d")); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := bl.Commit([]string{AzureBlockID(0), AzureBlockID(1), AzureBlockID(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.BlockLength != 0 {
+		t.Errorf("expected blocks of varying size to have no block length, got %d", tree.BlockLength)
+	}
+}
@@ -0,0 +1,194 @@
+package merkle
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Pack is a group of chunks stored together, with a tree over its chunks
+type Pack struct {
+	Data    []byte
+	Offsets []int // of each chunk in Data, and the end of the last
+	Tree    *Tree // leaves are the chunks, of varying size
+}
+
+// Chunk returns the bytes of the chunk at index
+func (p *Pack) Chunk(index int) []byte {
+	return p.Data[p.Offsets[index]:p.Offsets[index+1]]
+}
+
+// ChunkRef locates a chunk by its pack, and its index within the pack
+type ChunkRef struct {
+	Pack, Index int
+}
+
+// Snapshot groups the content defined chunks of files into packs, with a tree
+// over each pack and a super-root over the roots of the packs. Chunks shared
+// between or within files are stored once. Each file can be restored with its
+// chunks verified by proofs against the super-root alone.
+type Snapshot struct {
+	Packs []*Pack
+	Files map[string][]ChunkRef
+
+	hm       HashMaker
+	packSize int
+	seen     map[string]ChunkRef // chunk checksum to where it is stored
+	open     *Pack               // being filled, not yet sealed with a tree
+	sums     [][]byte            // of the chunks in the open pack
+}
+
+// Chunking parameters of a Snapshot, averaging about 8KiB chunks
+const (
+	snapshotMinChunk = 2 * 1024
+	snapshotMaxChunk = 64 * 1024
+	snapshotAvgBits  = 13
+)
+
+// NewSnapshot returns an empty Snapshot, with chunks checksummed by hm and
+// grouped into packs of about packSize bytes
+func NewSnapshot(hm HashMaker, packSize int) *Snapshot {
+	return &Snapshot{
+		Files:    map[string][]ChunkRef{},
+		hm:       hm,
+		packSize: packSize,
+		seen:     map[string]ChunkRef{},
+	}
+}
+
+// AddFile chunks the content of r, and stores the chunks not already in the
+// snapshot
+func (s *Snapshot) AddFile(name string, r io.Reader) error {
+	var (
+		c    = NewChunker(r, snapshotMinChunk, snapshotMaxChunk, snapshotAvgBits)
+		refs = []ChunkRef{}
+	)
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		n, err := NewNodeHashBlock(s.hm, chunk)
+		if err != nil {
+			return err
+		}
+		ref, ok := s.seen[string(n.checksum())]
+		if !ok {
+			if ref, err = s.store(chunk, n.checksum()); err != nil {
+				return err
+			}
+		}
+		refs = append(refs, ref)
+	}
+	s.Files[name] = refs
+	return nil
+}
+
+// store appends the chunk to the open pack, sealing it once it is full
+func (s *Snapshot) store(chunk, sum []byte) (ChunkRef, error) {
+	if s.open == nil {
+		s.open = &Pack{Offsets: []int{0}}
+	}
+	s.open.Data = append(s.open.Data, chunk...)
+	s.open.Offsets = append(s.open.Offsets, len(s.open.Data))
+	s.sums = append(s.sums, sum)
+	ref := ChunkRef{Pack: len(s.Packs), Index: len(s.sums) - 1}
+	s.seen[string(sum)] = ref
+	if len(s.open.Data) >= s.packSize {
+		return ref, s.seal()
+	}
+	return ref, nil
+}
+
+// seal builds the tree of the open pack
+func (s *Snapshot) seal() error {
+	if s.open == nil {
+		return nil
+	}
+	var (
+		tree = &Tree{}
+		slab = newLeafSlabOf(s.hm, len(s.sums))
+	)
+	for i, sum := range s.sums {
+		tree.appendLeaf(slab.leaf(sum), s.open.Offsets[i+1]-s.open.Offsets[i])
+	}
+	tree.length = int64(len(s.open.Data))
+	s.open.Tree = tree
+	s.Packs = append(s.Packs, s.open)
+	s.open, s.sums = nil, nil
+	return nil
+}
+
+// Root seals the open pack, and returns the super-root over the roots of the
+// packs
+func (s *Snapshot) Root() ([]byte, error) {
+	if err := s.seal(); err != nil {
+		return nil, err
+	}
+	return s.superTree().Root()
+}
+
+func (s *Snapshot) superTree() *SuperTree {
+	super := NewSuperTree(s.hm)
+	for i, p := range s.Packs {
+		root, _ := p.Tree.RootChecksum()
+		super.AddRoot(fmt.Sprintf("pack %d", i), root)
+	}
+	return super
+}
+
+// FileNames are the names of the files in the snapshot, sorted
+func (s *Snapshot) FileNames() []string {
+	names := make([]string, 0, len(s.Files))
+	for name := range s.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Restore writes the content of the file name to w, verifying each chunk by
+// its proof of inclusion in its pack, and the pack's by its proof of inclusion
+// under root. No part of a chunk that fails is written.
+func (s *Snapshot) Restore(name string, root []byte, w io.Writer) error {
+	refs, ok := s.Files[name]
+	if !ok {
+		return fmt.Errorf("no file %q in snapshot", name)
+	}
+	if err := s.seal(); err != nil {
+		return err
+	}
+	super := s.superTree()
+	for _, ref := range refs {
+		if ref.Pack >= len(s.Packs) {
+			return fmt.Errorf("file %q refers to missing pack %d", name, ref.Pack)
+		}
+		pack := s.Packs[ref.Pack]
+		chunk := pack.Chunk(ref.Index)
+		if err := s.verifyChunk(super, pack, ref, chunk, root); err != nil {
+			return fmt.Errorf("file %q: %s", name, err)
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Snapshot) verifyChunk(super *SuperTree, pack *Pack, ref ChunkRef, chunk, root []byte) error {
+	n, err := NewNodeHashBlock(s.hm, chunk)
+	if err != nil {
+		return err
+	}
+	proof, err := super.Prove(ref.Pack, pack.Tree, ref.Index)
+	if err != nil {
+		return err
+	}
+	if err := VerifyChain(s.hm, root, proof, n.checksum()); err != nil {
+		return fmt.Errorf("chunk %d of pack %d does not verify against the root", ref.Index, ref.Pack)
+	}
+	return nil
+}
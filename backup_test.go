@@ -0,0 +1,63 @@
+package merkle
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	var (
+		rnd   = rand.New(rand.NewSource(2))
+		base  = make([]byte, 200*1024)
+		other = make([]byte, 50*1024)
+	)
+	rnd.Read(base)
+	rnd.Read(other)
+	files := map[string][]byte{
+		"base":   base,
+		"edited": append(append(append([]byte{}, base[:5000]...), []byte("edit")...), base[5000:]...),
+		"other":  other,
+		"empty":  nil,
+	}
+
+	s := NewSnapshot(DefaultHashMaker, 64*1024)
+	for _, name := range []string{"base", "edited", "other", "empty"} {
+		if err := s.AddFile(name, bytes.NewReader(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, err := s.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored int
+	for _, p := range s.Packs {
+		stored += len(p.Data)
+	}
+	if stored >= len(base)*2 {
+		t.Errorf("expected the edited file to share chunks, stored %d bytes", stored)
+	}
+
+	for _, name := range s.FileNames() {
+		var buf bytes.Buffer
+		if err := s.Restore(name, root, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), files[name]) {
+			t.Errorf("%s: restored content does not match", name)
+		}
+	}
+
+	// corrupt a stored chunk
+	s.Packs[0].Data[10]++
+	if err := s.Restore("base", root, &bytes.Buffer{}); err == nil {
+		t.Errorf("expected an error restoring a corrupt chunk")
+	}
+	s.Packs[0].Data[10]--
+
+	if err := s.Restore("base", make([]byte, len(root)), &bytes.Buffer{}); err == nil {
+		t.Errorf("expected an error restoring against the wrong root")
+	}
+}
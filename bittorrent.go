@@ -0,0 +1,102 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+)
+
+// BitTorrentBlockLength is the size of the leaves of a BitTorrent v2 (BEP 52)
+// file tree
+const BitTorrentBlockLength = 16 << 10
+
+// BitTorrentTree reads r, and returns its tree as BitTorrent v2 hashes a file,
+// of sha256 over 16KiB leaves with a short last leaf hashed as is. An empty
+// file is a tree of no nodes, as it has no pieces root.
+func BitTorrentTree(r io.Reader) (*Tree, error) {
+	b := NewBuilder(sha256.New, BitTorrentBlockLength, WithEmptyRoot())
+	if _, err := io.Copy(b, r); err != nil {
+		return nil, err
+	}
+	tree, _, err := b.Finalize()
+	return tree, err
+}
+
+// BitTorrentPiecesRoot is the "pieces root" of the file of the tree, for the
+// file tree of a BitTorrent v2 torrent. Unlike the root of the tree, the
+// leaves are padded with zero hashes to a power of two, rather than promoting
+// the last node of a level.
+func (t *Tree) BitTorrentPiecesRoot() ([]byte, error) {
+	if err := t.bitTorrentCompatible(); err != nil {
+		return nil, err
+	}
+	if len(t.Nodes) == 0 {
+		return nil, ErrEmptyTree
+	}
+	layer, pad := t.bitTorrentLeaves(), make([]byte, sha256.Size)
+	for len(layer) > 1 {
+		layer, pad = bitTorrentLayer(layer, pad)
+	}
+	return layer[0], nil
+}
+
+// BitTorrentPieceLayer is the concatenated hashes of the pieces, of
+// pieceLength bytes, of the file of the tree, as the "piece layers" of a
+// BitTorrent v2 torrent hold for files longer than a piece. The pieceLength
+// is a power of two of at least BitTorrentBlockLength.
+func (t *Tree) BitTorrentPieceLayer(pieceLength int) ([]byte, error) {
+	if err := t.bitTorrentCompatible(); err != nil {
+		return nil, err
+	}
+	if pieceLength < BitTorrentBlockLength || pieceLength&(pieceLength-1) != 0 {
+		return nil, fmt.Errorf("invalid piece length %d", pieceLength)
+	}
+	if len(t.Nodes) == 0 {
+		return nil, ErrEmptyTree
+	}
+	layer, pad := t.bitTorrentLeaves(), make([]byte, sha256.Size)
+	for width := BitTorrentBlockLength; width < pieceLength; width *= 2 {
+		layer, pad = bitTorrentLayer(layer, pad)
+	}
+	pieces := make([]byte, 0, len(layer)*sha256.Size)
+	for _, sum := range layer {
+		pieces = append(pieces, sum...)
+	}
+	return pieces, nil
+}
+
+func (t *Tree) bitTorrentCompatible() error {
+	if !sameHash(t.hashMaker(), sha256.New) || t.BlockLength != BitTorrentBlockLength || t.FinalBlock != FinalBlockRaw {
+		return fmt.Errorf("BitTorrent v2 is of sha256 over %d byte blocks, with the final block raw", BitTorrentBlockLength)
+	}
+	return nil
+}
+
+func (t *Tree) bitTorrentLeaves() [][]byte {
+	leaves := make([][]byte, len(t.Nodes))
+	for i, n := range t.Nodes {
+		leaves[i] = n.checksum()
+	}
+	return leaves
+}
+
+// bitTorrentLayer hashes the pairs of a layer, with pad as the sibling of an
+// odd last node, and returns the layer above and its pad
+func bitTorrentLayer(layer [][]byte, pad []byte) ([][]byte, []byte) {
+	next := make([][]byte, 0, (len(layer)+1)/2)
+	for i := 0; i < len(layer); i += 2 {
+		right := pad
+		if i+1 < len(layer) {
+			right = layer[i+1]
+		}
+		next = append(next, bitTorrentHash(layer[i], right))
+	}
+	return next, bitTorrentHash(pad, pad)
+}
+
+func bitTorrentHash(l, r []byte) []byte {
+	h := sha256.New()
+	h.Write(l)
+	h.Write(r)
+	return h.Sum(nil)
+}
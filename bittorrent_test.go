@@ -0,0 +1,79 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/rand"
+	"testing"
+)
+
+// bitTorrentReference is the root of the leaves of data, padded with zero
+// hashes to width leaves, as BEP 52 describes
+func bitTorrentReference(data []byte, width int) []byte {
+	var level [][]byte
+	for i := 0; i < len(data); i += BitTorrentBlockLength {
+		end := i + BitTorrentBlockLength
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := sha256.Sum256(data[i:end])
+		level = append(level, sum[:])
+	}
+	for len(level) < width {
+		level = append(level, make([]byte, sha256.Size))
+	}
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			sum := sha256.Sum256(append(append([]byte{}, level[i]...), level[i+1]...))
+			next = append(next, sum[:])
+		}
+		level = next
+	}
+	return level[0]
+}
+
+func TestBitTorrent(t *testing.T) {
+	data := make([]byte, 5*BitTorrentBlockLength+1234)
+	rand.New(rand.NewSource(5)).Read(data)
+
+	for _, c := range []struct{ size, width int }{{1, 1}, {BitTorrentBlockLength, 1}, {3 * BitTorrentBlockLength, 4}, {len(data), 8}} {
+		tree, err := BitTorrentTree(bytes.NewReader(data[:c.size]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := tree.BitTorrentPiecesRoot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := bitTorrentReference(data[:c.size], c.width); !bytes.Equal(root, expected) {
+			t.Errorf("%d bytes: expected the pieces root %x, got %x", c.size, expected, root)
+		}
+	}
+
+	// pieces of 4 leaves, the last padded
+	tree, err := BitTorrentTree(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pieceLength := 4 * BitTorrentBlockLength
+	layer, err := tree.BitTorrentPieceLayer(pieceLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := append(bitTorrentReference(data[:pieceLength], 4), bitTorrentReference(data[pieceLength:], 4)...)
+	if !bytes.Equal(layer, expected) {
+		t.Errorf("expected the piece layer %x, got %x", expected, layer)
+	}
+	if _, err := tree.BitTorrentPieceLayer(3 * BitTorrentBlockLength); err == nil {
+		t.Error("expected an error of a piece length not a power of two")
+	}
+
+	other, _, err := NewBuilder(sha256.New, 1024).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.BitTorrentPiecesRoot(); err == nil {
+		t.Error("expected an error of a tree of other blocks")
+	}
+}
@@ -0,0 +1,188 @@
+package merkle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// BlobCache is a content-addressed cache of blobs, keyed by the root checksum
+// of their trees. Range reads are served from the cached bytes, and each block
+// is verified against the tree as it is read, the first time and then again
+// once its verification is older than MaxAge. A block that fails evicts the
+// blob, for the caller to fetch it again.
+type BlobCache struct {
+	MaxAge time.Duration // of a block's verification, 0 for no expiry
+
+	mu    sync.Mutex
+	blobs map[string]*cachedBlob
+}
+
+type cachedBlob struct {
+	tree *Tree
+	data io.ReaderAt
+
+	mu       sync.Mutex
+	verified []time.Time // of each block, zero until verified
+}
+
+// ErrNotCached is for a root that is not in the cache
+var ErrNotCached = errors.New("blob is not cached")
+
+// NewBlobCache returns an empty BlobCache
+func NewBlobCache() *BlobCache {
+	return &BlobCache{blobs: map[string]*cachedBlob{}}
+}
+
+// Put caches data, the blob of tree, and returns the root it is keyed by. The
+// bytes are not read until they are, so data may be a file of the blob. A
+// blob of the same root is replaced.
+func (c *BlobCache) Put(tree *Tree, data io.ReaderAt) ([]byte, error) {
+	if tree.BlockLength <= 0 {
+		return nil, ErrNoBlockLength
+	}
+	root, err := tree.RootChecksum()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.blobs == nil {
+		c.blobs = map[string]*cachedBlob{}
+	}
+	c.blobs[string(root)] = &cachedBlob{tree: tree, data: data, verified: make([]time.Time, len(tree.Nodes))}
+	return root, nil
+}
+
+// Tree returns the tree of the blob of root, if cached
+func (c *BlobCache) Tree(root []byte) (*Tree, bool) {
+	b := c.blob(root)
+	if b == nil {
+		return nil, false
+	}
+	return b.tree, true
+}
+
+// Delete evicts the blob of root
+func (c *BlobCache) Delete(root []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.blobs, string(root))
+}
+
+// Revalidate marks every block of the blob of root as unverified, so each is
+// verified again on its next read
+func (c *BlobCache) Revalidate(root []byte) error {
+	b := c.blob(root)
+	if b == nil {
+		return ErrNotCached
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := range b.verified {
+		b.verified[i] = time.Time{}
+	}
+	return nil
+}
+
+// ReadAt reads len(p) bytes of the blob of root from off. The blocks covering
+// them are verified as needed, and on a corrupt block the blob is evicted and
+// an ErrBlockMismatch returned.
+func (c *BlobCache) ReadAt(root, p []byte, off int64) (int, error) {
+	b := c.blob(root)
+	if b == nil {
+		return 0, ErrNotCached
+	}
+	total := b.tree.TotalLength()
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if off >= total {
+		return 0, io.EOF
+	}
+	n := int64(len(p))
+	if off+n > total {
+		n = total - off
+	}
+	bl := int64(b.tree.BlockLength)
+	var (
+		hm    = b.tree.hashMaker()
+		block = make([]byte, bl)
+	)
+	for read := int64(0); read < n; {
+		index := int((off + read) / bl)
+		begin := int64(index) * bl
+		end := begin + bl
+		if end > total {
+			end = total
+		}
+		data := block[:end-begin]
+		if m, err := b.data.ReadAt(data, begin); m < len(data) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return int(read), err
+		}
+		if err := b.verify(hm, index, data, c.MaxAge); err != nil {
+			c.evict(root, b)
+			return int(read), err
+		}
+		read += int64(copy(p[read:n], data[off+read-begin:]))
+	}
+	if n < int64(len(p)) {
+		return int(n), io.EOF
+	}
+	return int(n), nil
+}
+
+// Reader returns an io.ReaderAt of the blob of root, and its length
+func (c *BlobCache) Reader(root []byte) (io.ReaderAt, int64, error) {
+	b := c.blob(root)
+	if b == nil {
+		return nil, 0, ErrNotCached
+	}
+	return blobReader{c: c, root: root}, b.tree.TotalLength(), nil
+}
+
+type blobReader struct {
+	c    *BlobCache
+	root []byte
+}
+
+func (r blobReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.c.ReadAt(r.root, p, off)
+}
+
+func (c *BlobCache) blob(root []byte) *cachedBlob {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.blobs[string(root)]
+}
+
+// evict deletes the blob of root, unless it has been replaced since b
+func (c *BlobCache) evict(root []byte, b *cachedBlob) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.blobs[string(root)] == b {
+		delete(c.blobs, string(root))
+	}
+}
+
+// verify checks the block at index, unless it was verified within maxAge
+func (b *cachedBlob) verify(hm HashMaker, index int, data []byte, maxAge time.Duration) error {
+	b.mu.Lock()
+	at := b.verified[index]
+	b.mu.Unlock()
+	if !at.IsZero() && (maxAge <= 0 || time.Since(at) < maxAge) {
+		return nil
+	}
+	if err := verifyBlock(b.tree, hm, index, data); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.verified[index] = time.Now()
+	b.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,77 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestBlobCache(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	tree, err := SumOf(sha256.New, 64, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := append([]byte{}, data...)
+	c := NewBlobCache()
+	root, err := c.Put(tree, bytes.NewReader(stored))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := c.Tree(root); !ok || got != tree {
+		t.Fatal("expected the tree of the root")
+	}
+
+	p := make([]byte, 100)
+	n, err := c.ReadAt(root, p, 950)
+	if err != io.EOF || n != 50 || !bytes.Equal(p[:n], data[950:]) {
+		t.Errorf("expected the last 50 bytes and io.EOF, got %d, %v", n, err)
+	}
+	r, length, err := c.Reader(root)
+	if err != nil || length != int64(len(data)) {
+		t.Fatalf("expected a reader of %d bytes, got %d, %v", len(data), length, err)
+	}
+	got, err := ioutil.ReadAll(io.NewSectionReader(r, 0, length))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("expected the blob, got %v", err)
+	}
+
+	// verified blocks are not verified again until revalidated
+	stored[10] ^= 0xff
+	if _, err := c.ReadAt(root, p[:10], 0); err != nil {
+		t.Errorf("expected the verified block to be served, got %v", err)
+	}
+	if err := c.Revalidate(root); err != nil {
+		t.Fatal(err)
+	}
+	var mismatch ErrBlockMismatch
+	if _, err := c.ReadAt(root, p[:10], 0); !errors.As(err, &mismatch) || mismatch.Index != 0 {
+		t.Errorf("expected ErrBlockMismatch of block 0, got %v", err)
+	}
+	if _, err := c.ReadAt(root, p, 0); err != ErrNotCached {
+		t.Errorf("expected the corrupt blob to be evicted, got %v", err)
+	}
+}
+
+func TestBlobCacheMaxAge(t *testing.T) {
+	data := bytes.Repeat([]byte("abc"), 100)
+	tree, _ := SumOf(sha256.New, 64, data)
+	stored := append([]byte{}, data...)
+	c := NewBlobCache()
+	c.MaxAge = time.Millisecond
+	root, _ := c.Put(tree, bytes.NewReader(stored))
+
+	p := make([]byte, 64)
+	if _, err := c.ReadAt(root, p, 64); err != nil {
+		t.Fatal(err)
+	}
+	stored[64] ^= 0xff
+	time.Sleep(2 * time.Millisecond)
+	if _, err := c.ReadAt(root, p, 64); !errors.As(err, new(ErrBlockMismatch)) {
+		t.Errorf("expected an expired block to be verified again, got %v", err)
+	}
+}
@@ -1,6 +1,9 @@
 package merkle
 
 const (
+	// MinBlockSize is the smallest byte size of blocks for a Node
+	MinBlockSize = 1
+
 	// MaxBlockSize reasonable max byte size for blocks that are checksummed for
 	// a Node
 	MaxBlockSize = 1024 * 16
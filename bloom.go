@@ -0,0 +1,110 @@
+package merkle
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+)
+
+// BloomFilter answers whether a checksum is possibly among the leaves of a
+// tree. A checksum it does not contain is definitely not a leaf, so a dedup or
+// sync layer can skip looking up blocks that are new.
+type BloomFilter struct {
+	bits   []byte
+	hashes int // count of bits set per checksum
+}
+
+// NewBloomFilter returns an empty filter sized for n checksums, with the
+// false positive rate of p once they are added
+func NewBloomFilter(n int, p float64) *BloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.01
+	}
+	m := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	k := int(math.Round(m / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &BloomFilter{bits: make([]byte, (int(m)+7)/8), hashes: k}
+}
+
+// Add adds the checksum of a block to the filter
+func (bf *BloomFilter) Add(sum []byte) {
+	h1, h2, m := bf.locate(sum)
+	for i := 0; i < bf.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % m
+		bf.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// MayContain is whether the checksum is possibly in the filter. False is
+// definite, and true is subject to the false positive rate.
+func (bf *BloomFilter) MayContain(sum []byte) bool {
+	h1, h2, m := bf.locate(sum)
+	for i := 0; i < bf.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % m
+		if bf.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// locate is the two hashes of sum the bits are derived from, as by Kirsch and
+// Mitzenmacher, and the count of bits. The checksum is hashed again, rather
+// than used directly, as it may be short or of a weak hash.
+func (bf *BloomFilter) locate(sum []byte) (uint64, uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(sum)
+	v := h.Sum64()
+	return v & 0xffffffff, v>>32 | 1, uint64(len(bf.bits)) * 8
+}
+
+// MarshalBinary encodes the filter as uvarints of its count of hashes and of
+// bytes, followed by its bits
+func (bf *BloomFilter) MarshalBinary() ([]byte, error) {
+	var tmp [binary.MaxVarintLen64]byte
+	buf := make([]byte, 0, 2*len(tmp)+len(bf.bits))
+	buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(bf.hashes))]...)
+	buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(len(bf.bits)))]...)
+	return append(buf, bf.bits...), nil
+}
+
+// UnmarshalBinary decodes a filter encoded by MarshalBinary
+func (bf *BloomFilter) UnmarshalBinary(data []byte) error {
+	k, n := binary.Uvarint(data)
+	if n <= 0 || k == 0 || k > 64 {
+		return ErrMalformedTree
+	}
+	size, m := binary.Uvarint(data[n:])
+	if m <= 0 || size == 0 || size != uint64(len(data)-n-m) {
+		return ErrMalformedTree
+	}
+	bf.hashes = int(k)
+	bf.bits = append([]byte(nil), data[n+m:]...)
+	return nil
+}
+
+// Bloom returns the filter of the checksums of the leaves, or nil if it has
+// not been built
+func (t *Tree) Bloom() *BloomFilter {
+	return t.bloom
+}
+
+// BuildBloom builds the filter of the checksums of the leaves, with a false
+// positive rate of p, to be returned by Bloom and serialized with the tree
+func (t *Tree) BuildBloom(p float64) error {
+	sums, err := t.leafSums()
+	if err != nil {
+		return err
+	}
+	bf := NewBloomFilter(len(sums), p)
+	for _, sum := range sums {
+		bf.Add(sum)
+	}
+	t.bloom = bf
+	return nil
+}
@@ -0,0 +1,80 @@
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	bf := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		bf.Add([]byte(fmt.Sprintf("present %d", i)))
+	}
+	for i := 0; i < 1000; i++ {
+		if !bf.MayContain([]byte(fmt.Sprintf("present %d", i))) {
+			t.Fatalf("expected checksum %d to be possibly present", i)
+		}
+	}
+	var positives int
+	for i := 0; i < 10000; i++ {
+		if bf.MayContain([]byte(fmt.Sprintf("absent %d", i))) {
+			positives++
+		}
+	}
+	// a rate of 1% is around 100, allowing for variance
+	if positives > 300 {
+		t.Errorf("expected around 1%% false positives, got %d of 10000", positives)
+	}
+}
+
+func TestTreeBloom(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	tree, _, err := NewBuilder(DefaultHashMaker, 16, WithBloomFilter(0.001)).Build(bytes.NewReader(data[:16*50]), 16*50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bf := tree.Bloom()
+	if bf == nil {
+		t.Fatal("expected a Bloom filter")
+	}
+	for _, n := range tree.Nodes {
+		if !bf.MayContain(n.checksum()) {
+			t.Errorf("expected leaf %d to be possibly present", n.Index)
+		}
+	}
+	n, err := NewNodeHashBlock(DefaultHashMaker, []byte("not a block of the tree"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bf.MayContain(n.checksum()) {
+		t.Errorf("expected a new block not to be present")
+	}
+	tree.Append(n)
+	if !bf.MayContain(n.checksum()) {
+		t.Errorf("expected an appended leaf to be added to the filter")
+	}
+
+	// serialized with the tree
+	encoded, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Tree
+	if err := decoded.UnmarshalBinary(encoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Bloom() == nil || !decoded.Bloom().MayContain(n.checksum()) {
+		t.Errorf("expected the filter to be decoded with the tree")
+	}
+	if err := decoded.UnmarshalBinary(encoded[:len(encoded)-1]); err == nil {
+		t.Errorf("expected a truncated filter to fail")
+	}
+
+	if tree, _, err = NewBuilder(DefaultHashMaker, 16).Build(bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Bloom() != nil {
+		t.Errorf("expected no filter without WithBloomFilter")
+	}
+}
@@ -0,0 +1,419 @@
+package merkle
+
+import "io"
+
+// Builder constructs a Tree, either from an input of known size by hashing
+// aligned shards of the input concurrently, or from the bytes written to it
+// and then finalized.
+type Builder struct {
+	hm          HashMaker
+	blockLength int
+	opts        options
+	stream      *leafStream
+	interner    *checksumInterner // of the leaves written, if WithChecksumInterning
+	slab        *leafSlab         // of the leaves written
+	err         error             // of the options, as an ErrUnsupportedOption
+
+	nodes   []*Node
+	partial []byte // written bytes not yet a whole block
+	length  int64  // bytes written
+}
+
+// Result is a finalized tree, and the checksum of its root
+type Result struct {
+	Tree *Tree
+	Root []byte
+	Err  error
+}
+
+// NewBuilder returns a Builder for trees of blockLength blocks, checksummed
+// with hm. The input is split across as many shards as WithHashWorkers, or
+// more WithAdaptiveWorkers, and the interior of the tree across as many as
+// WithLevelWorkers.
+//
+// A blockLength of 0 is of a Builder only for BuildChunks, and Build, Write
+// and ReadFrom return an ErrInvalidBlockLength for any below MinBlockSize.
+// WithStrictLifecycle, WithErrorHandler and WithRateLimit are not applied, as
+// a Builder has no Sum, and each method returns an ErrUnsupportedOption.
+func NewBuilder(hm HashMaker, blockLength int, opts ...Option) *Builder {
+	o := newOptions(opts)
+	return &Builder{
+		hm:          o.hashMaker(hm),
+		blockLength: blockLength,
+		opts:        o,
+		stream:      newLeafStream(o.leafStream),
+		interner:    o.newInterner(),
+		err:         o.supported("NewBuilder", builderOptions),
+	}
+}
+
+// check is whether the Builder can build trees of whole blocks
+func (b *Builder) check() error {
+	if b.err != nil {
+		return b.err
+	}
+	if b.blockLength < MinBlockSize {
+		return ErrInvalidBlockLength{Length: b.blockLength}
+	}
+	return nil
+}
+
+// Build reads size bytes from r and returns the tree of its blocks, and the
+// checksum of the root. With no bytes, this is ErrEmptyTree unless the
+// Builder is WithEmptyRoot.
+//
+// Each shard is a power of two count of leaves, aligned to its own size, so
+// it is a complete subtree of the final tree. The roots of the shards are
+// merged into the same root as hashing the input sequentially.
+func (b *Builder) Build(r io.ReaderAt, size int64) (*Tree, []byte, error) {
+	if err := b.check(); err != nil {
+		return nil, nil, err
+	}
+	if size <= 0 {
+		root, err := b.root(nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := b.streamTree(nil, 0); err != nil {
+			return nil, nil, err
+		}
+		return &Tree{BlockLength: b.blockLength, FinalBlock: b.opts.finalBlock}, b.opts.commitRoot(b.hm, root, 0, b.blockLength), nil
+	}
+	if err := b.opts.checkLimits(b.blockLength, 0, 0, 0, size); err != nil {
+		return nil, nil, err
+	}
+	leaves64 := (size + int64(b.blockLength) - 1) / int64(b.blockLength)
+	if leaves64 > int64(maxInt) {
+		return nil, nil, ErrLimitExceeded{Limit: "leaves", Max: int64(maxInt)}
+	}
+	var (
+		leaves   = int(leaves64)
+		limiter  = b.opts.newLimiter()
+		perShard = shardLeaves(leaves, b.opts.hashWorkers*limiter.shards())
+		shards   = (leaves + perShard - 1) / perShard
+		nodes    = make([]*Node, leaves)
+		roots    = make([][]byte, shards)
+		errs     = make(chan error, shards)
+		interner = b.opts.newInterner()
+	)
+	for s := 0; s < shards; s++ {
+		go func(s int) {
+			start := s * perShard
+			end := start + perShard
+			if end > leaves {
+				end = leaves
+			}
+			offset, length := int64(start)*int64(b.blockLength), int64(end-start)*int64(b.blockLength)
+			if offset+length > size {
+				length = size - offset
+			}
+			var err error
+			limiter.do(r, length, func(r io.ReaderAt) {
+				roots[s], err = b.buildShard(r, size, nodes[start:end], start, interner)
+			})
+			errs <- err
+		}(s)
+	}
+	var err error
+	for s := 0; s < shards; s++ {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	root, err := subtreeHash(b.hm, roots)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := b.streamTree(nodes, size); err != nil {
+		return nil, nil, err
+	}
+	tree, err := b.opts.addIndexes(&Tree{Nodes: nodes, BlockLength: b.blockLength, FinalBlock: b.opts.finalBlock, length: size})
+	if err != nil {
+		return nil, nil, err
+	}
+	return tree, b.opts.commitRoot(b.hm, root, size, b.blockLength), nil
+}
+
+// BuildChunks returns the tree of chunks of varying size, as from content
+// defined chunking, and the checksum of its root. The chunks are hashed by
+// the hash workers, which steal from each other, so they stay balanced regardless
+// of the distribution of chunk sizes. The BlockLength of the tree is 0, as
+// there is no one length.
+func (b *Builder) BuildChunks(chunks [][]byte) (*Tree, []byte, error) {
+	if b.err != nil {
+		return nil, nil, b.err
+	}
+	nodes, err := hashBlocks(b.hm, chunks, b.opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		tree     = &Tree{}
+		sums     = make([][]byte, len(nodes))
+		interner = b.opts.newInterner()
+	)
+	for i, n := range nodes {
+		interner.intern(n)
+		sums[i] = n.checksum()
+		tree.appendLeaf(n, len(chunks[i]))
+		tree.length += int64(len(chunks[i]))
+	}
+	root, err := b.root(sums)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := b.streamTree(tree.Nodes, tree.length); err != nil {
+		return nil, nil, err
+	}
+	if tree, err = b.opts.addIndexes(tree); err != nil {
+		return nil, nil, err
+	}
+	return tree, b.opts.commitRoot(b.hm, root, tree.length, 0), nil
+}
+
+// ReadFrom writes the bytes of r until io.EOF, and returns the count of bytes
+// written, so io.Copy to a Builder reads the blocks ahead of hashing them, as
+// set WithReadAhead
+func (b *Builder) ReadFrom(r io.Reader) (int64, error) {
+	if err := b.check(); err != nil {
+		return 0, err
+	}
+	return readAhead(r, b.blockLength*readFromBlocks, b.opts.readAhead, b.Write)
+}
+
+// Write checksums each whole block of the written bytes as a leaf. A write
+// beyond the limits of WithMaxLeaves or WithMaxBytes writes nothing, and
+// returns an ErrLimitExceeded.
+func (b *Builder) Write(p []byte) (int, error) {
+	if err := b.check(); err != nil {
+		return 0, err
+	}
+	if err := b.opts.checkLimits(b.blockLength, b.length, len(b.nodes), len(b.partial), int64(len(p))); err != nil {
+		return 0, err
+	}
+	n, err := b.write(p)
+	b.length += int64(n)
+	return n, err
+}
+
+func (b *Builder) write(p []byte) (int, error) {
+	written := len(p)
+	if len(b.partial) > 0 {
+		l := b.blockLength - len(b.partial)
+		if l > len(p) {
+			l = len(p)
+		}
+		b.partial = append(b.partial, p[:l]...)
+		p = p[l:]
+		if len(b.partial) < b.blockLength {
+			return written, nil
+		}
+		n, err := b.leafSlab().hashLeaf(FinalBlockRaw, b.blockLength, b.partial)
+		if err != nil {
+			b.partial = b.partial[:len(b.partial)-l]
+			return 0, err
+		}
+		b.partial = b.partial[:0]
+		if err := b.appendLeaf(n, b.blockLength); err != nil {
+			return written - len(p), err
+		}
+	}
+	for len(p) >= b.blockLength {
+		n, err := b.leafSlab().hashLeaf(FinalBlockRaw, b.blockLength, p[:b.blockLength])
+		if err != nil {
+			return written - len(p), err
+		}
+		p = p[b.blockLength:]
+		if err := b.appendLeaf(n, b.blockLength); err != nil {
+			return written - len(p), err
+		}
+		b.opts.yield()
+	}
+	b.partial = append(b.partial, p...)
+	return written, nil
+}
+
+// Finalize returns the tree of the bytes written so far, with any trailing
+// partial block as the last leaf, and the checksum of its root. The Builder is
+// reset, for the next tree to be written.
+func (b *Builder) Finalize() (*Tree, []byte, error) {
+	r := <-b.FinalizeAsync()
+	return r.Tree, r.Root, r.Err
+}
+
+// FinalizeAsync is Finalize, with the interior of the tree computed in the
+// background. The Builder is reset before this returns, so the next tree can
+// be written while the Result is pending.
+func (b *Builder) FinalizeAsync() <-chan Result {
+	var (
+		res      = make(chan Result, 1)
+		nodes    = b.nodes
+		partial  = b.partial
+		length   = b.length
+		slab     = b.slab
+		interner = b.interner
+	)
+	if b.err != nil {
+		res <- Result{Err: b.err}
+		return res
+	}
+	b.nodes, b.partial, b.length, b.slab = nil, nil, 0, nil
+	b.interner = b.opts.newInterner()
+
+	// the last leaf is hashed here, rather than in the background, so it is
+	// streamed before the leaves of the next tree
+	if len(partial) > 0 {
+		if slab == nil {
+			slab = newLeafSlabOf(b.hm, 1)
+		}
+		n, err := slab.hashLeaf(b.opts.finalBlock, b.blockLength, partial)
+		if err != nil {
+			res <- Result{Err: err}
+			return res
+		}
+		n.Index, n.Offset, n.Length = len(nodes), int64(len(nodes))*int64(b.blockLength), len(partial)
+		interner.intern(n)
+		nodes = append(nodes, n)
+		if err := b.stream.leaf(b.hm, b.blockLength, b.opts.finalBlock, n.checksum(), n.Length); err != nil {
+			res <- Result{Err: err}
+			return res
+		}
+	}
+	if err := b.stream.end(b.hm, b.blockLength, b.opts.finalBlock, length); err != nil {
+		res <- Result{Err: err}
+		return res
+	}
+
+	go func() {
+		sums := make([][]byte, len(nodes))
+		for i, n := range nodes {
+			sums[i] = n.checksum()
+		}
+		root, err := b.root(sums)
+		if err != nil {
+			res <- Result{Err: err}
+			return
+		}
+		tree, err := b.opts.addIndexes(&Tree{Nodes: nodes, BlockLength: b.blockLength, FinalBlock: b.opts.finalBlock, length: length})
+		res <- Result{Tree: tree, Root: b.opts.commitRoot(b.hm, root, length, b.blockLength), Err: err}
+	}()
+	return res
+}
+
+// leafSlab is the slab of the leaves written, made with the first of them
+func (b *Builder) leafSlab() *leafSlab {
+	if b.slab == nil {
+		b.slab = newLeafSlab(b.hm)
+	}
+	return b.slab
+}
+
+// appendLeaf appends the leaf of the next whole block written, and streams it
+func (b *Builder) appendLeaf(n *Node, length int) error {
+	n.Index, n.Offset, n.Length = len(b.nodes), int64(len(b.nodes))*int64(b.blockLength), length
+	b.interner.intern(n)
+	b.nodes = append(b.nodes, n)
+	return b.stream.leaf(b.hm, b.blockLength, b.opts.finalBlock, n.checksum(), length)
+}
+
+// streamTree streams the leaves of a tree built whole, and its end
+func (b *Builder) streamTree(nodes []*Node, length int64) error {
+	for _, n := range nodes {
+		if err := b.stream.leaf(b.hm, b.blockLength, b.opts.finalBlock, n.checksum(), n.Length); err != nil {
+			return err
+		}
+	}
+	return b.stream.end(b.hm, b.blockLength, b.opts.finalBlock, length)
+}
+
+// root computes the checksum of the root over the leaf checksums, with the
+// subtree of each aligned shard on its own goroutine
+func (b *Builder) root(sums [][]byte) ([]byte, error) {
+	if len(sums) == 0 {
+		return b.opts.emptyTreeRoot(b.hm)
+	}
+	var (
+		perShard = shardLeaves(len(sums), b.opts.levelWorkers)
+		shards   = (len(sums) + perShard - 1) / perShard
+		roots    = make([][]byte, shards)
+		errs     = make(chan error, shards)
+	)
+	for s := 0; s < shards; s++ {
+		go func(s int) {
+			start := s * perShard
+			end := start + perShard
+			if end > len(sums) {
+				end = len(sums)
+			}
+			var err error
+			roots[s], err = subtreeHash(b.hm, sums[start:end])
+			errs <- err
+		}(s)
+	}
+	var err error
+	for s := 0; s < shards; s++ {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return subtreeHash(b.hm, roots)
+}
+
+// buildShard hashes the blocks of the leaves starting at index first into
+// nodes, interning their checksums, and returns the checksum of their subtree
+func (b *Builder) buildShard(r io.ReaderAt, size int64, nodes []*Node, first int, interner *checksumInterner) ([]byte, error) {
+	var (
+		pooled = buffers.get(b.blockLength)
+		buf    = *pooled
+		sums   = make([][]byte, len(nodes))
+		slab   = newLeafSlabOf(b.hm, len(nodes))
+	)
+	defer buffers.put(pooled)
+	for i := range nodes {
+		off := int64(first+i) * int64(b.blockLength)
+		l := int64(b.blockLength)
+		if off+l > size {
+			l = size - off
+		}
+		if n, err := r.ReadAt(buf[:l], off); int64(n) < l {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		n, err := slab.hashLeaf(b.opts.finalBlock, b.blockLength, buf[:l])
+		if err != nil {
+			return nil, err
+		}
+		n.Index, n.Offset, n.Length = first+i, off, int(l)
+		interner.intern(n)
+		nodes[i] = n
+		sums[i] = n.checksum()
+		b.opts.yield()
+	}
+	return subtreeHash(b.hm, sums)
+}
+
+// shardLeaves is the power of two count of leaves per shard, so that leaves
+// are spread across at most shards
+func shardLeaves(leaves, shards int) int {
+	if shards < 1 {
+		shards = 1
+	}
+	least := leaves / shards
+	if leaves%shards != 0 {
+		least++
+	}
+	per := 1
+	for per < least {
+		per <<= 1
+	}
+	return per
+}
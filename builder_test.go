@@ -0,0 +1,127 @@
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestBuilderMatchesSequential(t *testing.T) {
+	data := make([]byte, 10*1024+17)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	for _, size := range []int{1, 100, 1024, 1025, 4096, len(data)} {
+		h := NewHash(DefaultHashMaker, 100)
+		if _, err := h.Write(data[:size]); err != nil {
+			t.Fatal(err)
+		}
+		expected, err := h.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, shards := range []int{1, 2, 3, 8, 200} {
+			b := NewBuilder(DefaultHashMaker, 100, WithHashWorkers(shards), WithLevelWorkers(shards))
+			tree, root, err := b.Build(bytes.NewReader(data[:size]), int64(size))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(root, expected) {
+				t.Errorf("size %d, %d shards: expected root %x; got %x", size, shards, expected, root)
+			}
+			if len(tree.Nodes) != len(h.Nodes()) {
+				t.Errorf("size %d, %d shards: expected %d nodes, got %d", size, shards, len(h.Nodes()), len(tree.Nodes))
+			}
+			c, err := tree.Root().Checksum()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(c, root) {
+				t.Errorf("size %d, %d shards: tree root %x does not match %x", size, shards, c, root)
+			}
+		}
+	}
+
+	if _, _, err := NewBuilder(DefaultHashMaker, 100).Build(bytes.NewReader(nil), 0); err != ErrEmptyTree {
+		t.Errorf("expected %q, got %v", ErrEmptyTree, err)
+	}
+	if _, _, err := NewBuilder(DefaultHashMaker, 100).Build(bytes.NewReader(data[:10]), 20); err == nil {
+		t.Errorf("expected an error for a short input")
+	}
+}
+
+func TestBuilderFinalizeAsync(t *testing.T) {
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+	expected := "48940c1c72636648ad40aa59c162f2208e835b38"
+
+	b := NewBuilder(DefaultHashMaker, 10, WithLevelWorkers(3), WithLowPriority())
+	for _, chunk := range [][]byte{msg[:3], msg[3:4], msg[4:25], msg[25:]} {
+		if _, err := b.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pending := b.FinalizeAsync()
+
+	// the builder is ready for the next tree while the first is finalized
+	if _, err := b.Write(msg[:10]); err != nil {
+		t.Fatal(err)
+	}
+
+	r := <-pending
+	if r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	if got := fmt.Sprintf("%x", r.Root); got != expected {
+		t.Errorf("expected root %q; got %q", expected, got)
+	}
+	if len(r.Tree.Nodes) != 5 {
+		t.Errorf("expected 5 nodes, got %d", len(r.Tree.Nodes))
+	}
+
+	tree, root, err := b.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Nodes) != 1 || !bytes.Equal(root, tree.Nodes[0].checksum()) {
+		t.Errorf("expected a single leaf tree of the second write")
+	}
+
+	if _, _, err := b.Finalize(); err != ErrEmptyTree {
+		t.Errorf("expected %q, got %v", ErrEmptyTree, err)
+	}
+}
+
+func BenchmarkBuilder(b *testing.B) {
+	data := make([]byte, 64*1024*1024)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			builder := NewBuilder(DefaultHashMaker, 8192, WithHashWorkers(workers), WithLevelWorkers(workers))
+			for i := 0; i < b.N; i++ {
+				if _, _, err := builder.Build(bytes.NewReader(data), int64(len(data))); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestBuilderBlockLength(t *testing.T) {
+	for _, blockLength := range []int{0, -1} {
+		b := NewBuilder(DefaultHashMaker, blockLength)
+		if _, err := b.Write([]byte("abc")); err == nil {
+			t.Errorf("%d: expected Write to fail", blockLength)
+		}
+		if _, err := b.ReadFrom(bytes.NewReader([]byte("abc"))); err == nil {
+			t.Errorf("%d: expected ReadFrom to fail", blockLength)
+		}
+		if _, _, err := b.Build(bytes.NewReader([]byte("abc")), 3); err == nil {
+			t.Errorf("%d: expected Build to fail", blockLength)
+		}
+	}
+	// which is of BuildChunks alone
+	if _, _, err := NewBuilder(DefaultHashMaker, 0).BuildChunks([][]byte{[]byte("abc")}); err != nil {
+		t.Errorf("expected BuildChunks of no block length, got %v", err)
+	}
+}
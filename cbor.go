@@ -0,0 +1,255 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// CBOR major types, of RFC 8949
+const (
+	cborUint  = 0
+	cborBytes = 2
+	cborText  = 3
+	cborArray = 4
+	cborMap   = 5
+)
+
+// MarshalCBOR encodes the tree as a CBOR map of the same keys and values as
+// MarshalJSON, with the checksums as byte strings. Only definite lengths are
+// used, and the keys are in the order of the JSON form.
+func (t *Tree) MarshalCBOR() ([]byte, error) {
+	tf, err := t.fields()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		buf   bytes.Buffer
+		pairs = 6
+	)
+	if tf.Lengths != nil {
+		pairs++
+	}
+	if tf.Bloom != nil {
+		pairs++
+	}
+	cborHead(&buf, cborMap, uint64(pairs))
+	cborString(&buf, cborText, []byte("version"))
+	cborHead(&buf, cborUint, uint64(tf.Version))
+	cborString(&buf, cborText, []byte("hash"))
+	cborString(&buf, cborText, []byte(tf.Hash))
+	cborString(&buf, cborText, []byte("blockLength"))
+	cborHead(&buf, cborUint, uint64(tf.BlockLength))
+	cborString(&buf, cborText, []byte("finalBlock"))
+	cborHead(&buf, cborUint, uint64(tf.FinalBlock))
+	cborString(&buf, cborText, []byte("length"))
+	cborHead(&buf, cborUint, uint64(tf.Length))
+	cborString(&buf, cborText, []byte("leaves"))
+	cborHead(&buf, cborArray, uint64(len(tf.Leaves)))
+	for _, sum := range tf.Leaves {
+		cborString(&buf, cborBytes, sum)
+	}
+	if tf.Lengths != nil {
+		cborString(&buf, cborText, []byte("lengths"))
+		cborHead(&buf, cborArray, uint64(len(tf.Lengths)))
+		for _, l := range tf.Lengths {
+			cborHead(&buf, cborUint, uint64(l))
+		}
+	}
+	if tf.Bloom != nil {
+		cborString(&buf, cborText, []byte("bloom"))
+		cborString(&buf, cborBytes, tf.Bloom)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalCBOR decodes a tree encoded by MarshalCBOR. The hash it names must
+// be registered. Keys that are unknown, repeated or of the wrong type are an
+// ErrMalformedTree.
+func (t *Tree) UnmarshalCBOR(data []byte) error {
+	return t.unmarshalCBOR(data, DefaultDecodeLimits())
+}
+
+// unmarshalCBOR is UnmarshalCBOR of the limits l
+func (t *Tree) unmarshalCBOR(data []byte, l DecodeLimits) error {
+	if err := l.checkBytes(len(data)); err != nil {
+		return err
+	}
+	var (
+		d    = cborDecoder{data: data}
+		tf   treeFields
+		seen = map[string]bool{}
+	)
+	pairs, err := d.expect(cborMap)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < pairs; i++ {
+		key, err := d.string(cborText)
+		if err != nil {
+			return err
+		}
+		if seen[string(key)] {
+			return ErrMalformedTree
+		}
+		seen[string(key)] = true
+		switch string(key) {
+		case "version":
+			tf.Version, err = d.int()
+		case "hash":
+			var name []byte
+			name, err = d.string(cborText)
+			tf.Hash = string(name)
+		case "blockLength":
+			tf.BlockLength, err = d.int()
+		case "finalBlock":
+			var policy int
+			policy, err = d.int()
+			tf.FinalBlock = FinalBlockPolicy(policy)
+		case "length":
+			var length uint64
+			if length, err = d.expect(cborUint); err == nil && length > 1<<63-1 {
+				err = ErrMalformedTree
+			}
+			tf.Length = int64(length)
+		case "leaves":
+			var n uint64
+			if n, err = d.expect(cborArray); err != nil {
+				return err
+			}
+			if err := l.checkLeaves(n); err != nil {
+				return err
+			}
+			tf.Leaves = [][]byte{}
+			for j := uint64(0); j < n && err == nil; j++ {
+				var sum []byte
+				sum, err = d.string(cborBytes)
+				tf.Leaves = append(tf.Leaves, sum)
+			}
+		case "lengths":
+			var n uint64
+			if n, err = d.expect(cborArray); err != nil {
+				return err
+			}
+			tf.Lengths = []int{}
+			for j := uint64(0); j < n && err == nil; j++ {
+				var l int
+				l, err = d.int()
+				tf.Lengths = append(tf.Lengths, l)
+			}
+		case "bloom":
+			tf.Bloom, err = d.string(cborBytes)
+		default:
+			return ErrMalformedTree
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if d.pos != len(data) {
+		return ErrMalformedTree
+	}
+	tree, err := tf.tree(l)
+	if err != nil {
+		return err
+	}
+	*t = *tree
+	return nil
+}
+
+func cborHead(buf *bytes.Buffer, major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < 24:
+		buf.WriteByte(major | byte(arg))
+	case arg <= 0xff:
+		buf.Write([]byte{major | 24, byte(arg)})
+	case arg <= 0xffff:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(arg))
+	case arg <= 0xffffffff:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(arg))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, arg)
+	}
+}
+
+func cborString(buf *bytes.Buffer, major byte, s []byte) {
+	cborHead(buf, major, uint64(len(s)))
+	buf.Write(s)
+}
+
+// cborDecoder reads the CBOR items of data, of the definite lengths
+// MarshalCBOR encodes
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// head is the major type and argument of the next item
+func (d *cborDecoder) head() (byte, uint64, error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, ErrMalformedTree
+	}
+	b := d.data[d.pos]
+	d.pos++
+	major, info := b>>5, b&0x1f
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+	if info > 27 {
+		return 0, 0, ErrMalformedTree
+	}
+	n := 1 << (info - 24)
+	if len(d.data)-d.pos < n {
+		return 0, 0, ErrMalformedTree
+	}
+	var arg uint64
+	for _, c := range d.data[d.pos : d.pos+n] {
+		arg = arg<<8 | uint64(c)
+	}
+	d.pos += n
+	return major, arg, nil
+}
+
+// expect is the argument of the next item, which must be of major. The count
+// of an array or map is checked against the bytes left, each item being of at
+// least a byte, so it can not cause a large allocation.
+func (d *cborDecoder) expect(major byte) (uint64, error) {
+	m, arg, err := d.head()
+	if err != nil {
+		return 0, err
+	}
+	if m != major {
+		return 0, ErrMalformedTree
+	}
+	if (major == cborArray || major == cborMap) && arg > uint64(len(d.data)-d.pos) {
+		return 0, ErrMalformedTree
+	}
+	return arg, nil
+}
+
+func (d *cborDecoder) int() (int, error) {
+	arg, err := d.expect(cborUint)
+	if err != nil {
+		return 0, err
+	}
+	if arg > uint64(maxInt) {
+		return 0, ErrMalformedTree
+	}
+	return int(arg), nil
+}
+
+func (d *cborDecoder) string(major byte) ([]byte, error) {
+	n, err := d.expect(major)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, ErrMalformedTree
+	}
+	s := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return s, nil
+}
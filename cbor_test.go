@@ -0,0 +1,48 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestTreeCBOR(t *testing.T) {
+	for name, tree := range codecTrees(t) {
+		data, err := tree.MarshalCBOR()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Tree
+		if err := got.UnmarshalCBOR(data); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		checkRoundTrip(t, name, tree, &got)
+	}
+
+	// a map of 6 pairs, the first "version": 1
+	data, err := codecTrees(t)["empty"].MarshalCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefix, _ := hex.DecodeString("a66776657273696f6e01"); !bytes.HasPrefix(data, prefix) {
+		t.Errorf("expected the map to start %x, got %x", prefix, data)
+	}
+
+	data, err = codecTrees(t)["blocks"].MarshalCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Tree
+	for i := 0; i < len(data); i++ {
+		if err := got.UnmarshalCBOR(data[:i]); err == nil {
+			t.Fatalf("expected an error of %d of %d bytes", i, len(data))
+		}
+	}
+	if err := got.UnmarshalCBOR(append(data, 0)); err != ErrMalformedTree {
+		t.Errorf("expected ErrMalformedTree of a trailing byte, got %v", err)
+	}
+	// an array claiming more items than there are bytes
+	if err := got.UnmarshalCBOR([]byte{0xa1, 0x66, 'l', 'e', 'a', 'v', 'e', 's', 0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}); err != ErrMalformedTree {
+		t.Errorf("expected ErrMalformedTree of a huge array, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package merkle
+
+import (
+	"bufio"
+	"io"
+)
+
+// gearTable is the per byte values of the rolling gear hash, from a fixed
+// seed so chunk boundaries are stable across runs and machines
+var gearTable = func() (table [256]uint64) {
+	seed := uint64(0x6d65726b6c65) // "merkle"
+	for i := range table {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// Chunker splits a stream into content defined chunks, with a rolling gear
+// hash. An insertion or deletion in the stream only changes the chunks around
+// it, so the chunks of similar streams deduplicate.
+type Chunker struct {
+	r        *bufio.Reader
+	min, max int
+	mask     uint64
+	err      error
+}
+
+// NewChunker returns a Chunker of r, with chunks of at least min and at most
+// max bytes, averaging about min + 2^avgBits bytes
+func NewChunker(r io.Reader, min, max int, avgBits uint) *Chunker {
+	return &Chunker{
+		r:    bufio.NewReaderSize(r, max),
+		min:  min,
+		max:  max,
+		mask: 1<<avgBits - 1,
+	}
+}
+
+// Next returns the next chunk, or io.EOF after the last
+func (c *Chunker) Next() ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	var (
+		chunk = make([]byte, 0, c.min)
+		h     uint64
+	)
+	for len(chunk) < c.max {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			c.err = err
+			break
+		}
+		chunk = append(chunk, b)
+		h = h<<1 + gearTable[b]
+		if len(chunk) >= c.min && h&c.mask == 0 {
+			break
+		}
+	}
+	if len(chunk) == 0 {
+		return nil, c.err
+	}
+	return chunk, nil
+}
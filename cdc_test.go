@@ -0,0 +1,60 @@
+package merkle
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func chunkAll(t *testing.T, data []byte) [][]byte {
+	var (
+		c      = NewChunker(bytes.NewReader(data), 256, 4096, 10)
+		chunks [][]byte
+	)
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			return chunks
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunk) > 4096 {
+			t.Errorf("chunk of %d bytes is over the max", len(chunk))
+		}
+		chunks = append(chunks, append([]byte{}, chunk...))
+	}
+}
+
+func TestChunker(t *testing.T) {
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	chunks := chunkAll(t, data)
+	if got := bytes.Join(chunks, nil); !bytes.Equal(got, data) {
+		t.Fatalf("expected the chunks to join back into the data")
+	}
+	for _, chunk := range chunks[:len(chunks)-1] {
+		if len(chunk) < 256 {
+			t.Errorf("chunk of %d bytes is under the min", len(chunk))
+		}
+	}
+
+	// an insertion near the front leaves most chunks unchanged
+	edited := append(append(append([]byte{}, data[:1000]...), []byte("inserted")...), data[1000:]...)
+	seen := map[string]bool{}
+	for _, chunk := range chunks {
+		seen[string(chunk)] = true
+	}
+	var shared int
+	editedChunks := chunkAll(t, edited)
+	for _, chunk := range editedChunks {
+		if seen[string(chunk)] {
+			shared++
+		}
+	}
+	if shared < len(editedChunks)-3 {
+		t.Errorf("expected all but a few chunks to be shared, %d of %d are", shared, len(editedChunks))
+	}
+}
@@ -0,0 +1,217 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Checkpoint is a compact, signed statement of the size and root of a Tree,
+// for verifiers to gossip the latest roots they have seen.
+//
+// The text form has a body of the origin, size and base64 root on their own
+// lines, followed by a blank line and a line per signature:
+//
+//	example.com/log
+//	42
+//	qJ2pFS3L0JGu2bICoDeRKJZH3l8=
+//
+//	— alice NDI0MmFi...
+type Checkpoint struct {
+	Origin     string
+	Size       int
+	Root       []byte
+	Signatures []CheckpointSignature
+}
+
+// CheckpointSignature is one signer's signature over the body of a Checkpoint
+type CheckpointSignature struct {
+	Name      string `json:"name"`
+	Signature []byte `json:"signature"`
+}
+
+var (
+	// ErrCheckpointSignature is for checkpoints without a valid signature by
+	// the expected signer
+	ErrCheckpointSignature = errors.New("no valid checkpoint signature")
+
+	// ErrCheckpointOrigin is for comparing checkpoints of different logs
+	ErrCheckpointOrigin = errors.New("checkpoints are of different origins")
+
+	// ErrMalformedCheckpoint is for text that does not parse as a Checkpoint
+	ErrMalformedCheckpoint = errors.New("malformed checkpoint")
+)
+
+// ErrSplitView is for two checkpoints of the same size with different roots,
+// meaning the log has presented different trees to different verifiers
+type ErrSplitView struct {
+	Origin string
+	Size   int
+	Roots  [2][]byte
+}
+
+// Error shows the conflicting roots
+func (err ErrSplitView) Error() string {
+	return fmt.Sprintf("split view of %q at size %d: %x != %x", err.Origin, err.Size, err.Roots[0], err.Roots[1])
+}
+
+// NewCheckpoint returns an unsigned Checkpoint for the current state of t
+func NewCheckpoint(origin string, t *Tree) (*Checkpoint, error) {
+	if len(t.Nodes) == 0 {
+		return nil, ErrEmptyTree
+	}
+	root, err := t.RootChecksum()
+	if err != nil {
+		return nil, err
+	}
+	return &Checkpoint{Origin: origin, Size: len(t.Nodes), Root: root}, nil
+}
+
+// body is the signed portion of the checkpoint
+func (c Checkpoint) body() []byte {
+	return []byte(fmt.Sprintf("%s\n%d\n%s\n", c.Origin, c.Size, base64.StdEncoding.EncodeToString(c.Root)))
+}
+
+// Sign adds a signature by name over the checkpoint, replacing any prior
+// signature by that name
+func (c *Checkpoint) Sign(name string, key ed25519.PrivateKey) error {
+	if name == "" || strings.ContainsAny(name, " \n") {
+		return fmt.Errorf("invalid signer name %q", name)
+	}
+	c.addSignature(CheckpointSignature{Name: name, Signature: ed25519.Sign(key, c.body())})
+	return nil
+}
+
+// Verify checks that the checkpoint carries a valid signature by name
+func (c Checkpoint) Verify(name string, key ed25519.PublicKey) error {
+	for _, s := range c.Signatures {
+		if s.Name == name && ed25519.Verify(key, c.body(), s.Signature) {
+			return nil
+		}
+	}
+	return ErrCheckpointSignature
+}
+
+// hasSignature is whether c has a signature by name
+func (c Checkpoint) hasSignature(name string) bool {
+	for _, s := range c.Signatures {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Checkpoint) addSignature(sig CheckpointSignature) {
+	for i := range c.Signatures {
+		if c.Signatures[i].Name == sig.Name {
+			c.Signatures[i] = sig
+			return
+		}
+	}
+	c.Signatures = append(c.Signatures, sig)
+}
+
+// Compare orders c against other by size, returning -1, 0 or 1. An error is
+// returned if they are for different origins, or are the same size but with
+// different roots (ErrSplitView).
+//
+// Checkpoints of different sizes are only ordered here. Whether the larger is
+// an extension of the smaller needs a consistency proof.
+func (c Checkpoint) Compare(other Checkpoint) (int, error) {
+	if c.Origin != other.Origin {
+		return 0, ErrCheckpointOrigin
+	}
+	switch {
+	case c.Size < other.Size:
+		return -1, nil
+	case c.Size > other.Size:
+		return 1, nil
+	}
+	if !bytes.Equal(c.Root, other.Root) {
+		return 0, ErrSplitView{Origin: c.Origin, Size: c.Size, Roots: [2][]byte{c.Root, other.Root}}
+	}
+	return 0, nil
+}
+
+// Merge returns the latest of c and other. When they are the same checkpoint,
+// the result carries the signatures of both. A signature of other by a name
+// c already has a signature of is dropped, as the signatures of other are not
+// verified, so a forged one can not replace a valid one of c.
+func (c Checkpoint) Merge(other Checkpoint) (Checkpoint, error) {
+	cmp, err := c.Compare(other)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	switch cmp {
+	case -1:
+		return other, nil
+	case 1:
+		return c, nil
+	}
+	merged := c
+	merged.Signatures = append([]CheckpointSignature{}, c.Signatures...)
+	for _, s := range other.Signatures {
+		if !merged.hasSignature(s.Name) {
+			merged.Signatures = append(merged.Signatures, s)
+		}
+	}
+	return merged, nil
+}
+
+// MarshalText encodes the checkpoint and its signatures
+func (c Checkpoint) MarshalText() ([]byte, error) {
+	if strings.Contains(c.Origin, "\n") {
+		return nil, fmt.Errorf("invalid origin %q", c.Origin)
+	}
+	buf := bytes.NewBuffer(c.body())
+	buf.WriteString("\n")
+	for _, s := range c.Signatures {
+		fmt.Fprintf(buf, "— %s %s\n", s.Name, base64.StdEncoding.EncodeToString(s.Signature))
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalText decodes a checkpoint as produced by MarshalText. Signatures
+// are not verified.
+func (c *Checkpoint) UnmarshalText(text []byte) error {
+	parts := strings.SplitN(string(text), "\n\n", 2)
+	if len(parts) != 2 {
+		return ErrMalformedCheckpoint
+	}
+	body := strings.Split(parts[0], "\n")
+	if len(body) != 3 {
+		return ErrMalformedCheckpoint
+	}
+	size, err := strconv.Atoi(body[1])
+	if err != nil || size < 0 {
+		return ErrMalformedCheckpoint
+	}
+	root, err := base64.StdEncoding.DecodeString(body[2])
+	if err != nil {
+		return ErrMalformedCheckpoint
+	}
+
+	var sigs []CheckpointSignature
+	for _, line := range strings.Split(parts[1], "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, " ")
+		if len(fields) != 3 || fields[0] != "—" {
+			return ErrMalformedCheckpoint
+		}
+		sig, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil {
+			return ErrMalformedCheckpoint
+		}
+		sigs = append(sigs, CheckpointSignature{Name: fields[1], Signature: sig})
+	}
+
+	*c = Checkpoint{Origin: body[0], Size: size, Root: root, Signatures: sigs}
+	return nil
+}
@@ -0,0 +1,100 @@
+package merkle
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	alicePub, alice, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobPub, bob, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree := testTree(t, 5)
+	c1, err := NewCheckpoint("example.com/log", tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2 := *c1
+	if err := c1.Sign("alice", alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := c2.Sign("bob", bob); err != nil {
+		t.Fatal(err)
+	}
+
+	// round trip the text form
+	text, err := c1.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Checkpoint
+	if err := got.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if err := got.Verify("alice", alicePub); err != nil {
+		t.Errorf("alice: %s", err)
+	}
+	if err := got.Verify("alice", bobPub); err != ErrCheckpointSignature {
+		t.Errorf("expected %q for the wrong key, got %v", ErrCheckpointSignature, err)
+	}
+
+	merged, err := got.Merge(c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.Signatures) != 2 {
+		t.Errorf("expected 2 signatures, got %d", len(merged.Signatures))
+	}
+	if err := merged.Verify("bob", bobPub); err != nil {
+		t.Errorf("bob: %s", err)
+	}
+
+	// a forged signature of a peer does not replace a valid one
+	forged := c2
+	forged.Signatures = []CheckpointSignature{{Name: "alice", Signature: make([]byte, ed25519.SignatureSize)}}
+	if merged, err = merged.Merge(forged); err != nil {
+		t.Fatal(err)
+	}
+	if err := merged.Verify("alice", alicePub); err != nil {
+		t.Errorf("expected alice's signature kept, got %v", err)
+	}
+
+	// a larger checkpoint is the latest
+	tree.Append(testTree(t, 1).Nodes...)
+	c3, err := NewCheckpoint("example.com/log", tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmp, err := merged.Compare(*c3); err != nil || cmp != -1 {
+		t.Errorf("expected -1, got %d (%v)", cmp, err)
+	}
+	latest, err := merged.Merge(*c3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Size != 6 {
+		t.Errorf("expected size 6, got %d", latest.Size)
+	}
+
+	// same size with a different root is a split view
+	forked := *c1
+	forked.Root = c3.Root
+	if _, err := c1.Compare(forked); err == nil {
+		t.Errorf("expected a split view error")
+	} else if _, ok := err.(ErrSplitView); !ok {
+		t.Errorf("expected ErrSplitView, got %T", err)
+	}
+
+	other := *c1
+	other.Origin = "example.org/log"
+	if _, err := c1.Compare(other); err != ErrCheckpointOrigin {
+		t.Errorf("expected %q, got %v", ErrCheckpointOrigin, err)
+	}
+}
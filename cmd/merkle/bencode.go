@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// bencode encodes v, of int, int64, string, []byte, []interface{} and
+// map[string]interface{}, as BitTorrent does, with the keys of dictionaries
+// sorted
+func bencode(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case int:
+		fmt.Fprintf(buf, "i%de", v)
+	case int64:
+		fmt.Fprintf(buf, "i%de", v)
+	case string:
+		fmt.Fprintf(buf, "%d:%s", len(v), v)
+	case []byte:
+		fmt.Fprintf(buf, "%d:%s", len(v), v)
+	case []interface{}:
+		buf.WriteByte('l')
+		for _, e := range v {
+			if err := bencode(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('d')
+		for _, k := range keys {
+			fmt.Fprintf(buf, "%d:%s", len(k), k)
+			if err := bencode(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+	default:
+		return fmt.Errorf("can not bencode %T", v)
+	}
+	return nil
+}
+
+// bdecode decodes the single bencoded value of data, with integers as int64,
+// strings as string, lists as []interface{} and dictionaries as
+// map[string]interface{}
+func bdecode(data []byte) (interface{}, error) {
+	d := bdecoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(data) {
+		return nil, fmt.Errorf("bencode: trailing data at %d", d.pos)
+	}
+	return v, nil
+}
+
+// bdecodeDepth is the deepest nesting of lists and dictionaries decoded
+const bdecodeDepth = 64
+
+type bdecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *bdecoder) value(depth int) (interface{}, error) {
+	if d.pos >= len(d.data) {
+		return nil, fmt.Errorf("bencode: unexpected end")
+	}
+	if depth > bdecodeDepth {
+		return nil, fmt.Errorf("bencode: nested too deep at %d", d.pos)
+	}
+	switch c := d.data[d.pos]; {
+	case c == 'i':
+		end := bytes.IndexByte(d.data[d.pos:], 'e')
+		if end < 0 {
+			return nil, fmt.Errorf("bencode: unterminated integer at %d", d.pos)
+		}
+		n, err := strconv.ParseInt(string(d.data[d.pos+1:d.pos+end]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bencode: invalid integer at %d", d.pos)
+		}
+		d.pos += end + 1
+		return n, nil
+	case c >= '0' && c <= '9':
+		return d.string()
+	case c == 'l':
+		d.pos++
+		list := []interface{}{}
+		for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		if d.pos >= len(d.data) {
+			return nil, fmt.Errorf("bencode: unexpected end")
+		}
+		d.pos++
+		return list, nil
+	case c == 'd':
+		d.pos++
+		dict := map[string]interface{}{}
+		for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+			k, err := d.string()
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			dict[k] = v
+		}
+		if d.pos >= len(d.data) {
+			return nil, fmt.Errorf("bencode: unexpected end")
+		}
+		d.pos++
+		return dict, nil
+	default:
+		return nil, fmt.Errorf("bencode: unexpected %q at %d", c, d.pos)
+	}
+}
+
+func (d *bdecoder) string() (string, error) {
+	colon := bytes.IndexByte(d.data[d.pos:], ':')
+	if colon < 0 {
+		return "", fmt.Errorf("bencode: invalid string at %d", d.pos)
+	}
+	n, err := strconv.Atoi(string(d.data[d.pos : d.pos+colon]))
+	start := d.pos + colon + 1
+	if err != nil || n < 0 || n > len(d.data)-start {
+		return "", fmt.Errorf("bencode: invalid string at %d", d.pos)
+	}
+	d.pos = start + n
+	return string(d.data[start:d.pos]), nil
+}
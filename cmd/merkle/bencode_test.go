@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestBencode(t *testing.T) {
+	v := map[string]interface{}{
+		"b":    []interface{}{int64(-3), "x"},
+		"a":    "spam",
+		"dict": map[string]interface{}{"": int64(0)},
+	}
+	var buf bytes.Buffer
+	if err := bencode(&buf, v); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "d1:a4:spam1:bli-3e1:xe4:dictd0:i0eee"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+	got, err := bdecode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("expected %v decoded, got %v", v, got)
+	}
+
+	for _, bad := range []string{"", "i12", "ie", "5:abc", "l", "d1:a", "d1:ai1e", "i1ei2e", "x"} {
+		if _, err := bdecode([]byte(bad)); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+	if err := bencode(&buf, 1.5); err == nil {
+		t.Error("expected an error of a float")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/vbatts/merkle"
+)
+
+// blockChange is a block that differs between two trees, positioned in the
+// tree it is of (the old for a removed block, the new otherwise)
+type blockChange struct {
+	Change string `json:"change"` // "modified", "added" or "removed"
+	Index  int    `json:"index"`
+	Offset int64  `json:"offset"`
+	Length int    `json:"length"`
+}
+
+type diffResult struct {
+	OldRoot string        `json:"old_root"`
+	NewRoot string        `json:"new_root"`
+	Changes []blockChange `json:"changes"`
+}
+
+func runDiff(args []string, stdout io.Writer) error {
+	fs := newFlagSet("diff")
+	asJSON := fs.Bool("json", false, "print the changes as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("expected an old tree, and a new file or tree")
+	}
+	old, err := readTree(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var tree *merkle.Tree
+	if ok, err := isTree(fs.Arg(1)); err != nil {
+		return err
+	} else if ok {
+		tree, err = readTree(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+	} else {
+		if old.BlockLength == 0 {
+			return fmt.Errorf("%s is of blocks of varying length, and can only be compared to a tree", fs.Arg(0))
+		}
+		if tree, err = hashFile(fs.Arg(1), old); err != nil {
+			return err
+		}
+	}
+
+	res, err := diffTrees(old, tree)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+	for _, c := range res.Changes {
+		fmt.Fprintf(stdout, "%s block %d [%d, %d)\n", c.Change, c.Index, c.Offset, c.Offset+int64(c.Length))
+	}
+	return nil
+}
+
+// diffTrees compares the leaves of trees of the same parameters
+func diffTrees(old, tree *merkle.Tree) (diffResult, error) {
+	if old.BlockLength != tree.BlockLength || old.FinalBlock != tree.FinalBlock {
+		return diffResult{}, fmt.Errorf("trees of block length %d and %d are not comparable", old.BlockLength, tree.BlockLength)
+	}
+	oldHash, err := merkle.HashName(old.HashMaker())
+	if err != nil {
+		return diffResult{}, err
+	}
+	if name, err := merkle.HashName(tree.HashMaker()); err != nil || name != oldHash {
+		return diffResult{}, fmt.Errorf("trees of hash %s and %s are not comparable", oldHash, name)
+	}
+	res := diffResult{Changes: []blockChange{}}
+	if res.OldRoot, err = rootHex(old); err != nil {
+		return res, err
+	}
+	if res.NewRoot, err = rootHex(tree); err != nil {
+		return res, err
+	}
+	for i := 0; i < len(old.Nodes) || i < len(tree.Nodes); i++ {
+		switch {
+		case i >= len(old.Nodes):
+			res.Changes = append(res.Changes, change("added", tree.Nodes[i]))
+		case i >= len(tree.Nodes):
+			res.Changes = append(res.Changes, change("removed", old.Nodes[i]))
+		default:
+			a, err := old.Nodes[i].Checksum()
+			if err != nil {
+				return res, err
+			}
+			b, err := tree.Nodes[i].Checksum()
+			if err != nil {
+				return res, err
+			}
+			if !bytes.Equal(a, b) {
+				res.Changes = append(res.Changes, change("modified", tree.Nodes[i]))
+			}
+		}
+	}
+	return res, nil
+}
+
+func change(kind string, n *merkle.Node) blockChange {
+	return blockChange{Change: kind, Index: n.Index, Offset: n.Offset, Length: n.Length}
+}
+
+// rootHex is the hex encoded root of tree, or empty for a tree of no leaves
+func rootHex(tree *merkle.Tree) (string, error) {
+	if len(tree.Nodes) == 0 {
+		return "", nil
+	}
+	root, err := tree.RootChecksum()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(root), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vbatts/merkle"
+)
+
+// writeTree writes the tree of data, and data, to dir as name.tree and name
+func writeTree(t *testing.T, dir, name string, data []byte, blockLength int) string {
+	tree, _, err := merkle.NewBuilder(merkle.DefaultHashMaker, blockLength, merkle.WithEmptyRoot()).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path+".tree", blob, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkle-diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldData := bytes.Repeat([]byte("0123456789abcdef"), 10)
+	newData := append(append([]byte(nil), oldData...), "more"...)
+	newData[40] = 'X'
+	old := writeTree(t, dir, "old", oldData, 16)
+	changed := writeTree(t, dir, "new", newData, 16)
+
+	expected := []blockChange{{"modified", 2, 32, 16}, {"added", 10, 160, 4}}
+	for _, second := range []string{changed, changed + ".tree"} {
+		var out bytes.Buffer
+		if err := runDiff([]string{"-json", old + ".tree", second}, &out); err != nil {
+			t.Fatal(err)
+		}
+		var res diffResult
+		if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Changes) != len(expected) {
+			t.Fatalf("%s: expected %v, got %v", second, expected, res.Changes)
+		}
+		for i := range expected {
+			if res.Changes[i] != expected[i] {
+				t.Errorf("%s: expected %v, got %v", second, expected[i], res.Changes[i])
+			}
+		}
+		if res.OldRoot == "" || res.OldRoot == res.NewRoot {
+			t.Errorf("expected differing roots, got %q and %q", res.OldRoot, res.NewRoot)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := runDiff([]string{changed + ".tree", old}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "modified block 2 [32, 48)\nremoved block 10 [160, 164)\n"; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+
+	other := writeTree(t, dir, "other", oldData, 32)
+	if err := runDiff([]string{old + ".tree", other + ".tree"}, ioutil.Discard); err == nil {
+		t.Errorf("expected trees of different block lengths to fail")
+	}
+}
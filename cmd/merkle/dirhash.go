@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/vbatts/merkle"
+)
+
+func runDirhash(args []string, stdout io.Writer) error {
+	fs := newFlagSet("dirhash")
+	var (
+		prefix       = fs.String("prefix", "", "prefix of the names of the files, like MODULE@VERSION as go.sum hashes")
+		hashName     = fs.String("hash", "sha256", "hash of the blocks of the trees")
+		manifestPath = fs.String("manifest", "", "file to write a manifest of the trees of the files to, for verify-manifest")
+		blockLength  = sizeFlag(1 << 20)
+	)
+	fs.Var(&blockLength, "block-size", "length of the blocks of the trees")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected a directory")
+	}
+	hm, err := lookupHash(*hashName)
+	if err != nil {
+		return err
+	}
+	dir := fs.Arg(0)
+	d, err := merkle.HashDir(dir, *prefix, hm, int(blockLength))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%s  %s\n", d.Hash, dir)
+	if *manifestPath == "" {
+		return nil
+	}
+
+	// the manifest is of the files on disk, by the paths they were found at
+	trim := ""
+	if *prefix != "" {
+		trim = filepath.ToSlash(filepath.Clean(*prefix)) + "/"
+	}
+	m := manifest{Hash: *hashName, BlockLength: int(blockLength)}
+	st, err := d.SuperTree(hm)
+	if err != nil {
+		return err
+	}
+	for i, name := range d.Names {
+		m.Files = append(m.Files, manifestEntry{
+			Path:   filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(name, trim))),
+			Length: d.Trees[name].TotalLength(),
+			Root:   hex.EncodeToString(st.Roots[i]),
+		})
+	}
+	if m.Root, err = m.superRoot(hm); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(*manifestPath, append(data, '\n'), stdout)
+}
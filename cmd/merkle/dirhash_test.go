@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vbatts/merkle"
+)
+
+func TestDirhash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkle-dirhash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	module := filepath.Join(dir, "m")
+	if err := os.MkdirAll(filepath.Join(module, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{"go.mod": "module example.com/m\n", "sub/x.go": "package sub\n", "empty": ""} {
+		if err := ioutil.WriteFile(filepath.Join(module, filepath.FromSlash(name)), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifestPath := filepath.Join(dir, "manifest.json")
+	var out bytes.Buffer
+	if err := runDirhash([]string{"-prefix", "example.com/m@v1.0.0", "-block-size", "4", "-manifest", manifestPath, module}, &out); err != nil {
+		t.Fatal(err)
+	}
+	d, err := merkle.HashDir(module, "example.com/m@v1.0.0", merkle.DefaultHashMaker, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := d.Hash + "  " + module + "\n"; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+
+	out.Reset()
+	if err := runVerifyManifest([]string{manifestPath}, &out); err != nil {
+		t.Fatalf("%s: %s", err, out.String())
+	}
+	if strings.Count(out.String(), "OK ") != 3 {
+		t.Errorf("expected the three files of the manifest to verify, got %q", out.String())
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/vbatts/merkle"
+)
+
+// treeFormat is a form a tree is exported to, and imported from if decode is
+// set
+type treeFormat struct {
+	encode func(tree *merkle.Tree) ([]byte, error)
+	decode func(tree *merkle.Tree, data []byte) error
+}
+
+var treeFormats = map[string]treeFormat{
+	"binary": {(*merkle.Tree).MarshalBinary, (*merkle.Tree).UnmarshalBinary},
+	"cbor":   {(*merkle.Tree).MarshalCBOR, (*merkle.Tree).UnmarshalCBOR},
+	"dot":    {treeDOT, nil},
+	"json":   {indentJSON, (*merkle.Tree).UnmarshalJSON},
+	"proto":  {(*merkle.Tree).MarshalProto, (*merkle.Tree).UnmarshalProto},
+}
+
+// formatNames is the names of the formats, of those that can be imported if
+// decodable
+func formatNames(decodable bool) string {
+	var names []string
+	for name, f := range treeFormats {
+		if !decodable || f.decode != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
+}
+
+func runExport(args []string, stdout io.Writer) error {
+	fs := newFlagSet("export")
+	var (
+		format = fs.String("format", "json", "format to export to, "+formatNames(false))
+		out    = fs.String("o", "-", "file to write the tree to")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected a tree")
+	}
+	f, ok := treeFormats[*format]
+	if !ok {
+		return fmt.Errorf("unknown format %q, expected %s", *format, formatNames(false))
+	}
+	tree, err := readTree(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	data, err := f.encode(tree)
+	if err != nil {
+		return err
+	}
+	return writeFile(*out, data, stdout)
+}
+
+func runImport(args []string, stdout io.Writer) error {
+	fs := newFlagSet("import")
+	var (
+		format = fs.String("format", "json", "format to import from, "+formatNames(true))
+		out    = fs.String("o", "-", "file to write the serialized tree to")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected an exported tree")
+	}
+	f, ok := treeFormats[*format]
+	if !ok || f.decode == nil {
+		return fmt.Errorf("unknown format %q, expected %s", *format, formatNames(true))
+	}
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var tree merkle.Tree
+	if err := f.decode(&tree, data); err != nil {
+		return fmt.Errorf("%s: %s", fs.Arg(0), err)
+	}
+	if data, err = tree.MarshalBinary(); err != nil {
+		return err
+	}
+	return writeFile(*out, data, stdout)
+}
+
+func indentJSON(tree *merkle.Tree) ([]byte, error) {
+	data, err := json.MarshalIndent(tree, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// treeDOT is the nodes of the tree as a Graphviz digraph, from the root down
+// to the leaves, labeled by the first bytes of their checksums
+func treeDOT(tree *merkle.Tree) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("digraph merkle {\n\tnode [shape=box, fontname=monospace];\n")
+	var (
+		ids  = map[*merkle.Node]int{}
+		walk func(n *merkle.Node) error
+	)
+	walk = func(n *merkle.Node) error {
+		id := len(ids)
+		ids[n] = id
+		sum, err := n.Checksum()
+		if err != nil {
+			return err
+		}
+		label := hex.EncodeToString(sum)
+		if len(label) > 16 {
+			label = label[:16]
+		}
+		if n.Left == nil && n.Right == nil {
+			label = fmt.Sprintf("leaf %d\\n%s\\n%d+%d", n.Index, label, n.Offset, n.Length)
+		}
+		fmt.Fprintf(&buf, "\tn%d [label=\"%s\"];\n", id, label)
+		for _, child := range []*merkle.Node{n.Left, n.Right} {
+			if child == nil {
+				continue
+			}
+			if err := walk(child); err != nil {
+				return err
+			}
+			fmt.Fprintf(&buf, "\tn%d -> n%d;\n", id, ids[child])
+		}
+		return nil
+	}
+	if root := tree.Root(); root != nil {
+		if err := walk(root); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
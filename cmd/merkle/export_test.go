@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkle-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4)
+	data = append(data, "tail"...)
+	path := writeTree(t, dir, "file", data, 16)
+	expected, err := ioutil.ReadFile(path + ".tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"binary", "cbor", "json", "proto"} {
+		exported := filepath.Join(dir, "exported."+format)
+		if err := runExport([]string{"-format", format, "-o", exported, path + ".tree"}, ioutil.Discard); err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+		var out bytes.Buffer
+		if err := runImport([]string{"-format", format, exported}, &out); err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+		if !bytes.Equal(out.Bytes(), expected) {
+			t.Errorf("%s: expected the tree imported as exported", format)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := runExport([]string{"-format", "dot", path + ".tree"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	// 5 leaves and 4 interior nodes
+	if dot := out.String(); !strings.HasPrefix(dot, "digraph merkle {") || strings.Count(dot, "label=") != 9 || strings.Count(dot, "->") != 8 || !strings.Contains(dot, "leaf 4") {
+		t.Errorf("unexpected graph %s", dot)
+	}
+
+	if err := runImport([]string{"-format", "dot", path + ".tree"}, ioutil.Discard); err == nil {
+		t.Error("expected dot not to be imported")
+	}
+	if err := runExport([]string{"-format", "yaml", path + ".tree"}, ioutil.Discard); err == nil {
+		t.Error("expected an error of an unknown format")
+	}
+	if err := runImport([]string{"-format", "json", path}, ioutil.Discard); err == nil {
+		t.Error("expected an error importing what is not JSON")
+	}
+}
@@ -0,0 +1,180 @@
+// Command merkle builds, compares and verifies the trees of files.
+//
+// Trees are stored in the serialized form of Tree.MarshalBinary, as sidecars
+// of the files they are of.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vbatts/merkle"
+)
+
+// command is a subcommand, run with the arguments after its name
+type command struct {
+	usage string
+	run   func(args []string, stdout io.Writer) error
+}
+
+// commands are set in init, as their flags refer back to their usage
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"diff":            {"diff [-json] OLD.tree NEW-FILE|NEW.tree", runDiff},
+		"dirhash":         {"dirhash [-prefix MODULE@VERSION] [-hash NAME] [-block-size SIZE] [-manifest FILE] DIR", runDirhash},
+		"export":          {"export [-format binary|cbor|dot|json|proto] [-o FILE] FILE.tree", runExport},
+		"import":          {"import [-format binary|cbor|json|proto] [-o FILE] EXPORTED", runImport},
+		"manifest":        {"manifest [-hash NAME] [-block-size SIZE] [-j N] [-o FILE] PATH...", runManifest},
+		"parity":          {"parity create [-data N] [-parity N] [-o FILE] FILE.tree FILE", runParity},
+		"proof":           {"proof -leaf N [-json] [-o FILE] FILE.tree", runProof},
+		"repair":          {"repair [-parity FILE] FILE.tree FILE", runRepair},
+		"serve":           {"serve [-store DIR] [-listen ADDR]", runServe},
+		"sum":             {"sum [-hash NAME] [-block-size SIZE] [-tree FILE] FILE...|-", runSum},
+		"torrent":         {"torrent create [-name NAME] [-piece-length SIZE] [-announce URL] [-o FILE] PATH... | torrent verify [-dir DIR] FILE.torrent", runTorrent},
+		"verify-manifest": {"verify-manifest [-root HEX] [-j N] MANIFEST", runVerifyManifest},
+		"verify-proof":    {"verify-proof -root HEX [-leaf N] [-block-size N] [-final-block POLICY] PROOF BLOCK", runVerifyProof},
+		"watch":           {"watch [-out DIR] [-hash NAME] [-block-size SIZE] [-interval DURATION] [-append-only] DIR", runWatch},
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "merkle %s: %s\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "usage:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "\tmerkle %s\n", commands[name].usage)
+	}
+}
+
+// newFlagSet returns the flags of a command, which report their errors rather
+// than exit
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("merkle "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: merkle %s\n", commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// treeMagic starts a serialized tree
+var treeMagic = []byte("MRKL")
+
+// readTree reads the serialized tree at path
+func readTree(path string) (*merkle.Tree, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var tree merkle.Tree
+	if _, err := tree.ReadFrom(f); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return &tree, nil
+}
+
+// isTree is whether the file at path is a serialized tree
+func isTree(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(treeMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(magic, treeMagic), nil
+}
+
+// hashFile builds the tree of the file at path, of the same hash, block
+// length and final block policy as like
+func hashFile(path string, like *merkle.Tree) (*merkle.Tree, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	b := merkle.NewBuilder(like.HashMaker(), like.BlockLength, merkle.WithFinalBlockPolicy(like.FinalBlock), merkle.WithEmptyRoot())
+	tree, _, err := b.Build(f, fi.Size())
+	return tree, err
+}
+
+// writeFile writes data to path, or to stdout for "-"
+func writeFile(path string, data []byte, stdout io.Writer) error {
+	if path == "-" {
+		_, err := stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// sizeFlag is a count of bytes, like "4096", "64KiB" or "1MiB"
+type sizeFlag int
+
+func (s *sizeFlag) String() string {
+	return strconv.Itoa(int(*s))
+}
+
+var sizeSuffixes = []struct {
+	suffix string
+	scale  int
+}{{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"B", 1}}
+
+func (s *sizeFlag) Set(value string) error {
+	number, scale := value, 1
+	for _, ss := range sizeSuffixes {
+		if strings.HasSuffix(value, ss.suffix) {
+			number, scale = strings.TrimSuffix(value, ss.suffix), ss.scale
+			break
+		}
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n <= 0 || n > int(^uint(0)>>1)/scale {
+		return fmt.Errorf("invalid size %q", value)
+	}
+	*s = sizeFlag(n * scale)
+	return nil
+}
+
+// lookupHash is the hash registered as name
+func lookupHash(name string) (merkle.HashMaker, error) {
+	hm, ok := merkle.LookupHash(name)
+	if !ok {
+		return nil, merkle.ErrUnknownHash{Name: name}
+	}
+	return hm, nil
+}
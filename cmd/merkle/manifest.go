@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/vbatts/merkle"
+)
+
+// manifest is the roots of files, and the root of a SuperTree over them in
+// the order listed
+type manifest struct {
+	Hash        string          `json:"hash"`
+	BlockLength int             `json:"blockLength"`
+	Root        string          `json:"root"`
+	Files       []manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	Path   string `json:"path"`
+	Length int64  `json:"length"`
+	Root   string `json:"root"`
+}
+
+func runManifest(args []string, stdout io.Writer) error {
+	fs := newFlagSet("manifest")
+	var (
+		hashName    = fs.String("hash", "sha256", "hash of the blocks")
+		jobs        = fs.Int("j", runtime.GOMAXPROCS(0), "count of files hashed at once")
+		out         = fs.String("o", "-", "file to write the manifest to")
+		blockLength = sizeFlag(1 << 20)
+	)
+	fs.Var(&blockLength, "block-size", "length of the blocks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected files or directories")
+	}
+	hm, err := lookupHash(*hashName)
+	if err != nil {
+		return err
+	}
+	paths, err := listFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	m := manifest{Hash: *hashName, BlockLength: int(blockLength), Files: make([]manifestEntry, len(paths))}
+	err = hashFiles(paths, *jobs, func(i int, path string) error {
+		tree, root, err := buildFile(path, hm, int(blockLength))
+		if err != nil {
+			return err
+		}
+		m.Files[i] = manifestEntry{Path: path, Length: tree.TotalLength(), Root: hex.EncodeToString(root)}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if m.Root, err = m.superRoot(hm); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(*out, append(data, '\n'), stdout)
+}
+
+func runVerifyManifest(args []string, stdout io.Writer) error {
+	fs := newFlagSet("verify-manifest")
+	var (
+		rootHex = fs.String("root", "", "hex encoded root the manifest must have")
+		jobs    = fs.Int("j", runtime.GOMAXPROCS(0), "count of files hashed at once")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected a manifest")
+	}
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("%s: %s", fs.Arg(0), err)
+	}
+	hm, err := lookupHash(m.Hash)
+	if err != nil {
+		return err
+	}
+	if m.BlockLength <= 0 {
+		return fmt.Errorf("%s: invalid block length %d", fs.Arg(0), m.BlockLength)
+	}
+	// the manifest is checked first, so the files are only trusted for a
+	// manifest of the root expected
+	root, err := m.superRoot(hm)
+	if err != nil {
+		return err
+	}
+	if !equalHex(root, m.Root) || (*rootHex != "" && !equalHex(root, *rootHex)) {
+		return fmt.Errorf("%s: manifest does not have the root expected", fs.Arg(0))
+	}
+
+	var (
+		mu     sync.Mutex
+		failed int
+		paths  = make([]string, len(m.Files))
+		status = make([]string, len(m.Files))
+	)
+	for i, f := range m.Files {
+		paths[i] = f.Path
+	}
+	hashFiles(paths, *jobs, func(i int, path string) error {
+		_, sum, err := buildFile(path, hm, m.BlockLength)
+		switch {
+		case err != nil:
+			status[i] = fmt.Sprintf("FAILED %s: %s", path, err)
+		case !equalHex(hex.EncodeToString(sum), m.Files[i].Root):
+			status[i] = "FAILED " + path
+		default:
+			status[i] = "OK " + path
+			return nil
+		}
+		mu.Lock()
+		failed++
+		mu.Unlock()
+		return nil
+	})
+	for _, s := range status {
+		fmt.Fprintln(stdout, s)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, len(m.Files))
+	}
+	return nil
+}
+
+// superRoot is the hex encoded root of the SuperTree of the roots of the files
+func (m manifest) superRoot(hm merkle.HashMaker) (string, error) {
+	if len(m.Files) == 0 {
+		return "", fmt.Errorf("manifest of no files")
+	}
+	st := merkle.NewSuperTree(hm)
+	for _, f := range m.Files {
+		root, err := hex.DecodeString(f.Root)
+		if err != nil || len(root) != hm().Size() {
+			return "", fmt.Errorf("%s: invalid root %q", f.Path, f.Root)
+		}
+		st.AddRoot(f.Path, root)
+	}
+	root, err := st.Root()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(root), nil
+}
+
+// listFiles is the regular files of paths, and under the directories of
+// paths, in the order of paths and then sorted within each directory
+func listFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		var found []string
+		err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.Mode().IsRegular() {
+				found = append(found, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// hashFiles calls fn for each of paths, on as many as jobs goroutines, and
+// returns the first error
+func hashFiles(paths []string, jobs int, fn func(i int, path string) error) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+	var (
+		next  = make(chan int)
+		errs  = make(chan error, len(paths))
+		wg    sync.WaitGroup
+		first error
+	)
+	for j := 0; j < jobs; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs <- fn(i, paths[i])
+			}
+		}()
+	}
+	for i := range paths {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// buildFile is the tree and root of the file at path, with the root of an
+// empty file the checksum of no bytes
+func buildFile(path string, hm merkle.HashMaker, blockLength int) (*merkle.Tree, []byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	return merkle.NewBuilder(hm, blockLength, merkle.WithEmptyRoot()).Build(f, fi.Size())
+}
+
+// equalHex is whether the hex strings are of the same bytes
+func equalHex(a, b string) bool {
+	x, err := hex.DecodeString(a)
+	if err != nil {
+		return false
+	}
+	y, err := hex.DecodeString(b)
+	return err == nil && bytes.Equal(x, y)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkle-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"a":   bytes.Repeat([]byte("a"), 100),
+		"d/b": bytes.Repeat([]byte("b"), 1000),
+		"d/c": nil,
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "manifest.json")
+	args := []string{"-block-size", "64", "-j", "2", "-o", path, filepath.Join(dir, "a"), filepath.Join(dir, "d")}
+	if err := runManifest(args, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 3 || m.Files[1].Path != filepath.Join(dir, "d/b") || m.Files[1].Length != 1000 || m.Root == "" {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+
+	var out bytes.Buffer
+	if err := runVerifyManifest([]string{"-root", m.Root, path}, &out); err != nil {
+		t.Fatalf("%s: %s", err, out.String())
+	}
+	if strings.Count(out.String(), "OK ") != 3 {
+		t.Errorf("expected 3 files OK, got %q", out.String())
+	}
+
+	// a changed file fails alone
+	if err := ioutil.WriteFile(filepath.Join(dir, "d/b"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := runVerifyManifest([]string{path}, &out); err == nil {
+		t.Errorf("expected a changed file to fail")
+	}
+	if !strings.Contains(out.String(), "FAILED "+filepath.Join(dir, "d/b")) || strings.Count(out.String(), "OK ") != 2 {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	// as does a manifest of a root other than the one expected
+	if err := runVerifyManifest([]string{"-root", strings.Repeat("00", 32), path}, ioutil.Discard); err == nil {
+		t.Errorf("expected a manifest of another root to fail")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParityRepair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkle-parity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 10)
+	data = append(data, "tail"...)
+	path := writeTree(t, dir, "file", data, 16)
+	if err := runParity([]string{"create", "-data", "4", "-parity", "2", path + ".tree", path}, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	// corrupt blocks 1 and 5, and cut the last block short
+	corrupt := append([]byte(nil), data[:len(data)-2]...)
+	corrupt[20] = 'X'
+	corrupt[90] = 'X'
+	if err := ioutil.WriteFile(path, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := runRepair([]string{path + ".tree", path}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "repaired block 1\nrepaired block 10\nrepaired block 5\nOK\n"; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+	if got, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("expected the file repaired, got %v", err)
+	}
+
+	if err := runParity([]string{"create", path + ".tree", path + ".parity"}, ioutil.Discard); err == nil {
+		t.Error("expected parity of a file other than that of the tree to fail")
+	}
+	if err := runParity([]string{path + ".tree", path}, ioutil.Discard); err == nil {
+		t.Error("expected an error without the create subcommand")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/vbatts/merkle"
+)
+
+// proofDoc is the JSON form of a proof, with the parameters of its tree to
+// hash a final short block by. The binary form is of the proof alone.
+type proofDoc struct {
+	BlockLength int                     `json:"blockLength"`
+	FinalBlock  merkle.FinalBlockPolicy `json:"finalBlock"`
+	Proof       *merkle.PartialTree     `json:"proof"`
+}
+
+func runProof(args []string, stdout io.Writer) error {
+	fs := newFlagSet("proof")
+	var (
+		leaf   = fs.Int("leaf", -1, "index of the leaf to prove")
+		asJSON = fs.Bool("json", false, "write the proof as JSON, rather than binary")
+		out    = fs.String("o", "-", "file to write the proof to")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *leaf < 0 {
+		fs.Usage()
+		return fmt.Errorf("expected a tree, and the -leaf to prove")
+	}
+	tree, err := readTree(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	p, err := tree.Partial(*leaf)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if *asJSON {
+		data, err = json.MarshalIndent(proofDoc{BlockLength: tree.BlockLength, FinalBlock: tree.FinalBlock, Proof: p}, "", "  ")
+		data = append(data, '\n')
+	} else {
+		data, err = p.MarshalBinary()
+	}
+	if err != nil {
+		return err
+	}
+	return writeFile(*out, data, stdout)
+}
+
+func runVerifyProof(args []string, stdout io.Writer) error {
+	fs := newFlagSet("verify-proof")
+	var (
+		rootHex     = fs.String("root", "", "hex encoded root to verify against")
+		leaf        = fs.Int("leaf", -1, "index of the leaf of the block, if the proof is of more than one")
+		blockLength = fs.Int("block-size", 0, "block length of the tree, for a final short block of a binary proof")
+		finalBlock  = fs.String("final-block", "", "final block policy of the tree, for a final short block of a binary proof")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 || *rootHex == "" {
+		fs.Usage()
+		return fmt.Errorf("expected the -root, a proof and a block")
+	}
+	root, err := hex.DecodeString(*rootHex)
+	if err != nil {
+		return fmt.Errorf("root: %s", err)
+	}
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	doc := proofDoc{Proof: &merkle.PartialTree{}}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		err = doc.Proof.UnmarshalBinary(data)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s", fs.Arg(0), err)
+	}
+	if *blockLength > 0 {
+		doc.BlockLength = *blockLength
+	}
+	if *finalBlock != "" {
+		if err := doc.FinalBlock.UnmarshalText([]byte(*finalBlock)); err != nil {
+			return err
+		}
+	}
+	block, err := ioutil.ReadFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if err := verifyBlockProof(doc, *leaf, block, root); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "OK")
+	return nil
+}
+
+// verifyBlockProof checks that block is the leaf at index of the proof, and
+// the proof of the tree of root
+func verifyBlockProof(doc proofDoc, index int, block, root []byte) error {
+	p := doc.Proof
+	if index < 0 {
+		if len(p.Indexes) != 1 {
+			return fmt.Errorf("proof is of %d leaves, choose one with -leaf", len(p.Indexes))
+		}
+		index = p.Indexes[0]
+	}
+	expected, ok := p.Leaf(index)
+	if !ok {
+		return fmt.Errorf("proof is not of leaf %d", index)
+	}
+	var (
+		hm  = p.HashMaker()
+		n   *merkle.Node
+		err error
+	)
+	if index == p.TreeSize-1 {
+		n, err = doc.FinalBlock.NewNode(hm, doc.BlockLength, block)
+	} else {
+		n, err = merkle.NewNodeHashBlock(hm, block)
+	}
+	if err != nil {
+		return err
+	}
+	sum, err := n.Checksum()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sum, expected) {
+		return fmt.Errorf("block does not match leaf %d of the proof", index)
+	}
+	return p.Verify(root)
+}
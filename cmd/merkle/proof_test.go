@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestProof(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkle-proof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 10)
+	data = append(data, "tail"...)
+	path := writeTree(t, dir, "file", data, 16)
+	tree, err := readTree(path + ".tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := tree.RootChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := hex.EncodeToString(sum)
+
+	blocks := map[int][]byte{3: data[48:64], 10: data[160:]}
+	for index, block := range blocks {
+		blockPath := filepath.Join(dir, "block")
+		if err := ioutil.WriteFile(blockPath, block, 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, format := range [][]string{nil, {"-json"}} {
+			proofPath := filepath.Join(dir, "proof")
+			args := append([]string{"-leaf", strconv.Itoa(index), "-o", proofPath}, format...)
+			if err := runProof(append(args, path+".tree"), ioutil.Discard); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err := runVerifyProof([]string{"-root", root, proofPath, blockPath}, &out); err != nil {
+				t.Errorf("leaf %d %v: %s", index, format, err)
+			} else if out.String() != "OK\n" {
+				t.Errorf("expected OK, got %q", out.String())
+			}
+			if err := runVerifyProof([]string{"-root", root, proofPath, path}, ioutil.Discard); err == nil {
+				t.Errorf("leaf %d %v: expected the whole file not to verify as the block", index, format)
+			}
+			other := "ff" + root[2:]
+			if root[:2] == "ff" {
+				other = "00" + root[2:]
+			}
+			if err := runVerifyProof([]string{"-root", other, proofPath, blockPath}, ioutil.Discard); err == nil {
+				t.Errorf("leaf %d %v: expected another root not to verify", index, format)
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vbatts/merkle"
+)
+
+func runServe(args []string, stdout io.Writer) error {
+	fs := newFlagSet("serve")
+	var (
+		store  = fs.String("store", ".", "directory of serialized trees")
+		listen = fs.String("listen", ":8080", "address to listen on")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected arguments")
+	}
+	if fi, err := os.Stat(*store); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", *store)
+	}
+	fmt.Fprintf(stdout, "serving the trees of %s on %s\n", *store, *listen)
+	return http.ListenAndServe(*listen, newStoreHandler(*store))
+}
+
+// treeInfo is the root of a tree, and the parameters it was built with
+type treeInfo struct {
+	Name        string                  `json:"name"`
+	Root        string                  `json:"root"`
+	Hash        string                  `json:"hash"`
+	BlockLength int                     `json:"blockLength"`
+	FinalBlock  merkle.FinalBlockPolicy `json:"finalBlock"`
+	Length      int64                   `json:"length"`
+	Leaves      int                     `json:"leaves"`
+}
+
+// newStoreHandler serves the trees in the directory store, read as they are
+// requested, so trees added or replaced are served without a restart:
+//
+//	GET /trees                         names of the trees
+//	GET /trees/NAME                    the serialized tree
+//	GET /trees/NAME/root               treeInfo, as JSON
+//	GET /trees/NAME/proof?index=N      Proof of the leaf N, as JSON
+func newStoreHandler(store string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if parts[0] != "trees" || len(parts) > 3 {
+			http.NotFound(w, r)
+			return
+		}
+		if len(parts) == 1 {
+			serveList(w, store)
+			return
+		}
+		name := parts[1]
+		if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+			http.Error(w, "invalid tree name", http.StatusBadRequest)
+			return
+		}
+		path := filepath.Join(store, name)
+		if fi, err := os.Stat(path); err != nil || !fi.Mode().IsRegular() {
+			http.NotFound(w, r)
+			return
+		}
+		if len(parts) == 2 {
+			w.Header().Set("Content-Type", merkle.MediaTypeTree)
+			http.ServeFile(w, r, path)
+			return
+		}
+		tree, err := readTree(path)
+		if err != nil {
+			log.Printf("%s: %s", name, err)
+			http.Error(w, "can not read tree", http.StatusInternalServerError)
+			return
+		}
+		switch parts[2] {
+		case "root":
+			info, err := newTreeInfo(name, tree)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, info)
+		case "proof":
+			index, err := strconv.Atoi(r.URL.Query().Get("index"))
+			if err != nil {
+				http.Error(w, "invalid index", http.StatusBadRequest)
+				return
+			}
+			proof, err := tree.InclusionProof(index)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			writeJSON(w, proof)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func serveList(w http.ResponseWriter, store string) {
+	infos, err := ioutil.ReadDir(store)
+	if err != nil {
+		log.Printf("%s: %s", store, err)
+		http.Error(w, "can not list trees", http.StatusInternalServerError)
+		return
+	}
+	names := []string{}
+	for _, fi := range infos {
+		if fi.Mode().IsRegular() {
+			if ok, err := isTree(filepath.Join(store, fi.Name())); err == nil && ok {
+				names = append(names, fi.Name())
+			}
+		}
+	}
+	writeJSON(w, names)
+}
+
+func newTreeInfo(name string, tree *merkle.Tree) (treeInfo, error) {
+	hash, err := merkle.HashName(tree.HashMaker())
+	if err != nil {
+		return treeInfo{}, err
+	}
+	root, err := tree.RootChecksum()
+	if err != nil {
+		return treeInfo{}, err
+	}
+	return treeInfo{
+		Name:        name,
+		Root:        hex.EncodeToString(root),
+		Hash:        hash,
+		BlockLength: tree.BlockLength,
+		FinalBlock:  tree.FinalBlock,
+		Length:      tree.TotalLength(),
+		Leaves:      len(tree.Nodes),
+	}, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/vbatts/merkle"
+)
+
+func TestServe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkle-serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := bytes.Repeat([]byte("0123456789abcdef"), 10)
+	path := writeTree(t, dir, "file", data, 16)
+	tree, err := readTree(path + ".tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(newStoreHandler(dir))
+	defer srv.Close()
+	get := func(path string, v interface{}) int {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusOK && v != nil {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("%s: %s", path, err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	var names []string
+	if get("/trees", &names); len(names) != 1 || names[0] != "file.tree" {
+		t.Errorf("expected only file.tree listed, got %v", names)
+	}
+	var info treeInfo
+	if status := get("/trees/file.tree/root", &info); status != http.StatusOK {
+		t.Fatalf("expected the root, got %d", status)
+	}
+	if expected, _ := newTreeInfo("file.tree", tree); info != expected {
+		t.Errorf("expected %v, got %v", expected, info)
+	}
+	var proof merkle.Proof
+	if status := get("/trees/file.tree/proof?index=4", &proof); status != http.StatusOK {
+		t.Fatalf("expected a proof, got %d", status)
+	}
+	if expected, _ := tree.InclusionProof(4); proof.Index != 4 || len(proof.Path) != len(expected.Path) {
+		t.Errorf("expected the proof %v, got %v", expected, proof)
+	}
+
+	for path, expected := range map[string]int{
+		"/trees/file.tree":                http.StatusOK,
+		"/trees/file.tree/proof?index=10": http.StatusNotFound,
+		"/trees/file.tree/proof?index=x":  http.StatusBadRequest,
+		"/trees/missing.tree/root":        http.StatusNotFound,
+		"/trees/../file.tree/root":        http.StatusNotFound,
+		"/trees/file/root":                http.StatusInternalServerError,
+		"/other":                          http.StatusNotFound,
+	} {
+		if status := get(path, nil); status != expected {
+			t.Errorf("%s: expected %d, got %d", path, expected, status)
+		}
+	}
+}
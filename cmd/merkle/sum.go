@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vbatts/merkle"
+)
+
+func runSum(args []string, stdout io.Writer) error {
+	return sum(args, os.Stdin, stdout)
+}
+
+// sum prints the root of each file, as sha256sum does its digest, with "-"
+// for stdin
+func sum(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("sum")
+	var (
+		hashName    = fs.String("hash", "sha256", "hash of the blocks")
+		treePath    = fs.String("tree", "", "file to write the serialized tree to, of a single input, or - for stdout in place of the root")
+		blockLength = sizeFlag(1 << 20)
+	)
+	fs.Var(&blockLength, "block-size", "length of the blocks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected files, or - for stdin")
+	}
+	if *treePath != "" && fs.NArg() != 1 {
+		return fmt.Errorf("-tree is of a single input")
+	}
+	hm, err := lookupHash(*hashName)
+	if err != nil {
+		return err
+	}
+	for _, name := range fs.Args() {
+		tree, root, err := sumInput(name, stdin, hm, int(blockLength))
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		if *treePath != "" {
+			data, err := tree.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			if err := writeFile(*treePath, data, stdout); err != nil {
+				return err
+			}
+			if *treePath == "-" {
+				// the root is of the tree, and a line after it would corrupt it
+				continue
+			}
+		}
+		fmt.Fprintf(stdout, "%s  %s\n", hex.EncodeToString(root), name)
+	}
+	return nil
+}
+
+// sumInput streams the file name, or stdin for "-", as the input may be
+// produced on the fly
+func sumInput(name string, stdin io.Reader, hm merkle.HashMaker, blockLength int) (*merkle.Tree, []byte, error) {
+	r := stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	b := merkle.NewBuilder(hm, blockLength, merkle.WithEmptyRoot())
+	if _, err := io.Copy(b, r); err != nil {
+		return nil, nil, err
+	}
+	return b.Finalize()
+}
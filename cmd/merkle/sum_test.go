@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vbatts/merkle"
+)
+
+func TestSumStdin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkle-sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := bytes.Repeat([]byte("streamed "), 1000)
+	expected, err := merkle.SumOf(merkle.DefaultHashMaker, 1024, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := expected.RootChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	treePath := filepath.Join(dir, "out.mtree")
+	var out bytes.Buffer
+	args := []string{"--hash", "sha1", "--block-size", "1KiB", "--tree", treePath, "-"}
+	if err := sum(args, bytes.NewReader(data), &out); err != nil {
+		t.Fatal(err)
+	}
+	if line := fmt.Sprintf("%s  -\n", hex.EncodeToString(root)); out.String() != line {
+		t.Errorf("expected %q, got %q", line, out.String())
+	}
+	tree, err := readTree(treePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tree.Equal(expected) {
+		t.Errorf("expected the tree of the input written")
+	}
+
+	// a tree to stdout is all of the output
+	out.Reset()
+	if err := sum([]string{"--hash", "sha1", "--block-size", "1KiB", "--tree", "-", "-"}, bytes.NewReader(data), &out); err != nil {
+		t.Fatal(err)
+	}
+	var streamed merkle.Tree
+	if err := streamed.UnmarshalBinary(out.Bytes()); err != nil || !streamed.Equal(expected) {
+		t.Errorf("expected only the tree of the input on stdout, got %v", err)
+	}
+
+	if err := sum([]string{"-tree", treePath, "a", "b"}, nil, ioutil.Discard); err == nil {
+		t.Errorf("expected -tree of more than one input to fail")
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vbatts/merkle"
+)
+
+func runTorrent(args []string, stdout io.Writer) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "create":
+			return runTorrentCreate(args[1:], stdout)
+		case "verify":
+			return runTorrentVerify(args[1:], stdout)
+		}
+	}
+	newFlagSet("torrent").Usage()
+	return fmt.Errorf("expected the create or verify subcommand")
+}
+
+// torrentFile is a file of a torrent, by the elements of its path in the
+// torrent
+type torrentFile struct {
+	path   []string
+	source string
+}
+
+func runTorrentCreate(args []string, stdout io.Writer) error {
+	fs := newFlagSet("torrent")
+	var (
+		name        = fs.String("name", "", "name of the torrent (default the name of the file or directory)")
+		out         = fs.String("o", "", "file to write the torrent to (default NAME.torrent)")
+		announce    = fs.String("announce", "", "URL of the tracker")
+		pieceLength = sizeFlag(256 << 10)
+	)
+	fs.Var(&pieceLength, "piece-length", "length of the pieces, a power of two of at least 16KiB")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected files or directories")
+	}
+	if pieceLength < merkle.BitTorrentBlockLength || pieceLength&(pieceLength-1) != 0 {
+		return fmt.Errorf("invalid piece length %d", pieceLength)
+	}
+	files, err := torrentFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	if *name == "" {
+		if fs.NArg() > 1 {
+			return fmt.Errorf("a torrent of more than one path needs a -name")
+		}
+		*name = filepath.Base(filepath.Clean(fs.Arg(0)))
+	}
+
+	var (
+		fileTree = map[string]interface{}{}
+		layers   = map[string]interface{}{}
+	)
+	for _, f := range files {
+		entry, layer, err := torrentEntry(f.source, int(pieceLength))
+		if err != nil {
+			return err
+		}
+		if layer != nil {
+			layers[entry["pieces root"].(string)] = string(layer)
+		}
+		if err := addTorrentEntry(fileTree, f.path, entry); err != nil {
+			return err
+		}
+	}
+	info := map[string]interface{}{
+		"name":         *name,
+		"piece length": int(pieceLength),
+		"meta version": 2,
+		"file tree":    fileTree,
+	}
+	torrent := map[string]interface{}{
+		"info":          info,
+		"piece layers":  layers,
+		"creation date": time.Now().Unix(),
+		"created by":    "merkle",
+	}
+	if *announce != "" {
+		torrent["announce"] = *announce
+	}
+	var buf bytes.Buffer
+	if err := bencode(&buf, torrent); err != nil {
+		return err
+	}
+	infoHash, err := torrentInfoHash(info)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = *name + ".torrent"
+	}
+	if err := writeFile(*out, buf.Bytes(), stdout); err != nil {
+		return err
+	}
+	if *out != "-" {
+		fmt.Fprintf(stdout, "%x  %s\n", infoHash, *out)
+	}
+	return nil
+}
+
+// torrentFiles is the files of paths, by their paths in the torrent. A single
+// file is the one file of its torrent, and the files of a single directory are
+// of paths under it. Paths of more than one file or directory are each under
+// the torrent by their names.
+func torrentFiles(paths []string) ([]torrentFile, error) {
+	var files []torrentFile
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		found, err := listFiles([]string{path})
+		if err != nil {
+			return nil, err
+		}
+		base := filepath.Dir(path)
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() && len(paths) == 1 {
+			base = path
+		}
+		for _, f := range found {
+			rel, err := filepath.Rel(base, f)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, torrentFile{path: strings.Split(filepath.ToSlash(rel), "/"), source: f})
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files")
+	}
+	return files, nil
+}
+
+// torrentEntry is the file tree entry of the file at path, and its piece
+// layer, nil for files of no more than a piece
+func torrentEntry(path string, pieceLength int) (map[string]interface{}, []byte, error) {
+	tree, err := bitTorrentFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry := map[string]interface{}{"length": tree.TotalLength()}
+	if tree.TotalLength() == 0 {
+		return entry, nil, nil
+	}
+	root, err := tree.BitTorrentPiecesRoot()
+	if err != nil {
+		return nil, nil, err
+	}
+	entry["pieces root"] = string(root)
+	if tree.TotalLength() <= int64(pieceLength) {
+		return entry, nil, nil
+	}
+	layer, err := tree.BitTorrentPieceLayer(pieceLength)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry, layer, nil
+}
+
+func bitTorrentFile(path string) (*merkle.Tree, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return merkle.BitTorrentTree(f)
+}
+
+// addTorrentEntry adds the entry of a file to the file tree, under the
+// elements of its path, with the entry itself keyed by ""
+func addTorrentEntry(fileTree map[string]interface{}, path []string, entry map[string]interface{}) error {
+	dir := fileTree
+	for _, elem := range path[:len(path)-1] {
+		next, ok := dir[elem].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			dir[elem] = next
+		}
+		dir = next
+	}
+	last := path[len(path)-1]
+	if _, ok := dir[last]; ok {
+		return fmt.Errorf("%s is in the torrent twice", strings.Join(path, "/"))
+	}
+	dir[last] = map[string]interface{}{"": entry}
+	return nil
+}
+
+// torrentInfoHash is the BitTorrent v2 info hash, the sha256 of the bencoded
+// info dictionary
+func torrentInfoHash(info map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := bencode(&buf, info); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return sum[:], nil
+}
+
+func runTorrentVerify(args []string, stdout io.Writer) error {
+	fs := newFlagSet("torrent")
+	dir := fs.String("dir", ".", "directory the content of the torrent is in")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected a torrent")
+	}
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	v, err := bdecode(data)
+	if err != nil {
+		return fmt.Errorf("%s: %s", fs.Arg(0), err)
+	}
+	torrent, _ := v.(map[string]interface{})
+	info, _ := torrent["info"].(map[string]interface{})
+	var (
+		name, _        = info["name"].(string)
+		pieceLength, _ = info["piece length"].(int64)
+		version, _     = info["meta version"].(int64)
+		fileTree, _    = info["file tree"].(map[string]interface{})
+		layers, _      = torrent["piece layers"].(map[string]interface{})
+	)
+	if version != 2 || fileTree == nil || name == "" || pieceLength < merkle.BitTorrentBlockLength || pieceLength&(pieceLength-1) != 0 {
+		return fmt.Errorf("%s: not a BitTorrent v2 torrent", fs.Arg(0))
+	}
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("%s: invalid name %q", fs.Arg(0), name)
+	}
+
+	entries := map[string]map[string]interface{}{}
+	if err := walkTorrentTree(fileTree, nil, entries); err != nil {
+		return fmt.Errorf("%s: %s", fs.Arg(0), err)
+	}
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	// a torrent of a single file of its name is of the file itself, rather
+	// than a directory
+	root := filepath.Join(*dir, name)
+	if len(paths) == 1 && paths[0] == name {
+		root = *dir
+	}
+	failed := 0
+	for _, path := range paths {
+		err := verifyTorrentFile(filepath.Join(root, filepath.FromSlash(path)), entries[path], layers, int(pieceLength))
+		if err != nil {
+			fmt.Fprintf(stdout, "FAILED %s: %s\n", path, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(stdout, "OK %s\n", path)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, len(paths))
+	}
+	return nil
+}
+
+// walkTorrentTree collects the entries of the files of a file tree, by their
+// slash separated paths
+func walkTorrentTree(dir map[string]interface{}, path []string, entries map[string]map[string]interface{}) error {
+	for elem, v := range dir {
+		node, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid file tree")
+		}
+		if elem == "" {
+			if len(path) == 0 {
+				return fmt.Errorf("invalid file tree")
+			}
+			entries[strings.Join(path, "/")] = node
+			continue
+		}
+		if elem == "." || elem == ".." || strings.ContainsAny(elem, `/\`) {
+			return fmt.Errorf("invalid path element %q", elem)
+		}
+		if err := walkTorrentTree(node, append(path[:len(path):len(path)], elem), entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyTorrentFile checks the file at path against its entry, and its piece
+// layer
+func verifyTorrentFile(path string, entry map[string]interface{}, layers map[string]interface{}, pieceLength int) error {
+	length, _ := entry["length"].(int64)
+	got, layer, err := torrentEntry(path, pieceLength)
+	if err != nil {
+		return err
+	}
+	if n := got["length"].(int64); n != length {
+		return fmt.Errorf("length %d, expected %d", n, length)
+	}
+	if length == 0 {
+		return nil
+	}
+	root, _ := entry["pieces root"].(string)
+	if root != got["pieces root"] {
+		return fmt.Errorf("pieces root %s does not match", hex.EncodeToString([]byte(root)))
+	}
+	if layer != nil {
+		if expected, _ := layers[root].(string); expected != string(layer) {
+			return fmt.Errorf("piece layer does not match")
+		}
+	}
+	return nil
+}
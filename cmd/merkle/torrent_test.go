@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vbatts/merkle"
+)
+
+func TestTorrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkle-torrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := filepath.Join(dir, "content")
+	if err := os.MkdirAll(filepath.Join(content, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 5*merkle.BitTorrentBlockLength+100)
+	rand.New(rand.NewSource(6)).Read(data)
+	files := map[string][]byte{"big": data, "sub/small": []byte("small"), "empty": nil}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(content, filepath.FromSlash(name)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a torrent of the directory, with a piece layer of the big file
+	torrentPath := filepath.Join(dir, "content.torrent")
+	if err := runTorrent([]string{"create", "-piece-length", "32KiB", "-o", torrentPath, content}, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := ioutil.ReadFile(torrentPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := bdecode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	torrent := v.(map[string]interface{})
+	if layers := torrent["piece layers"].(map[string]interface{}); len(layers) != 1 {
+		t.Errorf("expected the piece layer of one file, got %d", len(layers))
+	}
+	info := torrent["info"].(map[string]interface{})
+	if info["name"] != "content" || info["meta version"] != int64(2) {
+		t.Errorf("unexpected info %v", info)
+	}
+	if _, ok := info["file tree"].(map[string]interface{})["sub"].(map[string]interface{})["small"]; !ok {
+		t.Error("expected sub/small in the file tree")
+	}
+
+	var out bytes.Buffer
+	if err := runTorrent([]string{"verify", "-dir", dir, torrentPath}, &out); err != nil {
+		t.Fatalf("%s: %s", err, out.String())
+	}
+	if expected := "OK big\nOK empty\nOK sub/small\n"; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+
+	data[merkle.BitTorrentBlockLength*3]++
+	if err := ioutil.WriteFile(filepath.Join(content, "big"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := runTorrent([]string{"verify", "-dir", dir, torrentPath}, &out); err == nil || !strings.HasPrefix(out.String(), "FAILED big") {
+		t.Errorf("expected the corrupt file to fail, got %v %q", err, out.String())
+	}
+
+	// a torrent of a single file is of the file, not a directory
+	out.Reset()
+	single := filepath.Join(dir, "small.torrent")
+	if err := runTorrent([]string{"create", "-o", single, filepath.Join(content, "sub", "small")}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out.String(), "  "+single+"\n") || len(strings.Fields(out.String())[0]) != 64 {
+		t.Errorf("expected the info hash of the torrent, got %q", out.String())
+	}
+	out.Reset()
+	if err := runTorrent([]string{"verify", "-dir", filepath.Join(content, "sub"), single}, &out); err != nil || out.String() != "OK small\n" {
+		t.Errorf("expected the single file to verify, got %v %q", err, out.String())
+	}
+
+	if err := runTorrent([]string{"create", "-piece-length", "48KiB", content}, ioutil.Discard); err == nil {
+		t.Error("expected an error of a piece length not a power of two")
+	}
+	if err := runTorrent([]string{"create", content, torrentPath}, ioutil.Discard); err == nil {
+		t.Error("expected an error of more than one path without a name")
+	}
+}
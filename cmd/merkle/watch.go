@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vbatts/merkle"
+)
+
+func runWatch(args []string, stdout io.Writer) error {
+	fs := newFlagSet("watch")
+	var (
+		out         = fs.String("out", "", "directory of the tree sidecars (default DIR.trees)")
+		hashName    = fs.String("hash", "sha256", "hash of the blocks")
+		interval    = fs.Duration("interval", 2*time.Second, "time between scans of DIR")
+		appendOnly  = fs.Bool("append-only", false, "treat files that grow as appended to, re-reading only their new blocks")
+		blockLength = sizeFlag(1 << 20)
+	)
+	fs.Var(&blockLength, "block-size", "length of the blocks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected a directory to watch")
+	}
+	hm, err := lookupHash(*hashName)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Clean(fs.Arg(0))
+	if *out == "" {
+		*out = dir + ".trees"
+	}
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		return err
+	}
+	w := newWatcher(dir, *out, hm, int(blockLength), stdout)
+	w.appendOnly = *appendOnly
+	for {
+		if err := w.scan(); err != nil {
+			return err
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// watcher keeps a tree sidecar, in out, of each file under dir
+type watcher struct {
+	dir, out    string
+	hm          merkle.HashMaker
+	blockLength int
+	appendOnly  bool
+	stdout      io.Writer
+
+	files map[string]*watched // by path relative to dir
+}
+
+// watched is a file as of its last scan, and its tree
+type watched struct {
+	modTime time.Time
+	size    int64
+	tree    *merkle.Tree
+}
+
+func newWatcher(dir, out string, hm merkle.HashMaker, blockLength int, stdout io.Writer) *watcher {
+	return &watcher{
+		dir:         filepath.Clean(dir),
+		out:         filepath.Clean(out),
+		hm:          hm,
+		blockLength: blockLength,
+		stdout:      stdout,
+		files:       map[string]*watched{},
+	}
+}
+
+// scan updates the sidecars of the files changed since the last scan, and
+// removes those of files removed. Empty files have no tree, so no sidecar.
+func (w *watcher) scan() error {
+	seen := map[string]bool{}
+	err := filepath.Walk(w.dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() && path == w.out {
+			return filepath.SkipDir
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(w.dir, path)
+		if err != nil {
+			return err
+		}
+		if fi.Size() > 0 {
+			seen[rel] = true
+		}
+		return w.update(rel, fi)
+	})
+	if err != nil {
+		return err
+	}
+	for rel := range w.files {
+		if !seen[rel] {
+			delete(w.files, rel)
+			if err := os.Remove(w.sidecar(rel)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			fmt.Fprintf(w.stdout, "removed %s\n", rel)
+		}
+	}
+	return nil
+}
+
+func (w *watcher) sidecar(rel string) string {
+	return filepath.Join(w.out, rel+".tree")
+}
+
+// update rehashes the file at rel, if it changed since it was last seen
+func (w *watcher) update(rel string, fi os.FileInfo) error {
+	st := w.files[rel]
+	if st == nil {
+		st = w.load(rel, fi)
+	}
+	if st != nil && st.modTime.Equal(fi.ModTime()) && st.size == fi.Size() {
+		return nil
+	}
+	if fi.Size() == 0 {
+		return nil
+	}
+	f, err := os.Open(filepath.Join(w.dir, rel))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var tree *merkle.Tree
+	if st == nil {
+		if tree, _, err = merkle.NewBuilder(w.hm, w.blockLength).Build(f, fi.Size()); err != nil {
+			return err
+		}
+	} else {
+		var dirty []int
+		if w.appendOnly && fi.Size() >= st.size {
+			dirty = []int{}
+		}
+		tree = st.tree
+		changed, err := tree.Rehash(f, fi.Size(), dirty)
+		if err != nil {
+			return err
+		}
+		if len(changed) == 0 && fi.Size() == st.size {
+			// touched, not changed, so the sidecar is as new as the file
+			st.modTime = fi.ModTime()
+			now := time.Now()
+			return os.Chtimes(w.sidecar(rel), now, now)
+		}
+	}
+	if err := w.write(rel, tree); err != nil {
+		return err
+	}
+	w.files[rel] = &watched{modTime: fi.ModTime(), size: fi.Size(), tree: tree}
+	root, err := rootHex(tree)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w.stdout, "updated %s %s\n", rel, root)
+	return nil
+}
+
+// load is the sidecar of a file not yet seen, if it is newer than the file and
+// of the same parameters, so restarting does not rehash every file
+func (w *watcher) load(rel string, fi os.FileInfo) *watched {
+	sfi, err := os.Stat(w.sidecar(rel))
+	if err != nil || sfi.ModTime().Before(fi.ModTime()) {
+		return nil
+	}
+	tree, err := readTree(w.sidecar(rel))
+	if err != nil || tree.BlockLength != w.blockLength || tree.TotalLength() != fi.Size() {
+		return nil
+	}
+	if name, err := merkle.HashName(tree.HashMaker()); err != nil || name != w.hashName() {
+		return nil
+	}
+	st := &watched{modTime: fi.ModTime(), size: fi.Size(), tree: tree}
+	w.files[rel] = st
+	return st
+}
+
+func (w *watcher) hashName() string {
+	name, _ := merkle.HashName(w.hm)
+	return name
+}
+
+// write replaces the sidecar of rel with tree, whole
+func (w *watcher) write(rel string, tree *merkle.Tree) error {
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	path := w.sidecar(rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vbatts/merkle"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkle-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var (
+		src  = filepath.Join(dir, "src")
+		out  = filepath.Join(dir, "src.trees")
+		hm   = merkle.DefaultHashMaker
+		logs bytes.Buffer
+	)
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name string, data []byte, mtime time.Time) {
+		path := filepath.Join(src, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		// so a change is seen regardless of the resolution of the clock
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(name string, data []byte) {
+		tree, err := readTree(filepath.Join(out, name+".tree"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := merkle.SumOf(hm, 16, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tree.Equal(expected) {
+			t.Errorf("%s: sidecar is not the tree of the file", name)
+		}
+	}
+
+	then := time.Now().Add(-time.Hour)
+	a := bytes.Repeat([]byte("0123456789abcdef"), 8)
+	write("a", a, then)
+	write("sub/b", []byte("bbbb"), then)
+	w := newWatcher(src, out, hm, 16, &logs)
+	if err := w.scan(); err != nil {
+		t.Fatal(err)
+	}
+	check("a", a)
+	check("sub/b", []byte("bbbb"))
+
+	a = append(a, "appended"...)
+	a[3] = 'X'
+	write("a", a, then.Add(time.Minute))
+	if err := os.Remove(filepath.Join(src, "sub/b")); err != nil {
+		t.Fatal(err)
+	}
+	logs.Reset()
+	if err := w.scan(); err != nil {
+		t.Fatal(err)
+	}
+	check("a", a)
+	if _, err := os.Stat(filepath.Join(out, "sub/b.tree")); !os.IsNotExist(err) {
+		t.Errorf("expected the sidecar of a removed file to be removed, got %v", err)
+	}
+	if !strings.Contains(logs.String(), "updated a ") || !strings.Contains(logs.String(), "removed sub/b") {
+		t.Errorf("unexpected output %q", logs.String())
+	}
+
+	// a new watcher takes up the sidecars that are up to date
+	logs.Reset()
+	w = newWatcher(src, out, hm, 16, &logs)
+	if err := w.scan(); err != nil {
+		t.Fatal(err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("expected no updates on restart, got %q", logs.String())
+	}
+}
@@ -0,0 +1,168 @@
+package merkle
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// treeFormatVersion is the version of the JSON, CBOR and protobuf forms of a
+// Tree
+const treeFormatVersion = 1
+
+// treeFields is a Tree as its JSON, CBOR and protobuf forms hold it
+type treeFields struct {
+	Version     int              `json:"version"`
+	Hash        string           `json:"hash"` // as registered, see RegisterHash
+	BlockLength int              `json:"blockLength"`
+	FinalBlock  FinalBlockPolicy `json:"finalBlock"`
+	Length      int64            `json:"length"`
+	Leaves      [][]byte         `json:"leaves"`
+	Lengths     []int            `json:"lengths,omitempty"` // of the leaves, of a tree of no BlockLength
+	Bloom       []byte           `json:"bloom,omitempty"`   // the BloomFilter, in its binary form
+}
+
+// fields is the tree's parameters and the checksums of its leaves, checked as
+// for MarshalBinary
+func (t *Tree) fields() (treeFields, error) {
+	name, err := HashName(t.hashMaker())
+	if err != nil {
+		return treeFields{}, err
+	}
+	sums, err := t.leafSums()
+	if err != nil {
+		return treeFields{}, err
+	}
+	size := t.hashMaker()().Size()
+	for i, sum := range sums {
+		if len(sum) != size {
+			return treeFields{}, fmt.Errorf("leaf %d has a checksum of %d bytes, expected %d", i, len(sum), size)
+		}
+	}
+	tf := treeFields{
+		Version:     treeFormatVersion,
+		Hash:        name,
+		BlockLength: t.BlockLength,
+		FinalBlock:  t.FinalBlock,
+		Length:      t.length,
+		Leaves:      sums,
+	}
+	if t.BlockLength == 0 {
+		var total int64
+		for _, n := range t.Nodes {
+			tf.Lengths = append(tf.Lengths, n.Length)
+			total += int64(n.Length)
+		}
+		if total != t.length {
+			return treeFields{}, fmt.Errorf("leaves of %d bytes do not add up to the length %d", total, t.length)
+		}
+	}
+	if t.bloom != nil {
+		if tf.Bloom, err = t.bloom.MarshalBinary(); err != nil {
+			return treeFields{}, err
+		}
+	}
+	return tf, nil
+}
+
+// tree is the Tree of decoded fields, which are checked as UnmarshalBinary
+// checks its input, and any inconsistency is an ErrMalformedTree. Leaves
+// beyond the limits l are an ErrLimitExceeded.
+func (tf treeFields) tree(l DecodeLimits) (*Tree, error) {
+	if tf.Version != treeFormatVersion {
+		return nil, fmt.Errorf("unsupported tree format version %d", tf.Version)
+	}
+	hm, ok := LookupHash(tf.Hash)
+	if !ok {
+		return nil, ErrUnknownHash{Name: tf.Hash}
+	}
+	if tf.BlockLength < 0 || tf.Length < 0 {
+		return nil, ErrMalformedTree
+	}
+	if err := l.checkLeaves(uint64(len(tf.Leaves))); err != nil {
+		return nil, err
+	}
+	if err := checkTreeShape(tf.FinalBlock, uint64(tf.BlockLength), uint64(tf.Length), uint64(len(tf.Leaves))); err != nil {
+		return nil, err
+	}
+	size := hm().Size()
+	for i, sum := range tf.Leaves {
+		if len(sum) != size {
+			return nil, ErrInconsistentField{Field: "leaves", Reason: fmt.Sprintf("leaf %d has a checksum of %d bytes, expected %d", i, len(sum), size)}
+		}
+	}
+	var (
+		nodes = make([]*Node, len(tf.Leaves))
+		slab  = newLeafSlabOf(hm, len(tf.Leaves))
+	)
+	for i, sum := range tf.Leaves {
+		nodes[i] = slab.leaf(sum)
+	}
+	tree := &Tree{
+		Nodes:       nodes,
+		BlockLength: tf.BlockLength,
+		FinalBlock:  tf.FinalBlock,
+		length:      tf.Length,
+	}
+	if tf.BlockLength == 0 {
+		if len(tf.Lengths) != len(nodes) {
+			return nil, ErrMalformedTree
+		}
+		var offset int64
+		for i, n := range nodes {
+			l := tf.Lengths[i]
+			if l < 0 || int64(l) > tf.Length-offset {
+				return nil, ErrMalformedTree
+			}
+			n.Index, n.Offset, n.Length = i, offset, l
+			offset += int64(l)
+		}
+		if offset != tf.Length {
+			return nil, ErrMalformedTree
+		}
+	} else {
+		if len(tf.Lengths) != 0 {
+			return nil, ErrMalformedTree
+		}
+		tree.setPositions()
+	}
+	if len(tf.Bloom) > 0 {
+		tree.bloom = &BloomFilter{}
+		if err := tree.bloom.UnmarshalBinary(tf.Bloom); err != nil {
+			return nil, err
+		}
+	}
+	return tree, nil
+}
+
+// MarshalJSON encodes the tree's parameters, with the name of its hash, and
+// the checksums of its leaves, as MarshalBinary does
+func (t *Tree) MarshalJSON() ([]byte, error) {
+	tf, err := t.fields()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tf)
+}
+
+// UnmarshalJSON decodes a tree encoded by MarshalJSON. The hash it names must
+// be registered.
+func (t *Tree) UnmarshalJSON(data []byte) error {
+	return t.unmarshalJSON(data, DefaultDecodeLimits())
+}
+
+// unmarshalJSON is UnmarshalJSON of the limits l
+func (t *Tree) unmarshalJSON(data []byte, l DecodeLimits) error {
+	if err := l.checkBytes(len(data)); err != nil {
+		return err
+	}
+	var tf treeFields
+	if err := json.Unmarshal(data, &tf); err != nil {
+		return err
+	}
+	tree, err := tf.tree(l)
+	if err != nil {
+		return err
+	}
+	*t = *tree
+	return nil
+}
@@ -0,0 +1,116 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// codecTrees are trees of whole blocks with a Bloom filter, of chunks, and of
+// nothing, for the forms of a tree to round trip
+func codecTrees(t *testing.T) map[string]*Tree {
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	blocks, _, err := NewBuilder(DefaultHashMaker, 16, WithBloomFilter(0.01)).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, _, err := NewBuilder(DefaultHashMaker, 0).BuildChunks([][]byte{[]byte("abc"), []byte("defgh"), []byte("i")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]*Tree{"blocks": blocks, "chunks": chunks, "empty": {BlockLength: 16}}
+}
+
+// checkRoundTrip checks that the tree decoded is as the tree encoded, by their
+// binary forms
+func checkRoundTrip(t *testing.T, name string, expected, got *Tree) {
+	want, err := expected.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := got.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, have) {
+		t.Errorf("%s: expected the tree decoded as encoded", name)
+	}
+	for i, n := range got.Nodes {
+		if e := expected.Nodes[i]; n.Index != e.Index || n.Offset != e.Offset || n.Length != e.Length {
+			t.Errorf("%s: leaf %d is not positioned as encoded", name, i)
+		}
+	}
+}
+
+func TestTreeJSON(t *testing.T) {
+	for name, tree := range codecTrees(t) {
+		data, err := json.Marshal(tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Tree
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		checkRoundTrip(t, name, tree, &got)
+	}
+
+	tree := codecTrees(t)["chunks"]
+	data, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"hash":"sha1"`) || !strings.Contains(string(data), `"lengths":[3,5,1]`) {
+		t.Errorf("expected the hash and lengths of the leaves, got %s", data)
+	}
+	var got Tree
+	for _, bad := range []string{
+		strings.Replace(string(data), `"lengths":[3,5,1]`, `"lengths":[3,5,2]`, 1),
+		strings.Replace(string(data), `"version":1`, `"version":2`, 1),
+		strings.Replace(string(data), `"hash":"sha1"`, `"hash":"sha256"`, 1),
+	} {
+		if err := json.Unmarshal([]byte(bad), &got); err == nil {
+			t.Errorf("expected an error of %s", bad)
+		}
+	}
+}
+
+func TestTreeInconsistent(t *testing.T) {
+	tree := codecTrees(t)["blocks"]
+	for name, change := range map[string]func(*treeFields){
+		"fewer leaves":  func(tf *treeFields) { tf.Leaves = tf.Leaves[:2] },
+		"checksum size": func(tf *treeFields) { tf.Leaves[1] = tf.Leaves[1][1:] },
+	} {
+		tf, err := tree.fields()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tf.Leaves = append([][]byte(nil), tf.Leaves...)
+		change(&tf)
+		data, err := json.Marshal(tf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Tree
+		err = got.UnmarshalJSON(data)
+		if _, ok := err.(ErrInconsistentField); !ok {
+			t.Errorf("%s: expected ErrInconsistentField, got %v", name, err)
+		}
+		if !errors.Is(err, ErrMalformedTree) {
+			t.Errorf("%s: expected the error to be of a malformed tree", name)
+		}
+	}
+
+	// the policy follows the magic, version and name of the binary form
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(serializedMagic)+2+int(data[len(serializedMagic)+1])] = 9
+	var got Tree
+	if err := got.UnmarshalBinary(data); err == nil || err.(ErrInconsistentField).Field != "final block" {
+		t.Errorf("expected an unknown policy to be inconsistent, got %v", err)
+	}
+}
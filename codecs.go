@@ -0,0 +1,185 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Codec encodes and decodes the values of this package, as Proof, Tree and
+// Checkpoint, in a wire format. Codecs are registered by name, so the format
+// can be chosen at runtime.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// CodecFuncs is a Codec of a pair of functions, to adapt the functions of
+// another package, like
+//
+//	merkle.RegisterCodec("msgpack", merkle.CodecFuncs{
+//		MarshalFunc:   msgpack.Marshal,
+//		UnmarshalFunc: msgpack.Unmarshal,
+//	})
+type CodecFuncs struct {
+	MarshalFunc   func(v interface{}) ([]byte, error)
+	UnmarshalFunc func(data []byte, v interface{}) error
+}
+
+// Marshal is MarshalFunc
+func (c CodecFuncs) Marshal(v interface{}) ([]byte, error) {
+	return c.MarshalFunc(v)
+}
+
+// Unmarshal is UnmarshalFunc
+func (c CodecFuncs) Unmarshal(data []byte, v interface{}) error {
+	return c.UnmarshalFunc(data, v)
+}
+
+// ErrUnknownCodec is for a codec that is not registered
+type ErrUnknownCodec struct {
+	Name string
+}
+
+// Error shows the name of the codec
+func (err ErrUnknownCodec) Error() string {
+	return fmt.Sprintf("codec %q is not registered", err.Name)
+}
+
+// ErrUnsupportedType is for a value a codec has no form of
+type ErrUnsupportedType struct {
+	Codec string
+	Type  string
+}
+
+// Error shows the codec and the type
+func (err ErrUnsupportedType) Error() string {
+	return fmt.Sprintf("codec %q can not encode a %s", err.Codec, err.Type)
+}
+
+var (
+	codecRegistryMu sync.RWMutex
+	codecRegistry   = map[string]Codec{}
+)
+
+func init() {
+	RegisterCodec("json", CodecFuncs{MarshalFunc: json.Marshal, UnmarshalFunc: json.Unmarshal})
+	RegisterCodec("gob", CodecFuncs{MarshalFunc: gobMarshal, UnmarshalFunc: gobUnmarshal})
+	RegisterCodec("binary", methodCodec{name: "binary"})
+	RegisterCodec("text", methodCodec{name: "text"})
+	RegisterCodec("cbor", methodCodec{name: "cbor"})
+	RegisterCodec("proto", methodCodec{name: "proto"})
+}
+
+// RegisterCodec associates name with a Codec. The json, gob, binary, text,
+// cbor and proto codecs are registered already, the last four of the values
+// with methods of that form, as Tree and HashState for proto.
+func RegisterCodec(name string, c Codec) {
+	codecRegistryMu.Lock()
+	defer codecRegistryMu.Unlock()
+	codecRegistry[name] = c
+}
+
+// LookupCodec returns the Codec registered with name
+func LookupCodec(name string) (Codec, bool) {
+	codecRegistryMu.RLock()
+	defer codecRegistryMu.RUnlock()
+	c, ok := codecRegistry[name]
+	return c, ok
+}
+
+// Marshal encodes v with the codec registered as codec
+func Marshal(codec string, v interface{}) ([]byte, error) {
+	c, ok := LookupCodec(codec)
+	if !ok {
+		return nil, ErrUnknownCodec{Name: codec}
+	}
+	return c.Marshal(v)
+}
+
+// Unmarshal decodes data into v, a pointer, with the codec registered as
+// codec. The DefaultDecodeLimits apply, and a decoded Proof or PartialTree is
+// checked for consistency whatever the codec.
+func Unmarshal(codec string, data []byte, v interface{}) error {
+	return DefaultDecodeLimits().Unmarshal(codec, data, v)
+}
+
+func gobMarshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gobUnmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// methodCodec is the codec of the methods of a form, as MarshalBinary and
+// UnmarshalBinary
+type methodCodec struct {
+	name string
+}
+
+type (
+	protoMarshaler interface {
+		MarshalProto() ([]byte, error)
+	}
+	protoUnmarshaler interface {
+		UnmarshalProto([]byte) error
+	}
+	cborMarshaler interface {
+		MarshalCBOR() ([]byte, error)
+	}
+	cborUnmarshaler interface {
+		UnmarshalCBOR([]byte) error
+	}
+)
+
+func (c methodCodec) Marshal(v interface{}) ([]byte, error) {
+	switch c.name {
+	case "binary":
+		if m, ok := v.(encoding.BinaryMarshaler); ok {
+			return m.MarshalBinary()
+		}
+	case "text":
+		if m, ok := v.(encoding.TextMarshaler); ok {
+			return m.MarshalText()
+		}
+	case "cbor":
+		if m, ok := v.(cborMarshaler); ok {
+			return m.MarshalCBOR()
+		}
+	case "proto":
+		if m, ok := v.(protoMarshaler); ok {
+			return m.MarshalProto()
+		}
+	}
+	return nil, ErrUnsupportedType{Codec: c.name, Type: fmt.Sprintf("%T", v)}
+}
+
+func (c methodCodec) Unmarshal(data []byte, v interface{}) error {
+	switch c.name {
+	case "binary":
+		if m, ok := v.(encoding.BinaryUnmarshaler); ok {
+			return m.UnmarshalBinary(data)
+		}
+	case "text":
+		if m, ok := v.(encoding.TextUnmarshaler); ok {
+			return m.UnmarshalText(data)
+		}
+	case "cbor":
+		if m, ok := v.(cborUnmarshaler); ok {
+			return m.UnmarshalCBOR(data)
+		}
+	case "proto":
+		if m, ok := v.(protoUnmarshaler); ok {
+			return m.UnmarshalProto(data)
+		}
+	}
+	return ErrUnsupportedType{Codec: c.name, Type: fmt.Sprintf("%T", v)}
+}
@@ -0,0 +1,108 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	tree, err := SumOf(sha256.New, 64, bytes.Repeat([]byte("abc"), 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := tree.RootChecksum()
+	proof, err := tree.InclusionProof(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint, err := NewCheckpoint("example.com/log", tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, codec := range []string{"json", "gob", "binary", "cbor", "proto"} {
+		b, err := Marshal(codec, tree)
+		if err != nil {
+			t.Fatalf("%s: %s", codec, err)
+		}
+		var decoded Tree
+		if err := Unmarshal(codec, b, &decoded); err != nil {
+			t.Fatalf("%s: %s", codec, err)
+		}
+		if got, _ := decoded.RootChecksum(); !bytes.Equal(got, root) {
+			t.Errorf("%s: expected the root %x, got %x", codec, root, got)
+		}
+	}
+	for _, codec := range []string{"json", "gob"} {
+		b, err := Marshal(codec, proof)
+		if err != nil {
+			t.Fatalf("%s: %s", codec, err)
+		}
+		var decoded Proof
+		if err := Unmarshal(codec, b, &decoded); err != nil {
+			t.Fatalf("%s: %s", codec, err)
+		}
+		if !reflect.DeepEqual(decoded, proof) {
+			t.Errorf("%s: expected %v, got %v", codec, proof, decoded)
+		}
+	}
+	for _, codec := range []string{"gob", "text"} {
+		b, err := Marshal(codec, checkpoint)
+		if err != nil {
+			t.Fatalf("%s: %s", codec, err)
+		}
+		var decoded Checkpoint
+		if err := Unmarshal(codec, b, &decoded); err != nil {
+			t.Fatalf("%s: %s", codec, err)
+		}
+		if decoded.Size != checkpoint.Size || !bytes.Equal(decoded.Root, checkpoint.Root) {
+			t.Errorf("%s: expected %v, got %v", codec, checkpoint, decoded)
+		}
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	if _, err := Marshal("msgpack", Proof{}); !errors.As(err, new(ErrUnknownCodec)) {
+		t.Errorf("expected ErrUnknownCodec, got %v", err)
+	}
+	if _, err := Marshal("proto", Proof{}); !errors.As(err, new(ErrUnsupportedType)) {
+		t.Errorf("expected ErrUnsupportedType, got %v", err)
+	}
+
+	// a proof is checked whatever the codec
+	b, err := Marshal("gob", Proof{Index: 5, TreeSize: 2, Path: [][]byte{make([]byte, 32)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Unmarshal("gob", b, new(Proof)); !errors.Is(err, ErrMalformedTree) {
+		t.Errorf("expected ErrMalformedTree, got %v", err)
+	}
+
+	RegisterCodec("reversed-json", CodecFuncs{
+		MarshalFunc: func(v interface{}) ([]byte, error) {
+			b, err := Marshal("json", v)
+			for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+				b[i], b[j] = b[j], b[i]
+			}
+			return b, err
+		},
+		UnmarshalFunc: func(data []byte, v interface{}) error {
+			b := append([]byte{}, data...)
+			for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+				b[i], b[j] = b[j], b[i]
+			}
+			return Unmarshal("json", b, v)
+		},
+	})
+	b, err = Marshal("reversed-json", Proof{Index: 1, TreeSize: 2, Path: [][]byte{make([]byte, 32)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p Proof
+	if err := Unmarshal("reversed-json", b, &p); err != nil || p.Index != 1 {
+		t.Errorf("expected the proof of a registered codec, got %v, %v", p, err)
+	}
+}
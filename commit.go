@@ -0,0 +1,65 @@
+package merkle
+
+import "fmt"
+
+// commitContext starts the bytes of a committed root, so it is of no other
+// use of the hash
+const commitContext = "merkle root commitment v1\n"
+
+// WithLengthCommitment makes the root returned by a Builder, DiskBuilder or
+// hash the CommitRoot of the root of the tree, so it commits to the count of
+// bytes, the block length and the hash as well as the leaves. A prefix of the
+// input, or the input in blocks of another length, can then not have the
+// same root. The trees built, and their proofs, are of the root as without
+// it.
+func WithLengthCommitment() Option {
+	return func(o *options) {
+		o.given |= optLengthCommitment
+		o.commitLength = true
+	}
+}
+
+// CommitRoot is the checksum of root with the count of bytes of the input of
+// its tree, the block length, and the name of hm, or its type for a hash that
+// is not registered. The root of no input is committed as well, to its length
+// of 0.
+func CommitRoot(hm HashMaker, root []byte, length int64, blockLength int) []byte {
+	h, _ := unwrapHash(hm())
+	b := []byte(commitContext)
+	b = appendUvarint(b, uint64(length))
+	b = appendUvarint(b, uint64(blockLength))
+	id := hashID(hm)
+	b = appendUvarint(b, uint64(len(id)))
+	b = append(b, id...)
+	h.Write(append(b, root...))
+	return h.Sum(nil)
+}
+
+// CommittedRoot is the CommitRoot of the root of t, its length and block
+// length, as returned when it was built WithLengthCommitment
+func (t *Tree) CommittedRoot() ([]byte, error) {
+	root, err := t.RootChecksum()
+	if err != nil {
+		return nil, err
+	}
+	return CommitRoot(t.hashMaker(), root, t.length, t.BlockLength), nil
+}
+
+// hashID is the name hm is registered with, or else the type and size of its
+// hash
+func hashID(hm HashMaker) string {
+	if name, err := HashName(hm); err == nil {
+		return name
+	}
+	h := hm()
+	return fmt.Sprintf("%T/%d", h, h.Size())
+}
+
+// commitRoot is the root returned for a tree of length bytes, committed if
+// WithLengthCommitment
+func (o options) commitRoot(hm HashMaker, root []byte, length int64, blockLength int) []byte {
+	if !o.commitLength || root == nil {
+		return root
+	}
+	return CommitRoot(hm, root, length, blockLength)
+}
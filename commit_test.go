@@ -0,0 +1,67 @@
+package merkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLengthCommitment(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 8)
+	roots := map[string][]byte{}
+	for name, c := range map[string]struct {
+		blockLength int
+		data        []byte
+	}{
+		"whole":     {16, data},
+		"prefix":    {16, data[:64]},
+		"rechunked": {32, data},
+	} {
+		tree, root, err := NewBuilder(DefaultHashMaker, c.blockLength, WithLengthCommitment()).Build(bytes.NewReader(c.data), int64(len(c.data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain, err := tree.RootChecksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(root, plain) {
+			t.Errorf("%s: expected the root committed", name)
+		}
+		if expected := CommitRoot(DefaultHashMaker, plain, int64(len(c.data)), c.blockLength); !bytes.Equal(root, expected) {
+			t.Errorf("%s: expected the CommitRoot of the tree", name)
+		}
+		roots[name] = root
+	}
+	if bytes.Equal(roots["whole"], roots["prefix"]) || bytes.Equal(roots["whole"], roots["rechunked"]) {
+		t.Errorf("expected the roots of a prefix and of other blocks to differ")
+	}
+
+	// the hash, Builder and DiskBuilder agree
+	h, err := New(DefaultHashMaker, 16, WithLengthCommitment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Write(data[:70])
+	b := NewBuilder(DefaultHashMaker, 16, WithLengthCommitment())
+	b.Write(data[:70])
+	_, root, err := b.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(h.Sum(nil), root) {
+		t.Errorf("expected the hash and the Builder to agree")
+	}
+	db, err := NewDiskBuilder(DefaultHashMaker, 16, t.TempDir(), WithLengthCommitment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Write(data[:70])
+	dt, diskRoot, err := db.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dt.Close()
+	if !bytes.Equal(diskRoot, root) {
+		t.Errorf("expected the DiskBuilder and the Builder to agree")
+	}
+}
@@ -0,0 +1,71 @@
+package merkle
+
+import (
+	"fmt"
+)
+
+// Compose returns the tree of the concatenation of the objects of trees, as a
+// GCS compose of those objects, from their leaves alone. Every object but the
+// last must be whole blocks, so the blocks of the composed object are the
+// blocks of its components, and the trees must be of the same hash, block
+// length and final block policy.
+func Compose(trees ...*Tree) (*Tree, error) {
+	composed := &Tree{}
+	for i, t := range trees {
+		if i == 0 {
+			composed.BlockLength, composed.FinalBlock = t.BlockLength, t.FinalBlock
+		} else if err := composable(trees[0], t); err != nil {
+			return nil, fmt.Errorf("component %d: %s", i, err)
+		}
+		if err := composableLength(t, i == len(trees)-1); err != nil {
+			return nil, fmt.Errorf("component %d: %s", i, err)
+		}
+		for _, n := range t.Nodes {
+			c := n.leafCopy()
+			c.Index = len(composed.Nodes)
+			c.Offset += composed.length
+			composed.Nodes = append(composed.Nodes, c)
+		}
+		composed.length += t.length
+	}
+	return composed, nil
+}
+
+// composableLength is whether the length of t is known, as of a tree built
+// from a stream, and unless last, whole blocks by its leaves
+func composableLength(t *Tree, last bool) error {
+	if len(t.Nodes) > 0 && t.length == 0 {
+		return fmt.Errorf("length of the %d leaves is unknown", len(t.Nodes))
+	}
+	if last || t.BlockLength <= 0 {
+		return nil
+	}
+	if t.length != int64(len(t.Nodes))*int64(t.BlockLength) {
+		return fmt.Errorf("%d bytes is not whole blocks of %d", t.length, t.BlockLength)
+	}
+	for _, n := range t.Nodes {
+		if n.Length != t.BlockLength {
+			return fmt.Errorf("leaf %d of %d bytes is not a whole block of %d", n.Index, n.Length, t.BlockLength)
+		}
+	}
+	return nil
+}
+
+func composable(a, b *Tree) error {
+	switch {
+	case a.BlockLength != b.BlockLength:
+		return fmt.Errorf("block length %d does not match %d", b.BlockLength, a.BlockLength)
+	case a.FinalBlock != b.FinalBlock:
+		return fmt.Errorf("final block policy %s does not match %s", b.FinalBlock, a.FinalBlock)
+	}
+	if !sameHash(a.hashMaker(), b.hashMaker()) {
+		return fmt.Errorf("hash does not match")
+	}
+	return nil
+}
+
+// sameHash is whether the hashes made are of the same type and size, as
+// functions can not be compared
+func sameHash(a, b HashMaker) bool {
+	return sameHashes(a(), b())
+}
@@ -0,0 +1,65 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"testing"
+)
+
+func TestCompose(t *testing.T) {
+	var (
+		a = bytes.Repeat([]byte("a"), 2048)
+		b = bytes.Repeat([]byte("b"), 1024)
+		c = bytes.Repeat([]byte("c"), 700)
+	)
+	build := func(data []byte) *Tree {
+		tree, _, err := NewBuilder(DefaultHashMaker, 512).Build(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tree
+	}
+
+	composed, err := Compose(build(a), build(b), build(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	whole := append(append(append([]byte{}, a...), b...), c...)
+	expected := build(whole)
+	root, err := expected.RootChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := composed.RootChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, root) {
+		t.Errorf("expected the root of the composed object %x, got %x", root, got)
+	}
+	if composed.TotalLength() != int64(len(whole)) {
+		t.Errorf("expected length %d, got %d", len(whole), composed.TotalLength())
+	}
+
+	if _, err := Compose(build(c), build(a)); err == nil {
+		t.Errorf("expected an error for a component that is not whole blocks")
+	}
+
+	// a tree of Append is of no known length, though its last leaf is short
+	appended := &Tree{BlockLength: 512}
+	for _, n := range build(c).Nodes {
+		appended.Append(n)
+	}
+	if _, err := Compose(appended, build(a)); err == nil {
+		t.Errorf("expected an error for a component of unknown length")
+	}
+
+	other, _, err := NewBuilder(func() hash.Hash { return sha256.New() }, 512).Build(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Compose(build(a), other); err == nil {
+		t.Errorf("expected an error for components of different hashes")
+	}
+}
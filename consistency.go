@@ -0,0 +1,118 @@
+package merkle
+
+import "time"
+
+// ConsistencyProof returns the proof that the tree of the first oldSize
+// leaves is a prefix of the tree of the first newSize leaves, as of RFC 6962,
+// so a verifier holding the older root can check the log only appended since.
+// It is of the form of a ConsistencyFunc, for a Witness.
+func (t *Tree) ConsistencyProof(oldSize, newSize int) ([][]byte, error) {
+	if oldSize < 1 || oldSize > newSize || newSize > len(t.Nodes) {
+		return nil, ErrInvalidRange{Start: oldSize, End: newSize, Size: len(t.Nodes)}
+	}
+	sums, err := t.leafSums()
+	if err != nil {
+		return nil, err
+	}
+	return consistencyPath(t.hashMaker(), oldSize, sums[:newSize], true)
+}
+
+// consistencyPath is SUBPROOF of RFC 6962, of the first m of the leaves sums,
+// where whole is whether the first m leaves are the whole of the old tree, so
+// its root is known to the verifier and left out
+func consistencyPath(hm HashMaker, m int, sums [][]byte, whole bool) ([][]byte, error) {
+	n := len(sums)
+	if m == n {
+		if whole {
+			return nil, nil
+		}
+		root, err := subtreeHash(hm, sums)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{root}, nil
+	}
+	k := splitPoint(n)
+	var (
+		path    [][]byte
+		sibling []byte
+		err     error
+	)
+	if m <= k {
+		if path, err = consistencyPath(hm, m, sums[:k], whole); err != nil {
+			return nil, err
+		}
+		sibling, err = subtreeHash(hm, sums[k:])
+	} else {
+		if path, err = consistencyPath(hm, m-k, sums[k:], false); err != nil {
+			return nil, err
+		}
+		sibling, err = subtreeHash(hm, sums[:k])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(path, sibling), nil
+}
+
+// VerifyConsistency checks that proof shows the tree of oldSize leaves and
+// oldRoot is a prefix of the tree of newSize leaves and newRoot, as of RFC
+// 9162. A proof not of the shape of the sizes is ErrInvalidProof, and one of
+// other roots ErrTreeHashMismatch.
+func VerifyConsistency(hm HashMaker, oldSize, newSize int, oldRoot, newRoot []byte, proof [][]byte) (err error) {
+	if sink := auditing(); sink != nil {
+		defer func(start time.Time) {
+			audit(sink, AuditEvent{Kind: "consistency", Root: newRoot, Index: oldSize}, start, err)
+		}(time.Now())
+	}
+	if oldSize < 1 || oldSize > newSize {
+		return ErrInvalidProof
+	}
+	if oldSize == newSize {
+		if len(proof) != 0 {
+			return ErrInvalidProof
+		}
+		if !equalChecksums(oldRoot, newRoot) {
+			return ErrTreeHashMismatch
+		}
+		return nil
+	}
+	if isPowerOfTwo(oldSize) {
+		proof = append([][]byte{oldRoot}, proof...)
+	}
+	if len(proof) == 0 {
+		return ErrInvalidProof
+	}
+
+	fn, sn := oldSize-1, newSize-1
+	for fn&1 == 1 {
+		fn, sn = fn>>1, sn>>1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			if fr, err = hashChildren(hm, c, fr); err != nil {
+				return err
+			}
+			if sr, err = hashChildren(hm, c, sr); err != nil {
+				return err
+			}
+			for fn&1 == 0 && fn != 0 {
+				fn, sn = fn>>1, sn>>1
+			}
+		} else if sr, err = hashChildren(hm, sr, c); err != nil {
+			return err
+		}
+		fn, sn = fn>>1, sn>>1
+	}
+	if sn != 0 {
+		return ErrInvalidProof
+	}
+	if !equalChecksums(fr, oldRoot) || !equalChecksums(sr, newRoot) {
+		return ErrTreeHashMismatch
+	}
+	return nil
+}
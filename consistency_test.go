@@ -0,0 +1,77 @@
+package merkle
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestConsistencyProof(t *testing.T) {
+	// of the RFC 6962 reference tests
+	vectors := []struct {
+		oldSize, newSize int
+		proof            []string
+	}{
+		{1, 1, nil},
+		{1, 8, []string{
+			"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4",
+		}},
+		{6, 8, []string{
+			"0ebc5d3437fbe2db158b9f126a1d118e308181031d0a949f8dededebc558ef6a",
+			"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+			"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		}},
+		{2, 5, []string{
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+		}},
+	}
+	tree, hm := rfc6962Tree(t, 8)
+	for _, v := range vectors {
+		proof, err := tree.ConsistencyProof(v.oldSize, v.newSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(proof) != len(v.proof) {
+			t.Fatalf("%d to %d: expected %d checksums, got %d", v.oldSize, v.newSize, len(v.proof), len(proof))
+		}
+		for i, sum := range v.proof {
+			if hex.EncodeToString(proof[i]) != sum {
+				t.Errorf("%d to %d: expected %s at %d, got %x", v.oldSize, v.newSize, sum, i, proof[i])
+			}
+		}
+	}
+
+	// every pair of sizes verifies, and fails against the wrong roots
+	for newSize := 1; newSize <= 8; newSize++ {
+		newTree, _ := rfc6962Tree(t, newSize)
+		newRoot, _ := newTree.RootChecksum()
+		for oldSize := 1; oldSize <= newSize; oldSize++ {
+			oldTree, _ := rfc6962Tree(t, oldSize)
+			oldRoot, _ := oldTree.RootChecksum()
+			proof, err := tree.ConsistencyProof(oldSize, newSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyConsistency(hm, oldSize, newSize, oldRoot, newRoot, proof); err != nil {
+				t.Errorf("%d to %d: expected the proof to verify, got %v", oldSize, newSize, err)
+			}
+			if err := VerifyConsistency(hm, oldSize, newSize, newRoot[1:], newRoot, proof); err == nil && oldSize != newSize {
+				t.Errorf("%d to %d: expected the wrong old root to fail", oldSize, newSize)
+			}
+			if len(proof) > 0 {
+				if err := VerifyConsistency(hm, oldSize, newSize, oldRoot, newRoot, proof[1:]); err == nil {
+					t.Errorf("%d to %d: expected a truncated proof to fail", oldSize, newSize)
+				}
+			}
+		}
+	}
+
+	if _, err := tree.ConsistencyProof(0, 4); err == nil {
+		t.Error("expected an old size of 0 to fail")
+	}
+	if _, err := tree.ConsistencyProof(4, 9); err == nil {
+		t.Error("expected a new size beyond the tree to fail")
+	}
+}
@@ -0,0 +1,96 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+)
+
+// Labels for content ingested with an IngestWriter. They follow containerd's
+// conventions, so the sidecar tree blob is kept by the garbage collector for as
+// long as the content it describes.
+const (
+	// LabelTreeRef refers from the content to the digest of its sidecar tree
+	LabelTreeRef = "containerd.io/gc.ref.content.merkle"
+
+	// LabelTreeRoot is the hex encoded root checksum of the content's tree
+	LabelTreeRoot = AnnotationRoot
+)
+
+// IngestWriter wraps the writer of a content ingestion, as a containerd
+// content.Writer, computing the tree of the content alongside the standard
+// sha256 digest.
+//
+// This package does not depend on containerd. Ingest through the IngestWriter,
+// then write the Sidecar to the content store and commit the content with its
+// labels.
+type IngestWriter struct {
+	w      io.Writer
+	digest hash.Hash
+	b      *Builder
+	tree   *Tree
+	root   []byte
+}
+
+// NewIngestWriter returns an IngestWriter writing through to w
+func NewIngestWriter(w io.Writer, hm HashMaker, blockLength int) *IngestWriter {
+	return &IngestWriter{
+		w:      w,
+		digest: sha256.New(),
+		b:      NewBuilder(hm, blockLength, WithEmptyRoot()),
+	}
+}
+
+// Write writes p through, and hashes the bytes accepted
+func (iw *IngestWriter) Write(p []byte) (int, error) {
+	if iw.tree != nil {
+		return 0, ErrWriterClosed
+	}
+	n, err := iw.w.Write(p)
+	if n > 0 {
+		iw.digest.Write(p[:n])
+		if _, herr := iw.b.Write(p[:n]); herr != nil && err == nil {
+			err = herr
+		}
+	}
+	return n, err
+}
+
+// Digest is the sha256 digest of the content written, in the form of an OCI
+// digest ("sha256:...")
+func (iw *IngestWriter) Digest() string {
+	return digestString(iw.digest.Sum(nil))
+}
+
+// Sidecar finishes the tree of the content, and returns its serialized form
+// (see Tree.MarshalBinary), and the labels to commit the content with. The
+// sidecar blob must be stored as content with the digest in LabelTreeRef.
+func (iw *IngestWriter) Sidecar() ([]byte, map[string]string, error) {
+	if iw.tree == nil {
+		tree, root, err := iw.b.Finalize()
+		if err != nil {
+			return nil, nil, err
+		}
+		iw.tree, iw.root = tree, root
+	}
+	blob, err := iw.tree.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(blob)
+	labels := map[string]string{
+		LabelTreeRef:  digestString(sum[:]),
+		LabelTreeRoot: hex.EncodeToString(iw.root),
+	}
+	return blob, labels, nil
+}
+
+// Tree is the tree of the content, once Sidecar has been called
+func (iw *IngestWriter) Tree() *Tree {
+	return iw.tree
+}
+
+func digestString(sum []byte) string {
+	return "sha256:" + hex.EncodeToString(sum)
+}
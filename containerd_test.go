@@ -0,0 +1,45 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestIngestWriter(t *testing.T) {
+	content := bytes.Repeat([]byte("some content to ingest "), 500)
+	var dst bytes.Buffer
+	iw := NewIngestWriter(&dst, DefaultHashMaker, 1024)
+	if _, err := io.Copy(iw, bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if expected := fmt.Sprintf("sha256:%x", sha256.Sum256(content)); iw.Digest() != expected {
+		t.Errorf("expected digest %q; got %q", expected, iw.Digest())
+	}
+	if !bytes.Equal(dst.Bytes(), content) {
+		t.Errorf("expected the content written through")
+	}
+
+	blob, labels, err := iw.Sidecar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := fmt.Sprintf("sha256:%x", sha256.Sum256(blob)); labels[LabelTreeRef] != expected {
+		t.Errorf("expected ref label %q; got %q", expected, labels[LabelTreeRef])
+	}
+
+	// the sidecar verifies the content later
+	var tree Tree
+	if err := tree.UnmarshalBinary(blob); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, NewVerifyingReader(bytes.NewReader(content), &tree)); err != nil {
+		t.Errorf("expected the content to verify against its sidecar: %s", err)
+	}
+	if _, err := iw.Write(content); err != ErrWriterClosed {
+		t.Errorf("expected %q, got %v", ErrWriterClosed, err)
+	}
+}
@@ -0,0 +1,265 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Fields of RFC 9530, for the digest of the content or of the representation
+// of an HTTP message
+const (
+	HeaderContentDigest = "Content-Digest"
+	HeaderReprDigest    = "Repr-Digest"
+)
+
+// FieldDigest is a member of a Content-Digest or Repr-Digest field. The
+// digest of a tree is the root, with an algorithm like "merkle-sha256" and a
+// block-length parameter.
+type FieldDigest struct {
+	Algorithm   string
+	Digest      []byte
+	BlockLength int // of a tree, or 0 for other algorithms
+}
+
+// ErrMalformedField is for a field that does not parse as a structured field
+// dictionary of digests
+var ErrMalformedField = errors.New("malformed digest field")
+
+// TreeFieldDigest is the digest of t, for a Content-Digest or Repr-Digest
+// field
+func TreeFieldDigest(t *Tree) (FieldDigest, error) {
+	algorithm, err := SubjectDigestName(t.hashMaker())
+	if err != nil {
+		return FieldDigest{}, err
+	}
+	root, err := t.RootChecksum()
+	if err == ErrEmptyTree {
+		root, err = EmptyRoot(t.hashMaker()), nil
+	}
+	if err != nil {
+		return FieldDigest{}, err
+	}
+	return FieldDigest{Algorithm: algorithm, Digest: root, BlockLength: t.BlockLength}, nil
+}
+
+// FormatDigestField encodes digests as a structured field dictionary, like
+// `merkle-sha256=:...:;block-length=4096, sha-256=:...:`
+func FormatDigestField(digests ...FieldDigest) string {
+	members := make([]string, len(digests))
+	for i, d := range digests {
+		members[i] = fmt.Sprintf("%s=:%s:", d.Algorithm, base64.StdEncoding.EncodeToString(d.Digest))
+		if d.BlockLength > 0 {
+			members[i] += ";block-length=" + strconv.Itoa(d.BlockLength)
+		}
+	}
+	return strings.Join(members, ", ")
+}
+
+// ParseDigestField decodes a Content-Digest or Repr-Digest field. Members that
+// are not byte sequences, and unknown parameters, are skipped as RFC 9530
+// allows.
+func ParseDigestField(value string) ([]FieldDigest, error) {
+	var (
+		p       = sfParser{s: value}
+		digests []FieldDigest
+	)
+	p.skipSpace()
+	for !p.done() {
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		var (
+			d      = FieldDigest{Algorithm: key}
+			isSeq  bool
+			hasVal = p.consume('=')
+		)
+		if hasVal {
+			if d.Digest, isSeq, err = p.item(); err != nil {
+				return nil, err
+			}
+		}
+		for p.consume(';') {
+			p.skipSpace()
+			name, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			if !p.consume('=') {
+				continue
+			}
+			v, _, err := p.item()
+			if err != nil {
+				return nil, err
+			}
+			if name == "block-length" {
+				if d.BlockLength, err = strconv.Atoi(string(v)); err != nil || d.BlockLength < 0 {
+					return nil, ErrMalformedField
+				}
+			}
+		}
+		if isSeq {
+			digests = append(digests, d)
+		}
+		p.skipSpace()
+		if p.done() {
+			break
+		}
+		if !p.consume(',') {
+			return nil, ErrMalformedField
+		}
+		p.skipSpace()
+		if p.done() {
+			return nil, ErrMalformedField
+		}
+	}
+	return digests, nil
+}
+
+// CheckDigestField checks that the field value carries the digest of t, so a
+// tree fetched as a sidecar can be trusted to verify the content block by
+// block (see NewVerifyingReader)
+func CheckDigestField(value string, t *Tree) error {
+	expected, err := TreeFieldDigest(t)
+	if err != nil {
+		return err
+	}
+	digests, err := ParseDigestField(value)
+	if err != nil {
+		return err
+	}
+	for _, d := range digests {
+		if d.Algorithm != expected.Algorithm {
+			continue
+		}
+		if d.BlockLength != expected.BlockLength || !bytes.Equal(d.Digest, expected.Digest) {
+			return ErrAnnotationMismatch{Key: d.Algorithm}
+		}
+		return nil
+	}
+	return fmt.Errorf("no %s digest in field", expected.Algorithm)
+}
+
+// sfParser is a parser of the subset of RFC 8941 structured fields that digest
+// fields use: dictionaries of bare items with parameters
+type sfParser struct {
+	s string
+	i int
+}
+
+func (p *sfParser) done() bool { return p.i >= len(p.s) }
+
+func (p *sfParser) skipSpace() {
+	for !p.done() && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+}
+
+func (p *sfParser) consume(c byte) bool {
+	if !p.done() && p.s[p.i] == c {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *sfParser) key() (string, error) {
+	start := p.i
+	if p.done() || !(p.s[p.i] == '*' || (p.s[p.i] >= 'a' && p.s[p.i] <= 'z')) {
+		return "", ErrMalformedField
+	}
+	for !p.done() {
+		c := p.s[p.i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("_-.*", c) >= 0) {
+			break
+		}
+		p.i++
+	}
+	return p.s[start:p.i], nil
+}
+
+// item parses a bare item, returning byte sequences decoded, and the text of
+// other items
+func (p *sfParser) item() ([]byte, bool, error) {
+	if p.done() {
+		return nil, false, ErrMalformedField
+	}
+	switch c := p.s[p.i]; {
+	case c == ':':
+		end := strings.IndexByte(p.s[p.i+1:], ':')
+		if end < 0 {
+			return nil, false, ErrMalformedField
+		}
+		b, err := base64.StdEncoding.DecodeString(p.s[p.i+1 : p.i+1+end])
+		if err != nil {
+			return nil, false, ErrMalformedField
+		}
+		p.i += end + 2
+		return b, true, nil
+	case c == '"':
+		var buf []byte
+		for p.i++; !p.done(); p.i++ {
+			switch p.s[p.i] {
+			case '\\':
+				p.i++
+				if p.done() {
+					return nil, false, ErrMalformedField
+				}
+				buf = append(buf, p.s[p.i])
+			case '"':
+				p.i++
+				return buf, false, nil
+			default:
+				buf = append(buf, p.s[p.i])
+			}
+		}
+		return nil, false, ErrMalformedField
+	case c == '(':
+		return nil, false, ErrMalformedField // inner lists are not digests
+	default:
+		start := p.i
+		for !p.done() && strings.IndexByte(",; \t", p.s[p.i]) < 0 {
+			p.i++
+		}
+		if start == p.i {
+			return nil, false, ErrMalformedField
+		}
+		return []byte(p.s[start:p.i]), false, nil
+	}
+}
+
+// NewDigestHandler returns a handler that serves h, and sends the digest of
+// the tree of each response's content as a Content-Digest trailer
+func NewDigestHandler(h http.Handler, hm HashMaker, blockLength int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dw := &digestResponseWriter{ResponseWriter: w, b: NewBuilder(hm, blockLength, WithEmptyRoot())}
+		h.ServeHTTP(dw, r)
+		tree, _, err := dw.b.Finalize()
+		if err != nil {
+			return
+		}
+		d, err := TreeFieldDigest(tree)
+		if err != nil {
+			return
+		}
+		w.Header().Set(http.TrailerPrefix+HeaderContentDigest, FormatDigestField(d))
+	})
+}
+
+type digestResponseWriter struct {
+	http.ResponseWriter
+	b *Builder
+}
+
+func (dw *digestResponseWriter) Write(p []byte) (int, error) {
+	n, err := dw.ResponseWriter.Write(p)
+	if n > 0 {
+		dw.b.Write(p[:n])
+	}
+	return n, err
+}
@@ -0,0 +1,84 @@
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseDigestField(t *testing.T) {
+	// from RFC 9530, with a tree digest and unknown members and parameters
+	value := `sha-256=:RK/0qy18MlBSVnWgjwz6lZEWjP/lF5HF9bvEF8FabDg=:, unixsum=30637, merkle-sha256=:AAEC:;block-length=4096;x="y, z", id-sha-256`
+	digests, err := ParseDigestField(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(digests) != 2 {
+		t.Fatalf("expected 2 digests, got %+v", digests)
+	}
+	if digests[0].Algorithm != "sha-256" || fmt.Sprintf("%x", digests[0].Digest) != "44aff4ab2d7c3250525675a08f0cfa9591168cffe51791c5f5bbc417c15a6c38" {
+		t.Errorf("unexpected digest %+v", digests[0])
+	}
+	if digests[1].Algorithm != "merkle-sha256" || !bytes.Equal(digests[1].Digest, []byte{0, 1, 2}) || digests[1].BlockLength != 4096 {
+		t.Errorf("unexpected digest %+v", digests[1])
+	}
+
+	for _, bad := range []string{
+		"sha-256=:not base64!:",
+		"sha-256=:AAEC",
+		"Sha-256=:AAEC:",
+		"sha-256=:AAEC: sha-512=:AAEC:",
+		"sha-256=:AAEC:,",
+		"sha-256=(a b)",
+		"merkle-sha256=:AAEC:;block-length=-1",
+	} {
+		if _, err := ParseDigestField(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestDigestHandler(t *testing.T) {
+	content := bytes.Repeat([]byte("tree verified transfer "), 400)
+	srv := httptest.NewServer(NewDigestHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content[:1000])
+		w.Write(content[1000:])
+	}), DefaultHashMaker, 1024))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, content) {
+		t.Fatalf("expected the content to be served")
+	}
+
+	tree, _, err := NewBuilder(DefaultHashMaker, 1024).Build(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	field := resp.Trailer.Get(HeaderContentDigest)
+	if err := CheckDigestField(field, tree); err != nil {
+		t.Errorf("%q: %s", field, err)
+	}
+
+	other, _, err := NewBuilder(DefaultHashMaker, 512).Build(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckDigestField(field, other); err == nil {
+		t.Errorf("expected a tree of another block length not to match")
+	}
+	if err := CheckDigestField("sha-256=:AAEC:", tree); err == nil {
+		t.Errorf("expected an error for a field without a tree digest")
+	}
+}
@@ -0,0 +1,103 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DirHash is the hash of a directory as golang.org/x/mod/sumdb/dirhash.Hash1
+// computes it for go.sum, with the trees of the files in it, so a module can
+// be checked block by block while its "h1:" hash still matches the checksum
+// database
+type DirHash struct {
+	Hash  string           // like "h1:Uk2Tc..."
+	Names []string         // of the files, sorted, as hashed, like "prefix/dir/file.go"
+	Trees map[string]*Tree // of the files, by name
+}
+
+// HashDir hashes the files under dir, named by their slash separated paths
+// under prefix, as dirhash.HashDir does. Each file is read once, for both its
+// sha256 and its tree.
+func HashDir(dir, prefix string, hm HashMaker, blockLength int) (*DirHash, error) {
+	d := &DirHash{Trees: map[string]*Tree{}}
+	paths := map[string]string{}
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(filepath.Join(prefix, rel))
+		if strings.Contains(name, "\n") {
+			return fmt.Errorf("dirhash: filenames with newlines are not supported")
+		}
+		d.Names = append(d.Names, name)
+		paths[name] = path
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(d.Names)
+
+	h := sha256.New()
+	for _, name := range d.Names {
+		sum, tree, err := hashDirFile(paths[name], hm, blockLength)
+		if err != nil {
+			return nil, err
+		}
+		d.Trees[name] = tree
+		fmt.Fprintf(h, "%x  %s\n", sum, name)
+	}
+	d.Hash = "h1:" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+	return d, nil
+}
+
+// hashDirFile is the sha256 and the tree of the file at path
+func hashDirFile(path string, hm HashMaker, blockLength int) ([]byte, *Tree, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	var (
+		h = sha256.New()
+		b = NewBuilder(hm, blockLength, WithEmptyRoot())
+	)
+	if _, err := io.Copy(io.MultiWriter(h, b), f); err != nil {
+		return nil, nil, err
+	}
+	tree, _, err := b.Finalize()
+	if err != nil {
+		return nil, nil, err
+	}
+	return h.Sum(nil), tree, nil
+}
+
+// SuperTree is the SuperTree of the trees of the files, in the order of
+// their names
+func (d *DirHash) SuperTree(hm HashMaker) (*SuperTree, error) {
+	st := NewSuperTree(hm)
+	for _, name := range d.Names {
+		root, err := d.Trees[name].RootChecksum()
+		if err == ErrEmptyTree {
+			root, err = EmptyRoot(hm), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		st.AddRoot(name, root)
+	}
+	return st, nil
+}
@@ -0,0 +1,66 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHashDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkle-dirhash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string][]byte{
+		"go.mod":       []byte("module example.com/m\n"),
+		"m.go":         bytes.Repeat([]byte("package m\n"), 100),
+		"sub/empty.go": nil,
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := HashDir(dir, "example.com/m@v1.0.0", DefaultHashMaker, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"example.com/m@v1.0.0/go.mod", "example.com/m@v1.0.0/m.go", "example.com/m@v1.0.0/sub/empty.go"}
+	if !reflect.DeepEqual(d.Names, names) {
+		t.Errorf("expected names %v, got %v", names, d.Names)
+	}
+
+	// the summary of dirhash.Hash1, a line of the sha256 and name of each file
+	var summary bytes.Buffer
+	for _, name := range []string{"go.mod", "m.go", "sub/empty.go"} {
+		fmt.Fprintf(&summary, "%x  example.com/m@v1.0.0/%s\n", sha256.Sum256(files[name]), name)
+	}
+	sum := sha256.Sum256(summary.Bytes())
+	if expected := "h1:" + base64.StdEncoding.EncodeToString(sum[:]); d.Hash != expected {
+		t.Errorf("expected %s, got %s", expected, d.Hash)
+	}
+
+	if tree := d.Trees[names[1]]; len(tree.Nodes) != 16 || tree.TotalLength() != 1000 {
+		t.Errorf("expected the tree of m.go, of 16 leaves, got %d", len(tree.Nodes))
+	}
+	st, err := d.SuperTree(DefaultHashMaker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Roots) != 3 || !bytes.Equal(st.Roots[2], EmptyRoot(DefaultHashMaker)) {
+		t.Errorf("expected the roots of the three files, the empty one of no bytes")
+	}
+}
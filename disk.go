@@ -0,0 +1,347 @@
+package merkle
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// DiskBuilder constructs a tree like a Builder written to, but appends the
+// checksums of the leaves to a temporary file as they are produced, rather
+// than keeping a Node of each. The root is computed as the leaves are
+// appended, from the frontier of their complete subtrees, so memory does not
+// grow with the input: a tree of 500M leaves is a file of their checksums.
+type DiskBuilder struct {
+	hm          HashMaker
+	blockLength int
+	dir         string
+	opts        options
+	stream      *leafStream
+
+	f       *os.File
+	w       *bufio.Writer
+	summary SubtreeSummary
+	partial []byte
+	length  int64
+}
+
+// NewDiskBuilder returns a DiskBuilder for trees of blockLength blocks,
+// checksummed with hm, spilling the leaves to temporary files in dir, or the
+// default directory for temporary files if dir is "". Of the options of a
+// Builder, only WithLeafStream is applied, and any other is an
+// ErrUnsupportedOption, as the Bloom filter and leaf index are of the whole
+// tree in memory and the blocks are hashed as they are written.
+func NewDiskBuilder(hm HashMaker, blockLength int, dir string, opts ...Option) (*DiskBuilder, error) {
+	if blockLength < MinBlockSize {
+		return nil, ErrInvalidBlockLength{Length: blockLength}
+	}
+	o := newOptions(opts)
+	if err := o.supported("NewDiskBuilder", diskBuilderOptions); err != nil {
+		return nil, err
+	}
+	return &DiskBuilder{hm: o.hashMaker(hm), blockLength: blockLength, dir: dir, opts: o, stream: newLeafStream(o.leafStream)}, nil
+}
+
+// Write checksums each whole block of the written bytes as a leaf, appended
+// to the file of the leaves. A write beyond the limits of WithMaxLeaves or
+// WithMaxBytes writes nothing, and returns an ErrLimitExceeded.
+func (b *DiskBuilder) Write(p []byte) (int, error) {
+	if err := b.opts.checkLimits(b.blockLength, b.length, b.summary.End, len(b.partial), int64(len(p))); err != nil {
+		return 0, err
+	}
+	written := len(p)
+	for len(p) > 0 {
+		l := b.blockLength - len(b.partial)
+		if l > len(p) {
+			l = len(p)
+		}
+		if len(b.partial) == 0 && l == b.blockLength {
+			// a whole block need not be copied
+			if err := b.appendLeaf(p[:l]); err != nil {
+				return written - len(p), err
+			}
+		} else {
+			b.partial = append(b.partial, p[:l]...)
+			if len(b.partial) == b.blockLength {
+				if err := b.appendLeaf(b.partial); err != nil {
+					b.partial = b.partial[:len(b.partial)-l]
+					return written - len(p), err
+				}
+				b.partial = b.partial[:0]
+			}
+		}
+		p = p[l:]
+		b.length += int64(l)
+	}
+	return written, nil
+}
+
+// appendLeaf checksums the block as the next leaf
+func (b *DiskBuilder) appendLeaf(block []byte) error {
+	n, err := NewNodeHashBlock(b.hm, block)
+	if err != nil {
+		return err
+	}
+	if err := b.appendSum(n.checksum(), len(block)); err != nil {
+		return err
+	}
+	b.opts.yield()
+	return nil
+}
+
+func (b *DiskBuilder) appendSum(sum []byte, length int) error {
+	if b.f == nil {
+		f, err := ioutil.TempFile(b.dir, "merkle-leaves")
+		if err != nil {
+			return err
+		}
+		b.f, b.w = f, bufio.NewWriterSize(f, 1<<16)
+	}
+	if _, err := b.w.Write(sum); err != nil {
+		return err
+	}
+	leaf := SubtreeSummary{Start: b.summary.End, End: b.summary.End + 1, Frontier: [][]byte{sum}}
+	summary, err := CombineSubtrees(b.hm, b.summary, leaf)
+	if err != nil {
+		return err
+	}
+	b.summary = summary
+	return b.stream.leaf(b.hm, b.blockLength, b.opts.finalBlock, sum, length)
+}
+
+// Finalize returns the tree of the bytes written so far, with any trailing
+// partial block as the last leaf, and the checksum of its root. The file of
+// the leaves is handed to the DiskTree, to be removed by its Close, and the
+// DiskBuilder is reset for the next tree to be written.
+func (b *DiskBuilder) Finalize() (*DiskTree, []byte, error) {
+	defer func() {
+		b.f, b.w, b.summary, b.partial, b.length = nil, nil, SubtreeSummary{}, nil, 0
+	}()
+	fail := func(err error) (*DiskTree, []byte, error) {
+		if b.f != nil {
+			b.f.Close()
+			os.Remove(b.f.Name())
+		}
+		return nil, nil, err
+	}
+	if len(b.partial) > 0 {
+		n, err := b.opts.finalBlock.NewNode(b.hm, b.blockLength, b.partial)
+		if err != nil {
+			return fail(err)
+		}
+		if err := b.appendSum(n.checksum(), len(b.partial)); err != nil {
+			return fail(err)
+		}
+	}
+	if err := b.stream.end(b.hm, b.blockLength, b.opts.finalBlock, b.length); err != nil {
+		return fail(err)
+	}
+	dt := &DiskTree{
+		BlockLength: b.blockLength,
+		FinalBlock:  b.opts.finalBlock,
+		hm:          b.hm,
+		f:           b.f,
+		leaves:      b.summary.End,
+		size:        b.hm().Size(),
+		length:      b.length,
+	}
+	if b.w != nil {
+		if err := b.w.Flush(); err != nil {
+			return fail(err)
+		}
+	}
+	var err error
+	if dt.leaves == 0 {
+		dt.root, err = b.opts.emptyTreeRoot(b.hm)
+	} else {
+		dt.root, err = b.summary.Root(b.hm)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return dt, b.opts.commitRoot(b.hm, dt.root, b.length, b.blockLength), nil
+}
+
+// DiskTree is a tree of the leaf checksums in a file, as finalized by a
+// DiskBuilder. Its leaves and proofs are read from the file as they are
+// needed.
+type DiskTree struct {
+	BlockLength int
+	FinalBlock  FinalBlockPolicy
+
+	hm     HashMaker
+	f      *os.File // nil for no leaves
+	leaves int
+	size   int // of the checksums
+	length int64
+	root   []byte
+}
+
+// Len is the count of leaves
+func (dt *DiskTree) Len() int {
+	return dt.leaves
+}
+
+// TotalLength is the count of bytes the leaves are of
+func (dt *DiskTree) TotalLength() int64 {
+	return dt.length
+}
+
+// HashMaker is of the checksums of the tree
+func (dt *DiskTree) HashMaker() HashMaker {
+	return dt.hm
+}
+
+// RootChecksum is the checksum of the root, as computed while building
+func (dt *DiskTree) RootChecksum() ([]byte, error) {
+	if dt.leaves == 0 {
+		return nil, ErrEmptyTree
+	}
+	return dt.root, nil
+}
+
+// Leaf is the checksum of the leaf at index
+func (dt *DiskTree) Leaf(index int) ([]byte, error) {
+	if index < 0 || index >= dt.leaves {
+		return nil, ErrIndexOutOfRange{Index: index, Size: dt.leaves}
+	}
+	sum := make([]byte, dt.size)
+	if _, err := dt.f.ReadAt(sum, int64(index)*int64(dt.size)); err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+// InclusionProof returns the audit path for the leaf at index, as
+// Tree.InclusionProof does. The subtrees of the path are hashed from the file,
+// which reads each leaf once.
+func (dt *DiskTree) InclusionProof(index int) (Proof, error) {
+	if index < 0 || index >= dt.leaves {
+		return Proof{}, ErrIndexOutOfRange{Index: index, Size: dt.leaves}
+	}
+	path, err := dt.auditPath(index, 0, dt.leaves)
+	if err != nil {
+		return Proof{}, err
+	}
+	return Proof{Index: index, TreeSize: dt.leaves, Path: path}, nil
+}
+
+// auditPath is auditPath of the leaves [start, end), reading the subtrees of
+// siblings from the file
+func (dt *DiskTree) auditPath(m, start, end int) ([][]byte, error) {
+	n := end - start
+	if n <= 1 {
+		return nil, nil
+	}
+	k := splitPoint(n)
+	var (
+		path [][]byte
+		sib  []byte
+		err  error
+	)
+	if m < k {
+		if path, err = dt.auditPath(m, start, start+k); err != nil {
+			return nil, err
+		}
+		sib, err = dt.subtreeHash(start+k, end)
+	} else {
+		if path, err = dt.auditPath(m-k, start+k, end); err != nil {
+			return nil, err
+		}
+		sib, err = dt.subtreeHash(start, start+k)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(path, sib), nil
+}
+
+// subtreeHash is subtreeHash of the leaves [start, end), streamed from the
+// file. The ranges of an audit path are aligned, so the frontier of the
+// range is of decreasing subtrees, folded as for a whole tree.
+func (dt *DiskTree) subtreeHash(start, end int) ([]byte, error) {
+	var (
+		r       = bufio.NewReaderSize(io.NewSectionReader(dt.f, int64(start)*int64(dt.size), int64(end-start)*int64(dt.size)), 1<<16)
+		summary = SubtreeSummary{Start: start, End: start}
+	)
+	for i := start; i < end; i++ {
+		sum := make([]byte, dt.size)
+		if _, err := io.ReadFull(r, sum); err != nil {
+			return nil, err
+		}
+		leaf := SubtreeSummary{Start: i, End: i + 1, Frontier: [][]byte{sum}}
+		var err error
+		if summary, err = CombineSubtrees(dt.hm, summary, leaf); err != nil {
+			return nil, err
+		}
+	}
+	return foldFrontier(dt.hm, summary.Frontier)
+}
+
+// WriteTo writes the tree in the form of Tree.MarshalBinary, streaming the
+// leaves from the file, so it can be decoded as a Tree
+func (dt *DiskTree) WriteTo(w io.Writer) (int64, error) {
+	name, err := HashName(dt.hm)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		cw  = &countingWriter{w: w}
+		bw  = bufio.NewWriter(cw)
+		tmp [binary.MaxVarintLen64]byte
+	)
+	putUvarint := func(v uint64) {
+		bw.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+	}
+	bw.Write(serializedMagic)
+	bw.WriteByte(serializedVersion)
+	bw.WriteByte(byte(len(name)))
+	bw.WriteString(name)
+	bw.WriteByte(byte(dt.FinalBlock))
+	putUvarint(uint64(dt.BlockLength))
+	putUvarint(uint64(dt.length))
+	putUvarint(uint64(dt.leaves))
+	putUvarint(uint64(dt.size))
+	if dt.f != nil {
+		if _, err := io.Copy(bw, io.NewSectionReader(dt.f, 0, int64(dt.leaves)*int64(dt.size))); err != nil {
+			return cw.n, err
+		}
+	}
+	putUvarint(0) // no Bloom filter
+	err = bw.Flush()
+	return cw.n, err
+}
+
+// Tree reads the leaves into a Tree, for trees small enough to hold
+func (dt *DiskTree) Tree() (*Tree, error) {
+	tree := &Tree{BlockLength: dt.BlockLength, FinalBlock: dt.FinalBlock, length: dt.length}
+	if dt.f != nil {
+		r := bufio.NewReaderSize(io.NewSectionReader(dt.f, 0, int64(dt.leaves)*int64(dt.size)), 1<<16)
+		tree.Nodes = make([]*Node, dt.leaves)
+		slab := newLeafSlabOf(dt.hm, dt.leaves)
+		for i := range tree.Nodes {
+			n := slab.take()
+			if _, err := io.ReadFull(r, n.checksum()); err != nil {
+				return nil, err
+			}
+			tree.Nodes[i] = n
+		}
+	}
+	tree.setPositions()
+	return tree, nil
+}
+
+// Close removes the file of the leaves
+func (dt *DiskTree) Close() error {
+	if dt.f == nil {
+		return nil
+	}
+	err := dt.f.Close()
+	if rerr := os.Remove(dt.f.Name()); err == nil {
+		err = rerr
+	}
+	dt.f = nil
+	return err
+}
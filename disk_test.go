@@ -0,0 +1,91 @@
+package merkle
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDiskBuilder(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdefghij"), 50)
+	for _, size := range []int{1, 16, 17, 100, 256, 999, len(data)} {
+		expected, root, err := NewBuilder(DefaultHashMaker, 16).Build(bytes.NewReader(data[:size]), int64(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := NewDiskBuilder(DefaultHashMaker, 16, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// in writes that straddle the blocks
+		for i := 0; i < size; i += 7 {
+			end := i + 7
+			if end > size {
+				end = size
+			}
+			if _, err := b.Write(data[i:end]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		dt, got, err := b.Finalize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, root) || dt.Len() != len(expected.Nodes) || dt.TotalLength() != int64(size) {
+			t.Errorf("%d bytes: expected the root and leaves of the Builder", size)
+		}
+		for i := range expected.Nodes {
+			want, err := expected.InclusionProof(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			proof, err := dt.InclusionProof(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(proof, want) {
+				t.Errorf("%d bytes: expected the proof of leaf %d of the Builder", size, i)
+			}
+		}
+
+		var buf bytes.Buffer
+		if _, err := dt.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if want, _ := expected.MarshalBinary(); !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%d bytes: expected the serialized form of the Builder's tree", size)
+		}
+		tree, err := dt.Tree()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tree.Equal(expected) || tree.Nodes[len(tree.Nodes)-1].Length != expected.Nodes[len(expected.Nodes)-1].Length {
+			t.Errorf("%d bytes: expected the tree of the Builder", size)
+		}
+
+		name := dt.f.Name()
+		if err := dt.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("expected the file of the leaves removed, got %v", err)
+		}
+	}
+
+	b, err := NewDiskBuilder(DefaultHashMaker, 16, "", WithEmptyRoot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dt, root, err := b.Finalize()
+	if err != nil || !bytes.Equal(root, EmptyRoot(DefaultHashMaker)) || dt.Len() != 0 {
+		t.Errorf("expected the empty root of no input, got %x %v", root, err)
+	}
+	if _, err := dt.Leaf(0); err == nil {
+		t.Error("expected an error of a leaf of no leaves")
+	}
+
+	if _, err := NewDiskBuilder(DefaultHashMaker, 0, ""); err != (ErrInvalidBlockLength{Length: 0}) {
+		t.Errorf("expected an ErrInvalidBlockLength, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package merkle
+
+import (
+	"hash"
+	"reflect"
+	"strings"
+)
+
+// The prefixes of the checksums of leaves and interior nodes, of RFC 6962
+// section 2.1
+const (
+	leafPrefix     = 0x00
+	interiorPrefix = 0x01
+)
+
+// domainSuffix names a DomainSeparated hash, after the name of the hash it is
+// of (see HashName)
+const domainSuffix = "-rfc6962"
+
+// DomainSeparated returns hm with the leaves and interior nodes of trees
+// checksummed apart, as in RFC 6962: a leaf is the checksum of 0x00 and its
+// block, and an interior node of 0x01 and its children. Then an interior node
+// can not be passed off as a leaf, for a second preimage of a root. The root
+// of no leaves is still the checksum of no bytes.
+//
+// It is registered as the name of hm with "-rfc6962" after it, as
+// "sha256-rfc6962".
+func DomainSeparated(hm HashMaker) HashMaker {
+	if _, ok := hm().(*domainHash); ok {
+		return hm
+	}
+	return func() hash.Hash {
+		return &domainHash{Hash: hm(), prefix: leafPrefix}
+	}
+}
+
+// WithDomainSeparation makes the HashMaker of the trees built
+// DomainSeparated. With the default final block policy, and WithEmptyRoot for
+// no input, the roots and proofs are those of RFC 6962, as of Certificate
+// Transparency logs.
+func WithDomainSeparation() Option {
+	return func(o *options) {
+		o.given |= optDomainSeparation
+		o.domainSeparation = true
+	}
+}
+
+// hashMaker is hm, DomainSeparated if it is wanted
+func (o options) hashMaker(hm HashMaker) HashMaker {
+	if o.domainSeparation && hm != nil {
+		return DomainSeparated(hm)
+	}
+	return hm
+}
+
+// domainHash writes its prefix ahead of the first bytes written, or of Sum
+type domainHash struct {
+	hash.Hash
+	prefix  byte
+	started bool
+}
+
+func (d *domainHash) Write(p []byte) (int, error) {
+	if err := d.start(); err != nil {
+		return 0, err
+	}
+	return d.Hash.Write(p)
+}
+
+func (d *domainHash) Sum(b []byte) []byte {
+	d.start()
+	return d.Hash.Sum(b)
+}
+
+// Reset is back to no bytes written, of the same prefix
+func (d *domainHash) Reset() {
+	d.Hash.Reset()
+	d.started = false
+}
+
+func (d *domainHash) start() error {
+	if d.started {
+		return nil
+	}
+	d.started = true
+	_, err := d.Hash.Write([]byte{d.prefix})
+	return err
+}
+
+// interiorHash is a hash of hm for the checksum of an interior node, of the
+// interior prefix if hm is DomainSeparated
+func interiorHash(hm HashMaker) hash.Hash {
+	h := hm()
+	if d, ok := h.(*domainHash); ok {
+		d.prefix = interiorPrefix
+	}
+	return h
+}
+
+// unwrapHash is the hash a DomainSeparated hash is of, and whether it was
+func unwrapHash(h hash.Hash) (hash.Hash, bool) {
+	if d, ok := h.(*domainHash); ok {
+		return d.Hash, true
+	}
+	return h, false
+}
+
+// sameHashes is whether a and b are of the same hash, as HashName matches them
+func sameHashes(a, b hash.Hash) bool {
+	a, da := unwrapHash(a)
+	b, db := unwrapHash(b)
+	return da == db && reflect.TypeOf(a) == reflect.TypeOf(b) && a.Size() == b.Size()
+}
+
+// lookupDomainSeparated is the DomainSeparated hash of a name with the
+// domainSuffix
+func lookupDomainSeparated(name string) (HashMaker, bool) {
+	if !strings.HasSuffix(name, domainSuffix) {
+		return nil, false
+	}
+	hm, ok := LookupHash(strings.TrimSuffix(name, domainSuffix))
+	if !ok {
+		return nil, false
+	}
+	return DomainSeparated(hm), true
+}
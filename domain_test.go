@@ -0,0 +1,146 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"testing"
+)
+
+func TestDomainSeparated(t *testing.T) {
+	sha256Maker := func() hash.Hash { return sha256.New() }
+	hm := DomainSeparated(sha256Maker)
+	if got := DomainSeparated(hm); !sameHash(got, hm) {
+		t.Errorf("expected DomainSeparated of a DomainSeparated HashMaker to be the same")
+	}
+
+	// RFC 6962: leaves of 0x00 and the block, interior of 0x01 and the children
+	leaf := func(b byte) []byte {
+		s := sha256.Sum256([]byte{leafPrefix, b})
+		return s[:]
+	}
+	interior := func(l, r []byte) []byte {
+		s := sha256.Sum256(append(append([]byte{interiorPrefix}, l...), r...))
+		return s[:]
+	}
+	expected := interior(interior(leaf(0), leaf(1)), leaf(2))
+
+	b := NewBuilder(sha256Maker, 1, WithDomainSeparation())
+	if _, err := b.Write([]byte{0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	tree, root, err := b.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root, expected) {
+		t.Errorf("expected root %x; got %x", expected, root)
+	}
+	if sum, err := tree.Root().Checksum(); err != nil || !bytes.Equal(sum, expected) {
+		t.Errorf("expected the root node %x; got %x %v", expected, sum, err)
+	}
+	p, err := tree.InclusionProof(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := rootFromProof(tree.hashMaker(), p, leaf(2)); err != nil || !bytes.Equal(got, expected) {
+		t.Errorf("expected the proof of a leaf to the root; got %x %v", got, err)
+	}
+
+	if !bytes.Equal(EmptyRoot(hm), EmptyRoot(sha256Maker)) {
+		t.Errorf("expected the empty root of the checksum of no bytes")
+	}
+
+	name, err := HashName(hm)
+	if err != nil || name != "sha256-rfc6962" {
+		t.Fatalf("expected the name sha256-rfc6962; got %q %v", name, err)
+	}
+	if name, err := HashName(sha256Maker); err != nil || name != "sha256" {
+		t.Errorf("expected the name sha256; got %q %v", name, err)
+	}
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Tree
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if sum, err := got.RootChecksum(); err != nil || !bytes.Equal(sum, expected) {
+		t.Errorf("expected the root of the tree read back; got %x %v", sum, err)
+	}
+}
+
+// mth is the Merkle Tree Hash of RFC 6962 section 2.1, of the leaves as is
+func mth(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		s := sha256.Sum256(nil)
+		return s[:]
+	case 1:
+		s := sha256.Sum256(append([]byte{leafPrefix}, leaves[0]...))
+		return s[:]
+	}
+	k := splitPoint(len(leaves))
+	s := sha256.Sum256(append(append([]byte{interiorPrefix}, mth(leaves[:k])...), mth(leaves[k:])...))
+	return s[:]
+}
+
+func TestDomainSeparationRFC6962(t *testing.T) {
+	// the root of no leaves, of the RFC 6962 reference tests
+	const emptyRoot = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	h, err := New(sha256.New, 16, WithDomainSeparation(), WithEmptyRoot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != emptyRoot {
+		t.Errorf("expected the empty root %s; got %s", emptyRoot, got)
+	}
+
+	// a stream of the option is of the roots, inclusion and consistency proofs
+	// of RFC 6962, as of Certificate Transparency
+	data := make([]byte, 16*7+5)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	var leaves [][]byte
+	for i := 0; i < len(data); i += 16 {
+		end := i + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		leaves = append(leaves, data[i:end])
+	}
+	if _, err := h.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	root, err := h.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := mth(leaves); !bytes.Equal(root, expected) {
+		t.Fatalf("expected the root %x; got %x", expected, root)
+	}
+	tree := h.(*merkleHash).tree
+	hm := tree.hashMaker()
+	for i, leaf := range leaves {
+		p, err := tree.InclusionProof(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(append([]byte{leafPrefix}, leaf...))
+		if !VerifyInclusion(root, p, sum[:], hm) {
+			t.Errorf("expected the proof of leaf %d to verify", i)
+		}
+	}
+	for m := 1; m <= len(leaves); m++ {
+		proof, err := tree.ConsistencyProof(m, len(leaves))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyConsistency(hm, m, len(leaves), mth(leaves[:m]), root, proof); err != nil {
+			t.Errorf("expected the consistency of %d leaves to verify; got %v", m, err)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package merkle
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"os/exec"
+	"sync"
+)
+
+// ExternalHasher is a hash computed out of process, by a helper spoken to
+// over a pipe or a socket, so hash implementations that are proprietary or
+// hardware accelerated can be used without cgo in this package.
+//
+// Each message either way is a frame of a uvarint length and that many bytes.
+// The helper first sends a hello frame of a uvarint of the digest size and the
+// name of the hash. Then for each request frame, of the bytes to hash, it
+// sends a response frame of a 0 byte and the digest, or of a 1 byte and an
+// error message. ServeExternalHasher is the helper side.
+//
+// The bytes written to a hash.Hash of the HashMaker are kept until Sum, so
+// this suits the blocks of a tree rather than whole streams.
+type ExternalHasher struct {
+	Name string // of the hash, as told by the helper
+	Size int    // of the digest, as told by the helper
+
+	mu     sync.Mutex
+	r      *bufio.Reader
+	w      io.Writer
+	closer io.Closer
+	cmd    *exec.Cmd
+	err    error
+}
+
+// ErrExternalHasher is an error sent by the helper of an ExternalHasher
+type ErrExternalHasher struct {
+	Msg string
+}
+
+// Error shows the message of the helper
+func (err ErrExternalHasher) Error() string {
+	return "external hasher: " + err.Msg
+}
+
+// ErrExternalHasherClosed is for a helper that has closed the connection
+var ErrExternalHasherClosed = errors.New("external hasher closed")
+
+// maxExternalFrame caps the frames read, of blocks to the helper and of
+// digests and messages from it
+const maxExternalFrame = 64 << 20
+
+// NewExternalHasher speaks to a helper over rw, reading its hello frame
+func NewExternalHasher(rw io.ReadWriteCloser) (*ExternalHasher, error) {
+	e := &ExternalHasher{r: bufio.NewReader(rw), w: rw, closer: rw}
+	hello, err := readFrame(e.r)
+	if err != nil {
+		rw.Close()
+		return nil, err
+	}
+	size, n := binary.Uvarint(hello)
+	if n <= 0 || size == 0 || size > maxExternalFrame {
+		rw.Close()
+		return nil, fmt.Errorf("malformed hello from external hasher")
+	}
+	e.Size, e.Name = int(size), string(hello[n:])
+	return e, nil
+}
+
+// StartExternalHasher runs the helper command name with args, speaking to it
+// over its stdin and stdout
+func StartExternalHasher(name string, args ...string) (*ExternalHasher, error) {
+	cmd := exec.Command(name, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	e, err := NewExternalHasher(pipe{Reader: stdout, WriteCloser: stdin})
+	if err != nil {
+		cmd.Wait()
+		return nil, err
+	}
+	e.cmd = cmd
+	return e, nil
+}
+
+// DialExternalHasher connects to a helper listening on address, as of
+// net.Dial
+func DialExternalHasher(network, address string) (*ExternalHasher, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewExternalHasher(conn)
+}
+
+type pipe struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// HashMaker returns a HashMaker of hashes computed by the helper
+func (e *ExternalHasher) HashMaker() HashMaker {
+	return func() hash.Hash {
+		return &externalHash{e: e}
+	}
+}
+
+// Err is the first error of a Sum, which can not return it. Later Sums fail
+// the same.
+func (e *ExternalHasher) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// Close closes the connection to the helper, and waits for a command of
+// StartExternalHasher to exit
+func (e *ExternalHasher) Close() error {
+	err := e.closer.Close()
+	if e.cmd != nil {
+		if werr := e.cmd.Wait(); err == nil {
+			err = werr
+		}
+	}
+	return err
+}
+
+// digest is the checksum of b, computed by the helper
+func (e *ExternalHasher) digest(b []byte) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err != nil {
+		return nil, e.err
+	}
+	sum, err := e.roundTrip(b)
+	if err != nil {
+		if _, ok := err.(ErrExternalHasher); !ok {
+			// the framing is lost, so the connection is of no further use
+			e.err = err
+		}
+		return nil, err
+	}
+	return sum, nil
+}
+
+func (e *ExternalHasher) roundTrip(b []byte) ([]byte, error) {
+	if _, err := e.w.Write(appendUvarint(nil, uint64(len(b)))); err != nil {
+		return nil, err
+	}
+	if _, err := e.w.Write(b); err != nil {
+		return nil, err
+	}
+	resp, err := readFrame(e.r)
+	if err == io.EOF {
+		return nil, ErrExternalHasherClosed
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(resp) > 0 && resp[0] == 1:
+		return nil, ErrExternalHasher{Msg: string(resp[1:])}
+	case len(resp) != 1+e.Size || resp[0] != 0:
+		return nil, fmt.Errorf("malformed response from external hasher")
+	}
+	return resp[1:], nil
+}
+
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxExternalFrame {
+		return nil, ErrLimitExceeded{Limit: "frame bytes", Max: maxExternalFrame}
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// externalHash is a hash.Hash of an ExternalHasher, of the bytes written
+// since the last Reset
+type externalHash struct {
+	e   *ExternalHasher
+	buf []byte
+}
+
+func (h *externalHash) Write(b []byte) (int, error) {
+	if len(h.buf)+len(b) > maxExternalFrame {
+		return 0, ErrLimitExceeded{Limit: "frame bytes", Max: maxExternalFrame}
+	}
+	h.buf = append(h.buf, b...)
+	return len(b), nil
+}
+
+// Sum appends the digest from the helper to b. A failure is logged, and b
+// returned as is, with the error kept for ExternalHasher.Err.
+func (h *externalHash) Sum(b []byte) []byte {
+	sum, err := h.e.digest(h.buf)
+	if err != nil {
+		logSumError(err)
+		return b
+	}
+	return append(b, sum...)
+}
+
+func (h *externalHash) Reset()         { h.buf = h.buf[:0] }
+func (h *externalHash) Size() int      { return h.e.Size }
+func (h *externalHash) BlockSize() int { return 64 }
+
+// ServeExternalHasher is the helper side of an ExternalHasher, hashing each
+// request read from rw with hm, until rw is closed
+func ServeExternalHasher(rw io.ReadWriter, name string, hm HashMaker) error {
+	var (
+		r    = bufio.NewReader(rw)
+		size = hm().Size()
+	)
+	hello := append(appendUvarint(nil, uint64(size)), name...)
+	if _, err := rw.Write(append(appendUvarint(nil, uint64(len(hello))), hello...)); err != nil {
+		return err
+	}
+	for {
+		req, err := readFrame(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		h := hm()
+		resp := []byte{0}
+		if _, err := h.Write(req); err != nil {
+			resp = append([]byte{1}, err.Error()...)
+		} else {
+			resp = h.Sum(resp)
+		}
+		if _, err := rw.Write(append(appendUvarint(nil, uint64(len(resp))), resp...)); err != nil {
+			return err
+		}
+	}
+}
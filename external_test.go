@@ -0,0 +1,46 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"net"
+	"testing"
+)
+
+func TestExternalHasher(t *testing.T) {
+	client, server := net.Pipe()
+	go ServeExternalHasher(server, "sha256", sha256.New)
+	e, err := NewExternalHasher(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Name != "sha256" || e.Size != sha256.Size {
+		t.Errorf("expected the hello of sha256, got %q of %d bytes", e.Name, e.Size)
+	}
+
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	expected, err := SumOf(sha256.New, 64, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := SumOf(e.HashMaker(), 64, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := expected.RootChecksum()
+	b, _ := got.RootChecksum()
+	if !bytes.Equal(a, b) {
+		t.Errorf("expected the root %x, got %x", a, b)
+	}
+
+	server.Close()
+	h := e.HashMaker()()
+	h.Write([]byte("after"))
+	if sum := h.Sum(nil); len(sum) != 0 {
+		t.Errorf("expected no digest from a closed helper, got %x", sum)
+	}
+	if e.Err() == nil {
+		t.Error("expected the error of the closed helper")
+	}
+	e.Close()
+}
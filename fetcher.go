@@ -0,0 +1,216 @@
+package merkle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RangeFetcher reads ranges of a blob, by Range requests to any of a list of
+// endpoints serving the same blob, such as CDN edges and the origin. Each block
+// is verified against the tree of the blob, and a block that fails is fetched
+// again from the next endpoint.
+type RangeFetcher struct {
+	Client    *http.Client
+	Endpoints []string // URLs of the blob
+	Tree      *Tree
+	Retries   int // passes over the endpoints beyond the first, for each range
+
+	mu    sync.Mutex
+	next  int // endpoint to start the next range from
+	stats map[string]*EndpointStats
+	root  []byte // of the Tree, for AuditEvents
+}
+
+// EndpointStats are the counts of requests to an endpoint, and of those that
+// failed or returned corrupt blocks
+type EndpointStats struct {
+	Requests, Failures, CorruptBlocks int64
+}
+
+// ErrNoBlockLength is for a tree without a fixed BlockLength, whose blocks
+// can not be located by offset
+var ErrNoBlockLength = errors.New("tree has no block length")
+
+// NewRangeFetcher returns a RangeFetcher of the blob of tree from endpoints
+func NewRangeFetcher(tree *Tree, endpoints ...string) *RangeFetcher {
+	return &RangeFetcher{Endpoints: endpoints, Tree: tree}
+}
+
+// ReadAt reads len(p) bytes of the blob from off, fetching and verifying the
+// blocks covering them
+func (f *RangeFetcher) ReadAt(p []byte, off int64) (int, error) {
+	if f.Tree.BlockLength <= 0 {
+		return 0, ErrNoBlockLength
+	}
+	if len(f.Endpoints) == 0 {
+		return 0, fmt.Errorf("no endpoints to fetch from")
+	}
+	total := f.Tree.TotalLength()
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if off >= total {
+		return 0, io.EOF
+	}
+	n := int64(len(p))
+	if off+n > total {
+		n = total - off
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	bl := int64(f.Tree.BlockLength)
+	first, last := int(off/bl), int((off+n-1)/bl)
+	data, err := f.blocks(first, last)
+	if err != nil {
+		return 0, err
+	}
+	copy(p, data[off-int64(first)*bl:])
+	if n < int64(len(p)) {
+		return int(n), io.EOF
+	}
+	return int(n), nil
+}
+
+// Stats returns the counts of each endpoint requested so far
+func (f *RangeFetcher) Stats() map[string]EndpointStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := map[string]EndpointStats{}
+	for endpoint, s := range f.stats {
+		stats[endpoint] = *s
+	}
+	return stats
+}
+
+// blocks fetches and verifies the blocks [first, last], keeping the blocks
+// verified so far when an endpoint fails. When every attempt fails, a corrupt
+// block is reported over an unavailable endpoint.
+func (f *RangeFetcher) blocks(first, last int) ([]byte, error) {
+	var (
+		out      []byte
+		lastErr  error
+		corrupt  error
+		attempts = len(f.Endpoints) * (f.Retries + 1)
+		start    = f.rotate()
+		hm       = f.Tree.hashMaker()
+	)
+	for a := 0; a < attempts && first <= last; a++ {
+		endpoint := f.Endpoints[(start+a)%len(f.Endpoints)]
+		data, err := f.get(endpoint, first, last)
+		if err != nil {
+			f.count(endpoint, func(s *EndpointStats) { s.Failures++ })
+			lastErr = err
+			continue
+		}
+		for first <= last {
+			begin, end := f.blockBounds(first)
+			b := data[:end-begin]
+			if err := f.verifyBlock(hm, first, b); err != nil {
+				f.count(endpoint, func(s *EndpointStats) { s.CorruptBlocks++ })
+				corrupt = err
+				break
+			}
+			out = append(out, b...)
+			data = data[len(b):]
+			first++
+		}
+	}
+	if first <= last {
+		if corrupt != nil {
+			return nil, corrupt
+		}
+		return nil, lastErr
+	}
+	return out, nil
+}
+
+// verifyBlock checks the block at index against the leaf of the Tree, sent
+// as the outcome of verifying it
+func (f *RangeFetcher) verifyBlock(hm HashMaker, index int, b []byte) error {
+	sink := auditing()
+	if sink == nil {
+		return verifyBlock(f.Tree, hm, index, b)
+	}
+	start := time.Now()
+	err := verifyBlock(f.Tree, hm, index, b)
+	f.mu.Lock()
+	if f.root == nil {
+		f.root = auditRoot(f.Tree)
+	}
+	root := f.root
+	f.mu.Unlock()
+	audit(sink, AuditEvent{Kind: "block", Object: f.Tree.object, Root: root, Index: index}, start, err)
+	return err
+}
+
+// get requests the bytes of the blocks [first, last] from endpoint
+func (f *RangeFetcher) get(endpoint string, first, last int) ([]byte, error) {
+	f.count(endpoint, func(s *EndpointStats) { s.Requests++ })
+	begin, _ := f.blockBounds(first)
+	_, end := f.blockBounds(last)
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", begin, end-1))
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("GET %s: %s", endpoint, resp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, end-begin+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != end-begin {
+		return nil, fmt.Errorf("GET %s: %d bytes for a range of %d", endpoint, len(data), end-begin)
+	}
+	return data, nil
+}
+
+// blockBounds are the offsets of the block at index within the blob
+func (f *RangeFetcher) blockBounds(index int) (int64, int64) {
+	bl := int64(f.Tree.BlockLength)
+	begin, end := int64(index)*bl, int64(index+1)*bl
+	if total := f.Tree.TotalLength(); end > total {
+		end = total
+	}
+	return begin, end
+}
+
+// rotate returns the endpoint to start a range from, spreading ranges over the
+// endpoints
+func (f *RangeFetcher) rotate() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := f.next
+	f.next = (f.next + 1) % len(f.Endpoints)
+	return i
+}
+
+func (f *RangeFetcher) count(endpoint string, fn func(*EndpointStats)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stats == nil {
+		f.stats = map[string]*EndpointStats{}
+	}
+	s, ok := f.stats[endpoint]
+	if !ok {
+		s = &EndpointStats{}
+		f.stats[endpoint] = s
+	}
+	fn(s)
+}
@@ -0,0 +1,76 @@
+package merkle
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func serveBlob(data []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "blob", time.Time{}, bytes.NewReader(data))
+	}))
+}
+
+func TestRangeFetcher(t *testing.T) {
+	data := make([]byte, 10*1024+300)
+	rand.New(rand.NewSource(5)).Read(data)
+	tree, _, err := NewBuilder(DefaultHashMaker, 1024).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := append([]byte{}, data...)
+	corrupt[3*1024+10]++
+	var (
+		good   = serveBlob(data)
+		bad    = serveBlob(corrupt)
+		broken = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+	)
+	defer good.Close()
+	defer bad.Close()
+	defer broken.Close()
+
+	f := NewRangeFetcher(tree, bad.URL, broken.URL, good.URL)
+	for _, r := range []struct{ off, n int }{{3 * 1024, 1}, {0, 100}, {1000, 3000}, {9000, 2000}, {0, len(data)}} {
+		p := make([]byte, r.n)
+		n, err := f.ReadAt(p, int64(r.off))
+		if err != nil && err != io.EOF {
+			t.Fatalf("[%d, +%d): %s", r.off, r.n, err)
+		}
+		if !bytes.Equal(p[:n], data[r.off:r.off+n]) {
+			t.Errorf("[%d, +%d): expected the blob's bytes", r.off, r.n)
+		}
+	}
+
+	p := make([]byte, 500)
+	n, err := f.ReadAt(p, int64(len(data)-200))
+	if n != 200 || err != io.EOF {
+		t.Errorf("expected 200 bytes and io.EOF at the end, got %d, %v", n, err)
+	}
+	if _, err := f.ReadAt(p, int64(len(data))); err != io.EOF {
+		t.Errorf("expected io.EOF past the end, got %v", err)
+	}
+
+	stats := f.Stats()
+	if stats[bad.URL].CorruptBlocks == 0 {
+		t.Errorf("expected corrupt blocks counted for the bad endpoint, got %+v", stats[bad.URL])
+	}
+	if stats[broken.URL].Failures == 0 || stats[broken.URL].Failures != stats[broken.URL].Requests {
+		t.Errorf("expected every request of the broken endpoint to fail, got %+v", stats[broken.URL])
+	}
+	if stats[good.URL].Failures != 0 || stats[good.URL].CorruptBlocks != 0 {
+		t.Errorf("expected no failures of the good endpoint, got %+v", stats[good.URL])
+	}
+
+	f = NewRangeFetcher(tree, bad.URL, broken.URL)
+	if _, err := f.ReadAt(make([]byte, 10), 3*1024); err != (ErrBlockMismatch{Index: 3}) {
+		t.Errorf("expected block 3 to fail on every endpoint, got %v", err)
+	}
+}
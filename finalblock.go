@@ -0,0 +1,99 @@
+package merkle
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
+// FinalBlockPolicy is how a trailing block, shorter than the BlockLength, is
+// committed to as the last leaf of a tree. It is kept with the Tree, so a
+// verifier can apply the same policy.
+type FinalBlockPolicy int
+
+const (
+	// FinalBlockRaw is the checksum of the short block as is
+	FinalBlockRaw FinalBlockPolicy = iota
+
+	// FinalBlockPadded is the checksum of the short block, padded with zeros
+	// to the BlockLength
+	FinalBlockPadded
+
+	// FinalBlockLengthSuffixed is the checksum of the short block followed by
+	// its length, as a big endian uint64. Unlike padding, this can not collide
+	// with a whole block that ends in zeros.
+	FinalBlockLengthSuffixed
+)
+
+var finalBlockPolicyNames = map[FinalBlockPolicy]string{
+	FinalBlockRaw:            "raw",
+	FinalBlockPadded:         "padded",
+	FinalBlockLengthSuffixed: "length-suffixed",
+}
+
+func (p FinalBlockPolicy) String() string {
+	if name, ok := finalBlockPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("FinalBlockPolicy(%d)", int(p))
+}
+
+// MarshalText is the name of the policy
+func (p FinalBlockPolicy) MarshalText() ([]byte, error) {
+	if name, ok := finalBlockPolicyNames[p]; ok {
+		return []byte(name), nil
+	}
+	return nil, fmt.Errorf("unknown final block policy %d", int(p))
+}
+
+// UnmarshalText is the policy of the name
+func (p *FinalBlockPolicy) UnmarshalText(text []byte) error {
+	for policy, name := range finalBlockPolicyNames {
+		if name == string(text) {
+			*p = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown final block policy %q", text)
+}
+
+// NewNode returns the leaf Node for the block b, by this policy when b is
+// shorter than blockLength
+func (p FinalBlockPolicy) NewNode(hm HashMaker, blockLength int, b []byte) (*Node, error) {
+	h := hm()
+	if err := p.writeBlock(h, blockLength, b); err != nil {
+		return nil, err
+	}
+	return newLeaf(hm, h.Sum(nil)), nil
+}
+
+// writeBlock writes the bytes checksummed for the leaf of b to h, by this
+// policy when b is shorter than blockLength. The padding and suffix are
+// written after b, rather than copied with it.
+func (p FinalBlockPolicy) writeBlock(h hash.Hash, blockLength int, b []byte) error {
+	if _, err := h.Write(b); err != nil || len(b) >= blockLength {
+		return err
+	}
+	switch p {
+	case FinalBlockRaw:
+		return nil
+	case FinalBlockPadded:
+		for pad := blockLength - len(b); pad > 0; {
+			n := pad
+			if n > len(zeros) {
+				n = len(zeros)
+			}
+			if _, err := h.Write(zeros[:n]); err != nil {
+				return err
+			}
+			pad -= n
+		}
+		return nil
+	case FinalBlockLengthSuffixed:
+		var suffix [8]byte
+		binary.BigEndian.PutUint64(suffix[:], uint64(len(b)))
+		_, err := h.Write(suffix[:])
+		return err
+	}
+	return fmt.Errorf("unknown final block policy %d", int(p))
+}
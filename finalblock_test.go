@@ -0,0 +1,71 @@
+package merkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFinalBlockPolicies(t *testing.T) {
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+	roots := map[string]FinalBlockPolicy{}
+	for _, p := range []FinalBlockPolicy{FinalBlockRaw, FinalBlockPadded, FinalBlockLengthSuffixed} {
+		h, err := New(DefaultHashMaker, 10, WithFinalBlockPolicy(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := h.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		sum := h.Sum(nil)
+		if prior, ok := roots[string(sum)]; ok {
+			t.Errorf("%s and %s have the same root", p, prior)
+		}
+		roots[string(sum)] = p
+
+		b := NewBuilder(DefaultHashMaker, 10, WithFinalBlockPolicy(p))
+		tree, root, err := b.Build(bytes.NewReader(msg), int64(len(msg)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(root, sum) {
+			t.Errorf("%s: expected Build root %x; got %x", p, sum, root)
+		}
+		if tree.FinalBlock != p {
+			t.Errorf("expected the tree to have policy %s, got %s", p, tree.FinalBlock)
+		}
+
+		// a verifier applies the tree's policy to the short block
+		last, err := tree.FinalBlock.NewNode(DefaultHashMaker, tree.BlockLength, msg[40:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(last.checksum(), tree.Nodes[4].checksum()) {
+			t.Errorf("%s: the final leaf does not match the policy", p)
+		}
+
+		text, err := p.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got FinalBlockPolicy
+		if err := got.UnmarshalText(text); err != nil {
+			t.Fatal(err)
+		}
+		if got != p {
+			t.Errorf("expected %s, got %s", p, got)
+		}
+	}
+
+	// whole blocks are not affected by the policy
+	padded, err := FinalBlockPadded.NewNode(DefaultHashMaker, 10, msg[:10])
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := NewNodeHashBlock(DefaultHashMaker, msg[:10])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(padded.checksum(), raw.checksum()) {
+		t.Errorf("expected a whole block to not be padded")
+	}
+}
@@ -0,0 +1,144 @@
+package merkle
+
+import "fmt"
+
+// FrozenTree is an immutable tree laid out for serving roots and proofs. The
+// checksums of each level, from the leaves up to the root, are packed into
+// one array, so a proof is a lookup of a sibling on each level rather than
+// hashing, and walks memory a level at a time rather than a Node at a time.
+//
+// The checksums returned by its methods share the memory of the tree, and are
+// not to be modified. It is safe for concurrent use.
+type FrozenTree struct {
+	BlockLength int
+	FinalBlock  FinalBlockPolicy
+
+	hm      HashMaker
+	size    int      // of the checksums
+	counts  []int    // of the checksums of each level
+	levels  [][]byte // of the checksums of each level, the leaves first
+	lengths []int    // of the leaves, of a tree of no block length
+	length  int64
+}
+
+// Freeze computes every level of the tree into a FrozenTree. The levels are of
+// the shape of Root, each pairing the checksums of the one below and
+// promoting an odd last one.
+func (t *Tree) Freeze() (*FrozenTree, error) {
+	var (
+		hm   = t.hashMaker()
+		size = hm().Size()
+		ft   = &FrozenTree{BlockLength: t.BlockLength, FinalBlock: t.FinalBlock, hm: hm, size: size, length: t.length}
+	)
+	if len(t.Nodes) == 0 {
+		return ft, nil
+	}
+	leaves := make([]byte, 0, len(t.Nodes)*size)
+	for i, n := range t.Nodes {
+		if len(n.checksum()) != size {
+			return nil, fmt.Errorf("leaf %d has a checksum of %d bytes, expected %d", i, len(n.checksum()), size)
+		}
+		leaves = append(leaves, n.checksum()...)
+	}
+	if t.BlockLength == 0 {
+		ft.lengths = make([]int, len(t.Nodes))
+		for i, n := range t.Nodes {
+			ft.lengths[i] = n.Length
+		}
+	}
+	ft.counts, ft.levels = []int{len(t.Nodes)}, [][]byte{leaves}
+	for count, level := len(t.Nodes), leaves; count > 1; {
+		next := make([]byte, 0, (count+1)/2*size)
+		for i := 0; i+1 < count; i += 2 {
+			sum, err := hashChildren(hm, level[i*size:(i+1)*size], level[(i+1)*size:(i+2)*size])
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, sum...)
+		}
+		if count%2 == 1 {
+			next = append(next, level[(count-1)*size:]...)
+		}
+		count, level = (count+1)/2, next
+		ft.counts, ft.levels = append(ft.counts, count), append(ft.levels, level)
+	}
+	return ft, nil
+}
+
+// Len is the count of leaves
+func (ft *FrozenTree) Len() int {
+	if len(ft.counts) == 0 {
+		return 0
+	}
+	return ft.counts[0]
+}
+
+// TotalLength is the count of bytes the leaves are of
+func (ft *FrozenTree) TotalLength() int64 {
+	return ft.length
+}
+
+// HashMaker is of the checksums of the tree
+func (ft *FrozenTree) HashMaker() HashMaker {
+	return ft.hm
+}
+
+// RootChecksum is the checksum of the root. An empty tree is ErrEmptyTree.
+func (ft *FrozenTree) RootChecksum() ([]byte, error) {
+	if ft.Len() == 0 {
+		return nil, ErrEmptyTree
+	}
+	return ft.sum(len(ft.levels)-1, 0), nil
+}
+
+// Leaf is the checksum of the leaf at index
+func (ft *FrozenTree) Leaf(index int) ([]byte, error) {
+	if index < 0 || index >= ft.Len() {
+		return nil, ErrIndexOutOfRange{Index: index, Size: ft.Len()}
+	}
+	return ft.sum(0, index), nil
+}
+
+// InclusionProof returns the audit path for the leaf at index, as
+// Tree.InclusionProof does, of the sibling on each level that has one
+func (ft *FrozenTree) InclusionProof(index int) (Proof, error) {
+	if index < 0 || index >= ft.Len() {
+		return Proof{}, ErrIndexOutOfRange{Index: index, Size: ft.Len()}
+	}
+	var path [][]byte
+	for k, i := 0, index; k < len(ft.levels)-1; k, i = k+1, i/2 {
+		if sib := i ^ 1; sib < ft.counts[k] {
+			path = append(path, ft.sum(k, sib))
+		}
+	}
+	return Proof{Index: index, TreeSize: ft.Len(), Path: path}, nil
+}
+
+// sum is the checksum at index i of level k, capped so appending to it can not
+// write over the next
+func (ft *FrozenTree) sum(k, i int) []byte {
+	return ft.levels[k][i*ft.size : (i+1)*ft.size : (i+1)*ft.size]
+}
+
+// Tree is the leaves of the frozen tree, copied into a Tree
+func (ft *FrozenTree) Tree() *Tree {
+	tree := &Tree{BlockLength: ft.BlockLength, FinalBlock: ft.FinalBlock, length: ft.length}
+	if ft.Len() == 0 {
+		return tree
+	}
+	slab := newLeafSlabOf(ft.hm, ft.Len())
+	tree.Nodes = make([]*Node, ft.Len())
+	var offset int64
+	for i := range tree.Nodes {
+		tree.Nodes[i] = slab.leaf(ft.sum(0, i))
+		if ft.lengths != nil {
+			n := tree.Nodes[i]
+			n.Index, n.Offset, n.Length = i, offset, ft.lengths[i]
+			offset += int64(n.Length)
+		}
+	}
+	if ft.lengths == nil {
+		tree.setPositions()
+	}
+	return tree
+}
@@ -0,0 +1,78 @@
+package merkle
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestFreeze(t *testing.T) {
+	for size := 0; size <= 33; size++ {
+		tree := testTree(t, size)
+		ft, err := tree.Freeze()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ft.Len() != size {
+			t.Fatalf("expected %d leaves, got %d", size, ft.Len())
+		}
+		if size == 0 {
+			if _, err := ft.RootChecksum(); err != ErrEmptyTree {
+				t.Errorf("expected ErrEmptyTree of no leaves, got %v", err)
+			}
+			continue
+		}
+		expected, err := tree.RootChecksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := ft.RootChecksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(root, expected) {
+			t.Errorf("%d leaves: expected the root of the tree", size)
+		}
+		for i := 0; i < size; i++ {
+			want, err := tree.InclusionProof(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ft.InclusionProof(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%d leaves: unexpected proof of leaf %d", size, i)
+			}
+			if leaf, _ := ft.Leaf(i); !bytes.Equal(leaf, tree.Nodes[i].checksum()) {
+				t.Errorf("%d leaves: unexpected leaf %d", size, i)
+			}
+		}
+		if _, err := ft.InclusionProof(size); err == nil {
+			t.Errorf("%d leaves: expected an error of a leaf out of range", size)
+		}
+		if !ft.Tree().Equal(tree) {
+			t.Errorf("%d leaves: expected the tree thawed as frozen", size)
+		}
+	}
+
+	// the positions of chunks of varying length are kept
+	tree, _, err := NewBuilder(DefaultHashMaker, 0).BuildChunks([][]byte{[]byte("a"), []byte("bcd"), []byte("ef")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft, err := tree.Freeze()
+	if err != nil {
+		t.Fatal(err)
+	}
+	thawed := ft.Tree()
+	if n := thawed.Nodes[2]; n.Offset != 4 || n.Length != 2 || thawed.TotalLength() != 6 {
+		t.Errorf("expected the last chunk at 4 of 2 bytes, got %d of %d", n.Offset, n.Length)
+	}
+
+	tree.Nodes[1] = NewNode()
+	if _, err := tree.Freeze(); err == nil {
+		t.Error("expected an error of a leaf of no checksum")
+	}
+}
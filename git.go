@@ -0,0 +1,157 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// Modes of the entries of a Git tree
+const (
+	GitModeFile       = "100644"
+	GitModeExecutable = "100755"
+	GitModeSymlink    = "120000"
+	GitModeDir        = "40000"
+	GitModeSubmodule  = "160000"
+)
+
+// GitTreeEntry is an entry of a Git tree object
+type GitTreeEntry struct {
+	Mode string
+	Name string
+	ID   []byte // of the blob, tree or commit
+}
+
+// GitBlobID returns the object ID of a blob of size bytes read from r, as `git
+// hash-object` does. hm is sha1 for most repositories, or sha256 for those with
+// that object format.
+func GitBlobID(hm HashMaker, size int64, r io.Reader) ([]byte, error) {
+	h := hm()
+	fmt.Fprintf(h, "blob %d\x00", size)
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+	if n != size {
+		return nil, fmt.Errorf("blob of %d bytes, expected %d", n, size)
+	}
+	return h.Sum(nil), nil
+}
+
+// GitTreeID returns the object ID of a tree of the entries, sorted as Git
+// sorts them, with directories compared as if their name ended in "/"
+func GitTreeID(hm HashMaker, entries []GitTreeEntry) ([]byte, error) {
+	sorted := append([]GitTreeEntry{}, entries...)
+	sort.Slice(sorted, func(i, j int) bool { return gitSortName(sorted[i]) < gitSortName(sorted[j]) })
+
+	var body bytes.Buffer
+	for _, e := range sorted {
+		if _, err := strconv.ParseUint(e.Mode, 8, 32); err != nil {
+			return nil, fmt.Errorf("invalid mode %q of %q", e.Mode, e.Name)
+		}
+		body.WriteString(e.Mode)
+		body.WriteByte(' ')
+		body.WriteString(e.Name)
+		body.WriteByte(0)
+		body.Write(e.ID)
+	}
+	h := hm()
+	fmt.Fprintf(h, "tree %d\x00", body.Len())
+	h.Write(body.Bytes())
+	return h.Sum(nil), nil
+}
+
+func gitSortName(e GitTreeEntry) string {
+	if e.Mode == GitModeDir {
+		return e.Name + "/"
+	}
+	return e.Name
+}
+
+// GitHashDir returns the hex encoded ID of the tree object of the directory at
+// path, as if its content were committed, so a checkout can be verified against
+// the tree of an upstream commit. Like Git, any ".git" is skipped, empty
+// directories are left out, and only the executable bit of a file's mode is
+// kept.
+func GitHashDir(hm HashMaker, path string) (string, error) {
+	id, err := gitHashDir(hm, path)
+	if err != nil {
+		return "", err
+	}
+	if id == nil {
+		id, err = GitTreeID(hm, nil)
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// gitHashDir returns nil for a directory with nothing to commit
+func gitHashDir(hm HashMaker, path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []GitTreeEntry
+	for _, fi := range infos {
+		if fi.Name() == ".git" {
+			continue
+		}
+		var (
+			p     = filepath.Join(path, fi.Name())
+			entry = GitTreeEntry{Name: fi.Name()}
+		)
+		switch {
+		case fi.IsDir():
+			if entry.ID, err = gitHashDir(hm, p); err != nil {
+				return nil, err
+			}
+			if entry.ID == nil {
+				continue
+			}
+			entry.Mode = GitModeDir
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return nil, err
+			}
+			if entry.ID, err = GitBlobID(hm, int64(len(target)), bytes.NewReader([]byte(target))); err != nil {
+				return nil, err
+			}
+			entry.Mode = GitModeSymlink
+		case fi.Mode().IsRegular():
+			r, err := os.Open(p)
+			if err != nil {
+				return nil, err
+			}
+			entry.ID, err = GitBlobID(hm, fi.Size(), r)
+			r.Close()
+			if err != nil {
+				return nil, err
+			}
+			entry.Mode = GitModeFile
+			if fi.Mode()&0100 != 0 {
+				entry.Mode = GitModeExecutable
+			}
+		default:
+			return nil, fmt.Errorf("%s: unsupported file type %s", p, fi.Mode().Type())
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return GitTreeID(hm, entries)
+}
@@ -0,0 +1,93 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func sha1Maker() hash.Hash { return sha1.New() }
+
+func TestGitBlobID(t *testing.T) {
+	for content, expected := range map[string]string{
+		"":        "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391",
+		"hello\n": "ce013625030ba8dba906f756967f9e9ca394464a",
+	} {
+		id, err := GitBlobID(sha1Maker, int64(len(content)), bytes.NewReader([]byte(content)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%x", id); got != expected {
+			t.Errorf("%q: expected %s, got %s", content, expected, got)
+		}
+	}
+	if _, err := GitBlobID(sha1Maker, 10, bytes.NewReader([]byte("short"))); err == nil {
+		t.Errorf("expected an error for a blob shorter than its size")
+	}
+}
+
+func TestGitHashDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkle-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]os.FileMode{
+		"hello":     0644,
+		"a.c":       0644,
+		"a/b/x":     0644,
+		"a-b/run":   0755,
+		".git/HEAD": 0644,
+	}
+	content := map[string]string{"hello": "hello\n", "a/b/x": "x", "a-b/run": "#!"}
+	for name, mode := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content[name]), mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(p, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("hello", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// as from `git add -A && git write-tree`
+	expected := "e44ae7f5b597b21b2b0e814d87e08e77abb5bd55"
+	got, err := GitHashDir(sha1Maker, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != expected {
+		t.Errorf("expected tree %s, got %s", expected, got)
+	}
+}
+
+func TestGitHashDirEmpty(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkle-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	got, err := GitHashDir(sha1Maker, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "4b825dc642cb6eb9a060e54bf8d69288fbee4904"; got != expected {
+		t.Errorf("expected the empty tree %s, got %s", expected, got)
+	}
+}
@@ -0,0 +1,81 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// GlacierChunkSize is the size of the leaves of an AWS Glacier tree hash
+const GlacierChunkSize = 1 << 20
+
+// ErrTreeHashMismatch is for content that does not match an expected tree hash
+var ErrTreeHashMismatch = errors.New("tree hash does not match")
+
+// glacierHash is the hash of Glacier tree hashes
+func glacierHash() hash.Hash { return sha256.New() }
+
+// GlacierTree reads r, and returns its tree as Glacier hashes it, of sha256
+// over 1MiB leaves. Glacier pairs the nodes of each level and promotes an odd
+// last node, which is the same shape as a Tree, so the root is the value of
+// x-amz-sha256-tree-hash.
+func GlacierTree(r io.Reader) (*Tree, error) {
+	b := NewBuilder(glacierHash, GlacierChunkSize, WithEmptyRoot())
+	if _, err := io.Copy(b, r); err != nil {
+		return nil, err
+	}
+	tree, _, err := b.Finalize()
+	return tree, err
+}
+
+// GlacierTreeHash reads r, and returns its hex encoded tree hash
+func GlacierTreeHash(r io.Reader) (string, error) {
+	tree, err := GlacierTree(r)
+	if err != nil {
+		return "", err
+	}
+	return glacierTreeHash(tree)
+}
+
+func glacierTreeHash(tree *Tree) (string, error) {
+	root, err := tree.RootChecksum()
+	if err == ErrEmptyTree {
+		root, err = EmptyRoot(glacierHash), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(root), nil
+}
+
+// GlacierCombine returns the tree hash of an archive uploaded in parts, from
+// the hex encoded tree hashes of its parts in order. As Glacier requires, every
+// part but the last must be of the same size, a power of two multiple of 1MiB,
+// so each is a whole subtree of the archive's tree.
+func GlacierCombine(parts []string) (string, error) {
+	tree := &Tree{BlockLength: GlacierChunkSize}
+	for i, part := range parts {
+		sum, err := hex.DecodeString(part)
+		if err != nil || len(sum) != sha256.Size {
+			return "", fmt.Errorf("invalid tree hash %q of part %d", part, i)
+		}
+		tree.Append(newLeaf(glacierHash, sum))
+	}
+	return glacierTreeHash(tree)
+}
+
+// VerifyGlacierTreeHash reads r, as an archive or a range of one retrieved
+// from Glacier, and checks it against the tree hash returned by the service
+func VerifyGlacierTreeHash(r io.Reader, expected string) error {
+	got, err := GlacierTreeHash(r)
+	if err != nil {
+		return err
+	}
+	if got != expected {
+		return ErrTreeHashMismatch
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// glacierReference is the tree hash as described in the Glacier developer
+// guide, hashing pairs level by level
+func glacierReference(data []byte) string {
+	var level [][]byte
+	for i := 0; i < len(data); i += GlacierChunkSize {
+		end := i + GlacierChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := sha256.Sum256(data[i:end])
+		level = append(level, sum[:])
+	}
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			sum := sha256.Sum256(append(append([]byte{}, level[i]...), level[i+1]...))
+			next = append(next, sum[:])
+		}
+		level = next
+	}
+	return fmt.Sprintf("%x", level[0])
+}
+
+func TestGlacierTreeHash(t *testing.T) {
+	data := make([]byte, 5*GlacierChunkSize+1234)
+	rand.New(rand.NewSource(4)).Read(data)
+
+	for _, size := range []int{1, GlacierChunkSize, 3 * GlacierChunkSize, len(data)} {
+		got, err := GlacierTreeHash(bytes.NewReader(data[:size]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := glacierReference(data[:size]); got != expected {
+			t.Errorf("%d bytes: expected %s, got %s", size, expected, got)
+		}
+	}
+
+	// parts of 2MiB
+	var parts []string
+	for i := 0; i < len(data); i += 2 * GlacierChunkSize {
+		end := i + 2*GlacierChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		part, err := GlacierTreeHash(bytes.NewReader(data[i:end]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, part)
+	}
+	combined, err := GlacierCombine(parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := glacierReference(data); combined != expected {
+		t.Errorf("expected the combined tree hash %s, got %s", expected, combined)
+	}
+
+	if err := VerifyGlacierTreeHash(bytes.NewReader(data), combined); err != nil {
+		t.Error(err)
+	}
+	data[GlacierChunkSize]++
+	if err := VerifyGlacierTreeHash(bytes.NewReader(data), combined); err != ErrTreeHashMismatch {
+		t.Errorf("expected ErrTreeHashMismatch, got %v", err)
+	}
+}
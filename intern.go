@@ -0,0 +1,66 @@
+package merkle
+
+import "sync"
+
+// WithChecksumInterning makes the leaves of the same checksum share one copy
+// of it, as they are built, so an input of many identical blocks, like the
+// zero pages of a sparse VM image, takes one checksum of memory for them all
+func WithChecksumInterning() Option {
+	return func(o *options) {
+		o.given |= optChecksumInterning
+		o.intern = true
+	}
+}
+
+// checksumInterner is the first node of each checksum seen, safe for the
+// shards of a Build to share
+type checksumInterner struct {
+	mu    sync.Mutex
+	nodes map[string]*Node
+}
+
+// newInterner is a checksumInterner, or nil if interning is not wanted
+func (o options) newInterner() *checksumInterner {
+	if !o.intern {
+		return nil
+	}
+	return &checksumInterner{nodes: map[string]*Node{}}
+}
+
+// intern makes n of the checksum of the node of it seen first, and is whether
+// it was not n. A nil checksumInterner leaves n as it is.
+func (ci *checksumInterner) intern(n *Node) bool {
+	sum := n.checksum()
+	if ci == nil || sum == nil {
+		return false
+	}
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	first, ok := ci.nodes[string(sum)]
+	if !ok {
+		ci.nodes[string(sum)] = n
+		return false
+	}
+	if first.sums == n.sums && first.slot == n.slot {
+		return false
+	}
+	n.sums, n.slot = first.sums, first.slot
+	return true
+}
+
+// InternChecksums makes the leaves of the same checksum share one copy of it,
+// as WithChecksumInterning does for trees being built, for a tree decoded or
+// built without it. It returns the count of leaves that now share the
+// checksum of an earlier leaf.
+func (t *Tree) InternChecksums() int {
+	var (
+		ci     = &checksumInterner{nodes: map[string]*Node{}}
+		shared int
+	)
+	for _, n := range t.Nodes {
+		if ci.intern(n) {
+			shared++
+		}
+	}
+	return shared
+}
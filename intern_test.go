@@ -0,0 +1,80 @@
+package merkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+// distinctChecksums is the count of distinct backing arrays of the checksums
+// of the leaves
+func distinctChecksums(tree *Tree) int {
+	seen := map[*byte]bool{}
+	for _, n := range tree.Nodes {
+		seen[&n.checksum()[0]] = true
+	}
+	return len(seen)
+}
+
+func TestChecksumInterning(t *testing.T) {
+	// zero pages, with a block of data among them
+	data := make([]byte, 16*40+3)
+	copy(data[16*7:], "not a zero page")
+
+	plain, root, err := NewBuilder(DefaultHashMaker, 16).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := distinctChecksums(plain); n != len(plain.Nodes) {
+		t.Fatalf("expected %d checksums without interning, got %d", len(plain.Nodes), n)
+	}
+
+	build := func(b *Builder) (*Tree, []byte, error) {
+		return b.Build(bytes.NewReader(data), int64(len(data)))
+	}
+	write := func(b *Builder) (*Tree, []byte, error) {
+		for i := 0; i < len(data); i += 5 {
+			end := i + 5
+			if end > len(data) {
+				end = len(data)
+			}
+			if _, err := b.Write(data[i:end]); err != nil {
+				return nil, nil, err
+			}
+		}
+		return b.Finalize()
+	}
+	for name, fn := range map[string]func(*Builder) (*Tree, []byte, error){"Build": build, "Write": write} {
+		b := NewBuilder(DefaultHashMaker, 16, WithChecksumInterning(), WithHashWorkers(4))
+		for i := 0; i < 2; i++ {
+			tree, r, err := fn(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(r, root) || !tree.Equal(plain) {
+				t.Errorf("%s: expected the same tree as without interning", name)
+			}
+			// the zero pages, the data and the short last block
+			if n := distinctChecksums(tree); n != 3 {
+				t.Errorf("%s: expected 3 distinct checksums, got %d", name, n)
+			}
+		}
+	}
+
+	tree, _, err := NewBuilder(DefaultHashMaker, 0, WithChecksumInterning()).BuildChunks([][]byte{data[:16], data[16:32], []byte("x")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := distinctChecksums(tree); n != 2 {
+		t.Errorf("BuildChunks: expected 2 distinct checksums, got %d", n)
+	}
+
+	if shared := plain.InternChecksums(); shared != len(plain.Nodes)-3 {
+		t.Errorf("expected %d leaves sharing a checksum, got %d", len(plain.Nodes)-3, shared)
+	}
+	if n := distinctChecksums(plain); n != 3 {
+		t.Errorf("expected 3 distinct checksums once interned, got %d", n)
+	}
+	if shared := plain.InternChecksums(); shared != 0 {
+		t.Errorf("expected nothing more to intern, got %d", shared)
+	}
+}
@@ -0,0 +1,150 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+)
+
+// Types of in-toto attestation statements of trees
+const (
+	// StatementType is the _type of an in-toto v1 statement
+	StatementType = "https://in-toto.io/Statement/v1"
+
+	// PredicateTypeTree is the predicateType of a TreePredicate
+	PredicateTypeTree = "https://github.com/vbatts/merkle/tree/v1"
+)
+
+// Statement is an in-toto attestation statement, as a signed envelope's payload
+type Statement struct {
+	Type          string          `json:"_type"`
+	Subject       []Subject       `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+// Subject is an artifact an in-toto statement is about, by its digests
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// TreePredicate describes the tree whose root is a subject's digest, with the
+// serialized tree (see Tree.MarshalBinary) either attached, or referenced by
+// its digest
+type TreePredicate struct {
+	Hash        string           `json:"hash"`
+	BlockLength int              `json:"blockLength"`
+	FinalBlock  FinalBlockPolicy `json:"finalBlock"`
+	Length      int64            `json:"length"`
+	Tree        []byte           `json:"tree,omitempty"`
+	TreeDigest  string           `json:"treeDigest,omitempty"`
+}
+
+// SubjectDigestName is the name of the digest of a subject that is the root of
+// its tree, like "merkle-sha256"
+func SubjectDigestName(hm HashMaker) (string, error) {
+	name, err := HashName(hm)
+	if err != nil {
+		return "", err
+	}
+	return "merkle-" + name, nil
+}
+
+// NewStatement returns a statement about the artifact name, with the root of
+// its tree as the subject's digest. The serialized tree is attached to the
+// predicate, or only referenced when it is published separately.
+func NewStatement(name string, tree *Tree, attach bool) (*Statement, error) {
+	digestName, err := SubjectDigestName(tree.hashMaker())
+	if err != nil {
+		return nil, err
+	}
+	annotations, err := LayerAnnotations(tree)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := tree.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	pred := TreePredicate{
+		Hash:        digestName[len("merkle-"):],
+		BlockLength: tree.BlockLength,
+		FinalBlock:  tree.FinalBlock,
+		Length:      tree.TotalLength(),
+	}
+	if attach {
+		pred.Tree = blob
+	} else {
+		sum := sha256.Sum256(blob)
+		pred.TreeDigest = digestString(sum[:])
+	}
+	predicate, err := json.Marshal(pred)
+	if err != nil {
+		return nil, err
+	}
+	return &Statement{
+		Type: StatementType,
+		Subject: []Subject{{
+			Name:   name,
+			Digest: map[string]string{digestName: annotations[AnnotationRoot]},
+		}},
+		PredicateType: PredicateTypeTree,
+		Predicate:     predicate,
+	}, nil
+}
+
+// Tree returns the tree of the subject name, from the attached tree or else
+// from sidecar, once it matches the predicate and the subject's digest
+func (s *Statement) Tree(name string, sidecar []byte) (*Tree, error) {
+	if s.Type != StatementType || s.PredicateType != PredicateTypeTree {
+		return nil, fmt.Errorf("statement is not of a tree")
+	}
+	var pred TreePredicate
+	if err := json.Unmarshal(s.Predicate, &pred); err != nil {
+		return nil, err
+	}
+	var subject *Subject
+	for i := range s.Subject {
+		if s.Subject[i].Name == name {
+			subject = &s.Subject[i]
+		}
+	}
+	if subject == nil {
+		return nil, fmt.Errorf("statement has no subject %q", name)
+	}
+
+	blob := pred.Tree
+	if blob == nil {
+		sum := sha256.Sum256(sidecar)
+		if digestString(sum[:]) != pred.TreeDigest {
+			return nil, ErrAnnotationMismatch{Key: "treeDigest"}
+		}
+		blob = sidecar
+	}
+	var tree Tree
+	if err := tree.UnmarshalBinary(blob); err != nil {
+		return nil, err
+	}
+	digestName, err := SubjectDigestName(tree.hashMaker())
+	if err != nil {
+		return nil, err
+	}
+	annotations, err := LayerAnnotations(&tree)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case digestName != "merkle-"+pred.Hash:
+		return nil, ErrAnnotationMismatch{Key: "hash"}
+	case tree.BlockLength != pred.BlockLength:
+		return nil, ErrAnnotationMismatch{Key: "blockLength"}
+	case tree.FinalBlock != pred.FinalBlock:
+		return nil, ErrAnnotationMismatch{Key: "finalBlock"}
+	case tree.TotalLength() != pred.Length:
+		return nil, ErrAnnotationMismatch{Key: "length"}
+	case subject.Digest[digestName] != annotations[AnnotationRoot]:
+		return nil, ErrAnnotationMismatch{Key: digestName}
+	}
+	return &tree, nil
+}
@@ -0,0 +1,69 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestStatement(t *testing.T) {
+	data := bytes.Repeat([]byte("build output "), 500)
+	tree, root, err := NewBuilder(DefaultHashMaker, 512).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, attach := range []bool{true, false} {
+		s, err := NewStatement("app.tar", tree, attach)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Subject[0].Digest["merkle-sha1"]; got != fmt.Sprintf("%x", root) {
+			t.Errorf("expected the subject digest to be the root %x, got %s", root, got)
+		}
+
+		buf, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Statement
+		if err := json.Unmarshal(buf, &decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		var sidecar []byte
+		if !attach {
+			if sidecar, err = tree.MarshalBinary(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := decoded.Tree("app.tar", sidecar)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotRoot, err := got.RootChecksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(gotRoot, root) {
+			t.Errorf("expected root %x, got %x", root, gotRoot)
+		}
+		if _, err := decoded.Tree("other", sidecar); err == nil {
+			t.Errorf("expected an error for a missing subject")
+		}
+	}
+
+	s, err := NewStatement("app.tar", tree, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Tree("app.tar", []byte("not the tree")); err == nil {
+		t.Errorf("expected an error for a sidecar not matching its digest")
+	}
+	s.Subject[0].Digest["merkle-sha1"] = fmt.Sprintf("%x", make([]byte, 20))
+	sidecar, _ := tree.MarshalBinary()
+	if _, err := s.Tree("app.tar", sidecar); err == nil {
+		t.Errorf("expected an error for a subject digest not matching the root")
+	}
+}
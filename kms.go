@@ -0,0 +1,160 @@
+package merkle
+
+import (
+	"context"
+	"crypto"
+	"io"
+	"sync"
+	"time"
+)
+
+// KMSSignFunc signs with a key held by a KMS or HSM, so the private key never
+// resides in this process. For ECDSA and RSA keys it is given the digest, as
+// AWS KMS Sign with a MessageType of DIGEST, GCP KMS AsymmetricSign with a
+// digest, or PKCS#11 C_Sign with CKM_ECDSA, expect. For Ed25519 keys it is
+// given the whole message.
+type KMSSignFunc func(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error)
+
+// KMSSigner is a crypto.Signer of a remotely held key, for signing roots with
+// Checkpoint.SignWith, Checkpoint.Bundle or a CheckpointSigner
+type KMSSigner struct {
+	Timeout time.Duration // of each signing, or 0 for none
+
+	pub  crypto.PublicKey
+	sign KMSSignFunc
+}
+
+// NewKMSSigner returns a KMSSigner of the key with the public key pub, as
+// fetched once from the KMS (such as by GetPublicKey)
+func NewKMSSigner(pub crypto.PublicKey, sign KMSSignFunc) *KMSSigner {
+	return &KMSSigner{pub: pub, sign: sign}
+}
+
+// Public is the public key of the remote key
+func (ks *KMSSigner) Public() crypto.PublicKey {
+	return ks.pub
+}
+
+// Sign has the remote key sign digest. rand is unused, as the KMS provides its
+// own randomness.
+func (ks *KMSSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	ctx := context.Background()
+	if ks.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ks.Timeout)
+		defer cancel()
+	}
+	return ks.sign(ctx, digest, opts)
+}
+
+// SignedCheckpoint is the result of signing a checkpoint
+type SignedCheckpoint struct {
+	Checkpoint Checkpoint
+	Err        error
+}
+
+// CheckpointSigner signs checkpoints by name with a Signer, such as a
+// KMSSigner, caching the most recent signed checkpoints so a root is only sent
+// to the KMS once, however many times it is signed
+type CheckpointSigner struct {
+	Name   string
+	Signer crypto.Signer
+
+	mu        sync.Mutex
+	cacheSize int
+	cache     map[string]*checkpointSigning // by checkpoint body
+	order     []string                      // of the cache, oldest first
+}
+
+type checkpointSigning struct {
+	done   chan struct{}
+	result SignedCheckpoint
+}
+
+// NewCheckpointSigner returns a CheckpointSigner caching cacheSize signed
+// checkpoints
+func NewCheckpointSigner(name string, signer crypto.Signer, cacheSize int) *CheckpointSigner {
+	return &CheckpointSigner{
+		Name:      name,
+		Signer:    signer,
+		cacheSize: cacheSize,
+		cache:     map[string]*checkpointSigning{},
+	}
+}
+
+// Sign returns c with the signature of the signer added, waiting on any
+// signing of the same checkpoint already in progress
+func (cs *CheckpointSigner) Sign(c Checkpoint) (Checkpoint, error) {
+	res := <-cs.SignAsync(c)
+	return res.Checkpoint, res.Err
+}
+
+// SignAsync signs c in the background, sending the result on the returned
+// channel. Failed signings are not cached.
+func (cs *CheckpointSigner) SignAsync(c Checkpoint) <-chan SignedCheckpoint {
+	out := make(chan SignedCheckpoint, 1)
+	key := string(c.body())
+
+	cs.mu.Lock()
+	s, ok := cs.cache[key]
+	if !ok {
+		s = &checkpointSigning{done: make(chan struct{})}
+		cs.add(key, s)
+		go cs.sign(key, s, c)
+	}
+	cs.mu.Unlock()
+
+	go func() {
+		<-s.done
+		res := s.result
+		if res.Err == nil {
+			// the cached signature, on the signatures c already has
+			signed := c
+			signed.Signatures = append([]CheckpointSignature{}, c.Signatures...)
+			for _, sig := range res.Checkpoint.Signatures {
+				if sig.Name == cs.Name {
+					signed.addSignature(sig)
+				}
+			}
+			res.Checkpoint = signed
+		}
+		out <- res
+	}()
+	return out
+}
+
+func (cs *CheckpointSigner) sign(key string, s *checkpointSigning, c Checkpoint) {
+	signed := Checkpoint{Origin: c.Origin, Size: c.Size, Root: c.Root}
+	err := signed.SignWith(cs.Name, cs.Signer)
+	s.result = SignedCheckpoint{Checkpoint: signed, Err: err}
+	if err != nil {
+		cs.mu.Lock()
+		cs.remove(key, s)
+		cs.mu.Unlock()
+	}
+	close(s.done)
+}
+
+// add caches s, evicting the oldest signings beyond the cache size
+func (cs *CheckpointSigner) add(key string, s *checkpointSigning) {
+	cs.cache[key] = s
+	cs.order = append(cs.order, key)
+	for len(cs.order) > 1 && len(cs.order) > cs.cacheSize {
+		delete(cs.cache, cs.order[0])
+		cs.order = cs.order[1:]
+	}
+}
+
+// remove drops a failed signing from the cache
+func (cs *CheckpointSigner) remove(key string, s *checkpointSigning) {
+	if cs.cache[key] != s {
+		return
+	}
+	delete(cs.cache, key)
+	for i, k := range cs.order {
+		if k == key {
+			cs.order = append(cs.order[:i], cs.order[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package merkle
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeKMS holds a key, as a KMS would, counting the signings asked of it
+func fakeKMS(t *testing.T, fail *int32) (*KMSSigner, *int32) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int32
+	return NewKMSSigner(key.Public(), func(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		if fail != nil && atomic.LoadInt32(fail) != 0 {
+			return nil, errors.New("kms unavailable")
+		}
+		return key.Sign(rand.Reader, digest, opts)
+	}), &calls
+}
+
+func TestCheckpointSigner(t *testing.T) {
+	ks, calls := fakeKMS(t, nil)
+	cs := NewCheckpointSigner("log", ks, 2)
+	c, err := NewCheckpoint("example.com/log", testTree(t, 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			signed, err := cs.Sign(*c)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := signed.VerifyWith("log", ks.Public()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("expected a single signing by the KMS, got %d", n)
+	}
+	if len(c.Signatures) != 0 {
+		t.Errorf("expected the checkpoint signed to be unchanged")
+	}
+
+	// evicted beyond the cache size
+	for size := 1; size <= 3; size++ {
+		other, _ := NewCheckpoint("example.com/log", testTree(t, size))
+		if res := <-cs.SignAsync(*other); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+	if _, err := cs.Sign(*c); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(calls); n != 5 {
+		t.Errorf("expected the evicted checkpoint to be signed again, got %d signings", n)
+	}
+}
+
+func TestCheckpointSignerFailure(t *testing.T) {
+	fail := int32(1)
+	ks, calls := fakeKMS(t, &fail)
+	cs := NewCheckpointSigner("log", ks, 4)
+	c, _ := NewCheckpoint("example.com/log", testTree(t, 3))
+	if _, err := cs.Sign(*c); err == nil {
+		t.Fatal("expected the signing to fail")
+	}
+	atomic.StoreInt32(&fail, 0)
+	signed, err := cs.Sign(*c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signed.VerifyWith("log", ks.Public()); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(calls); n != 2 {
+		t.Errorf("expected the failed signing not to be cached, got %d signings", n)
+	}
+}
@@ -0,0 +1,242 @@
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+	"sync"
+)
+
+// CacheInterior makes RootChecksum keep the checksums of the complete subtrees
+// it computes, and recompute only those over leaves appended, replaced or
+// removed since. Then appending often and asking for the root now and then
+// hashes each interior node about once, rather than the whole tree for each
+// root. The cache is safe for concurrent use, once enabled.
+//
+// The cache keeps a second slice of the leaves, and a checksum of each
+// complete subtree computed, so it about doubles the memory of the checksums
+// of the tree.
+func (t *Tree) CacheInterior() {
+	if t.interior == nil {
+		t.interior = &interiorCache{}
+	}
+}
+
+// WithInteriorCache makes the tree of a hash of New CacheInterior, so a Sum
+// after more is written hashes only the subtrees over the leaves since,
+// rather than the whole tree again. It is for hashes summed often as they are
+// written, at the memory cost of CacheInterior.
+func WithInteriorCache() Option {
+	return func(o *options) {
+		o.given |= optInteriorCache
+		o.interiorCache = true
+	}
+}
+
+// SetLeaf replaces the leaf at index i with n, of the position of the leaf it
+// replaces. With the interior cached, only the subtrees over i are
+// recomputed for the next root.
+//
+// The Bloom filter and leaf index of the tree, if any, are kept up to date, as
+// by Rehash.
+func (t *Tree) SetLeaf(i int, n *Node) error {
+	if i < 0 || i >= len(t.Nodes) {
+		return ErrIndexOutOfRange{Index: i, Size: len(t.Nodes)}
+	}
+	if n == nil || len(n.checksum()) == 0 {
+		return fmt.Errorf("leaf %d has no checksum", i)
+	}
+	old := t.Nodes[i]
+	n.Index, n.Offset, n.Length = old.Index, old.Offset, old.Length
+	t.Nodes[i] = n
+	if t.interior != nil {
+		t.interior.setLeaf(i, n)
+	}
+	if t.bloom != nil {
+		t.bloom.Add(n.checksum())
+	}
+	if t.indexes != nil {
+		t.reindexLeaf(i, old.checksum(), n.checksum())
+	}
+	return nil
+}
+
+// reindexLeaf moves the leaf index of leaf i from the checksum old to sum. Of
+// old, it is of the next leaf of it, if i was the first.
+func (t *Tree) reindexLeaf(i int, old, sum []byte) {
+	if first, ok := t.indexes[string(old)]; ok && first == i {
+		delete(t.indexes, string(old))
+		for j := i + 1; j < len(t.Nodes); j++ {
+			if bytes.Equal(t.Nodes[j].checksum(), old) {
+				t.indexes[string(old)] = j
+				break
+			}
+		}
+	}
+	if first, ok := t.indexes[string(sum)]; !ok || i < first {
+		t.indexes[string(sum)] = i
+	}
+}
+
+// rootWith is the root checksum of the leaves and then extra, as though it
+// were appended, without changing the tree. With the interior cached, only the
+// subtrees over extra are computed.
+func (t *Tree) rootWith(extra *Node) ([]byte, error) {
+	nodes := append(t.Nodes[:len(t.Nodes):len(t.Nodes)], extra)
+	if t.interior != nil {
+		return t.interior.root(nodes[0].hashMaker(), nodes)
+	}
+	snapshot := &Tree{Nodes: nodes}
+	return snapshot.RootChecksum()
+}
+
+// interiorCache is the checksums of the complete, aligned subtrees of the
+// leaves, computed as a root needs them. The leaves it was computed from are
+// kept too, so leaves replaced or removed since, however they were, are
+// found, and only the subtrees over them dropped.
+type interiorCache struct {
+	mu     sync.Mutex
+	leaves []*Node
+	levels [][][]byte // of the subtrees of 1<<k leaves at level k, nil where not computed
+}
+
+// root is the checksum of the root over nodes
+func (c *interiorCache) root(hm HashMaker, nodes []*Node) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sync(nodes)
+	if len(nodes) == 0 {
+		return nil, ErrEmptyTree
+	}
+	return c.rangeHash(hm, 0, len(nodes))
+}
+
+// proofs is the audit path of each leaf of indexes, of nodes
+func (c *interiorCache) proofs(hm HashMaker, indexes []int, nodes []*Node) ([][][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sync(nodes)
+	paths := make([][][]byte, len(indexes))
+	for i, m := range indexes {
+		var err error
+		if paths[i], err = c.auditPath(hm, m, 0, len(nodes)); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// auditPath is PATH(m, D[start:start+n]) of RFC 6962, split as auditPath is
+func (c *interiorCache) auditPath(hm HashMaker, m, start, n int) ([][]byte, error) {
+	if n <= 1 {
+		return nil, nil
+	}
+	var (
+		k         = splitPoint(n)
+		path      [][]byte
+		sib       []byte
+		err, serr error
+	)
+	if m < k {
+		path, err = c.auditPath(hm, m, start, k)
+		sib, serr = c.rangeHash(hm, start+k, n-k)
+	} else {
+		path, err = c.auditPath(hm, m-k, start+k, n-k)
+		sib, serr = c.rangeHash(hm, start, k)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if serr != nil {
+		return nil, serr
+	}
+	return append(path, sib), nil
+}
+
+// setLeaf replaces the cached leaf i with n, dropping the subtrees over it
+func (c *interiorCache) setLeaf(i int, n *Node) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i >= len(c.leaves) {
+		return
+	}
+	c.leaves[i] = n
+	c.drop(i)
+}
+
+// drop drops the subtrees over leaf i
+func (c *interiorCache) drop(i int) {
+	for k := 1; k < len(c.levels); k++ {
+		if j := i >> uint(k); j < len(c.levels[k]) {
+			c.levels[k][j] = nil
+		}
+	}
+}
+
+// sync drops the subtrees over the leaves that are not those of nodes
+func (c *interiorCache) sync(nodes []*Node) {
+	if len(nodes) < len(c.leaves) {
+		c.leaves = c.leaves[:len(nodes)]
+		for k := range c.levels {
+			if complete := len(nodes) >> uint(k); complete < len(c.levels[k]) {
+				c.levels[k] = c.levels[k][:complete]
+			}
+		}
+	}
+	for i, n := range c.leaves {
+		if nodes[i] != n {
+			c.leaves[i] = nodes[i]
+			c.drop(i)
+		}
+	}
+	c.leaves = append(c.leaves, nodes[len(c.leaves):]...)
+}
+
+// rangeHash is the checksum of the leaves [start, start+n), split as
+// subtreeHash does. The left of each split is a complete, aligned subtree.
+func (c *interiorCache) rangeHash(hm HashMaker, start, n int) ([]byte, error) {
+	if isPowerOfTwo(n) && start%n == 0 {
+		k := bits.TrailingZeros(uint(n))
+		return c.subtree(hm, k, start>>uint(k))
+	}
+	k := splitPoint(n)
+	l, err := c.rangeHash(hm, start, k)
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.rangeHash(hm, start+k, n-k)
+	if err != nil {
+		return nil, err
+	}
+	return hashChildren(hm, l, r)
+}
+
+// subtree is the checksum of the j-th subtree of 1<<k leaves
+func (c *interiorCache) subtree(hm HashMaker, k, j int) ([]byte, error) {
+	if k == 0 {
+		return c.leaves[j].Checksum()
+	}
+	for len(c.levels) <= k {
+		c.levels = append(c.levels, nil)
+	}
+	if j < len(c.levels[k]) && c.levels[k][j] != nil {
+		return c.levels[k][j], nil
+	}
+	l, err := c.subtree(hm, k-1, 2*j)
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.subtree(hm, k-1, 2*j+1)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := hashChildren(hm, l, r)
+	if err != nil {
+		return nil, err
+	}
+	for len(c.levels[k]) <= j {
+		c.levels[k] = append(c.levels[k], nil)
+	}
+	c.levels[k][j] = sum
+	return sum, nil
+}
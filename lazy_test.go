@@ -0,0 +1,151 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCacheInterior(t *testing.T) {
+	var hashes int64
+	hm := func() hash.Hash {
+		atomic.AddInt64(&hashes, 1)
+		return sha256.New()
+	}
+	leaf := func(i int) *Node {
+		n, err := NewNodeHashBlock(sha256.New, []byte{byte(i), byte(i >> 8)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.sums.hm = hm
+		return n
+	}
+	expected := func(tree *Tree) []byte {
+		sums, err := tree.leafSums()
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := subtreeHash(sha256.New, sums)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return root
+	}
+	check := func(tree *Tree) int64 {
+		atomic.StoreInt64(&hashes, 0)
+		root, err := tree.RootChecksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(root, expected(tree)) {
+			t.Fatalf("%d leaves: unexpected root", len(tree.Nodes))
+		}
+		return atomic.LoadInt64(&hashes)
+	}
+
+	tree := &Tree{}
+	tree.CacheInterior()
+	if _, err := tree.RootChecksum(); err != ErrEmptyTree {
+		t.Errorf("expected ErrEmptyTree, got %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		tree.Append(leaf(i))
+		check(tree)
+	}
+	if n := check(tree); n != 2 {
+		// 100 is 64+32+4, so only the two joins of those are not cached
+		t.Errorf("expected 2 hashes of an unchanged tree, got %d", n)
+	}
+
+	if err := tree.SetLeaf(37, leaf(1000)); err != nil {
+		t.Fatal(err)
+	}
+	if n := check(tree); n != 6+2 {
+		t.Errorf("expected the path of leaf 37 rehashed, got %d hashes", n)
+	}
+	if err := tree.SetLeaf(100, leaf(0)); err != (ErrIndexOutOfRange{Index: 100, Size: 100}) {
+		t.Errorf("expected an ErrIndexOutOfRange, got %v", err)
+	}
+
+	// leaves replaced and removed other than by SetLeaf
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		switch rnd.Intn(3) {
+		case 0:
+			tree.Nodes = tree.Nodes[:rnd.Intn(len(tree.Nodes))+1]
+		case 1:
+			tree.Nodes[rnd.Intn(len(tree.Nodes))] = leaf(rnd.Int())
+		default:
+			tree.Append(leaf(rnd.Int()), leaf(rnd.Int()))
+		}
+		check(tree)
+	}
+}
+
+func TestSetLeafIndex(t *testing.T) {
+	tree, err := SumOf(DefaultHashMaker, 2, []byte("aabbaacc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.BuildLeafIndex(); err != nil {
+		t.Fatal(err)
+	}
+	leaf := func(b string) *Node {
+		n, err := NewNodeHashBlock(DefaultHashMaker, []byte(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	find := func(b string) int {
+		i, ok := tree.FindLeaf(leaf(b).checksum())
+		if !ok {
+			return -1
+		}
+		return i
+	}
+
+	// the first "aa" moves to the next of it, and "dd" is new
+	if err := tree.SetLeaf(0, leaf("dd")); err != nil {
+		t.Fatal(err)
+	}
+	if find("aa") != 2 || find("dd") != 0 {
+		t.Errorf("expected aa at 2 and dd at 0, got %d and %d", find("aa"), find("dd"))
+	}
+	// the last "cc" is gone, and "bb" is still first at 1
+	if err := tree.SetLeaf(3, leaf("bb")); err != nil {
+		t.Fatal(err)
+	}
+	if find("cc") != -1 || find("bb") != 1 {
+		t.Errorf("expected no cc and bb at 1, got %d and %d", find("cc"), find("bb"))
+	}
+}
+
+func TestStreamSumCached(t *testing.T) {
+	if NewHash(DefaultHashMaker, 16).(*merkleHash).tree.interior != nil {
+		t.Error("expected the interior not cached without WithInteriorCache")
+	}
+	h, err := New(DefaultHashMaker, 16, WithInteriorCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.(*merkleHash).tree.interior == nil {
+		t.Fatal("expected the interior cached WithInteriorCache")
+	}
+	var data []byte
+	for i := 0; i < 300; i++ {
+		b := []byte{byte(i), byte(i * 3), byte(i * 5)}
+		data = append(data, b...)
+		h.Write(b)
+		_, root, err := NewBuilder(DefaultHashMaker, 16).Build(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum := h.Sum(nil); !bytes.Equal(sum, root) {
+			t.Fatalf("%d bytes: expected the root of the bytes written", len(data))
+		}
+	}
+}
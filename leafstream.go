@@ -0,0 +1,239 @@
+package merkle
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// The leaf stream form of a tree is written as the tree is built, a leaf at a
+// time, as its count and length are not known until the end. It is the magic
+// "MRKS" and a version byte, the length prefixed name of the hash, the
+// FinalBlock policy byte, and uvarints of the BlockLength and checksum size.
+// Each leaf is then a 1 byte, its checksum and, for a tree of no BlockLength,
+// a uvarint of its length. The end is a 0 byte and a uvarint of the
+// TotalLength.
+var leafStreamMagic = []byte("MRKS")
+
+const leafStreamVersion = 1
+
+// WithLeafStream writes each leaf to w as soon as it is checksummed, in the
+// leaf stream form read by ReadLeafStream, so persisting the tree overlaps
+// with hashing it. The trees of a Builder written to, and finalized in turn,
+// follow each other on w. A tree built from an io.ReaderAt is written once
+// its shards are all hashed, as they finish out of order.
+//
+// An error writing to w is returned by the Write or Finalize that hit it, and
+// by every one after, as the stream is then incomplete.
+func WithLeafStream(w io.Writer) Option {
+	return func(o *options) {
+		o.given |= optLeafStream
+		o.leafStream = w
+	}
+}
+
+// leafStream writes the leaves of the trees of a builder to the writer of
+// WithLeafStream
+type leafStream struct {
+	w       io.Writer
+	started bool // whether the header of the current tree is written
+	err     error
+	buf     []byte
+}
+
+func newLeafStream(w io.Writer) *leafStream {
+	if w == nil {
+		return nil
+	}
+	return &leafStream{w: w}
+}
+
+// leaf writes the checksum of the next leaf, of length bytes, starting the
+// tree if it is the first
+func (ls *leafStream) leaf(hm HashMaker, blockLength int, policy FinalBlockPolicy, sum []byte, length int) error {
+	if ls == nil {
+		return nil
+	}
+	if err := ls.start(hm, blockLength, policy); err != nil {
+		return err
+	}
+	ls.buf = append(ls.buf[:0], 1)
+	ls.buf = append(ls.buf, sum...)
+	if blockLength == 0 {
+		ls.buf = appendUvarint(ls.buf, uint64(length))
+	}
+	return ls.write(ls.buf)
+}
+
+// end ends the current tree, of length bytes
+func (ls *leafStream) end(hm HashMaker, blockLength int, policy FinalBlockPolicy, length int64) error {
+	if ls == nil {
+		return nil
+	}
+	if err := ls.start(hm, blockLength, policy); err != nil {
+		return err
+	}
+	ls.started = false
+	return ls.write(appendUvarint([]byte{0}, uint64(length)))
+}
+
+func (ls *leafStream) start(hm HashMaker, blockLength int, policy FinalBlockPolicy) error {
+	if ls.err != nil || ls.started {
+		return ls.err
+	}
+	name, err := HashName(hm)
+	if err != nil {
+		ls.err = err
+		return err
+	}
+	ls.started = true
+	header := append([]byte(nil), leafStreamMagic...)
+	header = append(header, leafStreamVersion, byte(len(name)))
+	header = append(header, name...)
+	header = append(header, byte(policy))
+	header = appendUvarint(header, uint64(blockLength))
+	header = appendUvarint(header, uint64(hm().Size()))
+	return ls.write(header)
+}
+
+func (ls *leafStream) write(p []byte) error {
+	if ls.err == nil {
+		_, ls.err = ls.w.Write(p)
+	}
+	return ls.err
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(b, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
+
+// ReadLeafStream reads the next tree of the leaf stream form from r, as
+// written WithLeafStream, or io.EOF if there are no more. A stream that ends
+// within a tree, as of a build that failed, is an ErrMalformedTree, and a tree
+// of more leaves than the DefaultDecodeLimits an ErrLimitExceeded.
+func ReadLeafStream(r io.Reader) (*Tree, error) {
+	return readLeafStream(r, DefaultDecodeLimits())
+}
+
+func readLeafStream(r io.Reader, l DecodeLimits) (*Tree, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		// reading ahead would lose the trees after this one, so the
+		// uvarints of a reader without ReadByte are read a byte at a time
+		br = byteReader{r}
+	}
+	for i, c := range leafStreamMagic {
+		b, err := br.ReadByte()
+		if err == io.EOF && i == 0 {
+			// the end of the stream, between trees
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, malformed(err)
+		}
+		if b != c {
+			return nil, ErrMalformedTree
+		}
+	}
+	version, err := br.ReadByte()
+	if err != nil {
+		return nil, malformed(err)
+	}
+	if version != leafStreamVersion {
+		return nil, ErrMalformedTree
+	}
+	nameLen, err := br.ReadByte()
+	if err != nil {
+		return nil, malformed(err)
+	}
+	name := make([]byte, nameLen)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return nil, malformed(err)
+	}
+	hm, ok := LookupHash(string(name))
+	if !ok {
+		return nil, ErrUnknownHash{Name: string(name)}
+	}
+	policy, err := br.ReadByte()
+	if err != nil {
+		return nil, malformed(err)
+	}
+	blockLength, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	if blockLength > uint64(maxInt) || size != uint64(hm().Size()) {
+		return nil, ErrMalformedTree
+	}
+
+	var (
+		tree   = &Tree{BlockLength: int(blockLength), FinalBlock: FinalBlockPolicy(policy)}
+		slab   = newLeafSlab(hm)
+		offset int64
+	)
+	for {
+		kind, err := br.ReadByte()
+		if err != nil {
+			return nil, malformed(err)
+		}
+		if kind == 0 {
+			break
+		}
+		if kind != 1 {
+			return nil, ErrMalformedTree
+		}
+		if err := l.checkLeaves(uint64(len(tree.Nodes) + 1)); err != nil {
+			return nil, err
+		}
+		n := slab.take()
+		if _, err := io.ReadFull(r, n.checksum()); err != nil {
+			return nil, malformed(err)
+		}
+		if blockLength == 0 {
+			l, err := binary.ReadUvarint(br)
+			if err != nil {
+				return nil, malformed(err)
+			}
+			if l > uint64(maxInt) || int64(l) > 1<<63-1-offset {
+				return nil, ErrMalformedTree
+			}
+			n.Index, n.Offset, n.Length = len(tree.Nodes), offset, int(l)
+			offset += int64(l)
+		}
+		tree.Nodes = append(tree.Nodes, n)
+	}
+	length, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	if length > 1<<63-1 {
+		return nil, ErrMalformedTree
+	}
+	tree.length = int64(length)
+	if blockLength == 0 {
+		if offset != tree.length {
+			return nil, ErrMalformedTree
+		}
+	} else {
+		if (length+blockLength-1)/blockLength != uint64(len(tree.Nodes)) {
+			return nil, ErrMalformedTree
+		}
+		tree.setPositions()
+	}
+	return tree, nil
+}
+
+// byteReader reads a byte at a time from r
+type byteReader struct {
+	r io.Reader
+}
+
+func (br byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(br.r, b[:])
+	return b[0], err
+}
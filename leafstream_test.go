@@ -0,0 +1,112 @@
+package merkle
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// checkStreamed checks the next tree read from the stream against expected
+func checkStreamed(t *testing.T, name string, r io.Reader, expected *Tree) {
+	got, err := ReadLeafStream(r)
+	if err != nil {
+		t.Fatalf("%s: %s", name, err)
+	}
+	want, _ := expected.MarshalBinary()
+	have, err := got.MarshalBinary()
+	if err != nil || !bytes.Equal(have, want) {
+		t.Errorf("%s: expected the tree streamed as built, got %v", name, err)
+	}
+}
+
+func TestLeafStream(t *testing.T) {
+	var (
+		buf  bytes.Buffer
+		data = bytes.Repeat([]byte("0123456789"), 10)
+		b    = NewBuilder(DefaultHashMaker, 16, WithLeafStream(&buf))
+	)
+	if _, err := b.Write(data[:50]); err != nil {
+		t.Fatal(err)
+	}
+	// the header, and a 1 byte and checksum of each of the 3 whole blocks
+	if expected := 4 + 1 + 1 + 4 + 1 + 1 + 1 + 3*21; buf.Len() != expected {
+		t.Errorf("expected %d bytes streamed of the leaves so far, got %d", expected, buf.Len())
+	}
+	if _, err := b.Write(data[50:]); err != nil {
+		t.Fatal(err)
+	}
+	first, _, err := b.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Write(data[:20]); err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := b.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	built, _, err := NewBuilder(DefaultHashMaker, 16, WithLeafStream(&buf)).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, _, err := NewBuilder(DefaultHashMaker, 0, WithLeafStream(&buf)).BuildChunks([][]byte{[]byte("abc"), []byte("defgh")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewDiskBuilder(DefaultHashMaker, 16, "", WithLeafStream(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Write(data[:33]); err != nil {
+		t.Fatal(err)
+	}
+	dt, _, err := db.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dt.Close()
+	disk, err := dt.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream := buf.Bytes()
+	r := bytes.NewReader(stream)
+	checkStreamed(t, "first", r, first)
+	checkStreamed(t, "second", r, second)
+	checkStreamed(t, "built", r, built)
+	checkStreamed(t, "chunks", r, chunks)
+	checkStreamed(t, "disk", r, disk)
+	if _, err := ReadLeafStream(r); err != io.EOF {
+		t.Errorf("expected io.EOF after the trees, got %v", err)
+	}
+	// read without ReadByte
+	checkStreamed(t, "reader", io.MultiReader(bytes.NewReader(stream)), first)
+
+	for _, n := range []int{1, 10, 40} {
+		if _, err := ReadLeafStream(bytes.NewReader(stream[:n])); err != ErrMalformedTree {
+			t.Errorf("expected ErrMalformedTree of %d bytes, got %v", n, err)
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestLeafStreamError(t *testing.T) {
+	b := NewBuilder(DefaultHashMaker, 16, WithLeafStream(failingWriter{}))
+	if _, err := b.Write(make([]byte, 10)); err != nil {
+		t.Errorf("expected no error before a leaf is streamed, got %v", err)
+	}
+	if n, err := b.Write(make([]byte, 30)); err == nil || n != 6 {
+		t.Errorf("expected the error of the stream after the first leaf, got %d %v", n, err)
+	}
+	if _, _, err := b.Finalize(); err == nil {
+		t.Error("expected the error of the stream from Finalize")
+	}
+}
@@ -0,0 +1,199 @@
+package merkle
+
+import "io"
+
+// DecodeLimits caps the trees, partial trees and proofs decoded, so input from
+// an untrusted peer can not exhaust memory however large the counts it
+// claims. Zero is no limit, and a limit exceeded is an ErrLimitExceeded.
+type DecodeLimits struct {
+	MaxLeaves     int   // of a tree, or the leaves and hashes of a partial tree
+	MaxProofDepth int   // checksums of the path of a proof
+	MaxBytes      int64 // of the encoded form
+}
+
+// DefaultDecodeLimits returns the limits of the Unmarshal and ReadFrom methods
+// of Tree, PartialTree, Proof, HashState and Parity, and of ReadLeafStream,
+// ReadTreeStats and Unmarshal. They are ample for trees of terabytes of
+// blocks, and bound what a peer can have a decode allocate. For other limits,
+// as of a service or a call, decode with the methods of a DecodeLimits.
+func DefaultDecodeLimits() DecodeLimits {
+	return DecodeLimits{
+		MaxLeaves:     1 << 26,
+		MaxProofDepth: 64,
+		MaxBytes:      1 << 33,
+	}
+}
+
+// limitedDecoder is a value that can be decoded of limits other than the
+// DefaultDecodeLimits, by the codec named, where it has a form of that codec
+type limitedDecoder interface {
+	unmarshalLimited(codec string, data []byte, l DecodeLimits) (bool, error)
+}
+
+// Unmarshal decodes data into v, a pointer, with the codec registered as
+// codec, as the package Unmarshal does but of the limits l. The binary, json,
+// cbor and proto forms of this package are checked as they are decoded, and
+// any other after, so l bounds the memory of the first and the size of the
+// value of all.
+func (l DecodeLimits) Unmarshal(codec string, data []byte, v interface{}) error {
+	c, ok := LookupCodec(codec)
+	if !ok {
+		return ErrUnknownCodec{Name: codec}
+	}
+	if err := l.checkBytes(len(data)); err != nil {
+		return err
+	}
+	handled := false
+	if d, ok := v.(limitedDecoder); ok {
+		var err error
+		if handled, err = d.unmarshalLimited(codec, data, l); err != nil {
+			return err
+		}
+	}
+	if !handled {
+		if err := c.Unmarshal(data, v); err != nil {
+			return err
+		}
+	}
+	return l.check(v)
+}
+
+// check is whether a decoded value is within the limits, and a Proof or
+// PartialTree consistent
+func (l DecodeLimits) check(v interface{}) error {
+	switch v := v.(type) {
+	case *Tree:
+		return l.checkLeaves(uint64(len(v.Nodes)))
+	case *Proof:
+		if err := l.checkDepth(len(v.Path)); err != nil {
+			return err
+		}
+		return v.check()
+	case *PartialTree:
+		if err := l.checkLeaves(uint64(len(v.Leaves) + len(v.Hashes))); err != nil {
+			return err
+		}
+		return v.check()
+	case *Parity:
+		return l.checkLeaves(uint64(v.Leaves))
+	}
+	return nil
+}
+
+// ReadTree decodes a tree of the form of MarshalBinary from r, as
+// Tree.ReadFrom does but of the limits l
+func (l DecodeLimits) ReadTree(r io.Reader) (*Tree, error) {
+	t := &Tree{}
+	if _, err := t.readFrom(r, l); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ReadLeafStream is the package ReadLeafStream, of the limits l
+func (l DecodeLimits) ReadLeafStream(r io.Reader) (*Tree, error) {
+	return readLeafStream(r, l)
+}
+
+// ReadTreeStats is the package ReadTreeStats, of the limits l
+func (l DecodeLimits) ReadTreeStats(r io.Reader) (TreeStats, error) {
+	return readTreeStats(r, l)
+}
+
+func (t *Tree) unmarshalLimited(codec string, data []byte, l DecodeLimits) (bool, error) {
+	switch codec {
+	case "binary":
+		return true, t.unmarshalBinary(data, l)
+	case "json":
+		return true, t.unmarshalJSON(data, l)
+	case "cbor":
+		return true, t.unmarshalCBOR(data, l)
+	case "proto":
+		return true, t.unmarshalProto(data, l)
+	}
+	return false, nil
+}
+
+func (p *PartialTree) unmarshalLimited(codec string, data []byte, l DecodeLimits) (bool, error) {
+	switch codec {
+	case "binary":
+		return true, p.unmarshalBinary(data, l)
+	case "json":
+		return true, p.unmarshalJSON(data, l)
+	}
+	return false, nil
+}
+
+func (p *Proof) unmarshalLimited(codec string, data []byte, l DecodeLimits) (bool, error) {
+	if codec == "json" {
+		return true, p.unmarshalJSON(data, l)
+	}
+	return false, nil
+}
+
+func (s *HashState) unmarshalLimited(codec string, data []byte, l DecodeLimits) (bool, error) {
+	if codec == "proto" {
+		return true, s.unmarshalProto(data, l)
+	}
+	return false, nil
+}
+
+func (p *Parity) unmarshalLimited(codec string, data []byte, l DecodeLimits) (bool, error) {
+	if codec == "binary" {
+		return true, p.unmarshalBinary(data, l)
+	}
+	return false, nil
+}
+
+func (l DecodeLimits) checkLeaves(n uint64) error {
+	if l.MaxLeaves > 0 && n > uint64(l.MaxLeaves) {
+		return ErrLimitExceeded{Limit: "leaves", Max: int64(l.MaxLeaves)}
+	}
+	return nil
+}
+
+func (l DecodeLimits) checkDepth(n int) error {
+	if l.MaxProofDepth > 0 && n > l.MaxProofDepth {
+		return ErrLimitExceeded{Limit: "proof depth", Max: int64(l.MaxProofDepth)}
+	}
+	return nil
+}
+
+func (l DecodeLimits) checkBytes(n int) error {
+	if l.MaxBytes > 0 && int64(n) > l.MaxBytes {
+		return ErrLimitExceeded{Limit: "encoded bytes", Max: l.MaxBytes}
+	}
+	return nil
+}
+
+// reader is r, failing with an ErrLimitExceeded once more than MaxBytes
+// would be read from it
+func (l DecodeLimits) reader(r io.Reader) io.Reader {
+	if l.MaxBytes <= 0 {
+		return r
+	}
+	return &limitReader{r: r, left: l.MaxBytes, max: l.MaxBytes}
+}
+
+type limitReader struct {
+	r         io.Reader
+	left, max int64
+}
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	if lr.left <= 0 {
+		// at the limit, which is only exceeded if there is more to read
+		var probe [1]byte
+		n, err := lr.r.Read(probe[:])
+		if n > 0 {
+			return 0, ErrLimitExceeded{Limit: "encoded bytes", Max: lr.max}
+		}
+		return 0, err
+	}
+	if int64(len(p)) > lr.left {
+		p = p[:lr.left]
+	}
+	n, err := lr.r.Read(p)
+	lr.left -= int64(n)
+	return n, err
+}
@@ -0,0 +1,126 @@
+package merkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecodeLimits(t *testing.T) {
+	tree := testTree(t, 9)
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonData, err := tree.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := tree.InclusionProof(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proofData, err := Marshal("json", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// within the limits, of the encoded bytes exactly
+	l := DecodeLimits{MaxLeaves: 9, MaxProofDepth: len(p.Path), MaxBytes: int64(len(data))}
+	got, err := l.ReadTree(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Nodes) != 9 {
+		t.Errorf("expected 9 leaves, got %d", len(got.Nodes))
+	}
+	var proof Proof
+	if err := l.Unmarshal("json", proofData, &proof); err != nil {
+		t.Fatal(err)
+	}
+
+	l = DecodeLimits{MaxBytes: int64(len(data))}
+	if _, err := l.ReadTree(bytes.NewReader(append(data, 0))); err != (ErrLimitExceeded{Limit: "encoded bytes", Max: int64(len(data))}) {
+		t.Errorf("expected the encoded bytes exceeded, got %v", err)
+	}
+	if err := l.Unmarshal("json", jsonData, got); err != (ErrLimitExceeded{Limit: "encoded bytes", Max: int64(len(data))}) {
+		t.Errorf("expected the encoded bytes of JSON exceeded, got %v", err)
+	}
+
+	l = DecodeLimits{MaxLeaves: 8}
+	for _, codec := range []string{"binary", "json", "cbor", "proto", "gob"} {
+		encoded, err := Marshal(codec, tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Unmarshal(codec, encoded, &Tree{}); err != (ErrLimitExceeded{Limit: "leaves", Max: 8}) {
+			t.Errorf("expected the leaves of %s exceeded, got %v", codec, err)
+		}
+		// which are not the limits of the methods
+		if err := Unmarshal(codec, encoded, &Tree{}); err != nil {
+			t.Errorf("expected %s of the default limits, got %v", codec, err)
+		}
+	}
+	partial, err := tree.Partial(1, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partialData, err := partial.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l = DecodeLimits{MaxLeaves: len(partial.Leaves) + len(partial.Hashes) - 1}
+	if err := l.Unmarshal("binary", partialData, &PartialTree{}); err == nil {
+		t.Errorf("expected the leaves and hashes of a partial tree exceeded")
+	}
+
+	l = DecodeLimits{MaxProofDepth: len(p.Path) - 1}
+	if err := l.Unmarshal("json", proofData, &proof); err != (ErrLimitExceeded{Limit: "proof depth", Max: int64(len(p.Path) - 1)}) {
+		t.Errorf("expected the proof depth exceeded, got %v", err)
+	}
+
+	// a header claiming many leaves is refused before they are read, of the
+	// default limits too
+	name, err := HashName(DefaultHashMaker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := append(append([]byte{}, serializedMagic...), serializedVersion, byte(len(name)))
+	header = append(append(header, name...), byte(FinalBlockRaw))
+	for _, v := range []uint64{1, 0, 1 << 40, uint64(DefaultHashMaker().Size())} {
+		header = appendUvarint(header, v)
+	}
+	max := int64(DefaultDecodeLimits().MaxLeaves)
+	if err := got.UnmarshalBinary(header); err != (ErrLimitExceeded{Limit: "leaves", Max: max}) {
+		t.Errorf("expected the leaves of the header exceeded, got %v", err)
+	}
+	if _, err := ReadTreeStats(bytes.NewReader(header)); err != (ErrLimitExceeded{Limit: "leaves", Max: max}) {
+		t.Errorf("expected the leaves of the header of stats exceeded, got %v", err)
+	}
+
+	l = DecodeLimits{MaxLeaves: 8}
+	if _, err := l.ReadTreeStats(bytes.NewReader(data)); err != (ErrLimitExceeded{Limit: "leaves", Max: 8}) {
+		t.Errorf("expected the leaves of stats exceeded, got %v", err)
+	}
+	var stream bytes.Buffer
+	if _, _, err := NewBuilder(DefaultHashMaker, 1, WithLeafStream(&stream)).Build(bytes.NewReader(make([]byte, 9)), 9); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.ReadLeafStream(bytes.NewReader(stream.Bytes())); err != (ErrLimitExceeded{Limit: "leaves", Max: 8}) {
+		t.Errorf("expected the leaves of a leaf stream exceeded, got %v", err)
+	}
+	blocks, err := SumOf(DefaultHashMaker, 1, make([]byte, 9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parity, err := NewParity(bytes.NewReader(make([]byte, 9)), blocks, 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parityData, err := parity.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Unmarshal("binary", parityData, &Parity{}); err != (ErrLimitExceeded{Limit: "leaves", Max: 8}) {
+		t.Errorf("expected the leaves of parity exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package merkle
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+)
+
+// ErrMACMismatch is for a RootMetadata whose MAC is not that of the key
+var ErrMACMismatch = errors.New("root MAC does not match")
+
+// macContext starts the bytes of a RootMetadata that are authenticated, so
+// its MAC is of no other use of the key
+const macContext = "merkle root mac v1\n"
+
+// RootMetadata is the root of a tree, with the parameters needed to make sense
+// of it: its count of leaves, block length and the name of its hash. A MAC of
+// these with a shared key authenticates them between services that have no
+// signing keys, as a Checkpoint would.
+type RootMetadata struct {
+	Hash        string `json:"hash"` // as registered, see RegisterHash
+	Size        int    `json:"size"`
+	BlockLength int    `json:"blockLength"`
+	Root        []byte `json:"root"`
+}
+
+// NewRootMetadata returns the RootMetadata of the current state of t
+func NewRootMetadata(t *Tree) (RootMetadata, error) {
+	name, err := HashName(t.hashMaker())
+	if err != nil {
+		return RootMetadata{}, err
+	}
+	root, err := t.RootChecksum()
+	if err != nil {
+		return RootMetadata{}, err
+	}
+	return RootMetadata{Hash: name, Size: len(t.Nodes), BlockLength: t.BlockLength, Root: root}, nil
+}
+
+// MAC is the HMAC-SHA256 of key over the metadata
+func (m RootMetadata) MAC(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(m.payload(macContext))
+	return mac.Sum(nil)
+}
+
+// VerifyMAC checks mac is the MAC of key over the metadata, or is an
+// ErrMACMismatch
+func (m RootMetadata) VerifyMAC(key, mac []byte) error {
+	if !hmac.Equal(m.MAC(key), mac) {
+		return ErrMACMismatch
+	}
+	return nil
+}
+
+// payload is the authenticated bytes: the context, then each field length
+// prefixed or as a uvarint, so no two metadata are of the same bytes
+func (m RootMetadata) payload(context string) []byte {
+	b := []byte(context)
+	b = appendUvarint(b, uint64(len(m.Hash)))
+	b = append(b, m.Hash...)
+	b = appendUvarint(b, uint64(m.Size))
+	b = appendUvarint(b, uint64(m.BlockLength))
+	b = appendUvarint(b, uint64(len(m.Root)))
+	return append(b, m.Root...)
+}
@@ -0,0 +1,34 @@
+package merkle
+
+import "testing"
+
+func TestRootMetadataMAC(t *testing.T) {
+	tree := testTree(t, 5)
+	m, err := NewRootMetadata(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Size != 5 || m.BlockLength != 1 || m.Hash != "sha1" {
+		t.Errorf("expected the metadata of the tree, got %+v", m)
+	}
+	key := []byte("shared key")
+	mac := m.MAC(key)
+	if err := m.VerifyMAC(key, mac); err != nil {
+		t.Error(err)
+	}
+	if err := m.VerifyMAC([]byte("other key"), mac); err != ErrMACMismatch {
+		t.Errorf("expected ErrMACMismatch of another key, got %v", err)
+	}
+	for name, change := range map[string]func(*RootMetadata){
+		"hash":         func(m *RootMetadata) { m.Hash = "sha256" },
+		"size":         func(m *RootMetadata) { m.Size = 4 },
+		"block length": func(m *RootMetadata) { m.BlockLength = 2 },
+		"root":         func(m *RootMetadata) { m.Root = append([]byte{0}, m.Root[1:]...) },
+	} {
+		changed := m
+		change(&changed)
+		if err := changed.VerifyMAC(key, mac); err != ErrMACMismatch {
+			t.Errorf("%s: expected ErrMACMismatch, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package merkle
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// MappedFile reads a local file of a tree through a memory map, verifying
+// each block the first time a read touches it. Blocks verified, and blocks
+// found corrupt, are tracked in bitmaps, so a read of blocks already verified
+// is a copy from the map. A read into a corrupt block returns the bytes before
+// it and an ErrBlockMismatch.
+//
+// Where memory maps are not supported, the file is read into memory instead.
+type MappedFile struct {
+	tree     *Tree
+	hm       HashMaker
+	data     []byte
+	verified []uint64 // bitmap of the blocks verified
+	corrupt  []uint64 // bitmap of the blocks that failed
+}
+
+// OpenMapped maps the file at path, of the blob of tree. The file must be of
+// the length of the tree.
+func OpenMapped(path string, tree *Tree) (*MappedFile, error) {
+	if tree.BlockLength <= 0 {
+		return nil, ErrNoBlockLength
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() != tree.TotalLength() {
+		return nil, fmt.Errorf("%s is %d bytes, for a tree of %d", path, fi.Size(), tree.TotalLength())
+	}
+	if fi.Size() > int64(maxInt) {
+		return nil, fmt.Errorf("%s is too large to map", path)
+	}
+	var data []byte
+	if fi.Size() > 0 {
+		if data, err = mapFile(f, int(fi.Size())); err != nil {
+			return nil, err
+		}
+	}
+	words := (len(tree.Nodes) + 63) / 64
+	return &MappedFile{
+		tree:     tree,
+		hm:       tree.hashMaker(),
+		data:     data,
+		verified: make([]uint64, words),
+		corrupt:  make([]uint64, words),
+	}, nil
+}
+
+// Size is the length of the file
+func (m *MappedFile) Size() int64 {
+	return int64(len(m.data))
+}
+
+// ReadAt reads len(p) bytes of the file from off, verifying the blocks
+// covering them that are not yet verified
+func (m *MappedFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > int64(len(m.data)) {
+		end = int64(len(m.data))
+	}
+	bl := int64(m.tree.BlockLength)
+	for index := int(off / bl); int64(index)*bl < end; index++ {
+		if err := m.verify(index); err != nil {
+			begin := int64(index) * bl
+			if begin < off {
+				begin = off
+			}
+			return copy(p, m.data[off:begin]), err
+		}
+	}
+	n := copy(p, m.data[off:end])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Verified is the count of blocks verified so far
+func (m *MappedFile) Verified() int {
+	var count int
+	for i := range m.tree.Nodes {
+		if bitSet(m.verified, i) {
+			count++
+		}
+	}
+	return count
+}
+
+// Close unmaps the file. The MappedFile is not to be read after.
+func (m *MappedFile) Close() error {
+	data := m.data
+	m.data = nil
+	if data == nil {
+		return nil
+	}
+	return unmapFile(data)
+}
+
+// verify checks the block at index, once. Concurrent reads may both hash a
+// block not yet verified, to the same outcome.
+func (m *MappedFile) verify(index int) error {
+	if bitSet(m.verified, index) {
+		return nil
+	}
+	if bitSet(m.corrupt, index) {
+		return ErrBlockMismatch{Index: index}
+	}
+	bl := m.tree.BlockLength
+	end := (index + 1) * bl
+	if end > len(m.data) {
+		end = len(m.data)
+	}
+	if err := verifyBlock(m.tree, m.hm, index, m.data[index*bl:end]); err != nil {
+		if _, ok := err.(ErrBlockMismatch); ok {
+			setBit(m.corrupt, index)
+		}
+		return err
+	}
+	setBit(m.verified, index)
+	return nil
+}
+
+func bitSet(bits []uint64, i int) bool {
+	return atomic.LoadUint64(&bits[i/64])&(1<<uint(i%64)) != 0
+}
+
+func setBit(bits []uint64, i int) {
+	word, bit := &bits[i/64], uint64(1)<<uint(i%64)
+	for {
+		old := atomic.LoadUint64(word)
+		if old&bit != 0 || atomic.CompareAndSwapUint64(word, old, old|bit) {
+			return
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package merkle
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads size bytes of f, as memory maps are not supported
+func mapFile(f *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func unmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,77 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMappedFile(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	tree, err := SumOf(sha256.New, 64, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "merkle-mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "blob")
+	corrupt := append([]byte{}, data...)
+	corrupt[200] ^= 0xff // of block 3
+	if err := ioutil.WriteFile(path, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := OpenMapped(path, tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	p := make([]byte, 100)
+	if n, err := m.ReadAt(p, 0); err != nil || !bytes.Equal(p[:n], data[:100]) {
+		t.Fatalf("expected the first 100 bytes, got %d, %v", n, err)
+	}
+	if got := m.Verified(); got != 2 {
+		t.Errorf("expected 2 blocks verified, got %d", got)
+	}
+	if n, err := m.ReadAt(p, 960); err != io.EOF || !bytes.Equal(p[:n], data[960:]) {
+		t.Errorf("expected the last 40 bytes and io.EOF, got %d, %v", n, err)
+	}
+
+	var mismatch ErrBlockMismatch
+	n, err := m.ReadAt(p, 150)
+	if !errors.As(err, &mismatch) || mismatch.Index != 3 {
+		t.Fatalf("expected ErrBlockMismatch of block 3, got %v", err)
+	}
+	if n != 42 || !bytes.Equal(p[:n], data[150:192]) {
+		t.Errorf("expected the 42 bytes before block 3, got %d", n)
+	}
+	if _, err := m.ReadAt(p[:10], 192); !errors.As(err, &mismatch) {
+		t.Errorf("expected the corrupt block to fail again, got %v", err)
+	}
+	if _, err := m.ReadAt(p[:10], 256); err != nil {
+		t.Errorf("expected the block after the corrupt one to read, got %v", err)
+	}
+}
+
+func TestMappedFileLength(t *testing.T) {
+	tree, _ := SumOf(sha256.New, 64, make([]byte, 100))
+	f, err := ioutil.TempFile("", "merkle-mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(make([]byte, 99))
+	f.Close()
+	if _, err := OpenMapped(f.Name(), tree); err == nil {
+		t.Error("expected a file of the wrong length to fail")
+	}
+}
@@ -0,0 +1,132 @@
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Multipart is the tree of an object uploaded in parts, as an S3 multipart
+// upload, with the summary of each part's subtree. As parts are whole blocks,
+// except the last, the root is the same as the tree of the whole object.
+type Multipart struct {
+	BlockLength int
+	PartSize    int64
+	Parts       []MultipartPart
+	Root        []byte
+}
+
+// MultipartPart is a part of a Multipart object
+type MultipartPart struct {
+	Number  int // from 1, as S3 numbers parts
+	Offset  int64
+	Size    int64
+	Summary SubtreeSummary
+}
+
+// ErrPartMismatch is for a part whose content does not match its subtree
+type ErrPartMismatch struct {
+	Number int
+}
+
+// Error shows the number of the part that failed
+func (err ErrPartMismatch) Error() string {
+	return fmt.Sprintf("part %d does not match its subtree", err.Number)
+}
+
+// NewMultipart reads the object r, in parts of partSize, which must be a
+// multiple of blockLength, and returns the subtree of each part and the root
+// of the object
+func NewMultipart(r io.Reader, hm HashMaker, blockLength int, partSize int64) (*Multipart, error) {
+	if blockLength < MinBlockSize || partSize < int64(blockLength) || partSize%int64(blockLength) != 0 {
+		return nil, fmt.Errorf("part size %d is not a multiple of block length %d", partSize, blockLength)
+	}
+	m := &Multipart{BlockLength: blockLength, PartSize: partSize}
+	var (
+		offset int64
+		leaves int
+	)
+	for {
+		cr := &countingReader{r: io.LimitReader(r, partSize)}
+		s, err := SummarizeReader(hm, blockLength, leaves, cr)
+		if err != nil {
+			return nil, err
+		}
+		if cr.n == 0 && len(m.Parts) > 0 {
+			break
+		}
+		m.Parts = append(m.Parts, MultipartPart{Number: len(m.Parts) + 1, Offset: offset, Size: cr.n, Summary: s})
+		offset += cr.n
+		leaves = s.End
+		if cr.n < partSize {
+			break
+		}
+	}
+
+	root, err := m.root(hm)
+	if err != nil {
+		return nil, err
+	}
+	m.Root = root
+	return m, nil
+}
+
+// VerifyPart checks the content of a downloaded part, as from a ranged GET or
+// a GET with its partNumber, against the part's subtree
+func (m *Multipart) VerifyPart(hm HashMaker, number int, r io.Reader) error {
+	if number < 1 || number > len(m.Parts) {
+		return ErrIndexOutOfRange{Index: number, Size: len(m.Parts)}
+	}
+	p := m.Parts[number-1]
+	cr := &countingReader{r: r}
+	s, err := SummarizeReader(hm, m.BlockLength, p.Summary.Start, cr)
+	if err != nil {
+		return err
+	}
+	if cr.n != p.Size || s.End != p.Summary.End || len(s.Frontier) != len(p.Summary.Frontier) {
+		return ErrPartMismatch{Number: number}
+	}
+	for i := range s.Frontier {
+		if !bytes.Equal(s.Frontier[i], p.Summary.Frontier[i]) {
+			return ErrPartMismatch{Number: number}
+		}
+	}
+	return nil
+}
+
+// Validate checks that the subtrees of the parts, as from metadata stored
+// alongside the object, assemble into the root
+func (m *Multipart) Validate(hm HashMaker) error {
+	root, err := m.root(hm)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(root, m.Root) {
+		return fmt.Errorf("parts do not assemble into the root %x", m.Root)
+	}
+	return nil
+}
+
+// root assembles the subtrees of the parts
+func (m *Multipart) root(hm HashMaker) ([]byte, error) {
+	summaries := make([]SubtreeSummary, len(m.Parts))
+	for i, p := range m.Parts {
+		summaries[i] = p.Summary
+	}
+	root, err := AssembleRoot(hm, summaries...)
+	if err == ErrEmptyTree {
+		return EmptyRoot(hm), nil
+	}
+	return root, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
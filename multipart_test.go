@@ -0,0 +1,71 @@
+package merkle
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestMultipart(t *testing.T) {
+	data := make([]byte, 10*1024+100)
+	rand.New(rand.NewSource(3)).Read(data)
+
+	m, err := NewMultipart(bytes.NewReader(data), DefaultHashMaker, 256, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Parts) != 3 || m.Parts[2].Size != 2*1024+100 || m.Parts[2].Offset != 8192 {
+		t.Fatalf("unexpected parts %+v", m.Parts)
+	}
+
+	_, root, err := NewBuilder(DefaultHashMaker, 256).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(m.Root, root) {
+		t.Errorf("expected the root of the whole object %x, got %x", root, m.Root)
+	}
+	if err := m.Validate(DefaultHashMaker); err != nil {
+		t.Error(err)
+	}
+
+	for _, p := range m.Parts {
+		part := data[p.Offset : p.Offset+p.Size]
+		if err := m.VerifyPart(DefaultHashMaker, p.Number, bytes.NewReader(part)); err != nil {
+			t.Errorf("part %d: %s", p.Number, err)
+		}
+	}
+	corrupt := append([]byte{}, data[4096:8192]...)
+	corrupt[100]++
+	if err := m.VerifyPart(DefaultHashMaker, 2, bytes.NewReader(corrupt)); err != (ErrPartMismatch{Number: 2}) {
+		t.Errorf("expected part 2 to fail, got %v", err)
+	}
+	if err := m.VerifyPart(DefaultHashMaker, 3, bytes.NewReader(data[8192:])); err != nil {
+		t.Error(err)
+	}
+	if err := m.VerifyPart(DefaultHashMaker, 3, bytes.NewReader(data[8192:len(data)-1])); err == nil {
+		t.Errorf("expected a short part to fail")
+	}
+	if err := m.VerifyPart(DefaultHashMaker, 4, bytes.NewReader(nil)); err == nil {
+		t.Errorf("expected an error for a missing part")
+	}
+
+	m.Parts[0].Summary.Frontier[0][0]++
+	if err := m.Validate(DefaultHashMaker); err == nil {
+		t.Errorf("expected altered parts not to assemble into the root")
+	}
+
+	if _, err := NewMultipart(bytes.NewReader(data), DefaultHashMaker, 256, 1000); err == nil {
+		t.Errorf("expected an error for parts that are not whole blocks")
+	}
+}
+
+func TestMultipartEmpty(t *testing.T) {
+	m, err := NewMultipart(bytes.NewReader(nil), DefaultHashMaker, 256, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Parts) != 1 || !bytes.Equal(m.Root, EmptyRoot(DefaultHashMaker)) {
+		t.Errorf("expected a single empty part and the empty root, got %+v", m)
+	}
+}
@@ -0,0 +1,187 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Nar is the hash of the Nix archive (NAR) serialization of a path, with the
+// trees of the regular files in it, so a large store path can be verified
+// block by block while its NAR hash still matches the Nix store's
+type Nar struct {
+	Hash  []byte           // sha256 of the NAR
+	Size  int64            // of the NAR
+	Files map[string]*Tree // by path within the archive, like "/bin/tool", or "/" for a file
+}
+
+// HashNar serializes the file, directory or symlink at path as a NAR, and
+// returns its hash along with the trees of the contents of its regular files
+func HashNar(path string, hm HashMaker, blockLength int) (*Nar, error) {
+	nw := &narWriter{
+		h:           sha256.New(),
+		hm:          hm,
+		blockLength: blockLength,
+		files:       map[string]*Tree{},
+	}
+	nw.str("nix-archive-1")
+	if err := nw.node(path, ""); err != nil {
+		return nil, err
+	}
+	return &Nar{Hash: nw.h.Sum(nil), Size: nw.size, Files: nw.files}, nil
+}
+
+// StoreHash is the hash as Nix shows a narHash, like "sha256:0mdqa9..."
+func (n *Nar) StoreHash() string {
+	return "sha256:" + nixBase32(n.Hash)
+}
+
+type narWriter struct {
+	h           hash.Hash
+	size        int64
+	hm          HashMaker
+	blockLength int
+	files       map[string]*Tree
+}
+
+func (nw *narWriter) write(b []byte) {
+	nw.h.Write(b) // hash.Hash writes do not fail
+	nw.size += int64(len(b))
+}
+
+func (nw *narWriter) uint64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	nw.write(b[:])
+}
+
+func (nw *narWriter) pad(n uint64) {
+	if n%8 != 0 {
+		nw.write(make([]byte, 8-n%8))
+	}
+}
+
+// str is a length prefixed string, padded to 8 bytes
+func (nw *narWriter) str(s string) {
+	nw.uint64(uint64(len(s)))
+	nw.write([]byte(s))
+	nw.pad(uint64(len(s)))
+}
+
+// node serializes the file at path, named name within the archive
+func (nw *narWriter) node(path, name string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	nw.str("(")
+	nw.str("type")
+	switch {
+	case fi.Mode().IsRegular():
+		nw.str("regular")
+		if fi.Mode()&0100 != 0 {
+			nw.str("executable")
+			nw.str("")
+		}
+		nw.str("contents")
+		if err := nw.contents(path, name, fi.Size()); err != nil {
+			return err
+		}
+	case fi.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		nw.str("symlink")
+		nw.str("target")
+		nw.str(target)
+	case fi.IsDir():
+		nw.str("directory")
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		names, err := f.Readdirnames(-1)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		sort.Strings(names)
+		for _, entry := range names {
+			nw.str("entry")
+			nw.str("(")
+			nw.str("name")
+			nw.str(entry)
+			nw.str("node")
+			if err := nw.node(filepath.Join(path, entry), name+"/"+entry); err != nil {
+				return err
+			}
+			nw.str(")")
+		}
+	default:
+		return fmt.Errorf("%s: unsupported file type %s", path, fi.Mode().Type())
+	}
+	nw.str(")")
+	return nil
+}
+
+// contents writes the contents of a regular file, while building its tree
+func (nw *narWriter) contents(path, name string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b := NewBuilder(nw.hm, nw.blockLength, WithEmptyRoot())
+	nw.uint64(uint64(size))
+	n, err := io.Copy(io.MultiWriter(writerFunc(func(p []byte) (int, error) {
+		nw.write(p)
+		return len(p), nil
+	}), b), f)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("%s: changed size while reading", path)
+	}
+	nw.pad(uint64(size))
+	tree, _, err := b.Finalize()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = "/"
+	}
+	nw.files[name] = tree
+	return nil
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+// nixBase32 is the base32 encoding Nix shows hashes in, which has its own
+// alphabet and takes the bits from the end of the hash
+func nixBase32(b []byte) string {
+	const alphabet = "0123456789abcdfghijklmnpqrsvwxyz"
+	n := (len(b)*8-1)/5 + 1
+	s := make([]byte, 0, n)
+	for i := n - 1; i >= 0; i-- {
+		var (
+			bit  = uint(i * 5)
+			j, k = bit / 8, bit % 8
+			c    = b[j] >> k
+		)
+		if int(j) < len(b)-1 {
+			c |= b[j+1] << (8 - k)
+		}
+		s = append(s, alphabet[c&0x1f])
+	}
+	return string(s)
+}
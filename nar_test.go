@@ -0,0 +1,92 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNixBase32(t *testing.T) {
+	sum := sha256.Sum256(nil)
+	expected := "0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73"
+	if got := nixBase32(sum[:]); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+// narStrings is the NAR of a sequence of strings
+func narStrings(strs ...string) []byte {
+	var buf bytes.Buffer
+	for _, s := range strs {
+		binary.Write(&buf, binary.LittleEndian, uint64(len(s)))
+		buf.WriteString(s)
+		for buf.Len()%8 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestHashNar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkle-nar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := bytes.Repeat([]byte("store path content"), 100)
+	if err := os.Mkdir(filepath.Join(dir, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "bin", "tool"), content, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "bin", "tool"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("bin/tool", filepath.Join(dir, "tool")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := narStrings(
+		"nix-archive-1", "(", "type", "directory",
+		"entry", "(", "name", "bin", "node",
+		"(", "type", "directory",
+		"entry", "(", "name", "tool", "node",
+		"(", "type", "regular", "executable", "", "contents", string(content), ")",
+		")",
+		")",
+		")",
+		"entry", "(", "name", "tool", "node",
+		"(", "type", "symlink", "target", "bin/tool", ")",
+		")",
+		")",
+	)
+	sum := sha256.Sum256(expected)
+
+	nar, err := HashNar(dir, DefaultHashMaker, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(nar.Hash, sum[:]) {
+		t.Errorf("expected NAR hash %x, got %x", sum, nar.Hash)
+	}
+	if nar.Size != int64(len(expected)) {
+		t.Errorf("expected NAR of %d bytes, got %d", len(expected), nar.Size)
+	}
+	if nar.StoreHash() != "sha256:"+nixBase32(sum[:]) {
+		t.Errorf("unexpected store hash %s", nar.StoreHash())
+	}
+
+	tree := nar.Files["/bin/tool"]
+	if tree == nil {
+		t.Fatalf("expected a tree of /bin/tool, got %v", nar.Files)
+	}
+	if _, err := ioutil.ReadAll(NewVerifyingReader(bytes.NewReader(content), tree)); err != nil {
+		t.Errorf("expected the content to verify against its tree: %s", err)
+	}
+}
@@ -21,41 +21,106 @@ func NewNode() *Node {
 
 // NewNodeHash returns a new Node using the provided crypto.Hash for checksums
 func NewNodeHash(h HashMaker) *Node {
-	return &Node{hash: h}
+	return &Node{sums: &digests{hm: h}, slot: noSlot}
 }
 
 // NewNodeHashBlock returns a new Node using the provided crypto.Hash, and calculates the block's checksum
 func NewNodeHashBlock(h HashMaker, b []byte) (*Node, error) {
-	n := &Node{hash: h}
-	h1 := n.hash()
+	h1 := h()
 	if _, err := h1.Write(b); err != nil {
 		return nil, err
 	}
-	n.checksum = h1.Sum(nil)
-	return n, nil
+	return newLeaf(h, h1.Sum(nil)), nil
+}
+
+// newLeaf is a leaf of the checksum sum, which it keeps, of hm
+func newLeaf(hm HashMaker, sum []byte) *Node {
+	return &Node{sums: &digests{hm: hm, size: len(sum), sums: sum}}
 }
 
 // Node is a fundamental part of the tree.
 type Node struct {
-	hash                HashMaker
-	checksum            []byte
+	// sums is of the HashMaker of the node, and its checksum at slot, or
+	// noSlot for none
+	sums *digests
+	slot int
+
 	Parent, Left, Right *Node
 
-	//pos int // XXX maybe keep their order when it is a direct block's hash
+	// Index, Offset and Length are the position of a leaf, as its index among
+	// the leaves and the offset and length of its block in the input
+	Index  int
+	Offset int64
+	Length int
+}
+
+// digests is the HashMaker of nodes and their checksums, packed size bytes
+// apart, so a Node is of the slot of its checksum rather than a slice of its
+// own. The leaves of a leafSlab share the digests of an array of them, a node
+// made on its own has digests of its one checksum, of any size, and the
+// interior nodes of Root share those of their left child, of no slot.
+type digests struct {
+	hm   HashMaker
+	size int
+	sums []byte
+
+	// annotation is committed to by the checksum of the one node of
+	// NewAnnotatedNode
+	annotation *[]byte
+}
+
+// noSlot is the slot of a node without a checksum of its own
+const noSlot = -1
+
+// checksum is the checksum of the node, capped so appending to it can not
+// write over the next, or nil if it has none
+func (n *Node) checksum() []byte {
+	d := n.sums
+	if d == nil || n.slot == noSlot || d.size == 0 {
+		return nil
+	}
+	start := n.slot * d.size
+	return d.sums[start : start+d.size : start+d.size]
+}
+
+// hashMaker returns the HashMaker of this node, falling back to the
+// DefaultHashMaker when none was provided
+func (n *Node) hashMaker() HashMaker {
+	if n.sums == nil || n.sums.hm == nil {
+		return DefaultHashMaker
+	}
+	return n.sums.hm
+}
+
+// leafCopy is a copy of the node's checksum, detached from any tree
+func (n Node) leafCopy() *Node {
+	c := &Node{Index: n.Index, Offset: n.Offset, Length: n.Length, slot: n.slot}
+	if n.sums != nil {
+		c.sums = &digests{hm: n.sums.hm, annotation: n.sums.annotation}
+		if sum := n.checksum(); sum != nil {
+			c.sums.size, c.sums.sums, c.slot = len(sum), append([]byte{}, sum...), 0
+		}
+	}
+	return c
 }
 
 // IsLeaf indicates this node is for specific block (and has no children)
 func (n Node) IsLeaf() bool {
-	return len(n.checksum) != 0 && (n.Left == nil && n.Right == nil)
+	return len(n.checksum()) != 0 && (n.Left == nil && n.Right == nil)
 }
 
 // Checksum returns the checksum of the block, or the checksum of this nodes
-// children (left.checksum + right.checksum)
+// children (left.checksum() + right.checksum())
 // If it is a leaf (no children) Node, then the Checksum is of the block of a
 // payload. Otherwise, the Checksum is of it's two children's Checksum.
-func (n Node) Checksum() ([]byte, error) {
-	if n.checksum != nil {
-		return n.checksum, nil
+// The Checksum of a nil Node, as is the Root of an empty Tree, is
+// ErrEmptyTree.
+func (n *Node) Checksum() ([]byte, error) {
+	if n == nil {
+		return nil, ErrEmptyTree
+	}
+	if sum := n.checksum(); sum != nil {
+		return sum, nil
 	}
 	if n.Left != nil && n.Right != nil {
 
@@ -73,7 +138,7 @@ func (n Node) Checksum() ([]byte, error) {
 			rSumChan <- childSumResponse{checksum: c, err: err}
 		}()
 
-		h := n.hash()
+		h := interiorHash(n.hashMaker())
 
 		// First left
 		lSum := <-lSumChan
@@ -95,7 +160,7 @@ func (n Node) Checksum() ([]byte, error) {
 
 		return h.Sum(nil), nil
 	}
-	return nil, ErrNoChecksumAvailable{node: &n}
+	return nil, ErrNoChecksumAvailable{node: n}
 }
 
 // ErrNoChecksumAvailable is for nodes that do not have the means to provide
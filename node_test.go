@@ -19,7 +19,7 @@ func TestNodeSums(t *testing.T) {
 			t.Errorf("on word %q, encountered %s", word, err)
 		}
 		sum := h.Sum(nil)
-		nodes = append(nodes, &Node{checksum: sum, hash: DefaultHashMaker})
+		nodes = append(nodes, newLeaf(DefaultHashMaker, sum))
 	}
 
 	newNodes := nodes
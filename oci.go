@@ -0,0 +1,79 @@
+package merkle
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Annotations for the descriptor of an OCI image layer, or any blob, so the
+// blob can be verified block by block as it is pulled
+const (
+	// AnnotationRoot is the hex encoded root checksum of the blob's tree
+	AnnotationRoot = "com.github.vbatts.merkle.root"
+
+	// AnnotationBlockLength is the BlockLength of the blob's tree
+	AnnotationBlockLength = "com.github.vbatts.merkle.block-length"
+)
+
+// ErrAnnotationMismatch is for descriptor annotations that are missing, or do
+// not match the tree of the blob
+type ErrAnnotationMismatch struct {
+	Key string
+}
+
+// Error shows the annotation that does not match
+func (err ErrAnnotationMismatch) Error() string {
+	return fmt.Sprintf("annotation %q does not match the tree", err.Key)
+}
+
+// LayerTree reads the layer blob r, and returns its tree and the annotations
+// to attach to the layer's descriptor
+func LayerTree(r io.Reader, hm HashMaker, blockLength int) (*Tree, map[string]string, error) {
+	b := NewBuilder(hm, blockLength, WithEmptyRoot())
+	if _, err := io.Copy(b, r); err != nil {
+		return nil, nil, err
+	}
+	tree, root, err := b.Finalize()
+	if err != nil {
+		return nil, nil, err
+	}
+	return tree, layerAnnotations(tree, root), nil
+}
+
+// LayerAnnotations returns the descriptor annotations for the tree of a layer
+func LayerAnnotations(t *Tree) (map[string]string, error) {
+	root, err := t.RootChecksum()
+	if err == ErrEmptyTree {
+		root, err = EmptyRoot(t.hashMaker()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return layerAnnotations(t, root), nil
+}
+
+func layerAnnotations(t *Tree, root []byte) map[string]string {
+	return map[string]string{
+		AnnotationRoot:        hex.EncodeToString(root),
+		AnnotationBlockLength: strconv.Itoa(t.BlockLength),
+	}
+}
+
+// NewLayerReader returns a reader of the layer blob r that verifies each block
+// against tree as it is pulled, so a corrupt block is found as soon as it is
+// read rather than at the final digest check. The tree, as from a sidecar, is
+// first checked against the layer descriptor's annotations.
+func NewLayerReader(r io.Reader, tree *Tree, annotations map[string]string) (io.Reader, error) {
+	expected, err := LayerAnnotations(tree)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range []string{AnnotationRoot, AnnotationBlockLength} {
+		if annotations[key] != expected[key] {
+			return nil, ErrAnnotationMismatch{Key: key}
+		}
+	}
+	return NewVerifyingReader(r, tree), nil
+}
@@ -0,0 +1,60 @@
+package merkle
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestLayerVerification(t *testing.T) {
+	blob := bytes.Repeat([]byte("a layer of an image "), 1000)
+	tree, annotations, err := LayerTree(bytes.NewReader(blob), DefaultHashMaker, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if annotations[AnnotationBlockLength] != "512" {
+		t.Errorf("expected block length annotation of 512, got %q", annotations[AnnotationBlockLength])
+	}
+
+	r, err := NewLayerReader(bytes.NewReader(blob), tree, annotations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, blob) {
+		t.Errorf("expected the blob to be read through")
+	}
+
+	// a corrupt byte fails on its block, and none of that block is returned
+	corrupt := append([]byte{}, blob...)
+	corrupt[3*512+7]++
+	r, err = NewLayerReader(bytes.NewReader(corrupt), tree, annotations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = ioutil.ReadAll(r)
+	if e, ok := err.(ErrBlockMismatch); !ok || e.Index != 3 {
+		t.Errorf("expected a mismatch of block 3, got %v", err)
+	}
+	if len(got) != 3*512 {
+		t.Errorf("expected only the 3 verified blocks, got %d bytes", len(got))
+	}
+
+	// a truncated blob is not a clean EOF
+	r, err = NewLayerReader(bytes.NewReader(blob[:4096]), tree, annotations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); err == nil {
+		t.Errorf("expected an error for a truncated blob")
+	}
+
+	// the tree must match the descriptor
+	other := map[string]string{AnnotationRoot: "00", AnnotationBlockLength: "512"}
+	if _, err := NewLayerReader(bytes.NewReader(blob), tree, other); err == nil {
+		t.Errorf("expected an error for a mismatched root annotation")
+	}
+}
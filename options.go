@@ -0,0 +1,311 @@
+package merkle
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// Option configures how trees are built. Not every constructor applies every
+// option, as each documents, and one given an option it does not apply fails
+// with an ErrUnsupportedOption rather than ignore it.
+type Option func(*options)
+
+// optionID is a bit of each Option, of the options given
+type optionID uint32
+
+const (
+	optHashWorkers optionID = 1 << iota
+	optLevelWorkers
+	optLowPriority
+	optEmptyRoot
+	optMaxLeaves
+	optMaxBytes
+	optStrictLifecycle
+	optErrorHandler
+	optFinalBlockPolicy
+	optBloomFilter
+	optLeafIndex
+	optLeafStream
+	optChecksumInterning
+	optReadAhead
+	optAdaptiveWorkers
+	optDomainSeparation
+	optLengthCommitment
+	optRateLimit
+	optInteriorCache
+)
+
+var optionNames = map[optionID]string{
+	optHashWorkers:       "WithHashWorkers",
+	optLevelWorkers:      "WithLevelWorkers",
+	optLowPriority:       "WithLowPriority",
+	optEmptyRoot:         "WithEmptyRoot",
+	optMaxLeaves:         "WithMaxLeaves",
+	optMaxBytes:          "WithMaxBytes",
+	optStrictLifecycle:   "WithStrictLifecycle",
+	optErrorHandler:      "WithErrorHandler",
+	optFinalBlockPolicy:  "WithFinalBlockPolicy",
+	optBloomFilter:       "WithBloomFilter",
+	optLeafIndex:         "WithLeafIndex",
+	optLeafStream:        "WithLeafStream",
+	optChecksumInterning: "WithChecksumInterning",
+	optReadAhead:         "WithReadAhead",
+	optAdaptiveWorkers:   "WithAdaptiveWorkers",
+	optDomainSeparation:  "WithDomainSeparation",
+	optLengthCommitment:  "WithLengthCommitment",
+	optRateLimit:         "WithRateLimit",
+	optInteriorCache:     "WithInteriorCache",
+}
+
+// The options applied by each constructor. Those of the shape of a tree, as
+// its hash, final block and root, are applied by all that build one.
+const (
+	treeOptions = optEmptyRoot | optMaxLeaves | optMaxBytes | optFinalBlockPolicy |
+		optDomainSeparation | optLengthCommitment | optLowPriority
+
+	// of New, NewSecure, SumFile and ImportState
+	hashOptions = treeOptions | optStrictLifecycle | optErrorHandler | optReadAhead | optInteriorCache
+
+	// of NewBuilder
+	builderOptions = treeOptions | optHashWorkers | optLevelWorkers | optAdaptiveWorkers |
+		optBloomFilter | optLeafIndex | optLeafStream | optChecksumInterning | optReadAhead
+
+	// of NewDiskBuilder
+	diskBuilderOptions = treeOptions | optLeafStream
+
+	// of NewVerifyingReader and NewVerifyingHash
+	verifyOptions = optRateLimit
+)
+
+// ErrUnsupportedOption is for an option given to a constructor that does not
+// apply it
+type ErrUnsupportedOption struct {
+	Option, Constructor string
+}
+
+// Error shows the option and the constructor
+func (err ErrUnsupportedOption) Error() string {
+	return fmt.Sprintf("%s does not apply %s", err.Constructor, err.Option)
+}
+
+// supported is an ErrUnsupportedOption of the first option given that is not
+// of applied, by constructor
+func (o options) supported(constructor string, applied optionID) error {
+	extra := o.given &^ applied
+	if extra == 0 {
+		return nil
+	}
+	return ErrUnsupportedOption{Option: optionNames[extra&-extra], Constructor: constructor}
+}
+
+type options struct {
+	hashWorkers  int
+	levelWorkers int
+	lowPriority  bool
+	emptyRoot    bool
+	maxLeaves    int64
+	maxBytes     int64
+	strict       bool
+	finalBlock   FinalBlockPolicy
+	bloomRate    float64
+	leafIndex    bool
+	leafStream   io.Writer
+	intern       bool
+	readAhead    int
+	adaptive     bool
+
+	domainSeparation bool
+	commitLength     bool
+	interiorCache    bool
+	bytesPerSecond   int64
+	hashesPerSecond  int64
+	errorHandler     func(error)
+
+	given optionID // of the options given
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		hashWorkers:  runtime.GOMAXPROCS(0),
+		levelWorkers: runtime.GOMAXPROCS(0),
+		readAhead:    defaultReadAhead,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithHashWorkers sets the count of goroutines checksumming blocks. It
+// defaults to GOMAXPROCS.
+func WithHashWorkers(n int) Option {
+	return func(o *options) {
+		o.given |= optHashWorkers
+		if n > 0 {
+			o.hashWorkers = n
+		}
+	}
+}
+
+// WithLevelWorkers sets the count of goroutines computing the interior levels
+// of the tree. It defaults to GOMAXPROCS.
+func WithLevelWorkers(n int) Option {
+	return func(o *options) {
+		o.given |= optLevelWorkers
+		if n > 0 {
+			o.levelWorkers = n
+		}
+	}
+}
+
+// WithLowPriority yields the processor after each block is checksummed, so
+// background work like scrubbing does not starve other goroutines
+func WithLowPriority() Option {
+	return func(o *options) {
+		o.given |= optLowPriority
+		o.lowPriority = true
+	}
+}
+
+// yield gives up the processor in low priority mode
+func (o options) yield() {
+	if o.lowPriority {
+		runtime.Gosched()
+	}
+}
+
+// WithEmptyRoot makes the root of an empty input the checksum of no bytes, as
+// in RFC 6962, rather than an ErrEmptyTree. Then empty files have a stable
+// root that compares like any other.
+func WithEmptyRoot() Option {
+	return func(o *options) {
+		o.given |= optEmptyRoot
+		o.emptyRoot = true
+	}
+}
+
+// emptyTreeRoot is the root of a tree with no leaves, if there is one
+func (o options) emptyTreeRoot(hm HashMaker) ([]byte, error) {
+	if !o.emptyRoot {
+		return nil, ErrEmptyTree
+	}
+	return EmptyRoot(hm), nil
+}
+
+// WithMaxLeaves limits the tree to n leaves. A Write that would go beyond it
+// is rejected whole, with an ErrLimitExceeded.
+func WithMaxLeaves(n int64) Option {
+	return func(o *options) {
+		o.given |= optMaxLeaves
+		o.maxLeaves = n
+	}
+}
+
+// WithMaxBytes limits the input to n bytes. A Write that would go beyond it is
+// rejected whole, with an ErrLimitExceeded.
+func WithMaxBytes(n int64) Option {
+	return func(o *options) {
+		o.given |= optMaxBytes
+		o.maxBytes = n
+	}
+}
+
+// ErrLimitExceeded is for writes beyond the limits set WithMaxLeaves or
+// WithMaxBytes
+type ErrLimitExceeded struct {
+	Limit string // "leaves" or "bytes", or of DecodeLimits "proof depth" or "encoded bytes"
+	Max   int64
+}
+
+// Error shows the limit exceeded
+func (err ErrLimitExceeded) Error() string {
+	return fmt.Sprintf("limit of %d %s exceeded", err.Max, err.Limit)
+}
+
+// checkLimits is whether a write of n more bytes is within the limits, given
+// the bytes written so far, the whole leaves so far and the bytes pending in
+// a partial block
+func (o options) checkLimits(blockLength int, written int64, leaves, pending int, n int64) error {
+	if o.maxBytes > 0 && written+n > o.maxBytes {
+		return ErrLimitExceeded{Limit: "bytes", Max: o.maxBytes}
+	}
+	if o.maxLeaves > 0 {
+		total := int64(leaves) + (int64(pending)+n+int64(blockLength)-1)/int64(blockLength)
+		if total > o.maxLeaves {
+			return ErrLimitExceeded{Limit: "leaves", Max: o.maxLeaves}
+		}
+	}
+	return nil
+}
+
+// WithStrictLifecycle makes a Write after Sum or Finish return ErrFinalized,
+// until Reset. Otherwise writing after Sum continues the trailing partial
+// block, which is easily mistaken for having published the final root.
+func WithStrictLifecycle() Option {
+	return func(o *options) {
+		o.given |= optStrictLifecycle
+		o.strict = true
+	}
+}
+
+// WithErrorHandler sets fn to be called with the error of a Sum, which can
+// not return it, in place of printing it and a stack trace to os.Stderr. Sum
+// then returns nil, as ever. SumE returns the error instead.
+func WithErrorHandler(fn func(error)) Option {
+	return func(o *options) {
+		o.given |= optErrorHandler
+		o.errorHandler = fn
+	}
+}
+
+// sumError reports the error of a Sum, to the handler if one is set
+func (o options) sumError(err error) {
+	if o.errorHandler != nil {
+		o.errorHandler(err)
+		return
+	}
+	logSumError(err)
+}
+
+// WithFinalBlockPolicy sets how a trailing short block is committed to. It
+// defaults to FinalBlockRaw.
+func WithFinalBlockPolicy(p FinalBlockPolicy) Option {
+	return func(o *options) {
+		o.given |= optFinalBlockPolicy
+		o.finalBlock = p
+	}
+}
+
+// WithBloomFilter builds a Bloom filter of the leaf checksums alongside the
+// tree, with a false positive rate of p (see Tree.Bloom)
+func WithBloomFilter(p float64) Option {
+	return func(o *options) {
+		o.given |= optBloomFilter
+		o.bloomRate = p
+	}
+}
+
+// WithLeafIndex indexes the leaves of the tree by their checksum as it is
+// built, for Tree.FindLeaf
+func WithLeafIndex() Option {
+	return func(o *options) {
+		o.given |= optLeafIndex
+		o.leafIndex = true
+	}
+}
+
+// addIndexes builds the Bloom filter and leaf index of t, if they are wanted
+func (o options) addIndexes(t *Tree) (*Tree, error) {
+	if o.bloomRate > 0 {
+		if err := t.BuildBloom(o.bloomRate); err != nil {
+			return nil, err
+		}
+	}
+	if o.leafIndex {
+		if err := t.BuildLeafIndex(); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,89 @@
+package merkle
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestUnsupportedOption(t *testing.T) {
+	unsupported := func(option, constructor string) error {
+		return ErrUnsupportedOption{Option: option, Constructor: constructor}
+	}
+	for _, c := range []struct {
+		opt  Option
+		name string
+	}{
+		{WithBloomFilter(0.01), "WithBloomFilter"},
+		{WithLeafIndex(), "WithLeafIndex"},
+		{WithLeafStream(ioutil.Discard), "WithLeafStream"},
+		{WithChecksumInterning(), "WithChecksumInterning"},
+		{WithAdaptiveWorkers(), "WithAdaptiveWorkers"},
+		{WithLevelWorkers(2), "WithLevelWorkers"},
+		{WithRateLimit(1, 0), "WithRateLimit"},
+	} {
+		if _, err := New(DefaultHashMaker, 64, WithEmptyRoot(), c.opt); err != unsupported(c.name, "New") {
+			t.Errorf("expected New to fail of %s, got %v", c.name, err)
+		}
+	}
+	h, err := New(DefaultHashMaker, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := ExportState(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ImportState(state, WithBloomFilter(0.01)); err != unsupported("WithBloomFilter", "ImportState") {
+		t.Errorf("expected ImportState to fail, got %v", err)
+	}
+
+	imported, err := ImportState(state, WithDomainSeparation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state, err = ExportState(imported); err != nil {
+		t.Fatal(err)
+	}
+	if state.Hash != "sha1-rfc6962" {
+		t.Errorf("expected ImportState to apply WithDomainSeparation, got a hash of %q", state.Hash)
+	}
+
+	b := NewBuilder(DefaultHashMaker, 64, WithStrictLifecycle())
+	if _, err := b.Write([]byte("abc")); err != unsupported("WithStrictLifecycle", "NewBuilder") {
+		t.Errorf("expected Builder Write to fail, got %v", err)
+	}
+	if _, _, err := b.Build(bytes.NewReader([]byte("abc")), 3); err != unsupported("WithStrictLifecycle", "NewBuilder") {
+		t.Errorf("expected Builder Build to fail, got %v", err)
+	}
+	if _, _, err := b.Finalize(); err != unsupported("WithStrictLifecycle", "NewBuilder") {
+		t.Errorf("expected Builder Finalize to fail, got %v", err)
+	}
+	b = NewBuilder(DefaultHashMaker, 64, WithErrorHandler(func(error) {}))
+	if _, err := b.Write([]byte("abc")); err != unsupported("WithErrorHandler", "NewBuilder") {
+		t.Errorf("expected Builder Write to fail of WithErrorHandler, got %v", err)
+	}
+
+	if _, err := NewDiskBuilder(DefaultHashMaker, 64, "", WithLeafIndex()); err != unsupported("WithLeafIndex", "NewDiskBuilder") {
+		t.Errorf("expected NewDiskBuilder to fail, got %v", err)
+	}
+
+	tree, err := SumOf(DefaultHashMaker, 64, []byte("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVerifyingReader(bytes.NewReader([]byte("abc")), tree, WithEmptyRoot()).Read(make([]byte, 3)); err != unsupported("WithEmptyRoot", "NewVerifyingReader") {
+		t.Errorf("expected NewVerifyingReader to fail, got %v", err)
+	}
+	if _, err := NewVerifyingHash(DefaultHashMaker, tree, WithEmptyRoot()).Write([]byte("abc")); err != unsupported("WithEmptyRoot", "NewVerifyingHash") {
+		t.Errorf("expected NewVerifyingHash to fail, got %v", err)
+	}
+
+	// and each applies the options of the shape of a tree
+	if _, err := New(DefaultHashMaker, 64, SecureOptions()...); err != nil {
+		t.Error(err)
+	}
+	if _, err := NewDiskBuilder(DefaultHashMaker, 64, "", append(SecureOptions(), WithLowPriority())...); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,352 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// OSTree object checksums, so the content of an OSTree commit can be hashed
+// into trees while its objects are cross-checked against an existing
+// repository. The objects are serialized as GVariants, as OSTree does, and
+// checksummed with sha256.
+
+// OSTreeMeta is the ownership, mode and extended attributes recorded for
+// content objects and directories
+type OSTreeMeta struct {
+	UID, GID uint32
+	Mode     uint32 // including the file type bits, as st_mode
+	Xattrs   map[string][]byte
+}
+
+// OSTreeFile is a content object in a dirtree
+type OSTreeFile struct {
+	Name     string
+	Checksum string // hex encoded
+}
+
+// OSTreeSubdir is a directory in a dirtree, by the checksums of its own
+// dirtree and dirmeta
+type OSTreeSubdir struct {
+	Name         string
+	TreeChecksum string // hex encoded
+	MetaChecksum string // hex encoded
+}
+
+// OSTreeDirTree is the listing of a directory
+type OSTreeDirTree struct {
+	Files []OSTreeFile
+	Dirs  []OSTreeSubdir
+}
+
+// Checksum returns the hex encoded checksum of the dirtree object. The
+// entries are sorted by name, as OSTree requires.
+func (dt OSTreeDirTree) Checksum() (string, error) {
+	files := append([]OSTreeFile{}, dt.Files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	dirs := append([]OSTreeSubdir{}, dt.Dirs...)
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].Name < dirs[j].Name })
+
+	fileVariants := make([]gvariant, len(files))
+	for i, f := range files {
+		sum, err := decodeOSTreeChecksum(f.Checksum)
+		if err != nil {
+			return "", err
+		}
+		fileVariants[i] = gvTuple(gvString(f.Name), gvBytes(sum))
+	}
+	dirVariants := make([]gvariant, len(dirs))
+	for i, d := range dirs {
+		tree, err := decodeOSTreeChecksum(d.TreeChecksum)
+		if err != nil {
+			return "", err
+		}
+		meta, err := decodeOSTreeChecksum(d.MetaChecksum)
+		if err != nil {
+			return "", err
+		}
+		dirVariants[i] = gvTuple(gvString(d.Name), gvBytes(tree), gvBytes(meta))
+	}
+	v := gvTuple(gvArray(1, fileVariants...), gvArray(1, dirVariants...))
+	sum := sha256.Sum256(v.data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// OSTreeDirMetaChecksum returns the hex encoded checksum of the dirmeta object
+// of a directory
+func OSTreeDirMetaChecksum(meta OSTreeMeta) string {
+	v := gvTuple(gvUint32BE(meta.UID), gvUint32BE(meta.GID), gvUint32BE(meta.Mode), gvXattrs(meta.Xattrs))
+	sum := sha256.Sum256(v.data)
+	return hex.EncodeToString(sum[:])
+}
+
+// OSTreeContent reads the content of a regular file, or nothing for a symlink
+// to symlinkTarget, and returns the hex encoded checksum of its content object
+// along with the tree of its content
+func OSTreeContent(meta OSTreeMeta, symlinkTarget string, r io.Reader, hm HashMaker, blockLength int) (string, *Tree, error) {
+	header := gvTuple(
+		gvUint32BE(meta.UID),
+		gvUint32BE(meta.GID),
+		gvUint32BE(meta.Mode),
+		gvUint32BE(0), // rdev
+		gvString(symlinkTarget),
+		gvXattrs(meta.Xattrs),
+	)
+	var (
+		h    = sha256.New()
+		size [8]byte // big endian length, then padding to align the header
+	)
+	binary.BigEndian.PutUint32(size[:4], uint32(len(header.data)))
+	h.Write(size[:])
+	h.Write(header.data)
+
+	b := NewBuilder(hm, blockLength, WithEmptyRoot())
+	if r != nil {
+		if _, err := io.Copy(io.MultiWriter(h, b), r); err != nil {
+			return "", nil, err
+		}
+	}
+	tree, _, err := b.Finalize()
+	if err != nil {
+		return "", nil, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), tree, nil
+}
+
+// OSTreeCheckout is the result of hashing a directory as an OSTree commit
+type OSTreeCheckout struct {
+	TreeChecksum string           // of the root dirtree
+	MetaChecksum string           // of the root dirmeta
+	Trees        map[string]*Tree // of the content objects, by their checksum
+}
+
+// OSTreeChecksumDir walks the directory at path, and returns the checksums of
+// its root dirtree and dirmeta, as they would be committed with
+// `ostree commit --owner-uid=0 --owner-gid=0 --no-xattrs`, and the tree of
+// each content object. Files other than regular files, directories and
+// symlinks are an error.
+func OSTreeChecksumDir(path string, hm HashMaker, blockLength int) (*OSTreeCheckout, error) {
+	co := &OSTreeCheckout{Trees: map[string]*Tree{}}
+	var err error
+	co.TreeChecksum, co.MetaChecksum, err = co.dir(path, hm, blockLength)
+	if err != nil {
+		return nil, err
+	}
+	return co, nil
+}
+
+func (co *OSTreeCheckout) dir(path string, hm HashMaker, blockLength int) (string, string, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return "", "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	entries, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return "", "", err
+	}
+
+	var dt OSTreeDirTree
+	for _, entry := range entries {
+		p := filepath.Join(path, entry.Name())
+		switch {
+		case entry.IsDir():
+			tree, meta, err := co.dir(p, hm, blockLength)
+			if err != nil {
+				return "", "", err
+			}
+			dt.Dirs = append(dt.Dirs, OSTreeSubdir{Name: entry.Name(), TreeChecksum: tree, MetaChecksum: meta})
+		case entry.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return "", "", err
+			}
+			sum, tree, err := OSTreeContent(OSTreeMeta{Mode: unixMode(entry.Mode())}, target, nil, hm, blockLength)
+			if err != nil {
+				return "", "", err
+			}
+			co.Trees[sum] = tree
+			dt.Files = append(dt.Files, OSTreeFile{Name: entry.Name(), Checksum: sum})
+		case entry.Mode().IsRegular():
+			r, err := os.Open(p)
+			if err != nil {
+				return "", "", err
+			}
+			sum, tree, err := OSTreeContent(OSTreeMeta{Mode: unixMode(entry.Mode())}, "", r, hm, blockLength)
+			r.Close()
+			if err != nil {
+				return "", "", err
+			}
+			co.Trees[sum] = tree
+			dt.Files = append(dt.Files, OSTreeFile{Name: entry.Name(), Checksum: sum})
+		default:
+			return "", "", fmt.Errorf("%s: unsupported file type %s", p, entry.Mode().Type())
+		}
+	}
+	tree, err := dt.Checksum()
+	if err != nil {
+		return "", "", err
+	}
+	return tree, OSTreeDirMetaChecksum(OSTreeMeta{Mode: unixMode(fi.Mode())}), nil
+}
+
+// unixMode is the st_mode of an os.FileMode
+func unixMode(m os.FileMode) uint32 {
+	mode := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		mode |= 04000
+	}
+	if m&os.ModeSetgid != 0 {
+		mode |= 02000
+	}
+	if m&os.ModeSticky != 0 {
+		mode |= 01000
+	}
+	switch {
+	case m.IsDir():
+		mode |= 0040000
+	case m&os.ModeSymlink != 0:
+		mode |= 0120000
+	case m.IsRegular():
+		mode |= 0100000
+	}
+	return mode
+}
+
+func decodeOSTreeChecksum(s string) ([]byte, error) {
+	sum, err := hex.DecodeString(s)
+	if err != nil || len(sum) != sha256.Size {
+		return nil, fmt.Errorf("invalid OSTree checksum %q", s)
+	}
+	return sum, nil
+}
+
+// gvariant is a serialized GVariant, in normal form, of the few types OSTree
+// objects are made of
+type gvariant struct {
+	data  []byte
+	align int
+	fixed bool // whether the type is of fixed size
+}
+
+// gvUint32BE is a "u", with the value stored big endian as OSTree does
+func gvUint32BE(v uint32) gvariant {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, v)
+	return gvariant{data: data, align: 4, fixed: true}
+}
+
+// gvString is an "s"
+func gvString(s string) gvariant {
+	return gvariant{data: append([]byte(s), 0), align: 1}
+}
+
+// gvBytes is an "ay"
+func gvBytes(b []byte) gvariant {
+	return gvariant{data: append([]byte{}, b...), align: 1}
+}
+
+// gvXattrs is the "a(ayay)" of extended attributes, sorted by name, with the
+// names NUL terminated as bytestrings
+func gvXattrs(xattrs map[string][]byte) gvariant {
+	names := make([]string, 0, len(xattrs))
+	for name := range xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	elems := make([]gvariant, len(names))
+	for i, name := range names {
+		elems[i] = gvTuple(gvBytes(append([]byte(name), 0)), gvBytes(xattrs[name]))
+	}
+	return gvArray(1, elems...)
+}
+
+// gvTuple is a structure of the members. The end of each variable sized
+// member but the last is recorded in the framing offsets, in reverse order.
+func gvTuple(members ...gvariant) gvariant {
+	var (
+		v       = gvariant{align: 1, fixed: true}
+		offsets []int
+	)
+	for i, m := range members {
+		if m.align > v.align {
+			v.align = m.align
+		}
+		v.data = gvPad(v.data, m.align)
+		v.data = append(v.data, m.data...)
+		if !m.fixed {
+			v.fixed = false
+			if i != len(members)-1 {
+				offsets = append(offsets, len(v.data))
+			}
+		}
+	}
+	if v.fixed {
+		v.data = gvPad(v.data, v.align)
+		if len(v.data) == 0 {
+			v.data = []byte{0}
+		}
+		return v
+	}
+	for i, j := 0, len(offsets)-1; i < j; i, j = i+1, j-1 {
+		offsets[i], offsets[j] = offsets[j], offsets[i]
+	}
+	v.data = gvFrame(v.data, offsets)
+	return v
+}
+
+// gvArray is an array of the elements, which are all of a type aligned to
+// align. The end of each variable sized element is recorded in the framing
+// offsets.
+func gvArray(align int, elems ...gvariant) gvariant {
+	var (
+		v       = gvariant{align: align}
+		offsets []int
+	)
+	for _, e := range elems {
+		v.data = gvPad(v.data, align)
+		v.data = append(v.data, e.data...)
+		if !e.fixed {
+			offsets = append(offsets, len(v.data))
+		}
+	}
+	v.data = gvFrame(v.data, offsets)
+	return v
+}
+
+func gvPad(data []byte, align int) []byte {
+	for len(data)%align != 0 {
+		data = append(data, 0)
+	}
+	return data
+}
+
+// gvFrame appends the framing offsets to a container, each of the smallest
+// size that can address the whole container
+func gvFrame(data []byte, offsets []int) []byte {
+	if len(offsets) == 0 {
+		return data
+	}
+	size := 8
+	for _, s := range []int{1, 2, 4} {
+		if uint64(len(data)+len(offsets)*s) < 1<<uint(8*s) {
+			size = s
+			break
+		}
+	}
+	var tmp [8]byte
+	for _, off := range offsets {
+		binary.LittleEndian.PutUint64(tmp[:], uint64(off))
+		data = append(data, tmp[:size]...)
+	}
+	return data
+}
@@ -0,0 +1,120 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// gvInt32 is an "i", little endian as GVariant stores it
+func gvInt32(v int32) gvariant {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, uint32(v))
+	return gvariant{data: data, align: 4, fixed: true}
+}
+
+func TestGVariant(t *testing.T) {
+	// examples from the GVariant serialization specification
+	cases := []struct {
+		v        gvariant
+		expected []byte
+	}{
+		{
+			v:        gvTuple(gvString("foo"), gvInt32(-1)),
+			expected: []byte{'f', 'o', 'o', 0, 0xff, 0xff, 0xff, 0xff, 0x04},
+		},
+		{
+			v:        gvArray(1, gvString("i"), gvString("can"), gvString("has"), gvString("strings?")),
+			expected: append([]byte("i\x00can\x00has\x00strings?\x00"), 0x02, 0x06, 0x0a, 0x13),
+		},
+		{
+			v: gvArray(4, gvTuple(gvString("hi"), gvInt32(-2)), gvTuple(gvString("bye"), gvInt32(-1))),
+			expected: []byte{
+				'h', 'i', 0, 0, 0xfe, 0xff, 0xff, 0xff, 0x03, 0, 0, 0,
+				'b', 'y', 'e', 0, 0xff, 0xff, 0xff, 0xff, 0x04, 0x09, 0x15,
+			},
+		},
+		{
+			v:        gvTuple(gvString("foo"), gvBytes([]byte("bar"))),
+			expected: []byte("foo\x00bar\x04"),
+		},
+		{
+			v:        gvArray(1),
+			expected: []byte{},
+		},
+	}
+	for i, c := range cases {
+		if !bytes.Equal(c.v.data, c.expected) {
+			t.Errorf("%d: expected % x, got % x", i, c.expected, c.v.data)
+		}
+	}
+}
+
+func TestOSTreeChecksumDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merkle-ostree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "usr", "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := bytes.Repeat([]byte("#!/bin/sh\n"), 100)
+	if err := ioutil.WriteFile(filepath.Join(dir, "usr", "bin", "tool"), content, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("usr/bin", filepath.Join(dir, "bin")); err != nil {
+		t.Fatal(err)
+	}
+
+	co, err := OSTreeChecksumDir(dir, DefaultHashMaker, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(co.Trees) != 2 {
+		t.Errorf("expected trees of 2 content objects, got %d", len(co.Trees))
+	}
+
+	sum, tree, err := OSTreeContent(OSTreeMeta{Mode: 0100755}, "", bytes.NewReader(content), DefaultHashMaker, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if co.Trees[sum] == nil {
+		t.Fatalf("expected a tree for the content object %s", sum)
+	}
+	if len(tree.Nodes) != 16 || tree.TotalLength() != int64(len(content)) {
+		t.Errorf("expected a tree of 16 leaves over %d bytes, got %d over %d", len(content), len(tree.Nodes), tree.TotalLength())
+	}
+
+	again, err := OSTreeChecksumDir(dir, DefaultHashMaker, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.TreeChecksum != co.TreeChecksum || again.MetaChecksum != co.MetaChecksum {
+		t.Errorf("expected the same checksums of the same directory")
+	}
+
+	if err := os.Chmod(filepath.Join(dir, "usr", "bin", "tool"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := OSTreeChecksumDir(dir, DefaultHashMaker, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.TreeChecksum == co.TreeChecksum {
+		t.Errorf("expected the mode of a file to change the root dirtree")
+	}
+	if changed.MetaChecksum != co.MetaChecksum {
+		t.Errorf("expected the root dirmeta to be unchanged")
+	}
+}
+
+func TestOSTreeDirTreeInvalidChecksum(t *testing.T) {
+	dt := OSTreeDirTree{Files: []OSTreeFile{{Name: "a", Checksum: "not hex"}}}
+	if _, err := dt.Checksum(); err == nil {
+		t.Errorf("expected an error for an invalid checksum")
+	}
+}
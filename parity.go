@@ -0,0 +1,379 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Parity is Reed-Solomon parity of the blocks of a tree, so corrupt blocks,
+// as found by their leaves, can be reconstructed.
+//
+// The blocks are striped across groups of DataShards blocks, block i being in
+// group i%Groups, so a run of corrupt blocks falls across groups. Each group
+// has ParityShards parity blocks, and any that many corrupt blocks of a group
+// can be reconstructed.
+type Parity struct {
+	BlockLength  int
+	Leaves       int
+	DataShards   int
+	ParityShards int
+	Blocks       [][]byte // ParityShards blocks of each group, in order of the groups
+}
+
+// ErrUnrepairable is for blocks that are corrupt beyond what the parity can
+// reconstruct
+type ErrUnrepairable struct {
+	Indexes []int
+}
+
+// Error shows the indexes of the blocks
+func (err ErrUnrepairable) Error() string {
+	return fmt.Sprintf("blocks %v can not be repaired", err.Indexes)
+}
+
+// NewParity computes the parity of the blocks of tree, read from r, with
+// parityShards parity blocks for each dataShards blocks
+func NewParity(r io.ReaderAt, tree *Tree, dataShards, parityShards int) (*Parity, error) {
+	if tree.BlockLength <= 0 {
+		return nil, fmt.Errorf("parity is of trees of a block length")
+	}
+	if dataShards < 1 || parityShards < 1 || dataShards+parityShards > 256 {
+		return nil, fmt.Errorf("invalid shards %d+%d, at most 256 in all", dataShards, parityShards)
+	}
+	p := &Parity{
+		BlockLength:  tree.BlockLength,
+		Leaves:       len(tree.Nodes),
+		DataShards:   dataShards,
+		ParityShards: parityShards,
+	}
+	matrix := cauchyMatrix(dataShards, parityShards)
+	for g := 0; g < p.Groups(); g++ {
+		parity := make([][]byte, parityShards)
+		for i := range parity {
+			parity[i] = make([]byte, p.BlockLength)
+		}
+		for j, index := range p.group(g) {
+			if index < 0 {
+				continue
+			}
+			b, err := p.readBlock(r, tree, index)
+			if err != nil {
+				return nil, err
+			}
+			for i := range parity {
+				gfMulAdd(parity[i], b, matrix[i][j])
+			}
+		}
+		p.Blocks = append(p.Blocks, parity...)
+	}
+	return p, nil
+}
+
+// Groups is the count of groups of blocks
+func (p *Parity) Groups() int {
+	if p.Leaves == 0 {
+		return 0
+	}
+	return (p.Leaves + p.DataShards - 1) / p.DataShards
+}
+
+// group is the indexes of the blocks of group g, with -1 for the positions
+// past the last block
+func (p *Parity) group(g int) []int {
+	var (
+		groups  = p.Groups()
+		indexes = make([]int, p.DataShards)
+	)
+	for j := range indexes {
+		indexes[j] = j*groups + g
+		if indexes[j] >= p.Leaves {
+			indexes[j] = -1
+		}
+	}
+	return indexes
+}
+
+// readBlock reads the block at index, padded with zeros to the BlockLength. A
+// block cut short by a truncated file is padded too, to fail verification.
+func (p *Parity) readBlock(r io.ReaderAt, tree *Tree, index int) ([]byte, error) {
+	offset, length := blockSpan(tree, index)
+	b := make([]byte, p.BlockLength)
+	if _, err := r.ReadAt(b[:length], offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return b, nil
+}
+
+// blockSpan is the offset and length of the block at index, of a tree of a
+// block length. Trees of the first serialized version have no leaf lengths, so
+// their blocks are taken to be whole.
+func blockSpan(tree *Tree, index int) (int64, int) {
+	length := tree.Nodes[index].Length
+	if length == 0 {
+		length = tree.BlockLength
+	}
+	return int64(index) * int64(tree.BlockLength), length
+}
+
+// Repair checks the blocks read from r against the leaves of tree, and
+// writes the corrupt ones, reconstructed and verified, to w. The indexes of
+// the blocks repaired are returned, and any left corrupt are an
+// ErrUnrepairable.
+func (p *Parity) Repair(r io.ReaderAt, w io.WriterAt, tree *Tree) ([]int, error) {
+	if tree.BlockLength != p.BlockLength || len(tree.Nodes) != p.Leaves {
+		return nil, fmt.Errorf("parity of %d blocks of %d bytes is not of the tree", p.Leaves, p.BlockLength)
+	}
+	if len(p.Blocks) != p.Groups()*p.ParityShards {
+		return nil, fmt.Errorf("parity has %d blocks, expected %d", len(p.Blocks), p.Groups()*p.ParityShards)
+	}
+	var (
+		hm           = tree.hashMaker()
+		matrix       = cauchyMatrix(p.DataShards, p.ParityShards)
+		repaired     []int
+		unrepairable []int
+	)
+	for g := 0; g < p.Groups(); g++ {
+		var (
+			indexes = p.group(g)
+			shards  = make([][]byte, p.DataShards)
+			corrupt []int // positions in the group
+		)
+		for j, index := range indexes {
+			if index < 0 {
+				shards[j] = make([]byte, p.BlockLength)
+				continue
+			}
+			b, err := p.readBlock(r, tree, index)
+			if err != nil {
+				return nil, err
+			}
+			if _, length := blockSpan(tree, index); verifyBlock(tree, hm, index, b[:length]) != nil {
+				corrupt = append(corrupt, j)
+				continue
+			}
+			shards[j] = b
+		}
+		if len(corrupt) == 0 {
+			continue
+		}
+		if len(corrupt) > p.ParityShards {
+			for _, j := range corrupt {
+				unrepairable = append(unrepairable, indexes[j])
+			}
+			continue
+		}
+		data, err := reconstruct(matrix, shards, p.Blocks[g*p.ParityShards:(g+1)*p.ParityShards], corrupt)
+		if err != nil {
+			return nil, err
+		}
+		for _, j := range corrupt {
+			index := indexes[j]
+			offset, length := blockSpan(tree, index)
+			if verifyBlock(tree, hm, index, data[j][:length]) != nil {
+				unrepairable = append(unrepairable, index)
+				continue
+			}
+			if _, err := w.WriteAt(data[j][:length], offset); err != nil {
+				return repaired, err
+			}
+			repaired = append(repaired, index)
+		}
+	}
+	if len(unrepairable) > 0 {
+		return repaired, ErrUnrepairable{Indexes: unrepairable}
+	}
+	return repaired, nil
+}
+
+// reconstruct solves for the missing data shards of a group, from the data
+// shards that are intact and the parity shards
+func reconstruct(matrix [][]byte, shards, parity [][]byte, missing []int) ([][]byte, error) {
+	k := len(shards)
+	// the rows of the encoding matrix of k intact shards, identity rows for
+	// the data shards and the Cauchy rows for parity
+	var (
+		rows   [][]byte
+		values [][]byte
+	)
+	for j, s := range shards {
+		if s != nil {
+			row := make([]byte, k)
+			row[j] = 1
+			rows, values = append(rows, row), append(values, s)
+		}
+	}
+	for i := 0; len(rows) < k && i < len(parity); i++ {
+		rows, values = append(rows, matrix[i]), append(values, parity[i])
+	}
+	inv, err := gfInvert(rows)
+	if err != nil {
+		return nil, err
+	}
+	data := make([][]byte, k)
+	for _, j := range missing {
+		data[j] = make([]byte, len(values[0]))
+		for r := range values {
+			gfMulAdd(data[j], values[r], inv[j][r])
+		}
+	}
+	return data, nil
+}
+
+// parityMagic starts the binary form of Parity
+var parityMagic = []byte("MRKR")
+
+// MarshalBinary encodes the parity as the magic "MRKR" and a version byte,
+// uvarints of the BlockLength, Leaves, DataShards and ParityShards, followed by
+// the concatenated parity blocks
+func (p *Parity) MarshalBinary() ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		tmp [binary.MaxVarintLen64]byte
+	)
+	buf.Write(parityMagic)
+	buf.WriteByte(1)
+	for _, v := range []int{p.BlockLength, p.Leaves, p.DataShards, p.ParityShards} {
+		buf.Write(tmp[:binary.PutUvarint(tmp[:], uint64(v))])
+	}
+	for _, b := range p.Blocks {
+		if len(b) != p.BlockLength {
+			return nil, fmt.Errorf("parity block of %d bytes, expected %d", len(b), p.BlockLength)
+		}
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes parity encoded by MarshalBinary. Parity of more
+// leaves than the DefaultDecodeLimits is an ErrLimitExceeded.
+func (p *Parity) UnmarshalBinary(data []byte) error {
+	return p.unmarshalBinary(data, DefaultDecodeLimits())
+}
+
+// unmarshalBinary is UnmarshalBinary of the limits l
+func (p *Parity) unmarshalBinary(data []byte, l DecodeLimits) error {
+	if err := l.checkBytes(len(data)); err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, parityMagic) || len(data) < len(parityMagic)+1 || data[len(parityMagic)] != 1 {
+		return ErrMalformedTree
+	}
+	r := bytes.NewReader(data[len(parityMagic)+1:])
+	var fields [4]int // block length, leaves, data shards, parity shards
+	for i := range fields {
+		v, err := binary.ReadUvarint(r)
+		if err != nil || v > uint64(maxInt) {
+			return ErrMalformedTree
+		}
+		fields[i] = int(v)
+	}
+	parity := Parity{BlockLength: fields[0], Leaves: fields[1], DataShards: fields[2], ParityShards: fields[3]}
+	if err := l.checkLeaves(uint64(parity.Leaves)); err != nil {
+		return err
+	}
+	if parity.BlockLength == 0 || parity.DataShards < 1 || parity.ParityShards < 1 || parity.DataShards+parity.ParityShards > 256 {
+		return ErrMalformedTree
+	}
+	count := parity.Groups() * parity.ParityShards
+	if uint64(r.Len()) != uint64(count)*uint64(parity.BlockLength) {
+		return ErrMalformedTree
+	}
+	rest := data[len(data)-r.Len():]
+	for i := 0; i < count; i++ {
+		parity.Blocks = append(parity.Blocks, append([]byte(nil), rest[i*parity.BlockLength:(i+1)*parity.BlockLength]...))
+	}
+	*p = parity
+	return nil
+}
+
+// GF(2^8) of the polynomial x^8+x^4+x^3+x^2+1, as is usual for Reed-Solomon
+var (
+	gfExp [510]byte
+	gfLog [256]int
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i], gfExp[i+255] = byte(x), byte(x)
+		gfLog[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-gfLog[a]]
+}
+
+// gfMulAdd adds c times src to dst
+func gfMulAdd(dst, src []byte, c byte) {
+	if c == 0 {
+		return
+	}
+	lc := gfLog[c]
+	for i, s := range src {
+		if s != 0 {
+			dst[i] ^= gfExp[lc+gfLog[s]]
+		}
+	}
+}
+
+// cauchyMatrix is the parity rows of a systematic encoding matrix, any k rows
+// of which with the identity are invertible
+func cauchyMatrix(k, m int) [][]byte {
+	matrix := make([][]byte, m)
+	for i := range matrix {
+		matrix[i] = make([]byte, k)
+		for j := range matrix[i] {
+			matrix[i][j] = gfInv(byte(k+i) ^ byte(j))
+		}
+	}
+	return matrix
+}
+
+// gfInvert inverts a square matrix by Gauss-Jordan elimination
+func gfInvert(matrix [][]byte) ([][]byte, error) {
+	n := len(matrix)
+	work := make([][]byte, n)
+	for i, row := range matrix {
+		work[i] = make([]byte, 2*n)
+		copy(work[i], row)
+		work[i][n+i] = 1
+	}
+	for c := 0; c < n; c++ {
+		pivot := c
+		for pivot < n && work[pivot][c] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, fmt.Errorf("singular matrix")
+		}
+		work[c], work[pivot] = work[pivot], work[c]
+		scale := gfInv(work[c][c])
+		for i := range work[c] {
+			work[c][i] = gfMul(work[c][i], scale)
+		}
+		for r := 0; r < n; r++ {
+			if r != c && work[r][c] != 0 {
+				gfMulAdd(work[r], work[c], work[r][c])
+			}
+		}
+	}
+	inv := make([][]byte, n)
+	for i := range inv {
+		inv[i] = work[i][n:]
+	}
+	return inv, nil
+}
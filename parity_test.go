@@ -0,0 +1,110 @@
+package merkle
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// memFile is content that can be read and written at offsets
+type memFile []byte
+
+func (f memFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(f)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f memFile) WriteAt(p []byte, off int64) (int, error) {
+	return copy(f[off:], p), nil
+}
+
+func TestParityRepair(t *testing.T) {
+	data := make([]byte, 16*20+5)
+	rand.New(rand.NewSource(1)).Read(data)
+	tree, _, err := NewBuilder(DefaultHashMaker, 16).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parity, err := NewParity(bytes.NewReader(data), tree, 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups := parity.Groups(); groups != 6 || len(parity.Blocks) != 12 {
+		t.Fatalf("expected 6 groups of 2 parity blocks, got %d and %d blocks", groups, len(parity.Blocks))
+	}
+
+	buf, err := parity.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Parity
+	if err := decoded.UnmarshalBinary(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, parity) {
+		t.Fatal("expected the parity decoded as encoded")
+	}
+	if err := decoded.UnmarshalBinary(buf[:len(buf)-1]); err != ErrMalformedTree {
+		t.Errorf("expected ErrMalformedTree of truncated parity, got %v", err)
+	}
+
+	// a run of corrupt blocks, the short last one among them, falls across
+	// the groups
+	f := memFile(append([]byte(nil), data...))
+	for i := 16 * 17; i < len(f); i++ {
+		f[i] ^= 0xff
+	}
+	f[3] ^= 1
+	repaired, err := parity.Repair(f, f, tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{0, 17, 18, 19, 20}; !sameInts(repaired, expected) {
+		t.Errorf("expected blocks %v repaired, got %v", expected, repaired)
+	}
+	if !bytes.Equal(f, data) {
+		t.Error("expected the content repaired")
+	}
+
+	if repaired, err := parity.Repair(f, f, tree); err != nil || len(repaired) != 0 {
+		t.Errorf("expected nothing to repair, got %v %v", repaired, err)
+	}
+
+	// three corrupt blocks of a group of two parity blocks
+	for _, i := range []int{1, 7, 13} {
+		f[i*16] ^= 1
+	}
+	_, err = parity.Repair(f, f, tree)
+	if e, ok := err.(ErrUnrepairable); !ok || !sameInts(e.Indexes, []int{1, 7, 13}) {
+		t.Errorf("expected blocks 1, 7 and 13 unrepairable, got %v", err)
+	}
+
+	if _, err := NewParity(bytes.NewReader(data), tree, 200, 57); err == nil {
+		t.Error("expected an error of more than 256 shards")
+	}
+}
+
+// sameInts is whether a and b have the same ints, in any order
+func sameInts(a, b []int) bool {
+	seen := map[int]int{}
+	for _, i := range a {
+		seen[i]++
+	}
+	for _, i := range b {
+		seen[i]--
+	}
+	for _, n := range seen {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
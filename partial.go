@@ -0,0 +1,389 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PartialTree is a subset of the leaves of a tree, with the checksums of the
+// subtrees of none of those leaves, which are the least needed to recompute
+// the root. A server can send some blocks with the PartialTree of their
+// leaves, and a client verify all of them against a known root at once.
+type PartialTree struct {
+	TreeSize int
+	Indexes  []int    // of the leaves, ascending
+	Leaves   [][]byte // checksums of the leaves at Indexes
+	Hashes   [][]byte // of the subtrees of none of the leaves, left to right
+
+	hash HashMaker
+}
+
+// Partial returns the PartialTree of the leaves at indexes
+func (t *Tree) Partial(indexes ...int) (*PartialTree, error) {
+	sums, err := t.leafSums()
+	if err != nil {
+		return nil, err
+	}
+	if len(indexes) == 0 {
+		return nil, fmt.Errorf("no leaves for a partial tree")
+	}
+	sorted := append([]int(nil), indexes...)
+	sort.Ints(sorted)
+	p := &PartialTree{TreeSize: len(sums), hash: t.hashMaker()}
+	for i, index := range sorted {
+		if index < 0 || index >= len(sums) {
+			return nil, ErrIndexOutOfRange{Index: index, Size: len(sums)}
+		}
+		if i > 0 && index == sorted[i-1] {
+			continue
+		}
+		p.Indexes = append(p.Indexes, index)
+		p.Leaves = append(p.Leaves, sums[index])
+	}
+	if err := p.collect(sums, 0, p.Indexes); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// collect appends the hashes of the subtrees of sums, of leaves from lo, that
+// have none of indexes
+func (p *PartialTree) collect(sums [][]byte, lo int, indexes []int) error {
+	if len(indexes) == 0 {
+		sum, err := subtreeHash(p.hash, sums)
+		if err != nil {
+			return err
+		}
+		p.Hashes = append(p.Hashes, sum)
+		return nil
+	}
+	if len(sums) == 1 {
+		return nil
+	}
+	k := splitPoint(len(sums))
+	split := sort.SearchInts(indexes, lo+k)
+	if err := p.collect(sums[:k], lo, indexes[:split]); err != nil {
+		return err
+	}
+	return p.collect(sums[k:], lo+k, indexes[split:])
+}
+
+// Root recomputes the root from the leaves and hashes
+func (p *PartialTree) Root() ([]byte, error) {
+	if p.TreeSize <= 0 || len(p.Indexes) == 0 || len(p.Indexes) != len(p.Leaves) {
+		return nil, ErrInvalidProof
+	}
+	for i, index := range p.Indexes {
+		if index < 0 || index >= p.TreeSize || (i > 0 && index <= p.Indexes[i-1]) {
+			return nil, ErrInvalidProof
+		}
+	}
+	pr := partialRoot{p: p}
+	root, err := pr.root(0, p.TreeSize)
+	if err != nil {
+		return nil, err
+	}
+	if pr.leaf != len(p.Leaves) || pr.hash != len(p.Hashes) {
+		return nil, ErrInvalidProof
+	}
+	return root, nil
+}
+
+// Verify checks that the leaves are of the tree of root
+func (p *PartialTree) Verify(root []byte) (err error) {
+	if sink := auditing(); sink != nil {
+		defer func(start time.Time) {
+			audit(sink, AuditEvent{Kind: "partial", Root: root, Index: -1}, start, err)
+		}(time.Now())
+	}
+	computed, err := p.Root()
+	if err != nil {
+		return err
+	}
+	if !equalChecksums(computed, root) {
+		return ErrTreeHashMismatch
+	}
+	return nil
+}
+
+// Leaf returns the checksum of the leaf at index, if it is in the partial tree
+func (p *PartialTree) Leaf(index int) ([]byte, bool) {
+	i := sort.SearchInts(p.Indexes, index)
+	if i == len(p.Indexes) || p.Indexes[i] != index {
+		return nil, false
+	}
+	return p.Leaves[i], true
+}
+
+// partialRoot consumes the leaves and hashes of a PartialTree in the order
+// they were collected
+type partialRoot struct {
+	p          *PartialTree
+	leaf, hash int // next of each to consume
+}
+
+func (pr *partialRoot) root(lo, hi int) ([]byte, error) {
+	if pr.leaf == len(pr.p.Indexes) || pr.p.Indexes[pr.leaf] >= hi {
+		if pr.hash == len(pr.p.Hashes) {
+			return nil, ErrInvalidProof
+		}
+		pr.hash++
+		return pr.p.Hashes[pr.hash-1], nil
+	}
+	if hi-lo == 1 {
+		pr.leaf++
+		return pr.p.Leaves[pr.leaf-1], nil
+	}
+	k := splitPoint(hi - lo)
+	l, err := pr.root(lo, lo+k)
+	if err != nil {
+		return nil, err
+	}
+	r, err := pr.root(lo+k, hi)
+	if err != nil {
+		return nil, err
+	}
+	return hashChildren(pr.p.hashMaker(), l, r)
+}
+
+// partialMagic starts the binary form of a PartialTree
+var partialMagic = []byte("MRKP")
+
+// MarshalBinary encodes the partial tree as the magic "MRKP" and a version
+// byte, the length prefixed name of the hash, and uvarints of the tree size,
+// count of leaves, count of hashes and checksum size, followed by uvarints of
+// the differences between successive indexes, then the concatenated leaf
+// checksums and hashes.
+func (p *PartialTree) MarshalBinary() ([]byte, error) {
+	hm := p.hashMaker()
+	name, err := HashName(hm)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Indexes) != len(p.Leaves) {
+		return nil, fmt.Errorf("%d indexes for %d leaves", len(p.Indexes), len(p.Leaves))
+	}
+	size := hm().Size()
+
+	var (
+		buf bytes.Buffer
+		tmp [binary.MaxVarintLen64]byte
+	)
+	putUvarint := func(v uint64) {
+		buf.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+	}
+	buf.Write(partialMagic)
+	buf.WriteByte(1)
+	buf.WriteByte(byte(len(name)))
+	buf.WriteString(name)
+	putUvarint(uint64(p.TreeSize))
+	putUvarint(uint64(len(p.Leaves)))
+	putUvarint(uint64(len(p.Hashes)))
+	putUvarint(uint64(size))
+	last := 0
+	for i, index := range p.Indexes {
+		if index < last || (i > 0 && index == last) {
+			return nil, fmt.Errorf("indexes are not ascending at %d", i)
+		}
+		putUvarint(uint64(index - last))
+		last = index
+	}
+	for _, sums := range [][][]byte{p.Leaves, p.Hashes} {
+		for _, sum := range sums {
+			if len(sum) != size {
+				return nil, fmt.Errorf("checksum of %d bytes, expected %d", len(sum), size)
+			}
+			buf.Write(sum)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a partial tree encoded by MarshalBinary. The hash it
+// names must be registered.
+func (p *PartialTree) UnmarshalBinary(data []byte) error {
+	return p.unmarshalBinary(data, DefaultDecodeLimits())
+}
+
+// unmarshalBinary is UnmarshalBinary of the limits l
+func (p *PartialTree) unmarshalBinary(data []byte, l DecodeLimits) error {
+	if err := l.checkBytes(len(data)); err != nil {
+		return err
+	}
+	r := bytes.NewReader(data)
+	for _, c := range partialMagic {
+		if b, err := r.ReadByte(); err != nil || b != c {
+			return ErrMalformedTree
+		}
+	}
+	if version, err := r.ReadByte(); err != nil || version != 1 {
+		return ErrMalformedTree
+	}
+	nameLen, err := r.ReadByte()
+	if err != nil || int(nameLen) > r.Len() {
+		return ErrMalformedTree
+	}
+	name := make([]byte, nameLen)
+	r.Read(name)
+	hm, ok := LookupHash(string(name))
+	if !ok {
+		return ErrUnknownHash{Name: string(name)}
+	}
+	var fields [4]uint64 // tree size, leaves, hashes, checksum size
+	for i := range fields {
+		if fields[i], err = binary.ReadUvarint(r); err != nil || fields[i] > uint64(maxInt) {
+			return ErrMalformedTree
+		}
+	}
+	treeSize, leaves, hashes, size := fields[0], fields[1], fields[2], fields[3]
+	if err := l.checkLeaves(leaves + hashes); err != nil {
+		return err
+	}
+	if size != uint64(hm().Size()) || leaves > treeSize || leaves > uint64(r.Len()) || hashes > uint64(r.Len())/size {
+		return ErrMalformedTree
+	}
+
+	if treeSize == 0 || leaves == 0 {
+		return ErrInconsistentField{Field: "indexes", Reason: fmt.Sprintf("%d of a tree of %d leaves", leaves, treeSize)}
+	}
+
+	partial := PartialTree{TreeSize: int(treeSize), hash: hm}
+	var index uint64
+	for i := uint64(0); i < leaves; i++ {
+		delta, err := binary.ReadUvarint(r)
+		if err != nil || (i > 0 && delta == 0) || delta >= treeSize-index {
+			return ErrMalformedTree
+		}
+		index += delta
+		partial.Indexes = append(partial.Indexes, int(index))
+	}
+	if (leaves+hashes)*size != uint64(r.Len()) {
+		return ErrMalformedTree
+	}
+	if expected := partialHashes(0, int(treeSize), partial.Indexes); hashes != uint64(expected) {
+		return ErrInconsistentField{Field: "hashes", Reason: fmt.Sprintf("%d, expected %d for the leaves", hashes, expected)}
+	}
+	rest := data[len(data)-r.Len():]
+	next := func() []byte {
+		sum := make([]byte, size)
+		copy(sum, rest)
+		rest = rest[size:]
+		return sum
+	}
+	for i := uint64(0); i < leaves; i++ {
+		partial.Leaves = append(partial.Leaves, next())
+	}
+	for i := uint64(0); i < hashes; i++ {
+		partial.Hashes = append(partial.Hashes, next())
+	}
+	*p = partial
+	return nil
+}
+
+type partialJSON struct {
+	Hash     string   `json:"hash"` // as registered, see RegisterHash
+	TreeSize int      `json:"treeSize"`
+	Indexes  []int    `json:"indexes"`
+	Leaves   [][]byte `json:"leaves"`
+	Hashes   [][]byte `json:"hashes"`
+}
+
+// MarshalJSON encodes the partial tree with the name of its hash
+func (p *PartialTree) MarshalJSON() ([]byte, error) {
+	name, err := HashName(p.hashMaker())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(partialJSON{Hash: name, TreeSize: p.TreeSize, Indexes: p.Indexes, Leaves: p.Leaves, Hashes: p.Hashes})
+}
+
+// UnmarshalJSON decodes a partial tree encoded by MarshalJSON. The hash it
+// names must be registered, and the partial tree be consistent as
+// UnmarshalBinary checks it, else it is an ErrInconsistentField.
+func (p *PartialTree) UnmarshalJSON(data []byte) error {
+	return p.unmarshalJSON(data, DefaultDecodeLimits())
+}
+
+// unmarshalJSON is UnmarshalJSON of the limits l
+func (p *PartialTree) unmarshalJSON(data []byte, l DecodeLimits) error {
+	if err := l.checkBytes(len(data)); err != nil {
+		return err
+	}
+	var pj partialJSON
+	if err := json.Unmarshal(data, &pj); err != nil {
+		return err
+	}
+	hm, ok := LookupHash(pj.Hash)
+	if !ok {
+		return ErrUnknownHash{Name: pj.Hash}
+	}
+	if err := l.checkLeaves(uint64(len(pj.Leaves) + len(pj.Hashes))); err != nil {
+		return err
+	}
+	partial := PartialTree{TreeSize: pj.TreeSize, Indexes: pj.Indexes, Leaves: pj.Leaves, Hashes: pj.Hashes, hash: hm}
+	if err := partial.check(); err != nil {
+		return err
+	}
+	*p = partial
+	return nil
+}
+
+// check is that the indexes are ascending within the tree, with a leaf of
+// each, and the hashes as many as the subtrees of none of them, of checksums
+// of the size of the hash
+func (p *PartialTree) check() error {
+	if p.TreeSize <= 0 || len(p.Indexes) == 0 {
+		return ErrInconsistentField{Field: "indexes", Reason: fmt.Sprintf("%d of a tree of %d leaves", len(p.Indexes), p.TreeSize)}
+	}
+	if len(p.Leaves) != len(p.Indexes) {
+		return ErrInconsistentField{Field: "leaves", Reason: fmt.Sprintf("%d for %d indexes", len(p.Leaves), len(p.Indexes))}
+	}
+	for i, index := range p.Indexes {
+		if index < 0 || index >= p.TreeSize || (i > 0 && index <= p.Indexes[i-1]) {
+			return ErrInconsistentField{Field: "indexes", Reason: fmt.Sprintf("%d at %d is not ascending within the tree", index, i)}
+		}
+	}
+	if expected := partialHashes(0, p.TreeSize, p.Indexes); len(p.Hashes) != expected {
+		return ErrInconsistentField{Field: "hashes", Reason: fmt.Sprintf("%d, expected %d for the leaves", len(p.Hashes), expected)}
+	}
+	size := p.hashMaker()().Size()
+	for _, sums := range [][][]byte{p.Leaves, p.Hashes} {
+		for _, sum := range sums {
+			if len(sum) != size {
+				return ErrInconsistentField{Field: "checksums", Reason: fmt.Sprintf("of %d bytes, expected %d", len(sum), size)}
+			}
+		}
+	}
+	return nil
+}
+
+// partialHashes is the count of the subtrees of the leaves [lo, hi) with none
+// of indexes, as collect appends them
+func partialHashes(lo, hi int, indexes []int) int {
+	if len(indexes) == 0 {
+		return 1
+	}
+	if hi-lo == 1 {
+		return 0
+	}
+	k := splitPoint(hi - lo)
+	split := sort.SearchInts(indexes, lo+k)
+	return partialHashes(lo, lo+k, indexes[:split]) + partialHashes(lo+k, hi, indexes[split:])
+}
+
+// HashMaker is of the checksums of the partial tree, or DefaultHashMaker if it
+// was not made by Tree.Partial or decoded
+func (p *PartialTree) HashMaker() HashMaker {
+	return p.hashMaker()
+}
+
+func (p *PartialTree) hashMaker() HashMaker {
+	if p.hash == nil {
+		return DefaultHashMaker
+	}
+	return p.hash
+}
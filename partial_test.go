@@ -0,0 +1,151 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestPartialTree(t *testing.T) {
+	for size := 1; size <= 13; size++ {
+		tree := testTree(t, size)
+		root, err := tree.RootChecksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, indexes := range [][]int{{0}, {size - 1}, {0, size - 1}, {size / 2, size / 3, size / 2}} {
+			p, err := tree.Partial(indexes...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Verify(root); err != nil {
+				t.Errorf("size %d, leaves %v: %s", size, indexes, err)
+			}
+			for _, index := range indexes {
+				if sum, ok := p.Leaf(index); !ok || !bytes.Equal(sum, tree.Nodes[index].checksum()) {
+					t.Errorf("size %d: expected leaf %d in the partial tree", size, index)
+				}
+			}
+
+			data, err := p.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded PartialTree
+			if err := decoded.UnmarshalBinary(data); err != nil {
+				t.Fatalf("size %d, leaves %v: %s", size, indexes, err)
+			}
+			if err := decoded.Verify(root); err != nil {
+				t.Errorf("size %d, leaves %v: decoded: %s", size, indexes, err)
+			}
+
+			if data, err = json.Marshal(p); err != nil {
+				t.Fatal(err)
+			}
+			var fromJSON PartialTree
+			if err := json.Unmarshal(data, &fromJSON); err != nil {
+				t.Fatal(err)
+			}
+			if err := fromJSON.Verify(root); err != nil {
+				t.Errorf("size %d, leaves %v: from JSON: %s", size, indexes, err)
+			}
+		}
+	}
+}
+
+func TestPartialTreeMinimal(t *testing.T) {
+	tree := testTree(t, 16)
+	p, err := tree.Partial(0, 1, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the leaves are the whole left quarter, so the rest is of two subtrees
+	if len(p.Hashes) != 2 {
+		t.Errorf("expected 2 hashes, got %d", len(p.Hashes))
+	}
+	p, err = tree.Partial(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Hashes) != 4 {
+		t.Errorf("expected the 4 hashes of an audit path, got %d", len(p.Hashes))
+	}
+}
+
+func TestPartialTreeInvalid(t *testing.T) {
+	tree := testTree(t, 9)
+	root, err := tree.RootChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.Partial(9); err == nil {
+		t.Errorf("expected an index beyond the tree to fail")
+	}
+	p, err := tree.Partial(2, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.Leaves[1] = tree.Nodes[6].checksum()
+	if err := p.Verify(root); err != ErrTreeHashMismatch {
+		t.Errorf("expected a changed leaf to mismatch, got %v", err)
+	}
+	p.Leaves[1] = tree.Nodes[7].checksum()
+
+	p.Hashes = p.Hashes[1:]
+	if err := p.Verify(root); err != ErrInvalidProof {
+		t.Errorf("expected missing hashes to be invalid, got %v", err)
+	}
+
+	data, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded PartialTree
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); err != ErrMalformedTree {
+		t.Errorf("expected a truncated partial tree to be malformed, got %v", err)
+	}
+}
+
+func TestPartialTreeInconsistent(t *testing.T) {
+	tree := testTree(t, 9)
+	p, err := tree.Partial(2, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded PartialTree
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	for name, change := range map[string]func(*PartialTree){
+		"descending":    func(p *PartialTree) { p.Indexes = []int{7, 2} },
+		"beyond":        func(p *PartialTree) { p.Indexes = []int{2, 9} },
+		"missing leaf":  func(p *PartialTree) { p.Leaves = p.Leaves[:1] },
+		"missing hash":  func(p *PartialTree) { p.Hashes = p.Hashes[1:] },
+		"checksum size": func(p *PartialTree) { p.Hashes = append([][]byte{p.Hashes[0][1:]}, p.Hashes[1:]...) },
+	} {
+		changed := *p
+		change(&changed)
+		data, err := json.Marshal(&changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.Unmarshal(data, &decoded)
+		if _, ok := err.(ErrInconsistentField); !ok {
+			t.Errorf("%s: expected ErrInconsistentField, got %v", name, err)
+		}
+	}
+
+	p.Hashes = p.Hashes[1:]
+	data, err = p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.UnmarshalBinary(data); err == nil || err.(ErrInconsistentField).Field != "hashes" {
+		t.Errorf("expected missing hashes to be inconsistent, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package merkle
+
+// Pipeline checksums each block received on blocks as a leaf Node, sent on the
+// returned channel in the order received, and positioned as the blocks follow
+// each other. Sending on the Node channel blocks
+// until it is received, so a slow consumer holds back the producer.
+//
+// The Node channel is closed once blocks is closed, and then the error channel
+// is closed. If checksumming a block fails, the error is sent and no more
+// Nodes are sent, though blocks is still drained until closed so the producer
+// is not left blocked.
+func Pipeline(hm HashMaker, blocks <-chan []byte) (<-chan *Node, <-chan error) {
+	var (
+		nodes = make(chan *Node)
+		errs  = make(chan error, 1)
+	)
+	go func() {
+		defer close(errs)
+		defer close(nodes)
+		var (
+			index  int
+			offset int64
+		)
+		for b := range blocks {
+			n, err := NewNodeHashBlock(hm, b)
+			if err != nil {
+				errs <- err
+				for range blocks {
+				}
+				return
+			}
+			n.Index, n.Offset, n.Length = index, offset, len(b)
+			index++
+			offset += int64(len(b))
+			nodes <- n
+		}
+	}()
+	return nodes, errs
+}
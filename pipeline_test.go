@@ -0,0 +1,70 @@
+package merkle
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+	h := NewHash(DefaultHashMaker, 10)
+	if _, err := h.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	expected := h.Sum(nil)
+
+	blocks := make(chan []byte)
+	go func() {
+		defer close(blocks)
+		for i := 0; i < len(msg); i += 10 {
+			end := i + 10
+			if end > len(msg) {
+				end = len(msg)
+			}
+			blocks <- msg[i:end]
+		}
+	}()
+
+	nodes, errs := Pipeline(DefaultHashMaker, blocks)
+	tree := Tree{BlockLength: 10}
+	for n := range nodes {
+		tree.Append(n)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	got, err := tree.Root().Checksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, got) {
+		t.Errorf("expected root %x; got %x", expected, got)
+	}
+}
+
+type failingHash struct {
+	hash.Hash
+}
+
+func (failingHash) Write([]byte) (int, error) {
+	return 0, errors.New("failing hash")
+}
+
+func TestPipelineError(t *testing.T) {
+	blocks := make(chan []byte)
+	go func() {
+		defer close(blocks)
+		for i := 0; i < 5; i++ {
+			blocks <- []byte{byte(i)}
+		}
+	}()
+	nodes, errs := Pipeline(func() hash.Hash { return failingHash{DefaultHashMaker()} }, blocks)
+	for range nodes {
+		t.Errorf("expected no nodes")
+	}
+	if err := <-errs; err == nil {
+		t.Errorf("expected an error")
+	}
+}
@@ -0,0 +1,35 @@
+package merkle
+
+import "sync"
+
+// buffers pools the temporary buffers of blocks and checksums by their
+// length. The lengths in use are few, those of the blocks and the digests of
+// the trees being built, so there is a pool of each.
+var buffers bufferPools
+
+type bufferPools struct {
+	pools sync.Map // of *sync.Pool by length
+}
+
+// get is a buffer of length bytes, of any content
+func (bp *bufferPools) get(length int) *[]byte {
+	if p, ok := bp.pools.Load(length); ok {
+		if b, ok := p.(*sync.Pool).Get().(*[]byte); ok {
+			return b
+		}
+	}
+	b := make([]byte, length)
+	return &b
+}
+
+// put returns a buffer from get, once it is no longer used
+func (bp *bufferPools) put(b *[]byte) {
+	p, ok := bp.pools.Load(len(*b))
+	if !ok {
+		p, _ = bp.pools.LoadOrStore(len(*b), &sync.Pool{})
+	}
+	p.(*sync.Pool).Put(b)
+}
+
+// zeros is written for the padding of blocks
+var zeros [4096]byte
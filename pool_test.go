@@ -0,0 +1,63 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestBufferPools(t *testing.T) {
+	var bp bufferPools
+	for _, length := range []int{0, 20, 1 << 16} {
+		b := bp.get(length)
+		if len(*b) != length {
+			t.Fatalf("expected a buffer of %d bytes, got %d", length, len(*b))
+		}
+		bp.put(b)
+		if b := bp.get(length); len(*b) != length {
+			t.Fatalf("expected a pooled buffer of %d bytes, got %d", length, len(*b))
+		}
+	}
+}
+
+func TestSubtreeHashAllocs(t *testing.T) {
+	sums := make([][]byte, 1000)
+	for i := range sums {
+		n, err := NewNodeHashBlock(sha256.New, []byte{byte(i), byte(i >> 8)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sums[i] = n.checksum()
+	}
+
+	// the tree hashed by pairs, as levelUp does
+	level := sums
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i+1 < len(level); i += 2 {
+			sum, err := hashChildren(sha256.New, level[i], level[i+1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			next = append(next, sum)
+		}
+		if len(level)%2 == 1 {
+			next = append(next, level[len(level)-1])
+		}
+		level = next
+	}
+	root, err := subtreeHash(sha256.New, sums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root, level[0]) {
+		t.Fatal("expected the root of the levels")
+	}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		subtreeHash(sha256.New, sums)
+	})
+	if allocs > 5 {
+		t.Errorf("expected the interior hashed in pooled buffers, got %v allocations", allocs)
+	}
+}
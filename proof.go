@@ -0,0 +1,411 @@
+package merkle
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"time"
+)
+
+// Proof is the audit path for a single leaf of a Tree. The Path is ordered
+// from the leaf's sibling up to the child of the root, as described in RFC
+// 6962 section 2.1.1.
+type Proof struct {
+	Index    int
+	TreeSize int
+	Path     [][]byte
+}
+
+// UnmarshalJSON decodes a proof, which must have a path of the length of its
+// index and tree size, of checksums of one size, as from an untrusted peer. A
+// proof that is not is an ErrInconsistentField.
+func (p *Proof) UnmarshalJSON(data []byte) error {
+	return p.unmarshalJSON(data, DefaultDecodeLimits())
+}
+
+// unmarshalJSON is UnmarshalJSON of the limits l
+func (p *Proof) unmarshalJSON(data []byte, l DecodeLimits) error {
+	if err := l.checkBytes(len(data)); err != nil {
+		return err
+	}
+	type proof Proof // without this method
+	var decoded proof
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if err := l.checkDepth(len(decoded.Path)); err != nil {
+		return err
+	}
+	if err := Proof(decoded).check(); err != nil {
+		return err
+	}
+	*p = Proof(decoded)
+	return nil
+}
+
+// check is that the path is of the shape of the index and tree size
+func (p Proof) check() error {
+	if p.Index < 0 || p.Index >= p.TreeSize {
+		return ErrInconsistentField{Field: "index", Reason: fmt.Sprintf("%d of a tree of %d leaves", p.Index, p.TreeSize)}
+	}
+	if length := proofLength(p.Index, p.TreeSize); len(p.Path) != length {
+		return ErrInconsistentField{Field: "path", Reason: fmt.Sprintf("%d checksums, expected %d", len(p.Path), length)}
+	}
+	for i, sum := range p.Path {
+		if len(sum) == 0 || len(sum) != len(p.Path[0]) {
+			return ErrInconsistentField{Field: "path", Reason: fmt.Sprintf("checksum %d is of %d bytes", i, len(sum))}
+		}
+	}
+	return nil
+}
+
+// InclusionProof returns the audit path for the leaf at index, at the current
+// size of the tree. With the interior cached, the path is of the subtrees
+// cached, so only those over leaves changed since are hashed.
+//
+// Otherwise, of a power of two leaves, every level of the tree is computed
+// once into a flat heap, kept for the proofs after until the leaves change.
+// This keeps about twice the checksums of the leaves, for a proof of a lookup
+// on each level rather than hashing the whole tree.
+func (t *Tree) InclusionProof(index int) (Proof, error) {
+	if index < 0 || index >= len(t.Nodes) {
+		return Proof{}, ErrIndexOutOfRange{Index: index, Size: len(t.Nodes)}
+	}
+	if t.interior != nil {
+		proofs, err := t.inclusionProofs([]int{index})
+		if err != nil {
+			return Proof{}, err
+		}
+		return proofs[0], nil
+	}
+	if isPowerOfTwo(len(t.Nodes)) {
+		p, err := t.perfectProofs()
+		if err != nil {
+			return Proof{}, err
+		}
+		return Proof{Index: index, TreeSize: len(t.Nodes), Path: p.path(index)}, nil
+	}
+	sums, err := t.leafSums()
+	if err != nil {
+		return Proof{}, err
+	}
+	path, err := auditPath(t.hashMaker(), index, sums)
+	if err != nil {
+		return Proof{}, err
+	}
+	return Proof{Index: index, TreeSize: len(sums), Path: path}, nil
+}
+
+// perfectProofs is the heap of the leaves of a tree of a power of two of
+// them, as kept, or computed again if the leaves changed since
+func (t *Tree) perfectProofs() (*perfectProofs, error) {
+	if p, ok := t.perfect.Load().(*perfectProofs); ok && p.of(t.Nodes) {
+		return p, nil
+	}
+	sums, err := t.leafSums()
+	if err != nil {
+		return nil, err
+	}
+	p, err := newPerfectProofs(t.hashMaker(), t.Nodes, sums)
+	if err != nil {
+		return nil, err
+	}
+	t.perfect.Store(p)
+	return p, nil
+}
+
+// perfectProofs is every checksum of a tree of a power of two leaves, laid out
+// flat as a heap, with the root at 1 and the leaves from the count of them.
+// Walking up the tree is shifting a position right, and the sibling of a
+// position is flipping its low bit.
+type perfectProofs struct {
+	leaves []*Node // it is of
+	size   int     // of a checksum
+	heap   []byte  // of the checksums of the positions, the first unused
+}
+
+func newPerfectProofs(hm HashMaker, nodes []*Node, sums [][]byte) (*perfectProofs, error) {
+	n, size := len(sums), len(sums[0])
+	p := &perfectProofs{leaves: append([]*Node(nil), nodes...), size: size, heap: make([]byte, 2*n*size)}
+	for i, sum := range sums {
+		if len(sum) != size {
+			return nil, fmt.Errorf("leaf %d has a checksum of %d bytes, expected %d", i, len(sum), size)
+		}
+		copy(p.sum(n+i), sum)
+	}
+	for i := n - 1; i > 0; i-- {
+		sum, err := hashChildren(hm, p.sum(i<<1), p.sum(i<<1|1))
+		if err != nil {
+			return nil, err
+		}
+		copy(p.sum(i), sum)
+	}
+	return p, nil
+}
+
+// sum is the checksum at position i
+func (p *perfectProofs) sum(i int) []byte {
+	return p.heap[i*p.size : (i+1)*p.size]
+}
+
+// of is whether the heap is of the leaves nodes
+func (p *perfectProofs) of(nodes []*Node) bool {
+	if len(nodes) != len(p.leaves) {
+		return false
+	}
+	for i, n := range nodes {
+		if n != p.leaves[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// path is the audit path of leaf m, copied out of the heap
+func (p *perfectProofs) path(m int) [][]byte {
+	depth := bits.TrailingZeros(uint(len(p.leaves)))
+	if depth == 0 {
+		return nil
+	}
+	var (
+		sums = make([]byte, depth*p.size)
+		path = make([][]byte, 0, depth)
+	)
+	for i := len(p.leaves) + m; i > 1; i >>= 1 {
+		sum := sums[:p.size:p.size]
+		copy(sum, p.sum(i^1))
+		path, sums = append(path, sum), sums[p.size:]
+	}
+	return path
+}
+
+// inclusionProofs is InclusionProof of each of indexes, of the interior
+// cached, which is synced with the leaves once for them all
+func (t *Tree) inclusionProofs(indexes []int) ([]Proof, error) {
+	paths, err := t.interior.proofs(t.hashMaker(), indexes, t.Nodes)
+	if err != nil {
+		return nil, err
+	}
+	proofs := make([]Proof, len(indexes))
+	for i, index := range indexes {
+		proofs[i] = Proof{Index: index, TreeSize: len(t.Nodes), Path: paths[i]}
+	}
+	return proofs, nil
+}
+
+// ErrInvalidProof is for a proof whose path does not fit its tree size
+var ErrInvalidProof = errors.New("invalid proof")
+
+// ErrIndexOutOfRange is for leaf indexes beyond the size of the tree
+type ErrIndexOutOfRange struct {
+	Index, Size int
+}
+
+// Error shows the requested index and the size of the tree
+func (err ErrIndexOutOfRange) Error() string {
+	return fmt.Sprintf("leaf index %d out of range for tree of size %d", err.Index, err.Size)
+}
+
+// rootFromProof recomputes the root from an audit path, per RFC 9162
+// section 2.1.3.2
+func rootFromProof(hm HashMaker, p Proof, leaf []byte) ([]byte, error) {
+	if p.Index < 0 || p.Index >= p.TreeSize {
+		return nil, ErrInvalidProof
+	}
+	var (
+		fn, sn = p.Index, p.TreeSize - 1
+		r      = leaf
+		err    error
+	)
+	for _, sib := range p.Path {
+		if sn == 0 {
+			return nil, ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			r, err = hashChildren(hm, sib, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r, err = hashChildren(hm, r, sib)
+		}
+		if err != nil {
+			return nil, err
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return nil, ErrInvalidProof
+	}
+	return r, nil
+}
+
+// VerifyProof checks that leaf, the checksum of a block, is proven under root
+// by p. A path not of the length of its index and tree size is
+// ErrInvalidProof, and one of another root ErrTreeHashMismatch.
+//
+// This is the entry point for authentication, where the time to reject a
+// forged path must not tell how much of it was right: every sibling is hashed
+// whatever the checksums, and the root is compared in constant time. Only the
+// index and tree size, which are public, change the work done.
+func VerifyProof(hm HashMaker, root []byte, p Proof, leaf []byte) (err error) {
+	if sink := auditing(); sink != nil {
+		defer func(start time.Time) {
+			audit(sink, AuditEvent{Kind: "proof", Root: root, Index: p.Index}, start, err)
+		}(time.Now())
+	}
+	if len(p.Path) != proofLength(p.Index, p.TreeSize) {
+		return ErrInvalidProof
+	}
+	got, err := rootFromProof(hm, p, leaf)
+	if err != nil {
+		return err
+	}
+	if !equalChecksums(got, root) {
+		return ErrTreeHashMismatch
+	}
+	return nil
+}
+
+// VerifyInclusion is whether leafChecksum, the checksum of a block, is proven
+// under root by proof. It is VerifyProof, for callers with no use of the
+// reason a proof fails.
+func VerifyInclusion(root []byte, proof Proof, leafChecksum []byte, hm HashMaker) bool {
+	return VerifyProof(hm, root, proof, leafChecksum) == nil
+}
+
+// proofLength is the length of the audit path of the leaf at index of a tree
+// of size leaves, stepping as rootFromProof does, or -1 if index is out of
+// range
+func proofLength(index, size int) int {
+	if index < 0 || index >= size {
+		return -1
+	}
+	length := 0
+	for fn, sn := index, size-1; sn != 0; length++ {
+		if fn&1 == 1 || fn == sn {
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return length
+}
+
+// equalChecksums compares a and b in constant time, of their length
+func equalChecksums(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// auditPath is PATH(m, D[n]) of RFC 6962, over the leaf checksums
+func auditPath(hm HashMaker, m int, sums [][]byte) ([][]byte, error) {
+	n := len(sums)
+	if n <= 1 {
+		return nil, nil
+	}
+	k := splitPoint(n)
+	if m < k {
+		path, err := auditPath(hm, m, sums[:k])
+		if err != nil {
+			return nil, err
+		}
+		sib, err := subtreeHash(hm, sums[k:])
+		if err != nil {
+			return nil, err
+		}
+		return append(path, sib), nil
+	}
+	path, err := auditPath(hm, m-k, sums[k:])
+	if err != nil {
+		return nil, err
+	}
+	sib, err := subtreeHash(hm, sums[:k])
+	if err != nil {
+		return nil, err
+	}
+	return append(path, sib), nil
+}
+
+// subtreeHash is MTH(D[n]) of RFC 6962, over the leaf checksums. This is the
+// same shape of tree as produced by levelUp.
+//
+// The leaves are pushed in order onto a stack of complete subtrees, each
+// joining those of its size, and the stack is then folded from the right as a
+// frontier is. The checksums of the stack are in a pooled buffer, and one
+// hash.Hash is Reset for each, so only the root is allocated.
+func subtreeHash(hm HashMaker, sums [][]byte) ([]byte, error) {
+	switch len(sums) {
+	case 0:
+		return nil, ErrEmptyTree
+	case 1:
+		return sums[0], nil
+	}
+	var (
+		h       = interiorHash(hm)
+		size    = h.Size()
+		scratch = buffers.get(maxStack * size)
+		array   [maxStack][]byte
+		stack   = array[:0]
+	)
+	defer buffers.put(scratch)
+	// join hashes the top two subtrees of the stack into one
+	join := func() error {
+		d := len(stack) - 2
+		h.Reset()
+		if _, err := h.Write(stack[d]); err != nil {
+			return err
+		}
+		if _, err := h.Write(stack[d+1]); err != nil {
+			return err
+		}
+		stack = append(stack[:d], h.Sum((*scratch)[d*size:d*size:(d+1)*size]))
+		return nil
+	}
+	for i, sum := range sums {
+		stack = append(stack, sum)
+		for n := i + 1; n&1 == 0; n >>= 1 {
+			if err := join(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for len(stack) > 1 {
+		if err := join(); err != nil {
+			return nil, err
+		}
+	}
+	return append([]byte(nil), stack[0]...), nil
+}
+
+// maxStack is the most complete subtrees on the stack of subtreeHash, one of
+// each bit of the count of leaves
+const maxStack = 64
+
+// hashChildren is the checksum of an interior node, from the checksums of its
+// left and right children
+func hashChildren(hm HashMaker, l, r []byte) ([]byte, error) {
+	h := interiorHash(hm)
+	if _, err := h.Write(l); err != nil {
+		return nil, err
+	}
+	if _, err := h.Write(r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// splitPoint is the largest power of two less than n, for n > 1
+func splitPoint(n int) int {
+	return 1 << uint(bits.Len(uint(n-1))-1)
+}
+
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
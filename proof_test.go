@@ -0,0 +1,347 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func testTree(t *testing.T, count int) *Tree {
+	tree := &Tree{BlockLength: 1}
+	for i := 0; i < count; i++ {
+		n, err := NewNodeHashBlock(DefaultHashMaker, []byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Append(n)
+	}
+	return tree
+}
+
+func TestInclusionProof(t *testing.T) {
+	for size := 1; size <= 17; size++ {
+		tree := testTree(t, size)
+		root, err := tree.Root().Checksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < size; i++ {
+			p, err := tree.InclusionProof(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := rootFromProof(DefaultHashMaker, p, tree.Nodes[i].checksum())
+			if err != nil {
+				t.Fatalf("size %d, index %d: %s", size, i, err)
+			}
+			if !bytes.Equal(got, root) {
+				t.Errorf("size %d, index %d: expected root %x; got %x", size, i, root, got)
+			}
+		}
+	}
+
+	tree := testTree(t, 3)
+	if _, err := tree.InclusionProof(3); err == nil {
+		t.Errorf("expected an error for an index beyond the tree")
+	}
+}
+
+func TestCachedInclusionProof(t *testing.T) {
+	for _, size := range []int{1, 2, 5, 8, 64, 100} {
+		tree := testTree(t, size)
+		tree.CacheInterior()
+		check := func(when string) {
+			sums, err := tree.leafSums()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range sums {
+				expected, err := auditPath(DefaultHashMaker, i, sums)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := tree.InclusionProof(i)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fmt.Sprintf("%x", got.Path) != fmt.Sprintf("%x", expected) {
+					t.Errorf("size %d, index %d %s: expected path %x; got %x", size, i, when, expected, got.Path)
+				}
+			}
+		}
+		check("of the cache")
+		n, err := NewNodeHashBlock(DefaultHashMaker, []byte("replaced"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.SetLeaf(size/2, n); err != nil {
+			t.Fatal(err)
+		}
+		check("after a leaf replaced")
+		tree.Append(n.leafCopy())
+		check("after a leaf appended")
+	}
+}
+
+func TestPerfectInclusionProof(t *testing.T) {
+	for _, size := range []int{1, 2, 4, 8, 64} {
+		tree := testTree(t, size)
+		check := func(when string) {
+			sums, err := tree.leafSums()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range sums {
+				expected, err := auditPath(DefaultHashMaker, i, sums)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := tree.InclusionProof(i)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fmt.Sprintf("%x", got.Path) != fmt.Sprintf("%x", expected) {
+					t.Errorf("size %d, index %d %s: expected path %x; got %x", size, i, when, expected, got.Path)
+				}
+			}
+		}
+		check("of the heap")
+		kept := tree.perfect.Load()
+		if _, err := tree.InclusionProof(0); err != nil {
+			t.Fatal(err)
+		}
+		if tree.perfect.Load() != kept {
+			t.Errorf("size %d: expected the heap kept across proofs", size)
+		}
+
+		// a proof does not share the memory of the heap
+		if p, _ := tree.InclusionProof(0); len(p.Path) > 0 {
+			p.Path[0][0] ^= 0xff
+			check("after a path was modified")
+		}
+		n, err := NewNodeHashBlock(DefaultHashMaker, []byte("replaced"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Nodes[size/2] = n
+		check("after a leaf replaced")
+		tree.Append(tree.Nodes...)
+		check("after the leaves doubled")
+	}
+}
+
+func benchmarkTree(b *testing.B, size int) *Tree {
+	tree := &Tree{}
+	for i := 0; i < size; i++ {
+		n, err := NewNodeHashBlock(DefaultHashMaker, []byte{byte(i), byte(i >> 8), byte(i >> 16)})
+		if err != nil {
+			b.Fatal(err)
+		}
+		tree.Append(n)
+	}
+	return tree
+}
+
+func benchmarkInclusionProof(b *testing.B, size int, cached bool) {
+	tree := benchmarkTree(b, size)
+	if cached {
+		tree.CacheInterior()
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tree.InclusionProof(i % size); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInclusionProof1024(b *testing.B) {
+	benchmarkInclusionProof(b, 1024, false)
+}
+
+// the path of InclusionProof for a tree of other than a power of two leaves,
+// of the same leaves as BenchmarkInclusionProof1024
+func BenchmarkInclusionProofGeneral1024(b *testing.B) {
+	tree := benchmarkTree(b, 1024)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sums, err := tree.leafSums()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := auditPath(tree.hashMaker(), i%1024, sums); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInclusionProof1023(b *testing.B) {
+	benchmarkInclusionProof(b, 1023, false)
+}
+
+func BenchmarkInclusionProofCached1023(b *testing.B) {
+	benchmarkInclusionProof(b, 1023, true)
+}
+
+func TestVerifyProof(t *testing.T) {
+	for size := 1; size <= 17; size++ {
+		tree := testTree(t, size)
+		root, err := tree.RootChecksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < size; i++ {
+			p, err := tree.InclusionProof(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := proofLength(i, size); got != len(p.Path) {
+				t.Errorf("size %d, index %d: expected a path of %d; got %d", size, i, len(p.Path), got)
+			}
+			leaf := tree.Nodes[i].checksum()
+			if err := VerifyProof(DefaultHashMaker, root, p, leaf); err != nil {
+				t.Errorf("size %d, index %d: %s", size, i, err)
+			}
+			if err := VerifyProof(DefaultHashMaker, root, p, bytes.Repeat([]byte{0xff}, len(leaf))); err != ErrTreeHashMismatch {
+				t.Errorf("size %d, index %d: expected ErrTreeHashMismatch for another leaf; got %v", size, i, err)
+			}
+			if len(p.Path) > 0 {
+				short := p
+				short.Path = p.Path[:len(p.Path)-1]
+				if err := VerifyProof(DefaultHashMaker, root, short, leaf); err != ErrInvalidProof {
+					t.Errorf("size %d, index %d: expected ErrInvalidProof for a short path; got %v", size, i, err)
+				}
+			}
+		}
+	}
+}
+
+func TestProofJSON(t *testing.T) {
+	tree := testTree(t, 9)
+	p, err := tree.InclusionProof(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Proof
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Index != 5 || got.TreeSize != 9 || len(got.Path) != len(p.Path) {
+		t.Errorf("expected the proof decoded as encoded, got %+v", got)
+	}
+	for name, change := range map[string]func(*Proof){
+		"index":         func(p *Proof) { p.Index = 9 },
+		"short path":    func(p *Proof) { p.Path = p.Path[1:] },
+		"checksum size": func(p *Proof) { p.Path = append([][]byte{p.Path[0][1:]}, p.Path[1:]...) },
+	} {
+		changed := p
+		change(&changed)
+		data, err := json.Marshal(changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.Unmarshal(data, &got)
+		if _, ok := err.(ErrInconsistentField); !ok {
+			t.Errorf("%s: expected ErrInconsistentField, got %v", name, err)
+		}
+	}
+}
+
+// the leaves, roots and inclusion proofs of the RFC 6962 reference tests
+var (
+	rfc6962Leaves = []string{"", "00", "10", "2021", "3031", "40414243", "5051525354555657", "606162636465666768696a6b6c6d6e6f"}
+	rfc6962Roots  = []string{
+		"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+		"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+		"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+		"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+		"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+		"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+	}
+	rfc6962Proofs = []struct {
+		index, size int
+		path        []string
+	}{
+		{0, 1, nil},
+		{0, 8, []string{
+			"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4",
+		}},
+		{5, 8, []string{
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+			"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+			"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		}},
+		{2, 3, []string{
+			"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+		}},
+		{1, 5, []string{
+			"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+		}},
+	}
+)
+
+// rfc6962Tree is the tree of the first size of the RFC 6962 reference leaves
+func rfc6962Tree(t *testing.T, size int) (*Tree, HashMaker) {
+	hm := DomainSeparated(sha256.New)
+	tree := &Tree{}
+	for _, leaf := range rfc6962Leaves[:size] {
+		b, _ := hex.DecodeString(leaf)
+		n, err := NewNodeHashBlock(hm, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Append(n)
+	}
+	return tree, hm
+}
+
+func TestVerifyInclusion(t *testing.T) {
+	for i, expected := range rfc6962Roots {
+		tree, _ := rfc6962Tree(t, i+1)
+		root, err := tree.RootChecksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(root) != expected {
+			t.Errorf("size %d: expected the root %s, got %x", i+1, expected, root)
+		}
+	}
+
+	for _, v := range rfc6962Proofs {
+		tree, hm := rfc6962Tree(t, v.size)
+		root, _ := tree.RootChecksum()
+		p, err := tree.InclusionProof(v.index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Index != v.index || p.TreeSize != v.size || len(p.Path) != len(v.path) {
+			t.Fatalf("leaf %d of %d: expected a path of %d, got %d", v.index, v.size, len(v.path), len(p.Path))
+		}
+		for i, sum := range v.path {
+			if hex.EncodeToString(p.Path[i]) != sum {
+				t.Errorf("leaf %d of %d: expected %s at %d, got %x", v.index, v.size, sum, i, p.Path[i])
+			}
+		}
+		leaf, _ := tree.Nodes[v.index].Checksum()
+		if !VerifyInclusion(root, p, leaf, hm) {
+			t.Errorf("leaf %d of %d: expected the proof to verify", v.index, v.size)
+		}
+		other, _ := tree.Nodes[(v.index+1)%v.size].Checksum()
+		if v.size > 1 && VerifyInclusion(root, p, other, hm) {
+			t.Errorf("leaf %d of %d: expected another leaf to fail", v.index, v.size)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProofToken grants access to the proofs of the leaves [Start, End) of the
+// tree with Root, until Expiry. Tokens are signed by the issuer, so edge
+// caches can serve proofs to token holders without access to the issuer, or
+// exposing the rest of the tree.
+type ProofToken struct {
+	Root       []byte
+	Start, End int
+	Expiry     time.Time
+}
+
+var (
+	// ErrInvalidToken is for a token that does not parse, or is not signed by
+	// the issuer
+	ErrInvalidToken = errors.New("invalid proof token")
+
+	// ErrTokenExpired is for a token past its expiry
+	ErrTokenExpired = errors.New("proof token expired")
+
+	// ErrTokenScope is for a leaf outside of the range a token grants
+	ErrTokenScope = errors.New("leaf is not in the range of the proof token")
+)
+
+// proofTokenContext separates the signatures of tokens from other signatures
+// by the same key
+const proofTokenContext = "merkle proof token v1\n"
+
+func (pt ProofToken) payload() []byte {
+	var (
+		buf bytes.Buffer
+		tmp [binary.MaxVarintLen64]byte
+	)
+	buf.WriteByte(1) // version
+	buf.Write(tmp[:binary.PutUvarint(tmp[:], uint64(pt.Start))])
+	buf.Write(tmp[:binary.PutUvarint(tmp[:], uint64(pt.End))])
+	buf.Write(tmp[:binary.PutVarint(tmp[:], pt.Expiry.Unix())])
+	buf.Write(tmp[:binary.PutUvarint(tmp[:], uint64(len(pt.Root)))])
+	buf.Write(pt.Root)
+	return buf.Bytes()
+}
+
+// Issue signs the token with signer, and returns it in its compact, URL safe
+// form
+func (pt ProofToken) Issue(signer crypto.Signer) (string, error) {
+	if pt.Start < 0 || pt.End < pt.Start {
+		return "", fmt.Errorf("invalid leaf range [%d, %d)", pt.Start, pt.End)
+	}
+	payload := pt.payload()
+	sig, err := signMessage(signer, append([]byte(proofTokenContext), payload...))
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// ParseProofToken verifies the signature of token by the issuer's public key,
+// and that it has not expired at now
+func ParseProofToken(token string, pub crypto.PublicKey, now time.Time) (*ProofToken, error) {
+	dot := strings.IndexByte(token, '.')
+	if dot < 0 {
+		return nil, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(token[:dot])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(token[dot+1:])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !verifyMessage(pub, append([]byte(proofTokenContext), payload...), sig) {
+		return nil, ErrInvalidToken
+	}
+
+	r := bytes.NewReader(payload)
+	if version, err := r.ReadByte(); err != nil || version != 1 {
+		return nil, ErrInvalidToken
+	}
+	start, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	end, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	expiry, err := binary.ReadVarint(r)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	rootLen, err := binary.ReadUvarint(r)
+	if err != nil || rootLen != uint64(r.Len()) || start > end || end > uint64(maxInt) {
+		return nil, ErrInvalidToken
+	}
+	pt := &ProofToken{
+		Root:   payload[len(payload)-r.Len():],
+		Start:  int(start),
+		End:    int(end),
+		Expiry: time.Unix(expiry, 0),
+	}
+	if !now.Before(pt.Expiry) {
+		return nil, ErrTokenExpired
+	}
+	return pt, nil
+}
+
+// Allows is whether the token grants the proof of the leaf at index
+func (pt ProofToken) Allows(index int) bool {
+	return index >= pt.Start && index < pt.End
+}
+
+// NewProofHandler returns a handler serving, as JSON, the Proof of the leaf at
+// the "index" query parameter, to requests with a "token" parameter issued by
+// the holder of the key pub, for the root of st. Requests for a tree that has
+// since grown past the token's root are refused with 410 Gone.
+func NewProofHandler(st *SyncTree, pub crypto.PublicKey) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pt, err := ParseProofToken(r.URL.Query().Get("token"), pub, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		index, err := strconv.Atoi(r.URL.Query().Get("index"))
+		if err != nil {
+			http.Error(w, "invalid index", http.StatusBadRequest)
+			return
+		}
+		if !pt.Allows(index) {
+			http.Error(w, ErrTokenScope.Error(), http.StatusForbidden)
+			return
+		}
+		proof, err := st.InclusionProof(index)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		leaves, err := st.NodeRange(index, index+1)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		// the tree may have grown since the token was issued
+		if err := VerifyProof(leaves[0].hashMaker(), pt.Root, proof, leaves[0].checksum()); err != nil {
+			http.Error(w, "tree no longer has the root of the token", http.StatusGone)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(proof)
+	})
+}
@@ -0,0 +1,113 @@
+package merkle
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProofToken(t *testing.T) {
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	root := []byte("root checksum")
+	now := time.Now()
+
+	token, err := ProofToken{Root: root, Start: 2, End: 5, Expiry: now.Add(time.Hour)}.Issue(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt, err := ParseProofToken(token, pub, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pt.Root) != string(root) || pt.Start != 2 || pt.End != 5 {
+		t.Errorf("unexpected token %+v", pt)
+	}
+	for index, allowed := range map[int]bool{1: false, 2: true, 4: true, 5: false} {
+		if pt.Allows(index) != allowed {
+			t.Errorf("leaf %d: expected allowed %t", index, allowed)
+		}
+	}
+
+	if _, err := ParseProofToken(token, pub, now.Add(2*time.Hour)); err != ErrTokenExpired {
+		t.Errorf("expected ErrTokenExpired, got %v", err)
+	}
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := ParseProofToken(token, otherPub, now); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for another issuer, got %v", err)
+	}
+	tampered := []byte(token)
+	tampered[3] ^= 1
+	for _, bad := range []string{string(tampered), "", strings.Split(token, ".")[0]} {
+		if _, err := ParseProofToken(bad, pub, now); err != ErrInvalidToken {
+			t.Errorf("%q: expected ErrInvalidToken, got %v", bad, err)
+		}
+	}
+}
+
+func TestProofHandler(t *testing.T) {
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	tree := testTree(t, 9)
+	st := NewSyncTree(tree)
+	root, err := st.RootChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewProofHandler(st, pub))
+	defer srv.Close()
+
+	token, err := ProofToken{Root: root, Start: 0, End: 4, Expiry: time.Now().Add(time.Hour)}.Issue(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(token, index string) *http.Response {
+		resp, err := http.Get(srv.URL + "?" + url.Values{"token": {token}, "index": {index}}.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := get(token, "3")
+	var proof Proof
+	err = json.NewDecoder(resp.Body).Decode(&proof)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, _ := tree.Nodes[3].Checksum()
+	got, err := rootFromProof(DefaultHashMaker, proof, sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(root) {
+		t.Errorf("expected the served proof to verify against the root")
+	}
+
+	for _, c := range []struct {
+		token, index string
+		status       int
+	}{
+		{token, "4", http.StatusForbidden},
+		{"bogus", "1", http.StatusUnauthorized},
+		{token, "x", http.StatusBadRequest},
+	} {
+		resp := get(c.token, c.index)
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Errorf("index %s: expected status %d, got %d", c.index, c.status, resp.StatusCode)
+		}
+	}
+
+	st.Append(testTree(t, 1).Nodes...)
+	resp = get(token, "1")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGone {
+		t.Errorf("expected 410 once the tree has grown, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,173 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// The protobuf form of a Tree is of the message
+//
+//	message Tree {
+//	  uint32 version = 1;
+//	  string hash = 2;
+//	  uint64 block_length = 3;
+//	  uint32 final_block = 4;
+//	  uint64 length = 5;
+//	  repeated bytes leaves = 6;
+//	  repeated uint64 lengths = 7; // packed
+//	  bytes bloom = 8;
+//	}
+const (
+	protoVersion = 1 + iota
+	protoHash
+	protoBlockLength
+	protoFinalBlock
+	protoLength
+	protoLeaves
+	protoLengths
+	protoBloom
+)
+
+// protobuf wire types
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// MarshalProto encodes the tree as the protobuf message Tree, of the same
+// fields as MarshalJSON
+func (t *Tree) MarshalProto() ([]byte, error) {
+	tf, err := t.fields()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	protoUvarint(&buf, protoVersion, uint64(tf.Version))
+	protoString(&buf, protoHash, []byte(tf.Hash))
+	protoUvarint(&buf, protoBlockLength, uint64(tf.BlockLength))
+	protoUvarint(&buf, protoFinalBlock, uint64(tf.FinalBlock))
+	protoUvarint(&buf, protoLength, uint64(tf.Length))
+	for _, sum := range tf.Leaves {
+		protoString(&buf, protoLeaves, sum)
+	}
+	if len(tf.Lengths) > 0 {
+		var packed bytes.Buffer
+		for _, l := range tf.Lengths {
+			writeUvarint(&packed, uint64(l))
+		}
+		protoString(&buf, protoLengths, packed.Bytes())
+	}
+	if len(tf.Bloom) > 0 {
+		protoString(&buf, protoBloom, tf.Bloom)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalProto decodes a tree encoded by MarshalProto. The hash it names
+// must be registered. As protobuf allows, unknown fields are skipped, and the
+// lengths may be packed or not.
+func (t *Tree) UnmarshalProto(data []byte) error {
+	return t.unmarshalProto(data, DefaultDecodeLimits())
+}
+
+// unmarshalProto is UnmarshalProto of the limits l
+func (t *Tree) unmarshalProto(data []byte, l DecodeLimits) error {
+	if err := l.checkBytes(len(data)); err != nil {
+		return err
+	}
+	var (
+		r  = bytes.NewReader(data)
+		tf treeFields
+	)
+	for r.Len() > 0 {
+		key, err := binary.ReadUvarint(r)
+		if err != nil {
+			return ErrMalformedTree
+		}
+		field, wire := key>>3, key&7
+		switch {
+		case wire == protoVarint:
+			v, err := binary.ReadUvarint(r)
+			if err != nil {
+				return ErrMalformedTree
+			}
+			switch field {
+			case protoVersion, protoBlockLength, protoFinalBlock, protoLengths:
+				if v > uint64(maxInt) {
+					return ErrMalformedTree
+				}
+			case protoLength:
+				if v > 1<<63-1 {
+					return ErrMalformedTree
+				}
+			}
+			switch field {
+			case protoVersion:
+				tf.Version = int(v)
+			case protoBlockLength:
+				tf.BlockLength = int(v)
+			case protoFinalBlock:
+				tf.FinalBlock = FinalBlockPolicy(v)
+			case protoLength:
+				tf.Length = int64(v)
+			case protoLengths:
+				tf.Lengths = append(tf.Lengths, int(v))
+			}
+		case wire == protoBytes:
+			n, err := binary.ReadUvarint(r)
+			if err != nil || n > uint64(r.Len()) {
+				return ErrMalformedTree
+			}
+			b := data[len(data)-r.Len() : len(data)-r.Len()+int(n)]
+			r.Seek(int64(n), io.SeekCurrent)
+			switch field {
+			case protoHash:
+				tf.Hash = string(b)
+			case protoLeaves:
+				tf.Leaves = append(tf.Leaves, b)
+			case protoLengths:
+				packed := bytes.NewReader(b)
+				for packed.Len() > 0 {
+					v, err := binary.ReadUvarint(packed)
+					if err != nil || v > uint64(maxInt) {
+						return ErrMalformedTree
+					}
+					tf.Lengths = append(tf.Lengths, int(v))
+				}
+			case protoBloom:
+				tf.Bloom = b
+			}
+		case wire == protoFixed64 && r.Len() >= 8:
+			r.Seek(8, io.SeekCurrent)
+		case wire == protoFixed32 && r.Len() >= 4:
+			r.Seek(4, io.SeekCurrent)
+		default:
+			return ErrMalformedTree
+		}
+	}
+	tree, err := tf.tree(l)
+	if err != nil {
+		return err
+	}
+	*t = *tree
+	return nil
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	buf.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+}
+
+func protoUvarint(buf *bytes.Buffer, field int, v uint64) {
+	writeUvarint(buf, uint64(field)<<3|protoVarint)
+	writeUvarint(buf, v)
+}
+
+func protoString(buf *bytes.Buffer, field int, b []byte) {
+	writeUvarint(buf, uint64(field)<<3|protoBytes)
+	writeUvarint(buf, uint64(len(b)))
+	buf.Write(b)
+}
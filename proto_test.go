@@ -0,0 +1,43 @@
+package merkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTreeProto(t *testing.T) {
+	for name, tree := range codecTrees(t) {
+		data, err := tree.MarshalProto()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Tree
+		if err := got.UnmarshalProto(data); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		checkRoundTrip(t, name, tree, &got)
+	}
+
+	tree := codecTrees(t)["chunks"]
+	data, err := tree.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// unknown fields are skipped, and lengths need not be packed
+	var extra bytes.Buffer
+	extra.Write(data[:bytes.LastIndexByte(data, protoLengths<<3|protoBytes)])
+	for _, l := range []uint64{3, 5, 1} {
+		protoUvarint(&extra, protoLengths, l)
+	}
+	protoUvarint(&extra, 99, 7)
+	protoString(&extra, 100, []byte("later"))
+	var got Tree
+	if err := got.UnmarshalProto(extra.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	checkRoundTrip(t, "unpacked", tree, &got)
+
+	if err := got.UnmarshalProto(data[:len(data)-1]); err != ErrMalformedTree {
+		t.Errorf("expected ErrMalformedTree of a truncated message, got %v", err)
+	}
+}
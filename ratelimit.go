@@ -0,0 +1,63 @@
+package merkle
+
+import (
+	"sync"
+	"time"
+)
+
+// WithRateLimit caps verification to bytesPerSecond and hashesPerSecond, a
+// hash being of a block, 0 for no cap of either. Whole blocks are paced, so
+// their alignment is kept, as a limiter wrapping the reader would not.
+func WithRateLimit(bytesPerSecond, hashesPerSecond int64) Option {
+	return func(o *options) {
+		o.given |= optRateLimit
+		o.bytesPerSecond = bytesPerSecond
+		o.hashesPerSecond = hashesPerSecond
+	}
+}
+
+// throttle paces blocks to the rates of WithRateLimit. Each block is due once
+// those before it have taken their share of time, so idle time is not saved up
+// for a burst.
+type throttle struct {
+	bytesPerSecond, hashesPerSecond int64
+	sleep                           func(time.Duration)
+
+	mu   sync.Mutex
+	next time.Time // when the next block is due
+}
+
+// throttle is the throttle of the rates set, or nil for none
+func (o options) throttle() *throttle {
+	if o.bytesPerSecond <= 0 && o.hashesPerSecond <= 0 {
+		return nil
+	}
+	return &throttle{bytesPerSecond: o.bytesPerSecond, hashesPerSecond: o.hashesPerSecond, sleep: time.Sleep}
+}
+
+// wait blocks until a block of n bytes is due. A nil throttle does not wait.
+func (t *throttle) wait(n int) {
+	if t == nil {
+		return
+	}
+	var cost time.Duration
+	if t.bytesPerSecond > 0 {
+		cost = time.Duration(int64(n) * int64(time.Second) / t.bytesPerSecond)
+	}
+	if t.hashesPerSecond > 0 {
+		if c := time.Second / time.Duration(t.hashesPerSecond); c > cost {
+			cost = c
+		}
+	}
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	delay := t.next.Sub(now)
+	t.next = t.next.Add(cost)
+	t.mu.Unlock()
+	if delay > 0 {
+		t.sleep(delay)
+	}
+}
@@ -0,0 +1,54 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	var slept []time.Duration
+	th := newOptions([]Option{WithRateLimit(1000, 4)}).throttle()
+	th.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	th.wait(500) // due now, 500ms of bytes
+	th.wait(100) // due after 500ms, 250ms of hashes
+	th.wait(100) // due after 750ms
+	if len(slept) != 2 {
+		t.Fatalf("expected 2 waits, got %v", slept)
+	}
+	for i, expected := range []time.Duration{500 * time.Millisecond, 750 * time.Millisecond} {
+		if d := slept[i]; d > expected || d < expected-50*time.Millisecond {
+			t.Errorf("wait %d: expected about %s, got %s", i, expected, d)
+		}
+	}
+
+	if newOptions(nil).throttle() != nil {
+		t.Error("expected no throttle without a rate limit")
+	}
+	var none *throttle
+	none.wait(1 << 20)
+}
+
+func TestVerifyingReaderRateLimit(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 64)
+	tree, err := SumOf(sha256.New, 64, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	got, err := ioutil.ReadAll(NewVerifyingReader(bytes.NewReader(data), tree, WithRateLimit(0, 200)))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("expected the data, got %v", err)
+	}
+	// 10 blocks at 200 a second, the first of which is due at once
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("expected the reads to be paced, took %s", elapsed)
+	}
+	if _, err := io.Copy(ioutil.Discard, NewVerifyingReader(bytes.NewReader(data), tree)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,104 @@
+package merkle
+
+import "io"
+
+// defaultReadAhead is the buffers read ahead of hashing, by default, so one is
+// read while another is hashed
+const defaultReadAhead = 1
+
+// WithReadAhead sets the count of buffers read ahead of the one being hashed
+// by ReadFrom, so reading the input overlaps hashing it rather than the disk
+// and the processor taking turns being idle. It defaults to 1, double
+// buffering, and 0 reads and hashes each buffer in turn.
+func WithReadAhead(depth int) Option {
+	return func(o *options) {
+		o.given |= optReadAhead
+		if depth >= 0 {
+			o.readAhead = depth
+		}
+	}
+}
+
+// readChunk is a buffer filled by readAhead, and the error reading it
+type readChunk struct {
+	buf *[]byte
+	n   int
+	err error
+}
+
+// readAhead reads r until io.EOF into buffers of length bytes, and calls fn
+// with each in order, on depth buffers read ahead of fn. The count of bytes
+// fn took is returned, with the first error of reading or of fn.
+func readAhead(r io.Reader, length, depth int, fn func([]byte) (int, error)) (int64, error) {
+	if depth < 1 {
+		pooled := buffers.get(length)
+		defer buffers.put(pooled)
+		var total int64
+		for {
+			n, err := io.ReadFull(r, *pooled)
+			if total, err = takeChunk(fn, total, (*pooled)[:n], err); err != nil || n < length {
+				return total, err
+			}
+		}
+	}
+
+	var (
+		chunks = make(chan readChunk, depth-1) // and one being read
+		done   = make(chan struct{})
+	)
+	go func() {
+		defer close(chunks)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			pooled := buffers.get(length)
+			n, err := io.ReadFull(r, *pooled)
+			select {
+			case chunks <- readChunk{buf: pooled, n: n, err: err}:
+			case <-done:
+				buffers.put(pooled)
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	defer func() {
+		// the reader is stopped, and the buffers it read ahead returned
+		close(done)
+		for c := range chunks {
+			buffers.put(c.buf)
+		}
+	}()
+
+	var total int64
+	for c := range chunks {
+		var err error
+		total, err = takeChunk(fn, total, (*c.buf)[:c.n], c.err)
+		buffers.put(c.buf)
+		if err != nil || c.n < length {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// takeChunk calls fn with the bytes of a chunk read with err, which is the end
+// of the input if io.EOF or io.ErrUnexpectedEOF
+func takeChunk(fn func([]byte) (int, error), total int64, b []byte, err error) (int64, error) {
+	if len(b) > 0 {
+		n, werr := fn(b)
+		total += int64(n)
+		if werr != nil {
+			return total, werr
+		}
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return total, nil
+	}
+	return total, err
+}
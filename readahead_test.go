@@ -0,0 +1,86 @@
+package merkle
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// readCounter counts the bytes read from r
+type readCounter struct {
+	r io.Reader
+	n int64
+}
+
+func (rc *readCounter) Read(p []byte) (int, error) {
+	n, err := rc.r.Read(p)
+	rc.n += int64(n)
+	return n, err
+}
+
+func TestReadAhead(t *testing.T) {
+	data := make([]byte, 16*readFromBlocks*10+5)
+	for i := range data {
+		data[i] = byte(i * 13)
+	}
+	_, root, err := NewBuilder(DefaultHashMaker, 16).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for depth := 0; depth <= 3; depth++ {
+		b := NewBuilder(DefaultHashMaker, 16, WithReadAhead(depth))
+		n, err := io.Copy(b, bytes.NewReader(data))
+		if err != nil || n != int64(len(data)) {
+			t.Fatalf("depth %d: expected %d bytes copied, got %d %v", depth, len(data), n, err)
+		}
+		_, sum, err := b.Finalize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sum, root) {
+			t.Errorf("depth %d: expected the root of the data", depth)
+		}
+
+		h, err := New(DefaultHashMaker, 16, WithReadAhead(depth))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(h, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(h.Sum(nil), root) {
+			t.Errorf("depth %d: expected the hash of the data", depth)
+		}
+
+		// a write failing stops the reading ahead
+		rc := &readCounter{r: bytes.NewReader(data)}
+		b = NewBuilder(DefaultHashMaker, 16, WithReadAhead(depth), WithMaxBytes(16*readFromBlocks*2))
+		n, err = b.ReadFrom(rc)
+		if _, ok := err.(ErrLimitExceeded); !ok {
+			t.Fatalf("depth %d: expected ErrLimitExceeded, got %v", depth, err)
+		}
+		if n != 16*readFromBlocks*2 {
+			t.Errorf("depth %d: expected the bytes within the limit written, got %d", depth, n)
+		}
+		if max := int64(16 * readFromBlocks * (depth + 4)); rc.n > max {
+			t.Errorf("depth %d: expected at most %d bytes read, got %d", depth, max, rc.n)
+		}
+
+		// an error reading is returned after the bytes read before it
+		failure := errors.New("failed")
+		b = NewBuilder(DefaultHashMaker, 16, WithReadAhead(depth))
+		n, err = b.ReadFrom(io.MultiReader(bytes.NewReader(data[:100]), &errReader{err: failure}))
+		if err != failure || n != 100 {
+			t.Errorf("depth %d: expected 100 bytes and the error reading, got %d %v", depth, n, err)
+		}
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (er *errReader) Read(p []byte) (int, error) {
+	return 0, er.err
+}
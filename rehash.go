@@ -0,0 +1,109 @@
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Rehash updates the tree to the content of r, of size bytes, re-reading only
+// the blocks at the dirty indexes and those past the whole blocks of the
+// tree, as for a file that was written to in place or appended to. With dirty
+// nil, every block is re-read. The indexes of the leaves whose checksum
+// changed, including new leaves, are returned in order.
+//
+// The Bloom filter and leaf index of the tree, if any, are kept up to date.
+// The filter still contains the checksums of leaves that were replaced.
+func (t *Tree) Rehash(r io.ReaderAt, size int64, dirty []int) ([]int, error) {
+	if t.BlockLength <= 0 {
+		return nil, fmt.Errorf("a tree of no block length can not be rehashed")
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("invalid size %d", size)
+	}
+	var (
+		hm        = t.hashMaker()
+		bl        = int64(t.BlockLength)
+		leaves64  = (size + bl - 1) / bl
+		oldLeaves = len(t.Nodes)
+	)
+	if leaves64 > int64(maxInt) {
+		return nil, ErrLimitExceeded{Limit: "leaves", Max: int64(maxInt)}
+	}
+	leaves := int(leaves64)
+
+	// the whole blocks of the tree are unchanged unless dirty, so reading
+	// starts from its short last block, if any
+	from := int(t.length / bl)
+	if dirty == nil || from > oldLeaves {
+		from = 0
+	}
+	read := map[int]bool{}
+	for i := from; i < leaves; i++ {
+		read[i] = true
+	}
+	if leaves > 0 && size < t.length {
+		// the last block may be newly short
+		read[leaves-1] = true
+	}
+	for _, i := range dirty {
+		if i >= 0 && i < leaves {
+			read[i] = true
+		}
+	}
+	indexes := make([]int, 0, len(read))
+	for i := range read {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	nodes := make([]*Node, leaves)
+	copy(nodes, t.Nodes)
+	var (
+		changed []int
+		pooled  = buffers.get(t.BlockLength)
+		block   = *pooled
+	)
+	defer buffers.put(pooled)
+	for _, i := range indexes {
+		offset := int64(i) * bl
+		length := t.BlockLength
+		if rest := size - offset; rest < bl {
+			length = int(rest)
+		}
+		if n, err := r.ReadAt(block[:length], offset); n < length {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		var (
+			n   *Node
+			err error
+		)
+		if i == leaves-1 {
+			n, err = t.FinalBlock.NewNode(hm, t.BlockLength, block[:length])
+		} else {
+			n, err = NewNodeHashBlock(hm, block[:length])
+		}
+		if err != nil {
+			return nil, err
+		}
+		n.Index, n.Offset, n.Length = i, offset, length
+		if i >= oldLeaves || !bytes.Equal(nodes[i].checksum(), n.checksum()) {
+			changed = append(changed, i)
+			if t.bloom != nil {
+				t.bloom.Add(n.checksum())
+			}
+		}
+		nodes[i] = n
+	}
+	t.Nodes, t.length = nodes, size
+	if t.indexes != nil && (len(changed) > 0 || leaves < oldLeaves) {
+		if err := t.BuildLeafIndex(); err != nil {
+			return nil, err
+		}
+	}
+	return changed, nil
+}
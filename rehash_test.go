@@ -0,0 +1,62 @@
+package merkle
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRehash(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 10)
+	data = append(data, "tail"...)
+	tree, _, err := NewBuilder(DefaultHashMaker, 16, WithLeafIndex()).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(name string, data []byte, dirty []int, expected []int) {
+		changed, err := tree.Rehash(bytes.NewReader(data), int64(len(data)), dirty)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !reflect.DeepEqual(changed, expected) {
+			t.Errorf("%s: expected changed leaves %v, got %v", name, expected, changed)
+		}
+		fresh, _, err := NewBuilder(DefaultHashMaker, 16).Build(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tree.Equal(fresh) {
+			t.Errorf("%s: expected the tree of the content built afresh", name)
+		}
+		for i, n := range tree.Nodes {
+			if n.Index != i || n.Offset != fresh.Nodes[i].Offset || n.Length != fresh.Nodes[i].Length {
+				t.Errorf("%s: leaf %d is not positioned as built afresh", name, i)
+			}
+		}
+	}
+
+	// appended to, past the short last block
+	data = append(data, bytes.Repeat([]byte("x"), 30)...)
+	check("append", data, []int{}, []int{10, 11, 12})
+
+	// written in place, and told where
+	data[20] = 'X'
+	check("in place", data, []int{1}, []int{1})
+
+	// written in place, and not told where
+	data[100] = 'X'
+	check("unknown", data, nil, []int{6})
+
+	// truncated into a short block
+	data = data[:40]
+	check("truncate", data, []int{}, []int{2})
+
+	if index, ok := tree.FindLeaf(tree.Nodes[2].checksum()); !ok || index != 2 {
+		t.Errorf("expected the leaf index updated, got %d %v", index, ok)
+	}
+
+	if changed, err := tree.Rehash(bytes.NewReader(nil), 0, nil); err != nil || len(changed) != 0 || len(tree.Nodes) != 0 {
+		t.Errorf("expected no leaves of no content, got %d %v", len(tree.Nodes), err)
+	}
+}
@@ -0,0 +1,104 @@
+package merkle
+
+import "sync"
+
+// workDeque is one worker's queue of block indexes. The owner takes from the
+// back, and idle workers steal from the front.
+type workDeque struct {
+	mu    sync.Mutex
+	items []int
+}
+
+func (d *workDeque) pop() (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.items) == 0 {
+		return 0, false
+	}
+	i := d.items[len(d.items)-1]
+	d.items = d.items[:len(d.items)-1]
+	return i, true
+}
+
+func (d *workDeque) steal() (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.items) == 0 {
+		return 0, false
+	}
+	i := d.items[0]
+	d.items = d.items[1:]
+	return i, true
+}
+
+// hashBlocks checksums each of blocks as a leaf Node, in order, across the
+// hash workers. The blocks are split evenly by count, and workers that
+// run out steal from the others, so blocks of very different sizes still keep
+// every worker busy.
+func hashBlocks(hm HashMaker, blocks [][]byte, opts options) ([]*Node, error) {
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+	workers := opts.hashWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(blocks) {
+		workers = len(blocks)
+	}
+	var (
+		nodes  = make([]*Node, len(blocks))
+		deques = make([]*workDeque, workers)
+		per    = (len(blocks) + workers - 1) / workers
+		wg     sync.WaitGroup
+		errMu  sync.Mutex
+		err    error
+	)
+	for w := range deques {
+		deques[w] = &workDeque{}
+		for i := w * per; i < (w+1)*per && i < len(blocks); i++ {
+			deques[w].items = append(deques[w].items, i)
+		}
+	}
+
+	next := func(w int) (int, bool) {
+		if i, ok := deques[w].pop(); ok {
+			return i, true
+		}
+		for v := 1; v < workers; v++ {
+			if i, ok := deques[(w+v)%workers].steal(); ok {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for {
+				i, ok := next(w)
+				if !ok {
+					return
+				}
+				n, e := NewNodeHashBlock(hm, blocks[i])
+				if e != nil {
+					errMu.Lock()
+					if err == nil {
+						err = e
+					}
+					errMu.Unlock()
+					return
+				}
+				nodes[i] = n
+				opts.yield()
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
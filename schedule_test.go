@@ -0,0 +1,66 @@
+package merkle
+
+import (
+	"bytes"
+	"hash"
+	"testing"
+)
+
+func TestHashBlocksStealing(t *testing.T) {
+	// a few huge chunks at the front, to leave the other workers idle if the
+	// work was only split statically
+	var blocks [][]byte
+	for i := 0; i < 4; i++ {
+		blocks = append(blocks, bytes.Repeat([]byte{byte(i)}, 1024*1024))
+	}
+	for i := 0; i < 200; i++ {
+		blocks = append(blocks, []byte{byte(i), byte(i >> 8)})
+	}
+
+	for _, workers := range []int{1, 3, 8} {
+		nodes, err := hashBlocks(DefaultHashMaker, blocks, newOptions([]Option{WithHashWorkers(workers)}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != len(blocks) {
+			t.Fatalf("expected %d nodes, got %d", len(blocks), len(nodes))
+		}
+		for i, n := range nodes {
+			expected, err := NewNodeHashBlock(DefaultHashMaker, blocks[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(n.checksum(), expected.checksum()) {
+				t.Errorf("%d workers: block %d out of order", workers, i)
+			}
+		}
+	}
+
+	if _, err := hashBlocks(func() hash.Hash { return failingHash{DefaultHashMaker()} }, blocks, newOptions(nil)); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestBuilderBuildChunks(t *testing.T) {
+	chunks := [][]byte{[]byte("the quick "), []byte("brown fox jumps"), []byte(" over the lazy"), []byte(" dog")}
+	tree := Tree{}
+	for _, c := range chunks {
+		n, err := NewNodeHashBlock(DefaultHashMaker, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Append(n)
+	}
+	expected, err := tree.Root().Checksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, root, err := NewBuilder(DefaultHashMaker, 0).BuildChunks(chunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root, expected) {
+		t.Errorf("expected root %x; got %x", expected, root)
+	}
+}
@@ -0,0 +1,27 @@
+package merkle
+
+// SecureOptions are the options of NewSecure, for a Builder or DiskBuilder of
+// the same profile:
+//
+//   - WithDomainSeparation, so an interior node can not be passed off as a leaf
+//   - WithFinalBlockPolicy(FinalBlockLengthSuffixed), so a short final block
+//     can not collide with a whole one
+//   - WithLengthCommitment, so the root commits to the length of the input,
+//     the block length and the hash
+//   - WithEmptyRoot, so no input is the canonical EmptyRoot, not an error
+//
+// Trees of this profile do not have the roots of trees built without it.
+func SecureOptions() []Option {
+	return []Option{
+		WithDomainSeparation(),
+		WithFinalBlockPolicy(FinalBlockLengthSuffixed),
+		WithLengthCommitment(),
+		WithEmptyRoot(),
+	}
+}
+
+// NewSecure is New with the SecureOptions, the profile for checksums of
+// untrusted input. Any more options are applied after them.
+func NewSecure(hm HashMaker, blockLength int, opts ...Option) (HashTreeer, error) {
+	return New(hm, blockLength, append(SecureOptions(), opts...)...)
+}
@@ -0,0 +1,49 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"testing"
+)
+
+func TestNewSecure(t *testing.T) {
+	sha256Maker := func() hash.Hash { return sha256.New() }
+	h, err := NewSecure(sha256Maker, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty := sha256.Sum256(nil)
+	if expected := CommitRoot(DomainSeparated(sha256Maker), empty[:], 0, 16); !bytes.Equal(h.Sum(nil), expected) {
+		t.Errorf("expected the committed empty root for no input")
+	}
+
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+	h.Write(msg)
+	b := NewBuilder(sha256Maker, 16, SecureOptions()...)
+	b.Write(msg)
+	tree, root, err := b.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(h.Sum(nil), root) {
+		t.Errorf("expected NewSecure and a Builder of SecureOptions to agree")
+	}
+	if committed, err := tree.CommittedRoot(); err != nil || !bytes.Equal(committed, root) {
+		t.Errorf("expected the root committed to the length of the tree, got %x %v", committed, err)
+	}
+	if tree.FinalBlock != FinalBlockLengthSuffixed {
+		t.Errorf("expected the final block length suffixed; got %s", tree.FinalBlock)
+	}
+	if name, err := HashName(tree.hashMaker()); err != nil || name != "sha256-rfc6962" {
+		t.Errorf("expected a domain separated hash; got %q %v", name, err)
+	}
+
+	_, plain, err := NewBuilder(sha256Maker, 16, WithFinalBlockPolicy(FinalBlockLengthSuffixed)).Build(bytes.NewReader(msg), int64(len(msg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(plain, root) {
+		t.Errorf("expected the secure root to differ from the plain one")
+	}
+}
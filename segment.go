@@ -0,0 +1,128 @@
+package merkle
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// SegmentRoot is the root of the tree of a segment of a partition of a
+// streaming log, as of Kafka: its messages, or batches, from BaseOffset are
+// the leaves
+type SegmentRoot struct {
+	Partition  int    `json:"partition"`
+	BaseOffset int64  `json:"baseOffset"`
+	Count      int    `json:"count"`
+	Root       []byte `json:"root"`
+}
+
+// Next is the offset of the message after the segment, the BaseOffset of the
+// next segment of the partition if there is no gap
+func (s SegmentRoot) Next() int64 {
+	return s.BaseOffset + int64(s.Count)
+}
+
+// leaf is the checksum of the segment in the topic's tree, of its position as
+// well as its root, so a segment can not be passed off as of another
+// partition or offset
+func (s SegmentRoot) leaf(hm HashMaker) []byte {
+	b := appendUvarint(nil, uint64(s.Partition))
+	b = appendUvarint(b, uint64(s.BaseOffset))
+	b = appendUvarint(b, uint64(s.Count))
+	h := hm()
+	h.Write(append(b, s.Root...))
+	return h.Sum(nil)
+}
+
+// ErrSegmentGap is for a segment that does not start at the offset after the
+// last of its partition
+type ErrSegmentGap struct {
+	Partition        int
+	Offset, Expected int64
+}
+
+// Error shows the offset of the segment, against the offset expected
+func (err ErrSegmentGap) Error() string {
+	return fmt.Sprintf("segment of partition %d at offset %d, expected %d", err.Partition, err.Offset, err.Expected)
+}
+
+// TopicTree is a tree of the segments of the partitions of a topic, under a
+// super-root of the topic. A consumer of a segment verifies it is whole and
+// untampered with VerifySegment, and that there is no gap with the Next of
+// the segment before.
+type TopicTree struct {
+	Super    *SuperTree
+	Segments []SegmentRoot // of each leaf of the Super
+
+	hm   HashMaker
+	next map[int]int64 // offset of the next segment of each partition
+}
+
+// NewTopicTree returns an empty TopicTree, of trees checksummed with hm
+func NewTopicTree(hm HashMaker) *TopicTree {
+	return &TopicTree{Super: NewSuperTree(hm), hm: hm, next: map[int]int64{}}
+}
+
+// AddSegment adds the segment of messages of partition from baseOffset, which
+// must follow the last segment added of the partition, and returns its index
+// in the Super
+func (tt *TopicTree) AddSegment(partition int, baseOffset int64, messages [][]byte) (int, error) {
+	if next, ok := tt.next[partition]; ok && baseOffset != next {
+		return 0, ErrSegmentGap{Partition: partition, Offset: baseOffset, Expected: next}
+	}
+	root, err := segmentRoot(tt.hm, messages)
+	if err != nil {
+		return 0, err
+	}
+	s := SegmentRoot{Partition: partition, BaseOffset: baseOffset, Count: len(messages), Root: root}
+	tt.next[partition] = s.Next()
+	tt.Segments = append(tt.Segments, s)
+	name := strconv.Itoa(partition) + "/" + strconv.FormatInt(baseOffset, 10)
+	return tt.Super.AddRoot(name, s.leaf(tt.hm)), nil
+}
+
+// Root is the super-root of the topic
+func (tt *TopicTree) Root() ([]byte, error) {
+	return tt.Super.Root()
+}
+
+// Prove returns the SegmentRoot of the segment at index, and its proof under
+// the super-root
+func (tt *TopicTree) Prove(index int) (SegmentRoot, Proof, error) {
+	if index < 0 || index >= len(tt.Segments) {
+		return SegmentRoot{}, Proof{}, ErrIndexOutOfRange{Index: index, Size: len(tt.Segments)}
+	}
+	path, err := auditPath(tt.hm, index, tt.Super.Roots)
+	if err != nil {
+		return SegmentRoot{}, Proof{}, err
+	}
+	return tt.Segments[index], Proof{Index: index, TreeSize: len(tt.Segments), Path: path}, nil
+}
+
+// VerifySegment checks that messages are the whole of segment s, and that s is
+// proven under topicRoot by p
+func VerifySegment(hm HashMaker, topicRoot []byte, s SegmentRoot, p Proof, messages [][]byte) error {
+	if len(messages) != s.Count {
+		return ErrLengthMismatch{Blocks: len(messages), Expected: s.Count}
+	}
+	root, err := segmentRoot(hm, messages)
+	if err != nil {
+		return err
+	}
+	if !equalChecksums(root, s.Root) {
+		return ErrTreeHashMismatch
+	}
+	return VerifyProof(hm, topicRoot, p, s.leaf(hm))
+}
+
+// segmentRoot is the root of the tree of messages, a leaf each
+func segmentRoot(hm HashMaker, messages [][]byte) ([]byte, error) {
+	sums := make([][]byte, len(messages))
+	for i, m := range messages {
+		n, err := NewNodeHashBlock(hm, m)
+		if err != nil {
+			return nil, err
+		}
+		sums[i] = n.checksum()
+	}
+	return subtreeHash(hm, sums)
+}
@@ -0,0 +1,55 @@
+package merkle
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTopicTree(t *testing.T) {
+	messages := func(partition int, base, count int) [][]byte {
+		var m [][]byte
+		for i := 0; i < count; i++ {
+			m = append(m, []byte(fmt.Sprintf("p%d message %d", partition, base+i)))
+		}
+		return m
+	}
+	tt := NewTopicTree(DefaultHashMaker)
+	for _, s := range []struct{ partition, base, count int }{
+		{0, 0, 5}, {1, 100, 3}, {0, 5, 4}, {1, 103, 2},
+	} {
+		if _, err := tt.AddSegment(s.partition, int64(s.base), messages(s.partition, s.base, s.count)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tt.AddSegment(0, 10, messages(0, 10, 1)); err != (ErrSegmentGap{Partition: 0, Offset: 10, Expected: 9}) {
+		t.Errorf("expected a gap in partition 0, got %v", err)
+	}
+	root, err := tt.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, p, err := tt.Prove(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Partition != 0 || s.BaseOffset != 5 || s.Next() != 9 {
+		t.Errorf("expected the second segment of partition 0, got %+v", s)
+	}
+	m := messages(0, 5, 4)
+	if err := VerifySegment(DefaultHashMaker, root, s, p, m); err != nil {
+		t.Error(err)
+	}
+	if err := VerifySegment(DefaultHashMaker, root, s, p, m[:3]); err == nil {
+		t.Errorf("expected a segment missing a message to fail")
+	}
+	m[1] = []byte("tampered")
+	if err := VerifySegment(DefaultHashMaker, root, s, p, m); err != ErrTreeHashMismatch {
+		t.Errorf("expected ErrTreeHashMismatch of a tampered message, got %v", err)
+	}
+	moved := s
+	moved.Partition = 1
+	if err := VerifySegment(DefaultHashMaker, root, moved, p, messages(0, 5, 4)); err != ErrTreeHashMismatch {
+		t.Errorf("expected a segment of another partition to fail, got %v", err)
+	}
+}
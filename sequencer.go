@@ -0,0 +1,172 @@
+package merkle
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrSequencerClosed is returned for leaves added after the Sequencer is closed
+var ErrSequencerClosed = errors.New("sequencer is closed")
+
+// Sequencer is an ingestion queue in front of a Tree. Concurrent calls to
+// AddLeaf are batched into single appends on the Tree, so writers do not
+// contend on it.
+//
+// The Sequencer owns the Tree while it is running. The Tree must not be
+// modified elsewhere until Close() has returned. Its interior is cached, so
+// the proofs of a batch are of the subtrees over the leaves appended alone.
+type Sequencer struct {
+	tree     *Tree
+	hm       HashMaker
+	maxBatch int
+	seen     map[string]int // leaf checksum to index, when deduplicating
+
+	queue     chan *LeafFuture
+	done      chan struct{}
+	closeOnce sync.Once
+	mu        sync.RWMutex // guards sending on queue against Close
+	closed    bool
+}
+
+// NewSequencer starts a Sequencer appending to t, with leaves checksummed by
+// hm. At most maxBatch leaves are appended at once. If dedup is true, adding a
+// leaf identical to one already in the tree resolves to the existing index
+// rather than appending it again.
+func NewSequencer(t *Tree, hm HashMaker, maxBatch int, dedup bool) *Sequencer {
+	if maxBatch < 1 {
+		maxBatch = 1
+	}
+	s := &Sequencer{
+		tree:     t,
+		hm:       hm,
+		maxBatch: maxBatch,
+		queue:    make(chan *LeafFuture, maxBatch),
+		done:     make(chan struct{}),
+	}
+	if dedup {
+		s.seen = map[string]int{}
+		for i, n := range t.Nodes {
+			if c, err := n.Checksum(); err == nil {
+				if _, ok := s.seen[string(c)]; !ok {
+					s.seen[string(c)] = i
+				}
+			}
+		}
+	}
+	t.CacheInterior()
+	go s.run()
+	return s
+}
+
+// LeafFuture resolves to the position of an added leaf, and its proof of
+// inclusion in the tree just after the leaf's batch was appended
+type LeafFuture struct {
+	node   *Node
+	length int // of the block
+	done   chan struct{}
+	index  int
+	proof  Proof
+	err    error
+}
+
+// Done is closed once the future is resolved
+func (f *LeafFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the leaf is sequenced, and returns its index and proof
+func (f *LeafFuture) Wait() (int, Proof, error) {
+	<-f.done
+	return f.index, f.proof, f.err
+}
+
+func (f *LeafFuture) resolve(index int, proof Proof, err error) {
+	f.index, f.proof, f.err = index, proof, err
+	close(f.done)
+}
+
+// AddLeaf queues the block b to be appended to the tree as a leaf. The
+// checksum of b is calculated in the calling goroutine.
+func (s *Sequencer) AddLeaf(b []byte) *LeafFuture {
+	f := &LeafFuture{done: make(chan struct{})}
+	n, err := NewNodeHashBlock(s.hm, b)
+	if err != nil {
+		f.resolve(-1, Proof{}, err)
+		return f
+	}
+	f.node, f.length = n, len(b)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		f.resolve(-1, Proof{}, ErrSequencerClosed)
+		return f
+	}
+	s.queue <- f
+	return f
+}
+
+// Close stops accepting leaves, and waits for the queued leaves to be
+// sequenced
+func (s *Sequencer) Close() error {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		close(s.queue)
+		s.mu.Unlock()
+	})
+	<-s.done
+	return nil
+}
+
+func (s *Sequencer) run() {
+	defer close(s.done)
+	batch := make([]*LeafFuture, 0, s.maxBatch)
+	for f := range s.queue {
+		batch = append(batch[:0], f)
+	fill:
+		for len(batch) < s.maxBatch {
+			select {
+			case f, ok := <-s.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, f)
+			default:
+				break fill
+			}
+		}
+		s.sequence(batch)
+	}
+}
+
+// sequence appends one batch to the tree, then resolves its futures
+func (s *Sequencer) sequence(batch []*LeafFuture) {
+	var (
+		indexes = make([]int, len(batch))
+		next    = len(s.tree.Nodes)
+	)
+	for i, f := range batch {
+		if s.seen != nil {
+			key := string(f.node.checksum())
+			if idx, ok := s.seen[key]; ok {
+				indexes[i] = idx
+				continue
+			}
+			s.seen[key] = next
+		}
+		indexes[i] = next
+		s.tree.appendLeaf(f.node, f.length)
+		s.tree.length += int64(f.length)
+		next++
+	}
+
+	proofs, err := s.tree.inclusionProofs(indexes)
+	for i, f := range batch {
+		if err != nil {
+			f.resolve(indexes[i], Proof{}, err)
+			continue
+		}
+		f.resolve(indexes[i], proofs[i], nil)
+	}
+}
@@ -0,0 +1,72 @@
+package merkle
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestSequencer(t *testing.T) {
+	var (
+		tree    = &Tree{BlockLength: 1}
+		s       = NewSequencer(tree, DefaultHashMaker, 8, true)
+		futures = make([]*LeafFuture, 100)
+		wg      sync.WaitGroup
+	)
+	for i := range futures {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// every other leaf is a duplicate
+			futures[i] = s.AddLeaf([]byte{byte(i / 2)})
+		}(i)
+	}
+	wg.Wait()
+	for _, f := range futures {
+		<-f.Done()
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[int]int{}
+	for i, f := range futures {
+		index, p, err := f.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[index]++
+		root, err := (&Tree{Nodes: tree.Nodes[:p.TreeSize]}).Root().Checksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := rootFromProof(DefaultHashMaker, p, tree.Nodes[index].checksum())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, root) {
+			t.Errorf("leaf %d: proof does not lead to the root at size %d", i, p.TreeSize)
+		}
+	}
+
+	if len(tree.Nodes) != 50 {
+		t.Errorf("expected 50 deduplicated leaves, got %d", len(tree.Nodes))
+	}
+	for i, n := range tree.Nodes {
+		if n.Index != i || n.Offset != int64(i) || n.Length != 1 {
+			t.Errorf("leaf %d: expected the position of its block, got %d %d %d", i, n.Index, n.Offset, n.Length)
+		}
+	}
+	if tree.TotalLength() != 50 {
+		t.Errorf("expected 50 bytes sequenced, got %d", tree.TotalLength())
+	}
+	for index, count := range seen {
+		if count != 2 {
+			t.Errorf("expected index %d to be returned twice, got %d", index, count)
+		}
+	}
+
+	if _, _, err := s.AddLeaf([]byte("late")).Wait(); err != ErrSequencerClosed {
+		t.Errorf("expected %q, got %v", ErrSequencerClosed, err)
+	}
+}
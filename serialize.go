@@ -0,0 +1,390 @@
+package merkle
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+var (
+	hashRegistryMu sync.RWMutex
+	hashRegistry   = map[string]HashMaker{}
+)
+
+func init() {
+	RegisterHash("sha1", func() hash.Hash { return sha1.New() })
+	RegisterHash("sha224", func() hash.Hash { return sha256.New224() })
+	RegisterHash("sha256", func() hash.Hash { return sha256.New() })
+	RegisterHash("sha384", func() hash.Hash { return sha512.New384() })
+	RegisterHash("sha512", func() hash.Hash { return sha512.New() })
+}
+
+// RegisterHash associates name with a HashMaker, so serialized trees can name
+// the checksum of their nodes. The sha1, sha224, sha256, sha384 and sha512
+// hashes are registered already.
+func RegisterHash(name string, hm HashMaker) {
+	hashRegistryMu.Lock()
+	defer hashRegistryMu.Unlock()
+	hashRegistry[name] = hm
+}
+
+// LookupHash returns the HashMaker registered with name
+func LookupHash(name string) (HashMaker, bool) {
+	hashRegistryMu.RLock()
+	hm, ok := hashRegistry[name]
+	hashRegistryMu.RUnlock()
+	if !ok {
+		return lookupDomainSeparated(name)
+	}
+	return hm, true
+}
+
+// RegisteredHashes returns the names of the hashes registered, sorted. Each
+// is also of a DomainSeparated hash, with "-rfc6962" after it.
+func RegisteredHashes() []string {
+	hashRegistryMu.RLock()
+	defer hashRegistryMu.RUnlock()
+	names := make([]string, 0, len(hashRegistry))
+	for name := range hashRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ErrUnknownHash is for a hash that is not registered
+type ErrUnknownHash struct {
+	Name string
+}
+
+// Error shows the name of the hash, if known
+func (err ErrUnknownHash) Error() string {
+	if err.Name == "" {
+		return "hash is not registered"
+	}
+	return fmt.Sprintf("hash %q is not registered", err.Name)
+}
+
+// HashName returns the name a HashMaker is registered with. As functions can
+// not be compared, this matches on the type and size of the hash.Hash made.
+// A DomainSeparated HashMaker is the name of its hash with "-rfc6962" after it.
+func HashName(hm HashMaker) (string, error) {
+	h, separated := unwrapHash(hm())
+	hashRegistryMu.RLock()
+	defer hashRegistryMu.RUnlock()
+	for name, rhm := range hashRegistry {
+		if sameHashes(rhm(), h) {
+			if separated {
+				name += domainSuffix
+			}
+			return name, nil
+		}
+	}
+	return "", ErrUnknownHash{}
+}
+
+// serializedMagic starts the binary form of a Tree
+var serializedMagic = []byte("MRKL")
+
+// serializedVersion is the current version of the binary form. Version 1 is
+// without the lengths of the leaves of trees of no BlockLength, and version 2
+// is without the Bloom filter.
+const serializedVersion = 3
+
+// ErrMalformedTree is for a serialized tree that can not be decoded
+var ErrMalformedTree = errors.New("malformed serialized tree")
+
+// ErrInconsistentField is for a decoded tree or proof with a field inconsistent
+// with the others, as from an untrusted peer
+type ErrInconsistentField struct {
+	Field  string
+	Reason string
+}
+
+func (err ErrInconsistentField) Error() string {
+	return fmt.Sprintf("malformed %s: %s", err.Field, err.Reason)
+}
+
+// Is matches ErrMalformedTree, for errors.Is of any malformed input
+func (err ErrInconsistentField) Is(target error) bool {
+	return target == ErrMalformedTree
+}
+
+// checkTreeShape checks the parameters of a decoded tree against each other,
+// before its leaves are allocated: the policy must be known, and a tree of a
+// known length in blocks must have a leaf of each block. It may have more, as
+// appended leaves do not add to the length.
+func checkTreeShape(policy FinalBlockPolicy, blockLength, length, leaves uint64) error {
+	if _, ok := finalBlockPolicyNames[policy]; !ok {
+		return ErrInconsistentField{Field: "final block", Reason: fmt.Sprintf("unknown policy %d", int(policy))}
+	}
+	if blockLength > 0 && length > 0 {
+		if blocks := (length-1)/blockLength + 1; leaves < blocks {
+			return ErrInconsistentField{Field: "leaves", Reason: fmt.Sprintf("%d for %d blocks of %d bytes", leaves, blocks, blockLength)}
+		}
+	}
+	return nil
+}
+
+// MarshalBinary encodes the tree's parameters and the checksums of its leaves.
+//
+// The form is the magic "MRKL" and a version byte, then the length prefixed
+// name of the hash, the FinalBlock policy byte, and uvarints of the
+// BlockLength, TotalLength, count of leaves and checksum size, followed by the
+// concatenated leaf checksums. A tree of no BlockLength, as of chunks of
+// varying size, is then followed by uvarints of the length of each leaf. Last
+// is a uvarint of the length of the encoded Bloom filter, 0 for none, and the
+// filter.
+func (t *Tree) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := t.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteTo writes the form of MarshalBinary to w, a leaf at a time
+func (t *Tree) WriteTo(w io.Writer) (int64, error) {
+	tf, err := t.fields()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		cw  = &countingWriter{w: w}
+		bw  = bufio.NewWriter(cw)
+		tmp [binary.MaxVarintLen64]byte
+	)
+	// the errors of bw are sticky, and returned by Flush
+	putUvarint := func(v uint64) {
+		bw.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+	}
+	bw.Write(serializedMagic)
+	bw.WriteByte(serializedVersion)
+	bw.WriteByte(byte(len(tf.Hash)))
+	bw.WriteString(tf.Hash)
+	bw.WriteByte(byte(tf.FinalBlock))
+	putUvarint(uint64(tf.BlockLength))
+	putUvarint(uint64(tf.Length))
+	putUvarint(uint64(len(tf.Leaves)))
+	putUvarint(uint64(t.hashMaker()().Size()))
+	for _, sum := range tf.Leaves {
+		bw.Write(sum)
+	}
+	for _, l := range tf.Lengths {
+		putUvarint(uint64(l))
+	}
+	putUvarint(uint64(len(tf.Bloom)))
+	bw.Write(tf.Bloom)
+	err = bw.Flush()
+	return cw.n, err
+}
+
+// UnmarshalBinary decodes a tree encoded by MarshalBinary. The hash it names
+// must be registered. The leaves are positioned as the blocks they are of.
+func (t *Tree) UnmarshalBinary(data []byte) error {
+	return t.unmarshalBinary(data, DefaultDecodeLimits())
+}
+
+// unmarshalBinary is UnmarshalBinary of the limits l
+func (t *Tree) unmarshalBinary(data []byte, l DecodeLimits) error {
+	_, err := t.readFrom(bytes.NewReader(data), l)
+	return err
+}
+
+// ReadFrom decodes a tree of the form of MarshalBinary from r, a leaf at a
+// time, until io.EOF. Bytes after the tree are an ErrMalformedTree, and a tree
+// beyond the DefaultDecodeLimits an ErrLimitExceeded.
+func (t *Tree) ReadFrom(r io.Reader) (int64, error) {
+	return t.readFrom(r, DefaultDecodeLimits())
+}
+
+// readFrom is ReadFrom of the limits l
+func (t *Tree) readFrom(r io.Reader, l DecodeLimits) (int64, error) {
+	var (
+		cr = &countingReader{r: l.reader(r)}
+		br = bufio.NewReader(cr)
+	)
+	tree, err := readTree(br, l)
+	if err == nil {
+		if _, err = br.ReadByte(); err == io.EOF {
+			*t = *tree
+			return cr.n, nil
+		} else if err == nil {
+			err = ErrMalformedTree
+		}
+	}
+	return cr.n, err
+}
+
+// initialLeaves caps the leaves allocated ahead of reading them, as the count
+// of a header is not to be trusted
+const initialLeaves = 1 << 16
+
+func readTree(br *bufio.Reader, l DecodeLimits) (*Tree, error) {
+	th, err := readTreeHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if th.size == 0 {
+		return nil, ErrMalformedTree
+	}
+	if err := l.checkLeaves(th.leaves); err != nil {
+		return nil, err
+	}
+	capacity := th.leaves
+	if capacity > initialLeaves {
+		capacity = initialLeaves
+	}
+	var (
+		nodes = make([]*Node, 0, capacity)
+		slab  = newLeafSlab(th.hm)
+	)
+	for i := uint64(0); i < th.leaves; i++ {
+		n := slab.take()
+		if _, err := io.ReadFull(br, n.checksum()); err != nil {
+			return nil, malformed(err)
+		}
+		nodes = append(nodes, n)
+	}
+	tree := &Tree{
+		Nodes:       nodes,
+		BlockLength: int(th.blockLength),
+		FinalBlock:  th.policy,
+		length:      int64(th.length),
+	}
+	if th.version >= 2 && th.blockLength == 0 {
+		var offset uint64
+		for i, n := range nodes {
+			l, err := binary.ReadUvarint(br)
+			if err != nil {
+				return nil, malformed(err)
+			}
+			if l > uint64(maxInt) || offset+l > th.length {
+				return nil, ErrMalformedTree
+			}
+			n.Index, n.Offset, n.Length = i, int64(offset), int(l)
+			offset += l
+		}
+		if offset != th.length {
+			return nil, ErrMalformedTree
+		}
+	} else if th.blockLength > 0 {
+		tree.setPositions()
+	}
+	if th.version >= 3 {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, malformed(err)
+		}
+		if n > 0 {
+			filter, err := ioutil.ReadAll(io.LimitReader(br, int64(n)))
+			if err != nil {
+				return nil, err
+			}
+			if uint64(len(filter)) != n {
+				return nil, ErrMalformedTree
+			}
+			tree.bloom = &BloomFilter{}
+			if err := tree.bloom.UnmarshalBinary(filter); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return tree, nil
+}
+
+// malformed is an ErrMalformedTree for input that ends early, or err
+func malformed(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrMalformedTree
+	}
+	return err
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// treeHeader is the parameters of a serialized tree, preceding its leaves
+type treeHeader struct {
+	version                           byte
+	hm                                HashMaker
+	policy                            FinalBlockPolicy
+	blockLength, length, leaves, size uint64
+}
+
+func readTreeHeader(r io.ByteReader) (treeHeader, error) {
+	var th treeHeader
+	for _, c := range serializedMagic {
+		if b, err := r.ReadByte(); err != nil || b != c {
+			return th, ErrMalformedTree
+		}
+	}
+	version, err := r.ReadByte()
+	if err != nil {
+		return th, ErrMalformedTree
+	}
+	if version < 1 || version > serializedVersion {
+		return th, fmt.Errorf("unsupported serialized tree version %d", version)
+	}
+	nameLen, err := r.ReadByte()
+	if err != nil {
+		return th, ErrMalformedTree
+	}
+	name := make([]byte, nameLen)
+	for i := range name {
+		if name[i], err = r.ReadByte(); err != nil {
+			return th, ErrMalformedTree
+		}
+	}
+	hm, ok := LookupHash(string(name))
+	if !ok {
+		return th, ErrUnknownHash{Name: string(name)}
+	}
+	policy, err := r.ReadByte()
+	if err != nil {
+		return th, ErrMalformedTree
+	}
+
+	var fields [4]uint64 // block length, total length, leaves, checksum size
+	for i := range fields {
+		if fields[i], err = binary.ReadUvarint(r); err != nil {
+			return th, ErrMalformedTree
+		}
+	}
+	th = treeHeader{
+		version:     version,
+		hm:          hm,
+		policy:      FinalBlockPolicy(policy),
+		blockLength: fields[0],
+		length:      fields[1],
+		leaves:      fields[2],
+		size:        fields[3],
+	}
+	if th.blockLength > uint64(maxInt) || th.length > 1<<63-1 || th.leaves > uint64(maxInt) {
+		return th, ErrMalformedTree
+	}
+	if size := hm().Size(); th.size != uint64(size) {
+		return th, ErrInconsistentField{Field: "checksum size", Reason: fmt.Sprintf("%d bytes, expected %d of %s", th.size, size, name)}
+	}
+	return th, checkTreeShape(th.policy, th.blockLength, th.length, th.leaves)
+}
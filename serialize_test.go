@@ -0,0 +1,210 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestTreeBinaryRoundTrip(t *testing.T) {
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+	sha256Maker := func() hash.Hash { return sha256.New() }
+	for _, hm := range []HashMaker{DefaultHashMaker, sha256Maker} {
+		b := NewBuilder(hm, 10, WithFinalBlockPolicy(FinalBlockLengthSuffixed))
+		if _, err := b.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		tree, root, err := b.Finalize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := tree.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Tree
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if got.BlockLength != 10 || got.FinalBlock != FinalBlockLengthSuffixed || got.TotalLength() != int64(len(msg)) {
+			t.Errorf("parameters not preserved: %d %s %d", got.BlockLength, got.FinalBlock, got.TotalLength())
+		}
+		gotRoot, err := got.RootChecksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(gotRoot, root) {
+			t.Errorf("expected root %x; got %x", root, gotRoot)
+		}
+
+		for _, bad := range [][]byte{nil, data[:4], data[:len(data)-1], append(append([]byte{}, data...), 0)} {
+			if err := got.UnmarshalBinary(bad); err == nil {
+				t.Errorf("expected an error for %d bytes of %d", len(bad), len(data))
+			}
+		}
+	}
+}
+
+func TestHashName(t *testing.T) {
+	name, err := HashName(DefaultHashMaker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "sha1" {
+		t.Errorf("expected sha1, got %q", name)
+	}
+	if _, err := HashName(func() hash.Hash { return failingHash{DefaultHashMaker()} }); err == nil {
+		t.Errorf("expected an unregistered hash to have no name")
+	}
+}
+
+func TestTreeBinaryPositions(t *testing.T) {
+	chunks := [][]byte{[]byte("abc"), []byte("defgh"), []byte("i")}
+	tree, _, err := NewBuilder(DefaultHashMaker, 0).BuildChunks(chunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Tree
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []struct {
+		offset int64
+		length int
+	}{{0, 3}, {3, 5}, {8, 1}} {
+		n := got.Nodes[i]
+		if n.Index != i || n.Offset != expected.offset || n.Length != expected.length {
+			t.Errorf("leaf %d: expected offset %d and length %d, got %d %d %d", i, expected.offset, expected.length, n.Index, n.Offset, n.Length)
+		}
+	}
+	if err := got.UnmarshalBinary(data[:len(data)-2]); err == nil {
+		t.Errorf("expected an error for missing leaf lengths")
+	}
+
+	// version 1, of a tree of whole blocks, is still decoded
+	fixed, _, err := NewBuilder(DefaultHashMaker, 4).Build(bytes.NewReader([]byte("0123456789")), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err = fixed.MarshalBinary(); err != nil {
+		t.Fatal(err)
+	}
+	// as is version 2
+	v2 := append([]byte(nil), data[:len(data)-1]...)
+	v2[len(serializedMagic)] = 2
+	if err := got.UnmarshalBinary(v2); err != nil || len(got.Nodes) != 3 {
+		t.Errorf("expected version 2 decoded, got %d leaves %v", len(got.Nodes), err)
+	}
+	// which is without the trailing length of the Bloom filter
+	data[len(serializedMagic)] = 1
+	data = data[:len(data)-1]
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if last := got.Nodes[2]; last.Index != 2 || last.Offset != 8 || last.Length != 2 {
+		t.Errorf("expected the last leaf at 8 of 2 bytes, got %d %d %d", last.Index, last.Offset, last.Length)
+	}
+
+	// leaves appended past the length are of no length
+	fixed.Append(fixed.Nodes[0].leafCopy())
+	if data, err = fixed.MarshalBinary(); err != nil {
+		t.Fatal(err)
+	}
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if last := got.Nodes[3]; last.Offset != 12 || last.Length != 0 {
+		t.Errorf("expected the appended leaf at 12 of no length, got %d %d", last.Offset, last.Length)
+	}
+}
+
+func TestTreeWriteToReadFrom(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	tree, _, err := NewBuilder(DefaultHashMaker, 16, WithBloomFilter(0.01)).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	n, err := tree.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) || !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("expected WriteTo to write the %d bytes of MarshalBinary, got %d", len(expected), n)
+	}
+
+	var got Tree
+	if n, err = got.ReadFrom(iotest.OneByteReader(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(expected)) {
+		t.Errorf("expected %d bytes read, got %d", len(expected), n)
+	}
+	if !got.Equal(tree) || got.Bloom() == nil {
+		t.Errorf("expected the tree read to equal the tree written")
+	}
+
+	if _, err := got.ReadFrom(io.MultiReader(bytes.NewReader(expected), bytes.NewReader([]byte{0}))); err != ErrMalformedTree {
+		t.Errorf("expected trailing bytes to be malformed, got %v", err)
+	}
+	if _, err := got.ReadFrom(iotest.TimeoutReader(bytes.NewReader(expected))); err != iotest.ErrTimeout {
+		t.Errorf("expected the error of the reader, got %v", err)
+	}
+}
+
+func TestRegisteredHashesRoundTrip(t *testing.T) {
+	msg := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog"), 10)
+	for _, registered := range RegisteredHashes() {
+		for _, name := range []string{registered, registered + domainSuffix} {
+			hm, ok := LookupHash(name)
+			if !ok {
+				t.Fatalf("expected %q to be registered", name)
+			}
+			if got, err := HashName(hm); err != nil || got != name {
+				t.Errorf("expected the name %q, got %q, %v", name, got, err)
+			}
+			tree, err := SumOf(hm, 64, msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			root, _ := tree.RootChecksum()
+
+			binary, err := tree.MarshalBinary()
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			json, err := tree.MarshalJSON()
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			var fromBinary, fromJSON Tree
+			if err := fromBinary.UnmarshalBinary(binary); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			if err := fromJSON.UnmarshalJSON(json); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			for form, got := range map[string]*Tree{"binary": &fromBinary, "JSON": &fromJSON} {
+				gotRoot, err := got.RootChecksum()
+				if err != nil || !bytes.Equal(gotRoot, root) {
+					t.Errorf("%s %s: expected the root %x, got %x, %v", name, form, root, gotRoot, err)
+				}
+				if gotName, _ := HashName(got.hashMaker()); gotName != name {
+					t.Errorf("%s %s: expected the hash %q, got %q", name, form, name, gotName)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package merkle
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Session is the state of an upload or verification of an object, to persist
+// (as JSON) while it is in progress, so an interrupted transfer resumes from
+// the last block done rather than from the start.
+//
+// Offset and Frontier cover the blocks done from the start of the object. An
+// upload also records the parts done beyond that, as parts finish out of
+// order.
+type Session struct {
+	Hash        string         `json:"hash"` // as registered, see RegisterHash
+	BlockLength int            `json:"blockLength"`
+	PartSize    int            `json:"partSize,omitempty"`
+	Offset      int64          `json:"offset"`
+	Frontier    SubtreeSummary `json:"frontier"`
+	Parts       []PartStatus   `json:"parts,omitempty"`
+}
+
+// PartStatus is a part done beyond the Offset of a Session, by its size and
+// the summary of its leaves
+type PartStatus struct {
+	Number  int            `json:"number"`
+	Size    int64          `json:"size"`
+	Summary SubtreeSummary `json:"summary"`
+}
+
+// NewSession returns the Session of a transfer yet to start. partSize is 0 for
+// a verification.
+func NewSession(hm HashMaker, blockLength, partSize int) (*Session, error) {
+	name, err := HashName(hm)
+	if err != nil {
+		return nil, err
+	}
+	if blockLength < MinBlockSize {
+		return nil, ErrInvalidBlockLength{Length: blockLength}
+	}
+	return &Session{Hash: name, BlockLength: blockLength, PartSize: partSize}, nil
+}
+
+func (s *Session) hashMaker() (HashMaker, error) {
+	hm, ok := LookupHash(s.Hash)
+	if !ok {
+		return nil, ErrUnknownHash{Name: s.Hash}
+	}
+	return hm, nil
+}
+
+// partDone is whether the part is covered by the Offset, or recorded as done
+func (s *Session) partDone(number int) bool {
+	if int64(number)*int64(s.PartSize) <= s.Offset {
+		return true
+	}
+	for _, p := range s.Parts {
+		if p.Number == number {
+			return true
+		}
+	}
+	return false
+}
+
+// addPart records a part of size bytes as done, and advances the Offset over
+// the parts done from it
+func (s *Session) addPart(hm HashMaker, number int, size int64, summary SubtreeSummary) error {
+	s.Parts = append(s.Parts, PartStatus{Number: number, Size: size, Summary: summary})
+	for advanced := true; advanced; {
+		advanced = false
+		for i, p := range s.Parts {
+			if p.Summary.Start != s.Frontier.End {
+				continue
+			}
+			combined, err := CombineSubtrees(hm, s.Frontier, p.Summary)
+			if err != nil {
+				return err
+			}
+			s.Frontier = combined
+			s.Offset = int64(p.Number-1)*int64(s.PartSize) + p.Size
+			s.Parts = append(s.Parts[:i], s.Parts[i+1:]...)
+			advanced = true
+			break
+		}
+	}
+	return nil
+}
+
+// Resume uploads the parts of the object r, of size bytes, that the session
+// does not have as done, updating the session as each part is done, and
+// returns the root of the object once every part is. Progress, when set, is
+// called with the updated session after each part, to persist it.
+func (u *Uploader) Resume(s *Session, r io.ReaderAt, size int64) ([]byte, error) {
+	hm, err := s.hashMaker()
+	if err != nil {
+		return nil, err
+	}
+	if s.BlockLength != u.blockLength || s.PartSize != u.PartSize {
+		return nil, fmt.Errorf("session of block length %d and part size %d does not match the uploader", s.BlockLength, s.PartSize)
+	}
+	if u.blockLength < MinBlockSize || u.PartSize < u.blockLength || u.PartSize%u.blockLength != 0 {
+		return nil, fmt.Errorf("part size %d is not a multiple of block length %d", u.PartSize, u.blockLength)
+	}
+	count := int((size + int64(u.PartSize) - 1) / int64(u.PartSize))
+	if count == 0 {
+		count = 1
+	}
+	workers := u.Concurrency
+	if workers < 1 {
+		workers = 4
+	}
+
+	var (
+		numbers = make(chan int)
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		errs    []error
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for number := range numbers {
+				err := u.resumePart(s, hm, &mu, r, size, number)
+				if err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for number := 1; number <= count; number++ {
+		mu.Lock()
+		done, failed := s.partDone(number), len(errs) > 0
+		mu.Unlock()
+		if failed {
+			break
+		}
+		if !done {
+			numbers <- number
+		}
+	}
+	close(numbers)
+	wg.Wait()
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	if s.Offset != size {
+		return nil, fmt.Errorf("session is at offset %d of %d", s.Offset, size)
+	}
+	if size == 0 {
+		return EmptyRoot(hm), nil
+	}
+	return s.Frontier.Root(hm)
+}
+
+func (u *Uploader) resumePart(s *Session, hm HashMaker, mu *sync.Mutex, r io.ReaderAt, size int64, number int) error {
+	off := int64(number-1) * int64(u.PartSize)
+	n := size - off
+	if n > int64(u.PartSize) {
+		n = int64(u.PartSize)
+	}
+	data := make([]byte, n)
+	if _, err := r.ReadAt(data, off); err != nil && !(err == io.EOF && n == int64(len(data))) {
+		return err
+	}
+	nodes, err := u.part(uploadPart{number: number, data: data})
+	if err != nil {
+		return err
+	}
+	sums := make([][]byte, len(nodes))
+	for i, node := range nodes {
+		sums[i] = node.checksum()
+	}
+	summary, err := SummarizeLeaves(hm, int(off/int64(u.blockLength)), sums)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if err := s.addPart(hm, number, n, summary); err != nil {
+		return err
+	}
+	if u.Progress != nil {
+		u.Progress(*s)
+	}
+	return nil
+}
+
+// SessionVerifier verifies an object against its root as it is written,
+// resuming from the Offset of a Session
+type SessionVerifier struct {
+	s       *Session
+	hm      HashMaker
+	root    []byte
+	partial []byte // of the block being written
+}
+
+// NewSessionVerifier returns a SessionVerifier of the object with root, to be
+// written the bytes of the object from the session's Offset
+func NewSessionVerifier(s *Session, root []byte) (*SessionVerifier, error) {
+	hm, err := s.hashMaker()
+	if err != nil {
+		return nil, err
+	}
+	if s.Offset%int64(s.BlockLength) != 0 {
+		return nil, fmt.Errorf("session offset %d is not on a block boundary", s.Offset)
+	}
+	return &SessionVerifier{s: s, hm: hm, root: root}, nil
+}
+
+// Write hashes whole blocks into the session, advancing its Offset
+func (sv *SessionVerifier) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := sv.s.BlockLength - len(sv.partial)
+		if n > len(p) {
+			n = len(p)
+		}
+		sv.partial = append(sv.partial, p[:n]...)
+		p = p[n:]
+		if len(sv.partial) == sv.s.BlockLength {
+			if err := sv.block(); err != nil {
+				return written - len(p), err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (sv *SessionVerifier) block() error {
+	leaf, err := NewNodeHashBlock(sv.hm, sv.partial)
+	if err != nil {
+		return err
+	}
+	f := sv.s.Frontier
+	combined, err := CombineSubtrees(sv.hm, f, SubtreeSummary{Start: f.End, End: f.End + 1, Frontier: [][]byte{leaf.checksum()}})
+	if err != nil {
+		return err
+	}
+	sv.s.Frontier = combined
+	sv.s.Offset += int64(len(sv.partial))
+	sv.partial = sv.partial[:0]
+	return nil
+}
+
+// Close hashes the final block, and checks the root of the object written
+func (sv *SessionVerifier) Close() (err error) {
+	if sink := auditing(); sink != nil {
+		defer func(start time.Time) {
+			audit(sink, AuditEvent{Kind: "session", Root: sv.root, Index: -1}, start, err)
+		}(time.Now())
+	}
+	if len(sv.partial) > 0 {
+		if err := sv.block(); err != nil {
+			return err
+		}
+	}
+	root, err := sv.s.Frontier.Root(sv.hm)
+	if err == ErrEmptyTree {
+		root, err = EmptyRoot(sv.hm), nil
+	}
+	if err != nil {
+		return err
+	}
+	if !equalChecksums(root, sv.root) {
+		return ErrTreeHashMismatch
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// flakyPartStore fails the parts in fail, once each
+type flakyPartStore struct {
+	memPartStore
+	failOnce map[int]bool
+}
+
+func (s *flakyPartStore) UploadPart(number int, data []byte) ([]byte, error) {
+	s.mu.Lock()
+	fail := s.failOnce[number]
+	delete(s.failOnce, number)
+	s.mu.Unlock()
+	if fail {
+		return nil, errors.New("connection reset")
+	}
+	return s.memPartStore.UploadPart(number, data)
+}
+
+func TestUploaderResume(t *testing.T) {
+	data := make([]byte, 100*1024+77)
+	rand.New(rand.NewSource(7)).Read(data)
+	_, root, err := NewBuilder(DefaultHashMaker, 1024).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &flakyPartStore{memPartStore: memPartStore{parts: map[int][]byte{}}, failOnce: map[int]bool{3: true}}
+	u := NewUploader(store, DefaultHashMaker, 1024, 16*1024)
+	u.Concurrency = 1
+	var (
+		mu        sync.Mutex
+		persisted []byte
+	)
+	u.Progress = func(s Session) {
+		buf, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		persisted = buf
+		mu.Unlock()
+	}
+	s, err := NewSession(DefaultHashMaker, 1024, 16*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Resume(s, bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Fatal("expected the interrupted upload to fail")
+	}
+	if s.Offset != 2*16*1024 {
+		t.Errorf("expected the session at the end of part 2, got %d", s.Offset)
+	}
+
+	// resume from the persisted session, as after a restart
+	var resumed Session
+	if err := json.Unmarshal(persisted, &resumed); err != nil {
+		t.Fatal(err)
+	}
+	uploaded := len(store.parts)
+	got, err := u.Resume(&resumed, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, root) {
+		t.Errorf("expected root %x, got %x", root, got)
+	}
+	if !bytes.Equal(store.object(), data) || uploaded == 0 {
+		t.Errorf("expected the object uploaded across both attempts")
+	}
+	if resumed.Offset != int64(len(data)) || len(resumed.Parts) != 0 {
+		t.Errorf("expected the session complete, got offset %d and %d parts", resumed.Offset, len(resumed.Parts))
+	}
+}
+
+func TestUploaderResumeOutOfOrder(t *testing.T) {
+	data := make([]byte, 64*1024)
+	rand.New(rand.NewSource(8)).Read(data)
+	_, root, err := NewBuilder(DefaultHashMaker, 1024).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSession(DefaultHashMaker, 1024, 8*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &memPartStore{parts: map[int][]byte{}}
+	u := NewUploader(store, DefaultHashMaker, 1024, 8*1024)
+	got, err := u.Resume(s, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, root) {
+		t.Errorf("expected root %x, got %x", root, got)
+	}
+}
+
+func TestSessionVerifier(t *testing.T) {
+	data := make([]byte, 20*1024+5)
+	rand.New(rand.NewSource(9)).Read(data)
+	_, root, err := NewBuilder(DefaultHashMaker, 1024).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSession(DefaultHashMaker, 1024, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv, err := NewSessionVerifier(s, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// interrupted partway through a block
+	if _, err := sv.Write(data[:7*1024+100]); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resumed Session
+	if err := json.Unmarshal(buf, &resumed); err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Offset != 7*1024 {
+		t.Fatalf("expected the session at the last whole block, got %d", resumed.Offset)
+	}
+	sv, err = NewSessionVerifier(&resumed, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sv.Write(data[resumed.Offset:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := sv.Close(); err != nil {
+		t.Error(err)
+	}
+
+	s, _ = NewSession(DefaultHashMaker, 1024, 0)
+	sv, _ = NewSessionVerifier(s, root)
+	sv.Write(data[1:])
+	if err := sv.Close(); err != ErrTreeHashMismatch {
+		t.Errorf("expected ErrTreeHashMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package merkle
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MediaTypeSignedRoot is the media type of the JSON form of a SignedRoot
+const MediaTypeSignedRoot = "application/vnd.merkle.signed-root.v1+json"
+
+// signedRootContext starts the SignedBody of a SignedRoot
+const signedRootContext = "merkle signed root v1\n"
+
+// ErrRootSignature is for a SignedRoot without a valid signature by the
+// expected signer
+var ErrRootSignature = errors.New("no valid signature of the root")
+
+// SignedRoot is the root of a tree with its parameters, any timestamp token,
+// and the signatures over them, as one artifact to distribute. Its JSON form
+// is all a consumer needs to trust a root it recomputes.
+type SignedRoot struct {
+	MediaType  string                `json:"mediaType"`
+	Metadata   RootMetadata          `json:"metadata"`
+	Timestamp  []byte                `json:"timestamp,omitempty"` // as an RFC 3161 token of the SignedBody, checked by the caller
+	Signatures []CheckpointSignature `json:"signatures"`
+}
+
+// NewSignedRoot returns an unsigned SignedRoot of the current state of t
+func NewSignedRoot(t *Tree) (*SignedRoot, error) {
+	m, err := NewRootMetadata(t)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedRoot{MediaType: MediaTypeSignedRoot, Metadata: m}, nil
+}
+
+// SignedBody is the bytes the signatures, and any timestamp token, are over
+func (s SignedRoot) SignedBody() []byte {
+	return s.Metadata.payload(signedRootContext)
+}
+
+// Sign adds a signature by name, replacing any prior signature by that name.
+// Ed25519 signers sign the body, and others its sha256 digest.
+func (s *SignedRoot) Sign(name string, signer crypto.Signer) error {
+	if name == "" || strings.ContainsAny(name, " \n") {
+		return fmt.Errorf("invalid signer name %q", name)
+	}
+	sig, err := signMessage(signer, s.SignedBody())
+	if err != nil {
+		return err
+	}
+	for i := range s.Signatures {
+		if s.Signatures[i].Name == name {
+			s.Signatures[i].Signature = sig
+			return nil
+		}
+	}
+	s.Signatures = append(s.Signatures, CheckpointSignature{Name: name, Signature: sig})
+	return nil
+}
+
+// Verify checks that the SignedRoot carries a valid signature by name, for an
+// Ed25519, ECDSA or RSA public key
+func (s SignedRoot) Verify(name string, pub crypto.PublicKey) error {
+	if s.MediaType != MediaTypeSignedRoot {
+		return fmt.Errorf("unsupported signed root media type %q", s.MediaType)
+	}
+	body := s.SignedBody()
+	for _, sig := range s.Signatures {
+		if sig.Name == name && verifyMessage(pub, body, sig.Signature) {
+			return nil
+		}
+	}
+	return ErrRootSignature
+}
+
+// VerifyTree checks that t is of the signed root and parameters, as well as
+// the signature by name
+func (s SignedRoot) VerifyTree(t *Tree, name string, pub crypto.PublicKey) error {
+	if err := s.Verify(name, pub); err != nil {
+		return err
+	}
+	m, err := NewRootMetadata(t)
+	if err != nil {
+		return err
+	}
+	if m.Hash != s.Metadata.Hash || m.Size != s.Metadata.Size || m.BlockLength != s.Metadata.BlockLength || !equalChecksums(m.Root, s.Metadata.Root) {
+		return ErrTreeHashMismatch
+	}
+	return nil
+}
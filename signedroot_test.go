@@ -0,0 +1,60 @@
+package merkle
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+)
+
+func TestSignedRoot(t *testing.T) {
+	tree := testTree(t, 7)
+	s, err := NewSignedRoot(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sign("alice", edKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sign("bob", ecKey); err != nil {
+		t.Fatal(err)
+	}
+	s.Timestamp = []byte("token")
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got SignedRoot
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := got.VerifyTree(tree, "alice", edKey.Public()); err != nil {
+		t.Error(err)
+	}
+	if err := got.Verify("bob", ecKey.Public()); err != nil {
+		t.Error(err)
+	}
+	if err := got.Verify("bob", edKey.Public()); err != ErrRootSignature {
+		t.Errorf("expected ErrRootSignature of another key, got %v", err)
+	}
+
+	changed := got
+	changed.Metadata.BlockLength = 2
+	if err := changed.Verify("alice", edKey.Public()); err != ErrRootSignature {
+		t.Errorf("expected ErrRootSignature of changed parameters, got %v", err)
+	}
+	if err := got.VerifyTree(testTree(t, 6), "alice", edKey.Public()); err != ErrTreeHashMismatch {
+		t.Errorf("expected ErrTreeHashMismatch of another tree, got %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package merkle
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// MediaTypeBundle is the media type of a sigstore bundle
+const MediaTypeBundle = "application/vnd.dev.sigstore.bundle.v0.3+json"
+
+// Bundle is a sigstore bundle of a message signature, as verified by
+// `cosign verify-blob --bundle`. The message is the SignedBody of a
+// Checkpoint.
+type Bundle struct {
+	MediaType            string                     `json:"mediaType"`
+	VerificationMaterial BundleVerificationMaterial `json:"verificationMaterial"`
+	MessageSignature     BundleMessageSignature     `json:"messageSignature"`
+}
+
+// BundleVerificationMaterial is the certificate of the signer, as issued by
+// Fulcio for keyless signing, or else a hint of the signer's public key
+type BundleVerificationMaterial struct {
+	Certificate *BundleCertificate `json:"certificate,omitempty"`
+	PublicKey   *BundlePublicKey   `json:"publicKey,omitempty"`
+}
+
+// BundleCertificate is a DER encoded X.509 certificate
+type BundleCertificate struct {
+	RawBytes []byte `json:"rawBytes"`
+}
+
+// BundlePublicKey identifies a public key known to the verifier
+type BundlePublicKey struct {
+	Hint string `json:"hint"`
+}
+
+// BundleMessageSignature is a signature over a message, with its digest
+type BundleMessageSignature struct {
+	MessageDigest BundleDigest `json:"messageDigest"`
+	Signature     []byte       `json:"signature"`
+}
+
+// BundleDigest is a digest, by sigstore's name of its algorithm
+type BundleDigest struct {
+	Algorithm string `json:"algorithm"`
+	Digest    []byte `json:"digest"`
+}
+
+// SignedBody is the portion of the checkpoint that signatures are over
+func (c Checkpoint) SignedBody() []byte {
+	return c.body()
+}
+
+// SignWith adds a signature by name over the checkpoint, as Sign does, with
+// any crypto.Signer, such as a key held in a KMS or HSM. Ed25519 signers sign
+// the body, and others its sha256 digest.
+func (c *Checkpoint) SignWith(name string, signer crypto.Signer) error {
+	if name == "" || strings.ContainsAny(name, " \n") {
+		return fmt.Errorf("invalid signer name %q", name)
+	}
+	sig, err := signMessage(signer, c.body())
+	if err != nil {
+		return err
+	}
+	c.addSignature(CheckpointSignature{Name: name, Signature: sig})
+	return nil
+}
+
+// VerifyWith checks that the checkpoint carries a valid signature by name, for
+// an Ed25519, ECDSA or RSA public key
+func (c Checkpoint) VerifyWith(name string, pub crypto.PublicKey) error {
+	for _, s := range c.Signatures {
+		if s.Name == name && verifyMessage(pub, c.body(), s.Signature) {
+			return nil
+		}
+	}
+	return ErrCheckpointSignature
+}
+
+// Bundle signs the checkpoint with signer, and returns the signature as a
+// sigstore bundle. cert is the DER encoded certificate of the signer, as from
+// Fulcio, or nil to identify the signer by a hint of its public key.
+func (c Checkpoint) Bundle(signer crypto.Signer, cert []byte) (*Bundle, error) {
+	body := c.body()
+	sig, err := signMessage(signer, body)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(body)
+	b := &Bundle{
+		MediaType: MediaTypeBundle,
+		MessageSignature: BundleMessageSignature{
+			MessageDigest: BundleDigest{Algorithm: "SHA2_256", Digest: digest[:]},
+			Signature:     sig,
+		},
+	}
+	if cert != nil {
+		b.VerificationMaterial.Certificate = &BundleCertificate{RawBytes: cert}
+	} else {
+		hint, err := publicKeyHint(signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		b.VerificationMaterial.PublicKey = &BundlePublicKey{Hint: hint}
+	}
+	return b, nil
+}
+
+// VerifyBundle checks the bundle's signature over the checkpoint, by pub, or
+// by the public key of the bundle's certificate when pub is nil. The
+// certificate's chain and identity, and any transparency log entries, are for
+// the caller to check with sigstore's tooling.
+func (c Checkpoint) VerifyBundle(b *Bundle, pub crypto.PublicKey) error {
+	if b.MediaType != MediaTypeBundle {
+		return fmt.Errorf("unsupported bundle media type %q", b.MediaType)
+	}
+	body := c.body()
+	digest := sha256.Sum256(body)
+	md := b.MessageSignature.MessageDigest
+	if md.Algorithm != "SHA2_256" || string(md.Digest) != string(digest[:]) {
+		return ErrCheckpointSignature
+	}
+	if pub == nil {
+		if b.VerificationMaterial.Certificate == nil {
+			return fmt.Errorf("bundle has no certificate, and no public key was given")
+		}
+		cert, err := x509.ParseCertificate(b.VerificationMaterial.Certificate.RawBytes)
+		if err != nil {
+			return err
+		}
+		pub = cert.PublicKey
+	}
+	if !verifyMessage(pub, body, b.MessageSignature.Signature) {
+		return ErrCheckpointSignature
+	}
+	return nil
+}
+
+// publicKeyHint is the hex encoded sha256 of the PKIX form of pub
+func publicKeyHint(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func signMessage(signer crypto.Signer, msg []byte) ([]byte, error) {
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		return signer.Sign(rand.Reader, msg, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(msg)
+	return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+func verifyMessage(pub crypto.PublicKey, msg, sig []byte) bool {
+	digest := sha256.Sum256(msg)
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, msg, sig)
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(pub, digest[:], sig)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil ||
+			rsa.VerifyPSS(pub, crypto.SHA256, digest[:], sig, nil) == nil
+	}
+	return false
+}
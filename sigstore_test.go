@@ -0,0 +1,112 @@
+package merkle
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestCheckpointSignWith(t *testing.T) {
+	tree := testTree(t, 7)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, signer := range map[string]crypto.Signer{"ed25519": edKey, "ecdsa": ecKey, "rsa": rsaKey} {
+		c, err := NewCheckpoint("example.com/log", tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SignWith(name, signer); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.VerifyWith(name, signer.Public()); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+		c.Size++
+		if err := c.VerifyWith(name, signer.Public()); err != ErrCheckpointSignature {
+			t.Errorf("%s: expected the altered checkpoint not to verify, got %v", name, err)
+		}
+	}
+
+	// Ed25519 signatures are the same as by Sign
+	c, _ := NewCheckpoint("example.com/log", tree)
+	if err := c.SignWith("alice", edKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Verify("alice", edKey.Public().(ed25519.PublicKey)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckpointBundle(t *testing.T) {
+	c, err := NewCheckpoint("example.com/log", testTree(t, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a self signed stand-in for a Fulcio certificate
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "signer"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(10 * time.Minute),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := c.Bundle(key, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Bundle
+	if err := json.Unmarshal(buf, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifyBundle(&decoded, nil); err != nil {
+		t.Errorf("expected the bundle to verify by its certificate: %s", err)
+	}
+
+	b, err = c.Bundle(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.VerificationMaterial.PublicKey == nil || b.VerificationMaterial.PublicKey.Hint == "" {
+		t.Errorf("expected a public key hint")
+	}
+	if err := c.VerifyBundle(b, key.Public()); err != nil {
+		t.Error(err)
+	}
+	if err := c.VerifyBundle(b, nil); err == nil {
+		t.Errorf("expected an error without a certificate or public key")
+	}
+	c.Size++
+	if err := c.VerifyBundle(b, key.Public()); err != ErrCheckpointSignature {
+		t.Errorf("expected the bundle not to verify another checkpoint, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package merkle
+
+// leafSlab allocates leaves from arrays of Nodes and of their checksums,
+// sized to the digest of the hash when the slab is made. A leaf then takes the
+// size of a Node and of its digest, rather than a checksum allocated on its
+// own and rounded up to a size class, and the checksums of neighbouring leaves
+// are neighbours in memory. The arrays are kept as long as any of their leaves.
+type leafSlab struct {
+	hm    HashMaker
+	size  int
+	next  int // count of leaves of the next arrays
+	nodes []Node
+	sums  *digests // of the nodes
+	slot  int      // of the next Node in sums
+}
+
+const (
+	minSlabLeaves = 16
+	maxSlabLeaves = 4096
+)
+
+// newLeafSlab is a slab of leaves of hm, growing as they are taken, for a
+// count of leaves not known ahead
+func newLeafSlab(hm HashMaker) *leafSlab {
+	return &leafSlab{hm: hm, size: hm().Size(), next: minSlabLeaves}
+}
+
+// newHashSlab is newLeafSlab, of the size of the digest of the first leaf
+// hashed, so making it makes no hash. Its leaves are only of hashLeaf.
+func newHashSlab(hm HashMaker) *leafSlab {
+	return &leafSlab{hm: hm, next: minSlabLeaves}
+}
+
+// newLeafSlabOf is a slab of exactly count leaves of hm
+func newLeafSlabOf(hm HashMaker, count int) *leafSlab {
+	s := &leafSlab{hm: hm, size: hm().Size(), next: minSlabLeaves}
+	s.grow(count)
+	return s
+}
+
+func (s *leafSlab) grow(count int) {
+	s.nodes = make([]Node, count)
+	s.sums = &digests{hm: s.hm, size: s.size, sums: make([]byte, count*s.size)}
+	s.slot = 0
+}
+
+// take is the next Node of the slab, with its checksum of zeros, to be
+// written in place
+func (s *leafSlab) take() *Node {
+	if len(s.nodes) == 0 {
+		s.grow(s.next)
+		if s.next < maxSlabLeaves {
+			s.next *= 2
+		}
+	}
+	n := &s.nodes[0]
+	n.sums, n.slot = s.sums, s.slot
+	s.nodes, s.slot = s.nodes[1:], s.slot+1
+	return n
+}
+
+// leaf is a leaf of a copy of the checksum sum. A sum not of the size of the
+// digest is copied on its own.
+func (s *leafSlab) leaf(sum []byte) *Node {
+	if len(sum) != s.size {
+		return newLeaf(s.hm, append([]byte(nil), sum...))
+	}
+	n := s.take()
+	copy(n.checksum(), sum)
+	return n
+}
+
+// hashLeaf is the leaf of the block b, by the policy when b is shorter than
+// blockLength
+func (s *leafSlab) hashLeaf(policy FinalBlockPolicy, blockLength int, b []byte) (*Node, error) {
+	h := s.hm()
+	if err := policy.writeBlock(h, blockLength, b); err != nil {
+		return nil, err
+	}
+	if s.size == 0 && len(s.nodes) == 0 {
+		s.size = h.Size()
+	}
+	if h.Size() != s.size {
+		return newLeaf(s.hm, h.Sum(nil)), nil
+	}
+	n := s.take()
+	h.Sum(n.checksum()[:0])
+	return n, nil
+}
@@ -0,0 +1,70 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+	"unsafe"
+)
+
+func TestLeafSlab(t *testing.T) {
+	data := make([]byte, 16*100+7)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	built, root, err := NewBuilder(sha256.New, 16, WithHashWorkers(3)).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBuilder(sha256.New, 16)
+	b.Write(data)
+	written, sum, err := b.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root, sum) || !built.Equal(written) {
+		t.Fatal("expected the same tree built and written")
+	}
+	buf, err := built.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Tree
+	if err := decoded.UnmarshalBinary(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Equal(built) {
+		t.Fatal("expected the tree decoded as encoded")
+	}
+
+	for name, tree := range map[string]*Tree{"built": built, "written": written, "decoded": &decoded} {
+		for i, n := range tree.Nodes {
+			if len(n.checksum()) != sha256.Size || cap(n.checksum()) != sha256.Size {
+				t.Fatalf("%s: leaf %d has a checksum of %d bytes, of capacity %d", name, i, len(n.checksum()), cap(n.checksum()))
+			}
+		}
+		// the first leaves are of one array
+		for i := 1; i < minSlabLeaves; i++ {
+			prev, n := tree.Nodes[i-1], tree.Nodes[i]
+			if uintptr(unsafe.Pointer(&n.checksum()[0]))-uintptr(unsafe.Pointer(&prev.checksum()[0])) != sha256.Size {
+				t.Errorf("%s: expected the checksums of leaves %d and %d adjacent", name, i-1, i)
+			}
+		}
+	}
+
+	// a leaf of a checksum not of the digest size is copied on its own
+	s := newLeafSlab(sha256.New)
+	if n := s.leaf([]byte("short")); string(n.checksum()) != "short" || len(s.nodes) != 0 {
+		t.Error("expected a short checksum copied on its own")
+	}
+}
+
+func TestNodeSize(t *testing.T) {
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		t.Skip("of 64-bit platforms")
+	}
+	// of its digests and slot, links and position, without the checksum
+	if size := unsafe.Sizeof(Node{}); size > 64 {
+		t.Errorf("expected a Node of at most 64 bytes, got %d", size)
+	}
+}
@@ -0,0 +1,111 @@
+package merkle
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// SumFile returns the tree of the file at path, as SumOf its bytes. The holes
+// of a sparse file, as of VM images and databases, are found by SEEK_HOLE and
+// SEEK_DATA where supported, and their whole blocks take the leaf of a block
+// of zeros, hashed once, rather than being read and hashed.
+func SumFile(hm HashMaker, blockLength int, path string, opts ...Option) (*Tree, error) {
+	h, err := New(hm, blockLength, opts...)
+	if err != nil {
+		return nil, err
+	}
+	mh := h.(*merkleHash)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	extents, err := dataExtents(f, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		bl    = int64(blockLength)
+		block = make([]byte, blockLength)
+		zero  *Node
+	)
+	for off := int64(0); off < size; off += bl {
+		end := off + bl
+		if end > size {
+			end = size
+		}
+		for len(extents) > 0 && extents[0][1] <= off {
+			extents = extents[1:]
+		}
+		inHole := len(extents) == 0 || extents[0][0] >= end
+		if inHole && end-off == bl {
+			if zero == nil {
+				if zero, err = zeroLeaf(mh.hm, blockLength); err != nil {
+					return nil, err
+				}
+			}
+			if err := mh.appendBlock(zero); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		b := block[:end-off]
+		if n, err := f.ReadAt(b, off); n < len(b) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if _, err := mh.Write(b); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := mh.Finish(); err != nil {
+		return nil, err
+	}
+	return mh.tree, nil
+}
+
+// appendBlock appends a leaf of the checksum of the leaf n, of a whole block,
+// as though the block were written. The leaf shares the checksum of n.
+func (mh *merkleHash) appendBlock(n *Node) error {
+	leaves := mh.base.End + len(mh.tree.Nodes)
+	if err := mh.opts.checkLimits(mh.blockSize, mh.TotalLength(), leaves, mh.lastBlockLen, int64(mh.blockSize)); err != nil {
+		return err
+	}
+	mh.tree.appendLeaf(&Node{sums: n.sums, slot: n.slot}, mh.blockSize)
+	mh.tree.length += int64(mh.blockSize)
+	return nil
+}
+
+type zeroLeafKey struct {
+	hash   string
+	length int
+}
+
+var zeroLeaves sync.Map // of zeroLeafKey to the *Node of a block of zeros
+
+// zeroLeaf is the leaf of a block of zeros, kept for a registered hash
+func zeroLeaf(hm HashMaker, blockLength int) (*Node, error) {
+	name, err := HashName(hm)
+	if err != nil {
+		return NewNodeHashBlock(hm, make([]byte, blockLength))
+	}
+	key := zeroLeafKey{hash: name, length: blockLength}
+	if n, ok := zeroLeaves.Load(key); ok {
+		return n.(*Node), nil
+	}
+	n, err := NewNodeHashBlock(hm, make([]byte, blockLength))
+	if err != nil {
+		return nil, err
+	}
+	zeroLeaves.Store(key, n)
+	return n, nil
+}
@@ -0,0 +1,40 @@
+package merkle
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+const (
+	seekData = 3 // SEEK_DATA
+	seekHole = 4 // SEEK_HOLE
+)
+
+// dataExtents are the ranges [start, end) of f holding data, in order, with
+// the rest of its size bytes holes. A file system without holes is all data.
+func dataExtents(f *os.File, size int64) ([][2]int64, error) {
+	var extents [][2]int64
+	for off := int64(0); off < size; {
+		start, err := f.Seek(off, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			break // no data after off
+		}
+		if errors.Is(err, syscall.EINVAL) {
+			return [][2]int64{{0, size}}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		end, err := f.Seek(start, seekHole)
+		if err != nil {
+			return nil, err
+		}
+		if end > size {
+			end = size
+		}
+		extents = append(extents, [2]int64{start, end})
+		off = end
+	}
+	return extents, nil
+}
@@ -0,0 +1,57 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSumFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "merkle-sparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	// data, a hole of whole and partial blocks, data, and a trailing hole
+	data := make([]byte, 1<<20+100)
+	copy(data, bytes.Repeat([]byte("head"), 1000))
+	copy(data[600000:], bytes.Repeat([]byte("middle"), 1000))
+	f.Write(data[:4000])
+	f.WriteAt(data[600000:606000], 600000)
+	if err := f.Truncate(int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	for _, opts := range [][]Option{nil, {WithDomainSeparation()}} {
+		expected, err := New(sha256.New, 4096, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := expected.WriteFinal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := SumFile(sha256.New, 4096, f.Name(), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := tree.RootChecksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, root) {
+			t.Errorf("expected the root %x, got %x", root, got)
+		}
+		if tree.TotalLength() != int64(len(data)) || len(tree.Nodes) != len(expected.Nodes()) {
+			t.Errorf("expected %d bytes in %d leaves, got %d in %d", len(data), len(expected.Nodes()), tree.TotalLength(), len(tree.Nodes))
+		}
+	}
+
+	if _, err := SumFile(sha256.New, 4096, f.Name(), WithMaxBytes(1<<20)); err == nil {
+		t.Error("expected the limit to apply to holes")
+	}
+}
@@ -0,0 +1,234 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// HashState is the in-progress state of a hash of New or NewHash, for a
+// hashing job to be handed off mid-stream, as between processes or pods. The
+// leaves hashed so far are kept only as their frontier, so the state is of a
+// size logarithmic in the bytes written.
+//
+// The protobuf form is of the message
+//
+//	message HashState {
+//	  uint32 version = 1;
+//	  string hash = 2;
+//	  uint64 block_length = 3;
+//	  uint32 final_block = 4;
+//	  uint64 length = 5;
+//	  uint64 leaves = 6;
+//	  repeated bytes frontier = 7;
+//	  bytes partial = 8;
+//	}
+type HashState struct {
+	Version     int
+	Hash        string // as of HashName
+	BlockLength int
+	FinalBlock  FinalBlockPolicy
+	Length      int64    // of the bytes written
+	Leaves      int      // whole blocks hashed
+	Frontier    [][]byte // of the leaves, as of a SubtreeSummary
+	Partial     []byte   // the trailing bytes, short of a block
+}
+
+// hashStateVersion is the version of the HashState written
+const hashStateVersion = 1
+
+const (
+	stateVersion = 1 + iota
+	stateHash
+	stateBlockLength
+	stateFinalBlock
+	stateLength
+	stateLeaves
+	stateFrontier
+	statePartial
+)
+
+// ExportState returns the state of h, a hash of New or NewHash, to continue
+// with ImportState. Writing to h may continue, as the state is a copy.
+func ExportState(h HashTreeer) (*HashState, error) {
+	mh, ok := h.(*merkleHash)
+	if !ok {
+		return nil, fmt.Errorf("can not export the state of %T", h)
+	}
+	name, err := HashName(mh.hm)
+	if err != nil {
+		return nil, err
+	}
+	s, err := mh.summary(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &HashState{
+		Version:     hashStateVersion,
+		Hash:        name,
+		BlockLength: mh.blockSize,
+		FinalBlock:  mh.opts.finalBlock,
+		Length:      mh.TotalLength(),
+		Leaves:      s.End,
+		Frontier:    s.Frontier,
+		Partial:     append([]byte{}, mh.lastBlock[:mh.lastBlockLen]...),
+	}, nil
+}
+
+// ImportState returns a hash that continues from s, so that its Sum is as of
+// one hash of all the bytes. The hash and final block policy are of s, and any
+// other options, as WithLengthCommitment, must be given again.
+// WithDomainSeparation makes the hash DomainSeparated, as it already is if s
+// was exported of a DomainSeparated hash.
+//
+// Nodes and NodeRange of the returned hash are of the leaves written since the
+// import, indexed from 0.
+func ImportState(s *HashState, opts ...Option) (HashTreeer, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	hm, _ := LookupHash(s.Hash)
+	o := newOptions(append(opts, WithFinalBlockPolicy(s.FinalBlock)))
+	if err := o.supported("ImportState", hashOptions); err != nil {
+		return nil, err
+	}
+	mh := newMerkleHash(o.hashMaker(hm), s.BlockLength, o)
+	mh.base = SubtreeSummary{End: s.Leaves, Frontier: s.Frontier}
+	mh.baseLength = s.Length
+	mh.lastBlockLen = copy(mh.lastBlock, s.Partial)
+	return mh, nil
+}
+
+// check is whether the fields of the state are consistent
+func (s *HashState) check() error {
+	if s.Version != hashStateVersion {
+		return fmt.Errorf("unsupported hash state version %d", s.Version)
+	}
+	hm, ok := LookupHash(s.Hash)
+	if !ok {
+		return ErrUnknownHash{Name: s.Hash}
+	}
+	if s.BlockLength < MinBlockSize {
+		return ErrInvalidBlockLength{Length: s.BlockLength}
+	}
+	if _, ok := finalBlockPolicyNames[s.FinalBlock]; !ok {
+		return ErrInconsistentField{Field: "final block", Reason: fmt.Sprintf("unknown policy %d", int(s.FinalBlock))}
+	}
+	if s.Leaves < 0 {
+		return ErrInconsistentField{Field: "leaves", Reason: fmt.Sprintf("%d leaves", s.Leaves)}
+	}
+	if expected := len(decompose(0, s.Leaves)); len(s.Frontier) != expected {
+		return ErrInconsistentField{Field: "frontier", Reason: fmt.Sprintf("%d leaves need %d checksums, got %d", s.Leaves, expected, len(s.Frontier))}
+	}
+	size := hm().Size()
+	for _, sum := range s.Frontier {
+		if len(sum) != size {
+			return ErrInconsistentField{Field: "frontier", Reason: fmt.Sprintf("checksum of %d bytes, for a hash of %d", len(sum), size)}
+		}
+	}
+	if len(s.Partial) >= s.BlockLength {
+		return ErrInconsistentField{Field: "partial", Reason: fmt.Sprintf("%d bytes, of a block of %d", len(s.Partial), s.BlockLength)}
+	}
+	if s.Length != int64(s.Leaves)*int64(s.BlockLength)+int64(len(s.Partial)) {
+		return ErrInconsistentField{Field: "length", Reason: fmt.Sprintf("%d bytes, for %d blocks and %d partial bytes", s.Length, s.Leaves, len(s.Partial))}
+	}
+	return nil
+}
+
+// MarshalProto encodes the state as the protobuf message HashState
+func (s *HashState) MarshalProto() ([]byte, error) {
+	var buf bytes.Buffer
+	protoUvarint(&buf, stateVersion, uint64(s.Version))
+	protoString(&buf, stateHash, []byte(s.Hash))
+	protoUvarint(&buf, stateBlockLength, uint64(s.BlockLength))
+	protoUvarint(&buf, stateFinalBlock, uint64(s.FinalBlock))
+	protoUvarint(&buf, stateLength, uint64(s.Length))
+	protoUvarint(&buf, stateLeaves, uint64(s.Leaves))
+	for _, sum := range s.Frontier {
+		protoString(&buf, stateFrontier, sum)
+	}
+	if len(s.Partial) > 0 {
+		protoString(&buf, statePartial, s.Partial)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalProto decodes a state encoded by MarshalProto, and checks that it
+// is consistent. The hash it names must be registered.
+func (s *HashState) UnmarshalProto(data []byte) error {
+	return s.unmarshalProto(data, DefaultDecodeLimits())
+}
+
+// unmarshalProto is UnmarshalProto of the limits l
+func (s *HashState) unmarshalProto(data []byte, l DecodeLimits) error {
+	if err := l.checkBytes(len(data)); err != nil {
+		return err
+	}
+	var (
+		r     = bytes.NewReader(data)
+		state HashState
+	)
+	for r.Len() > 0 {
+		key, err := binary.ReadUvarint(r)
+		if err != nil {
+			return ErrMalformedTree
+		}
+		field, wire := key>>3, key&7
+		switch {
+		case wire == protoVarint:
+			v, err := binary.ReadUvarint(r)
+			if err != nil {
+				return ErrMalformedTree
+			}
+			switch field {
+			case stateVersion, stateBlockLength, stateFinalBlock, stateLeaves:
+				if v > uint64(maxInt) {
+					return ErrMalformedTree
+				}
+			case stateLength:
+				if v > 1<<63-1 {
+					return ErrMalformedTree
+				}
+			}
+			switch field {
+			case stateVersion:
+				state.Version = int(v)
+			case stateBlockLength:
+				state.BlockLength = int(v)
+			case stateFinalBlock:
+				state.FinalBlock = FinalBlockPolicy(v)
+			case stateLength:
+				state.Length = int64(v)
+			case stateLeaves:
+				state.Leaves = int(v)
+			}
+		case wire == protoBytes:
+			n, err := binary.ReadUvarint(r)
+			if err != nil || n > uint64(r.Len()) {
+				return ErrMalformedTree
+			}
+			b := data[len(data)-r.Len() : len(data)-r.Len()+int(n)]
+			r.Seek(int64(n), io.SeekCurrent)
+			switch field {
+			case stateHash:
+				state.Hash = string(b)
+			case stateFrontier:
+				state.Frontier = append(state.Frontier, append([]byte{}, b...))
+			case statePartial:
+				state.Partial = append([]byte{}, b...)
+			}
+		case wire == protoFixed64 && r.Len() >= 8:
+			r.Seek(8, io.SeekCurrent)
+		case wire == protoFixed32 && r.Len() >= 4:
+			r.Seek(4, io.SeekCurrent)
+		default:
+			return ErrMalformedTree
+		}
+	}
+	if err := state.check(); err != nil {
+		return err
+	}
+	*s = state
+	return nil
+}
@@ -0,0 +1,74 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestHashState(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdefghij"), 100)
+	for _, split := range []int{0, 1, 64, 100, 333, 1024, len(data)} {
+		whole, err := New(sha256.New, 64, WithLengthCommitment())
+		if err != nil {
+			t.Fatal(err)
+		}
+		whole.Write(data)
+		expected := whole.Sum(nil)
+
+		first, _ := New(sha256.New, 64, WithLengthCommitment())
+		first.Write(data[:split])
+		state, err := ExportState(first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := state.MarshalProto()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded HashState
+		if err := decoded.UnmarshalProto(b); err != nil {
+			t.Fatalf("split %d: %s", split, err)
+		}
+		second, err := ImportState(&decoded, WithLengthCommitment())
+		if err != nil {
+			t.Fatalf("split %d: %s", split, err)
+		}
+		second.Write(data[split:])
+		if got := second.Sum(nil); !bytes.Equal(got, expected) {
+			t.Errorf("split %d: expected %x, got %x", split, expected, got)
+		}
+		if second.TotalLength() != int64(len(data)) {
+			t.Errorf("split %d: expected a length of %d, got %d", split, len(data), second.TotalLength())
+		}
+
+		// the exported hash continues on its own
+		first.Write(data[split:])
+		if got := first.Sum(nil); !bytes.Equal(got, expected) {
+			t.Errorf("split %d: after export, expected %x, got %x", split, expected, got)
+		}
+	}
+}
+
+func TestHashStateInconsistent(t *testing.T) {
+	h, _ := New(sha256.New, 64)
+	h.Write(make([]byte, 200))
+	good, err := ExportState(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, mutate := range map[string]func(s *HashState){
+		"frontier": func(s *HashState) { s.Frontier = s.Frontier[1:] },
+		"leaves":   func(s *HashState) { s.Leaves++ },
+		"length":   func(s *HashState) { s.Length++ },
+		"partial":  func(s *HashState) { s.Partial = make([]byte, 64) },
+		"checksum": func(s *HashState) { s.Frontier = [][]byte{s.Frontier[0][1:], s.Frontier[1]} },
+	} {
+		s := *good
+		mutate(&s)
+		if _, err := ImportState(&s); !errors.Is(err, ErrMalformedTree) {
+			t.Errorf("%s: expected ErrMalformedTree, got %v", name, err)
+		}
+	}
+}
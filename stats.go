@@ -0,0 +1,75 @@
+package merkle
+
+import (
+	"bufio"
+	"io"
+	"unsafe"
+)
+
+// TreeStats are the size of a tree, and an estimate of the memory it takes
+type TreeStats struct {
+	Leaves   int
+	Interior int // nodes above the leaves, as built by Root
+	Levels   int // including the leaves
+
+	// ChecksumBytes is of the checksums of the leaves and interior nodes
+	ChecksumBytes int64
+
+	// HeapBytes is an estimate of the heap taken by the leaves and the
+	// interior nodes, with their checksums
+	HeapBytes int64
+}
+
+// Stats returns the statistics of the tree, as it is once its Root is built
+func (t *Tree) Stats() TreeStats {
+	return treeStats(len(t.Nodes), t.hashMaker()().Size())
+}
+
+// ReadTreeStats reads only the header of a serialized tree (see
+// Tree.MarshalBinary), and returns the statistics of the tree it would decode
+// to, so the memory for a large tree can be budgeted before it is loaded. A
+// tree of more leaves than the DefaultDecodeLimits is an ErrLimitExceeded.
+func ReadTreeStats(r io.Reader) (TreeStats, error) {
+	return readTreeStats(r, DefaultDecodeLimits())
+}
+
+func readTreeStats(r io.Reader, l DecodeLimits) (TreeStats, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	th, err := readTreeHeader(br)
+	if err != nil {
+		return TreeStats{}, err
+	}
+	if err := l.checkLeaves(th.leaves); err != nil {
+		return TreeStats{}, err
+	}
+	return treeStats(int(th.leaves), int(th.size)), nil
+}
+
+// treeStats is for the shape of levelUp, where each level pairs the nodes of
+// the one below and promotes an odd last node, adding a node per pair
+func treeStats(leaves, size int) TreeStats {
+	s := TreeStats{Leaves: leaves}
+	if leaves == 0 {
+		return s
+	}
+	s.Levels = 1
+	for n := leaves; n > 1; n = (n + 1) / 2 {
+		s.Interior += n / 2
+		s.Levels++
+	}
+	nodes := int64(s.Leaves + s.Interior)
+	s.ChecksumBytes = nodes * int64(size)
+
+	// the leaves are packed with their checksums, and the interior nodes
+	// each have a checksum of their own
+	var (
+		node     = int64(unsafe.Sizeof(Node{}))
+		checksum = int64((size + 7) &^ 7) // rounded up to the word
+		pointer  = int64(unsafe.Sizeof(&Node{}))
+	)
+	s.HeapBytes = int64(s.Leaves)*(node+int64(size)+pointer) + int64(s.Interior)*(node+checksum)
+	return s
+}
@@ -0,0 +1,64 @@
+package merkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTreeStats(t *testing.T) {
+	for _, c := range []struct {
+		leaves, interior, levels int
+	}{
+		{0, 0, 0},
+		{1, 0, 1},
+		{2, 1, 2},
+		{3, 2, 3},
+		{4, 3, 3},
+		{5, 4, 4},
+		{8, 7, 4},
+		{9, 8, 5},
+	} {
+		tree := &Tree{}
+		if c.leaves > 0 {
+			tree = testTree(t, c.leaves)
+		}
+		s := tree.Stats()
+		if s.Leaves != c.leaves || s.Interior != c.interior || s.Levels != c.levels {
+			t.Errorf("%d leaves: expected %d interior and %d levels, got %+v", c.leaves, c.interior, c.levels, s)
+		}
+		if s.ChecksumBytes != int64(c.leaves+c.interior)*20 {
+			t.Errorf("%d leaves: unexpected checksum bytes %d", c.leaves, s.ChecksumBytes)
+		}
+		if c.leaves > 0 && s.HeapBytes <= s.ChecksumBytes {
+			t.Errorf("%d leaves: expected the heap estimate over the checksums, got %d", c.leaves, s.HeapBytes)
+		}
+
+		// the levels built by Root
+		levels := 0
+		for n := tree.Root(); n != nil; n = n.Left {
+			levels++
+		}
+		if levels != c.levels {
+			t.Errorf("%d leaves: expected Root of %d levels, got %d", c.leaves, c.levels, levels)
+		}
+	}
+}
+
+func TestReadTreeStats(t *testing.T) {
+	tree := testTree(t, 100)
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the header is needed
+	s, err := ReadTreeStats(bytes.NewReader(data[:20]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != tree.Stats() {
+		t.Errorf("expected %+v, got %+v", tree.Stats(), s)
+	}
+	if _, err := ReadTreeStats(bytes.NewReader([]byte("MRKX"))); err != ErrMalformedTree {
+		t.Errorf("expected ErrMalformedTree, got %v", err)
+	}
+}
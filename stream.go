@@ -1,8 +1,10 @@
 package merkle
 
 import (
+	"errors"
 	"fmt"
 	"hash"
+	"io"
 	"os"
 	"runtime"
 )
@@ -10,22 +12,104 @@ import (
 // NewHash provides a hash.Hash to generate a merkle.Tree checksum, given a
 // HashMaker for the checksums of the blocks written and the blockSize of each
 // block per node in the tree.
+//
+// The arguments are not validated. See New.
 func NewHash(hm HashMaker, merkleBlockLength int) HashTreeer {
-	return newMerkleHash(hm, merkleBlockLength)
+	return newMerkleHash(hm, merkleBlockLength, newOptions(nil))
+}
+
+// NewHashParallel is NewHash, with the whole blocks of each Write checksummed
+// across workers goroutines, and the leaves kept in order. The tree is that of
+// NewHash. Large writes gain the most, and ReadFrom reads enough blocks at a
+// time for every worker.
+func NewHashParallel(hm HashMaker, merkleBlockLength, workers int) HashTreeer {
+	mh := newMerkleHash(hm, merkleBlockLength, newOptions([]Option{WithHashWorkers(workers)}))
+	mh.parallel = workers > 1
+	return mh
+}
+
+// New is NewHash, with validation of the arguments and any options. An
+// ErrInvalidBlockLength or ErrInvalidHashMaker is returned for unusable
+// arguments, and an ErrUnsupportedOption for the options of a Builder alone,
+// as WithBloomFilter, WithLeafIndex, WithLeafStream, WithChecksumInterning,
+// WithHashWorkers, WithLevelWorkers and WithAdaptiveWorkers, or of verifying,
+// WithRateLimit.
+func New(hm HashMaker, merkleBlockLength int, opts ...Option) (HashTreeer, error) {
+	if merkleBlockLength < MinBlockSize {
+		return nil, ErrInvalidBlockLength{Length: merkleBlockLength}
+	}
+	if hm == nil {
+		return nil, ErrInvalidHashMaker{Reason: "nil HashMaker"}
+	}
+	h := hm()
+	if h == nil {
+		return nil, ErrInvalidHashMaker{Reason: "HashMaker returned a nil hash.Hash"}
+	}
+	if h.Size() <= 0 {
+		return nil, ErrInvalidHashMaker{Reason: fmt.Sprintf("hash.Hash has a size of %d", h.Size())}
+	}
+	o := newOptions(opts)
+	if err := o.supported("New", hashOptions); err != nil {
+		return nil, err
+	}
+	return newMerkleHash(o.hashMaker(hm), merkleBlockLength, o), nil
+}
+
+// SumOf returns the tree of data, with any trailing partial block as its last
+// leaf. Empty data is an ErrEmptyTree.
+func SumOf(hm HashMaker, blockLength int, data []byte) (*Tree, error) {
+	h, err := New(hm, blockLength)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := h.WriteFinal(data); err != nil {
+		return nil, err
+	}
+	return h.(*merkleHash).tree, nil
+}
+
+// ErrInvalidBlockLength is for block lengths that can not make a tree
+type ErrInvalidBlockLength struct {
+	Length int
+}
+
+// Error shows the invalid length
+func (err ErrInvalidBlockLength) Error() string {
+	return fmt.Sprintf("invalid block length %d, must be at least %d", err.Length, MinBlockSize)
 }
 
-func newMerkleHash(hm HashMaker, merkleBlockLength int) *merkleHash {
+// ErrInvalidHashMaker is for a HashMaker that can not make checksums
+type ErrInvalidHashMaker struct {
+	Reason string
+}
+
+// Error shows why the HashMaker is invalid
+func (err ErrInvalidHashMaker) Error() string {
+	return "invalid HashMaker: " + err.Reason
+}
+
+func newMerkleHash(hm HashMaker, merkleBlockLength int, opts options) *merkleHash {
 	mh := new(merkleHash)
 	mh.blockSize = merkleBlockLength
 	mh.hm = hm
-	mh.tree = &Tree{Nodes: []*Node{}, BlockLength: merkleBlockLength}
+	mh.opts = opts
+	mh.tree = mh.newTree()
+	mh.slab = newHashSlab(hm)
 	mh.lastBlock = make([]byte, merkleBlockLength)
 	return mh
 }
 
 // Treeer (Tree-er) provides access to the Merkle tree internals
 type Treeer interface {
+	// Nodes returns the leaf nodes of the tree.
+	//
+	// Deprecated: this may be the tree's own slice, which a caller can corrupt
+	// the tree through. Use NodeRange.
 	Nodes() []*Node
+
+	// NodeRange returns copies of the leaf nodes [start, end)
+	NodeRange(start, end int) ([]*Node, error)
+
 	Root() *Node
 }
 
@@ -33,170 +117,294 @@ type Treeer interface {
 // tree internals
 type HashTreeer interface {
 	hash.Hash
+	io.StringWriter
+	io.ReaderFrom
 	Treeer
-}
 
-// TODO make a similar hash.Hash, that accepts an argument of a merkle.Tree,
-// that will validate nodes as the new bytes are written. If a new written
-// block fails checksum, then return an error on the io.Writer
+	// WriteFinal writes the last of the data, and then is Finish
+	WriteFinal(b []byte) ([]byte, error)
+
+	// Finish hashes the trailing partial block, if any, as the last Node of
+	// the tree and returns the checksum of the root
+	Finish() ([]byte, error)
+
+	// SumE is Sum, returning the error of checksumming the partial block or
+	// the root rather than reporting it
+	SumE(b []byte) ([]byte, error)
+
+	// TotalLength is the count of bytes written since the last Reset
+	TotalLength() int64
+}
 
 type merkleHash struct {
-	blockSize       int
-	tree            *Tree
-	hm              HashMaker
-	lastBlock       []byte // as needed, for Sum()
-	lastBlockLen    int
-	partialLastNode bool // true when Sum() has appended a Node for a partial block
+	blockSize    int
+	tree         *Tree
+	hm           HashMaker
+	lastBlock    []byte // as needed, for Sum()
+	lastBlockLen int
+	opts         options
+	finalized    bool      // true once Sum() or Finish() has been called
+	parallel     bool      // of NewHashParallel, to hash blocks across the hash workers
+	slab         *leafSlab // of the leaves of whole blocks
+
+	// base is the summary of the leaves hashed before an ImportState, which
+	// the leaves of tree follow, and baseLength the bytes written before it
+	base       SubtreeSummary
+	baseLength int64
 }
 
+// newTree is the empty tree of the leaves, of its interior cached
+// WithInteriorCache
+func (mh *merkleHash) newTree() *Tree {
+	t := &Tree{Nodes: []*Node{}, BlockLength: mh.blockSize, FinalBlock: mh.opts.finalBlock}
+	if mh.opts.interiorCache {
+		t.CacheInterior()
+	}
+	return t
+}
+
+// ErrFinalized is for a Write after Sum or Finish, WithStrictLifecycle
+var ErrFinalized = errors.New("write after the tree was finalized")
+
 func (mh *merkleHash) Reset() {
-	mh.tree = &Tree{Nodes: []*Node{}, BlockLength: mh.blockSize}
+	mh.tree = mh.newTree()
 	mh.lastBlockLen = 0
-	mh.partialLastNode = false
+	mh.finalized = false
+	mh.base = SubtreeSummary{}
+	mh.baseLength = 0
 }
 
 func (mh merkleHash) Nodes() []*Node {
 	return mh.tree.Nodes
 }
 
+func (mh merkleHash) NodeRange(start, end int) ([]*Node, error) {
+	return mh.tree.NodeRange(start, end)
+}
+
+func (mh merkleHash) TotalLength() int64 {
+	return mh.baseLength + mh.tree.length
+}
+
 func (mh merkleHash) Root() *Node {
 	return mh.tree.Root()
 }
 
-// XXX this will be tricky, as the last block can be less than the BlockSize.
-// if they get the sum, it will be mh.tree.Root().Checksum() at that point.
-//
-// But if they continue writing, it would mean a continuation of the bytes in
-// the last block. So popping the last node, and having a buffer for the bytes
-// in that last partial block.
+// Sum appends the checksum of the root of the tree of the bytes written so far
+// to b, per the hash.Hash convention. Any trailing partial block is included
+// as the last leaf of a snapshot of the tree, which the tree itself is not
+// changed by: Sum may be called any number of times, and writing after it
+// continues the partial block, as with any other hash.Hash. With nothing
+// written, b is returned as is, unless WithEmptyRoot.
 //
-// if that last block was complete, then no worries. start the next node.
+// To hash the trailing partial block as the final Node, use Finish. An error
+// is reported to the handler set WithErrorHandler, or else printed to
+// os.Stderr, and nil returned. Use SumE to have the error returned.
 func (mh *merkleHash) Sum(b []byte) []byte {
-	var (
-		curBlock = []byte{}
-		offset   int
-	)
-	if mh.partialLastNode {
-		// if this is true, then we need to pop the last node
-		mh.tree.Nodes = mh.tree.Nodes[:len(mh.tree.Nodes)-1]
-		mh.partialLastNode = false
-	}
-
-	if mh.lastBlockLen > 0 {
-		curBlock = append(curBlock[:], mh.lastBlock[:mh.lastBlockLen]...)
-		mh.lastBlockLen = 0
+	sum, err := mh.SumE(b)
+	if err != nil {
+		mh.opts.sumError(err)
+		return nil
 	}
+	return sum
+}
 
-	if b != nil && len(b) > 0 {
-		curBlock = append(curBlock, b...)
-	}
+// SumE is Sum, returning any error of checksumming the partial block or the
+// root
+func (mh *merkleHash) SumE(b []byte) ([]byte, error) {
+	mh.finalized = true
 
 	// incase we're at a new or reset state
-	if len(mh.tree.Nodes) == 0 && len(curBlock) == 0 {
-		return nil
+	if mh.base.End == 0 && len(mh.tree.Nodes) == 0 && mh.lastBlockLen == 0 {
+		if mh.opts.emptyRoot {
+			return append(b, mh.opts.commitRoot(mh.hm, EmptyRoot(mh.hm), 0, mh.blockSize)...), nil
+		}
+		return b, nil
 	}
 
-	for i := 0; i < len(curBlock)/mh.blockSize; i++ {
-		n, err := NewNodeHashBlock(mh.hm, curBlock[offset:(offset+mh.blockSize)])
+	var partial *Node
+	if mh.lastBlockLen > 0 {
+		var err error
+		partial, err = mh.opts.finalBlock.NewNode(mh.hm, mh.blockSize, mh.lastBlock[:mh.lastBlockLen])
 		if err != nil {
-			// XXX i hate to swallow an error here, but the `Sum() []byte` signature
-			// :-\
-			sBuf := make([]byte, 1024)
-			runtime.Stack(sBuf, false)
-			fmt.Fprintf(os.Stderr, "[ERROR]: %s %q", err, string(sBuf))
-			return nil
+			return nil, err
 		}
-		mh.tree.Nodes = append(mh.tree.Nodes, n)
-		offset = offset + mh.blockSize
 	}
 
-	// If there is remainder, we'll need to make a partial node and stash it
-	if m := (len(curBlock) % mh.blockSize); m != 0 {
-		mh.lastBlockLen = copy(mh.lastBlock, curBlock[offset:])
+	sum, err := mh.rootChecksum(partial)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, mh.opts.commitRoot(mh.hm, sum, mh.TotalLength(), mh.blockSize)...), nil
+}
 
-		n, err := NewNodeHashBlock(mh.hm, curBlock[offset:])
-		if err != nil {
-			sBuf := make([]byte, 1024)
-			runtime.Stack(sBuf, false)
-			fmt.Fprintf(os.Stderr, "[ERROR]: %s %q", err, string(sBuf))
-			return nil
+// rootChecksum is the root of the leaves so far, following those of the base,
+// and then partial if not nil
+func (mh *merkleHash) rootChecksum(partial *Node) ([]byte, error) {
+	if mh.base.End == 0 {
+		if partial == nil {
+			return mh.tree.RootChecksum()
 		}
-		mh.tree.Nodes = append(mh.tree.Nodes, n)
-		mh.partialLastNode = true
+		return mh.tree.rootWith(partial)
 	}
+	s, err := mh.summary(partial)
+	if err != nil {
+		return nil, err
+	}
+	return s.Root(mh.hm)
+}
 
-	sum, err := mh.tree.Root().Checksum()
+// summary is the SubtreeSummary of all the leaves so far, including the base,
+// and then partial if not nil
+func (mh *merkleHash) summary(partial *Node) (SubtreeSummary, error) {
+	sums, err := mh.tree.leafSums()
 	if err != nil {
-		// XXX i hate to swallow an error here, but the `Sum() []byte` signature
-		// :-\
-		sBuf := make([]byte, 1024)
-		runtime.Stack(sBuf, false)
-		fmt.Fprintf(os.Stderr, "[ERROR]: %s %q", err, string(sBuf))
-		return nil
+		return SubtreeSummary{}, err
 	}
-	return sum
+	if partial != nil {
+		sums = append(sums, partial.checksum())
+	}
+	s, err := SummarizeLeaves(mh.hm, mh.base.End, sums)
+	if err != nil {
+		return SubtreeSummary{}, err
+	}
+	return CombineSubtrees(mh.hm, mh.base, s)
 }
 
-func (mh *merkleHash) Write(b []byte) (int, error) {
-	// basically we need to:
-	// * include prior partial lastBlock, if any
-	// * chunk these writes into blockSize
-	// * create Node of the sum
-	// * add the Node to the tree
-	// * stash remainder in the mh.lastBlock
+// XXX i hate to swallow an error here, but the `Sum() []byte` signature :-\
+func logSumError(err error) {
+	sBuf := make([]byte, 1024)
+	runtime.Stack(sBuf, false)
+	fmt.Fprintf(os.Stderr, "[ERROR]: %s %q", err, string(sBuf))
+}
+
+// WriteFinal writes b as the last of the data, and then is Finish
+func (mh *merkleHash) WriteFinal(b []byte) ([]byte, error) {
+	if _, err := mh.Write(b); err != nil {
+		return nil, err
+	}
+	return mh.Finish()
+}
 
+// Finish hashes any trailing partial block as the last Node of the tree, and
+// returns the checksum of the root. Bytes written after this start a new
+// block. With nothing written, this is ErrEmptyTree unless WithEmptyRoot.
+func (mh *merkleHash) Finish() ([]byte, error) {
+	mh.finalized = true
+	if mh.lastBlockLen > 0 {
+		n, err := mh.opts.finalBlock.NewNode(mh.hm, mh.blockSize, mh.lastBlock[:mh.lastBlockLen])
+		if err != nil {
+			return nil, err
+		}
+		mh.tree.appendLeaf(n, mh.lastBlockLen)
+		mh.lastBlockLen = 0
+	}
 	var (
-		curBlock   = make([]byte, mh.blockSize)
-		numBytes   int
-		numWritten int
-		offset     int
+		root []byte
+		err  error
 	)
-	if mh.lastBlock != nil && mh.lastBlockLen > 0 {
-		if (mh.lastBlockLen + len(b)) < mh.blockSize {
-			mh.lastBlockLen += copy(mh.lastBlock[mh.lastBlockLen:], b[:])
+	if mh.base.End == 0 && len(mh.tree.Nodes) == 0 {
+		root, err = mh.opts.emptyTreeRoot(mh.hm)
+	} else {
+		root, err = mh.rootChecksum(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mh.opts.commitRoot(mh.hm, root, mh.TotalLength(), mh.blockSize), nil
+}
+
+// Write chunks b into blocks, adding a Node to the tree for each whole block
+// and stashing the remainder until the next Write (or Sum).
+//
+// It returns len(b) on success. If checksumming a block fails, the returned
+// count is of the bytes of b that made it into the tree, and the state is as
+// though only those bytes had been written. So writing the rest of b again
+// continues where this left off.
+//
+// A write beyond the limits of WithMaxLeaves or WithMaxBytes writes nothing,
+// and returns an ErrLimitExceeded. WithStrictLifecycle, a write after Sum or
+// Finish writes nothing, and returns ErrFinalized.
+func (mh *merkleHash) Write(b []byte) (int, error) {
+	if mh.opts.strict && mh.finalized {
+		return 0, ErrFinalized
+	}
+	leaves := mh.base.End + len(mh.tree.Nodes)
+	if err := mh.opts.checkLimits(mh.blockSize, mh.TotalLength(), leaves, mh.lastBlockLen, int64(len(b))); err != nil {
+		return 0, err
+	}
+
+	n, err := mh.write(b)
+	mh.tree.length += int64(n)
+	return n, err
+}
+
+func (mh *merkleHash) write(b []byte) (int, error) {
+	var offset int
+
+	// fill out the prior partial block first
+	if mh.lastBlockLen > 0 {
+		if mh.lastBlockLen+len(b) < mh.blockSize {
+			mh.lastBlockLen += copy(mh.lastBlock[mh.lastBlockLen:], b)
 			return len(b), nil
 		}
+		offset = copy(mh.lastBlock[mh.lastBlockLen:], b)
+		n, err := mh.slab.hashLeaf(FinalBlockRaw, mh.blockSize, mh.lastBlock)
+		if err != nil {
+			// lastBlockLen is untouched, so the copied bytes are dropped
+			return 0, err
+		}
+		mh.tree.appendLeaf(n, mh.blockSize)
+		mh.lastBlockLen = 0
+	}
 
-		//                                         XXX off by one?
-		numBytes = copy(curBlock[:], mh.lastBlock[:mh.lastBlockLen])
-		// not adding to numWritten, since these blocks were accounted for in a
-		// prior Write()
-
-		// then we'll chunk the front of the incoming bytes
-		end := mh.blockSize - numBytes
-		if end > len(b) {
-			end = len(b)
+	if mh.parallel && len(b)-offset >= 2*mh.blockSize {
+		blocks := make([][]byte, (len(b)-offset)/mh.blockSize)
+		for i := range blocks {
+			blocks[i] = b[offset+i*mh.blockSize : offset+(i+1)*mh.blockSize]
 		}
-		offset = copy(curBlock[numBytes:], b[:end])
-		n, err := NewNodeHashBlock(mh.hm, curBlock)
+		nodes, err := hashBlocks(mh.hm, blocks, mh.opts)
 		if err != nil {
-			// XXX might need to stash again the prior lastBlock and first little chunk
-			return numWritten, err
+			return offset, err
 		}
-		mh.tree.Nodes = append(mh.tree.Nodes, n)
-		numWritten += offset
+		for _, n := range nodes {
+			mh.tree.appendLeaf(n, mh.blockSize)
+		}
+		offset += len(blocks) * mh.blockSize
 	}
 
-	numBytes = (len(b) - offset)
-	for i := 0; i < numBytes/mh.blockSize; i++ {
-		//fmt.Printf("%s", b[offset:offset+mh.blockSize])
-		numWritten += copy(curBlock, b[offset:offset+mh.blockSize])
-		n, err := NewNodeHashBlock(mh.hm, curBlock)
+	for ; len(b)-offset >= mh.blockSize; offset += mh.blockSize {
+		n, err := mh.slab.hashLeaf(FinalBlockRaw, mh.blockSize, b[offset:offset+mh.blockSize])
 		if err != nil {
-			// XXX might need to stash again the prior lastBlock and first little chunk
-			return numWritten, err
+			return offset, err
 		}
-		mh.tree.Nodes = append(mh.tree.Nodes, n)
-		offset = offset + mh.blockSize
+		mh.tree.appendLeaf(n, mh.blockSize)
+		mh.opts.yield()
 	}
 
-	mh.lastBlockLen = numBytes % mh.blockSize
-	//                                       XXX off by one?
-	numWritten += copy(mh.lastBlock[:], b[(len(b)-mh.lastBlockLen):])
+	mh.lastBlockLen = copy(mh.lastBlock, b[offset:])
+	return len(b), nil
+}
+
+// WriteString is Write of the bytes of s
+func (mh *merkleHash) WriteString(s string) (int, error) {
+	return mh.Write([]byte(s))
+}
 
-	return numWritten, nil
+// ReadFrom writes the bytes of r until io.EOF, whole blocks at a time, and
+// returns the count of bytes written. The blocks are read ahead of hashing
+// them, as set WithReadAhead.
+func (mh *merkleHash) ReadFrom(r io.Reader) (int64, error) {
+	blocks := readFromBlocks
+	if mh.parallel {
+		blocks *= mh.opts.hashWorkers
+	}
+	return readAhead(r, mh.blockSize*blocks, mh.opts.readAhead, mh.Write)
 }
 
+// readFromBlocks is the count of blocks ReadFrom reads at a time
+const readFromBlocks = 16
+
 // likely not the best to pass this through and not use our own node block
 // size, but let's revisit this.
 func (mh *merkleHash) BlockSize() int { return mh.hm().BlockSize() }
@@ -1,14 +1,17 @@
 package merkle
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"crypto/sha512"
 	"fmt"
 	"hash"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"testing"
+	"testing/iotest"
 )
 
 func TestMerkleHashWriterLargeChunk(t *testing.T) {
@@ -85,8 +88,7 @@ func TestMerkleHashWriter(t *testing.T) {
 		t.Errorf("expected initial checksum %q; got %q", expectedSum, gotSum)
 	}
 
-	// count blocks again, we should get 5 nodes now
-	expectedNum = 5
+	// Sum leaves the tree as is, with the partial block still pending
 	if len(h.Nodes()) != expectedNum {
 		t.Errorf("expected %d nodes, got %d", expectedNum, len(h.Nodes()))
 	}
@@ -118,7 +120,7 @@ func TestMerkleHashWriter(t *testing.T) {
 		t.Errorf("expected checksum %q; got %q", expectedSum, gotSum)
 	}
 
-	// Write more. This should pop the last node, and use the lastBlock.
+	// Write more. This continues the partial lastBlock.
 	i, err = h.Write(msg)
 	if err != nil {
 		t.Fatal(err)
@@ -126,7 +128,7 @@ func TestMerkleHashWriter(t *testing.T) {
 	if i != len(msg) {
 		t.Fatalf("expected to write %d, only wrote %d", len(msg), i)
 	}
-	expectedNum = 9
+	expectedNum = 8
 	if len(h.Nodes()) != expectedNum {
 		t.Errorf("expected %d nodes, got %d", expectedNum, len(h.Nodes()))
 	}
@@ -140,6 +142,304 @@ func TestMerkleHashWriter(t *testing.T) {
 
 }
 
+func TestMerkleHashWriteBoundaries(t *testing.T) {
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+	expectedSum := "48940c1c72636648ad40aa59c162f2208e835b38"
+
+	for chunk := 1; chunk <= len(msg); chunk++ {
+		h := NewHash(DefaultHashMaker, 10)
+		for i := 0; i < len(msg); i += chunk {
+			end := i + chunk
+			if end > len(msg) {
+				end = len(msg)
+			}
+			n, err := h.Write(msg[i:end])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != end-i {
+				t.Errorf("chunk %d: expected to write %d, wrote %d", chunk, end-i, n)
+			}
+		}
+		if gotSum := fmt.Sprintf("%x", h.Sum(nil)); gotSum != expectedSum {
+			t.Errorf("chunk %d: expected checksum %q; got %q", chunk, expectedSum, gotSum)
+		}
+		if len(h.Nodes()) != 4 {
+			t.Errorf("chunk %d: expected 4 nodes before Finish, got %d", chunk, len(h.Nodes()))
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(DefaultHashMaker, 0); err == nil {
+		t.Errorf("expected an error for a zero block length")
+	} else if _, ok := err.(ErrInvalidBlockLength); !ok {
+		t.Errorf("expected ErrInvalidBlockLength, got %T", err)
+	}
+	if _, err := New(nil, 10); err == nil {
+		t.Errorf("expected an error for a nil HashMaker")
+	} else if _, ok := err.(ErrInvalidHashMaker); !ok {
+		t.Errorf("expected ErrInvalidHashMaker, got %T", err)
+	}
+	if _, err := New(func() hash.Hash { return nil }, 10); err == nil {
+		t.Errorf("expected an error for a HashMaker of nil")
+	}
+
+	h, err := New(DefaultHashMaker, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Write([]byte("the quick brown fox jumps over the lazy dog")); err != nil {
+		t.Fatal(err)
+	}
+	if gotSum := fmt.Sprintf("%x", h.Sum(nil)); gotSum != "48940c1c72636648ad40aa59c162f2208e835b38" {
+		t.Errorf("unexpected checksum %q", gotSum)
+	}
+}
+
+func TestMerkleHashFinish(t *testing.T) {
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+	expectedSum := "48940c1c72636648ad40aa59c162f2208e835b38"
+
+	h := NewHash(DefaultHashMaker, 10)
+	if _, err := h.Write(msg[:20]); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := h.WriteFinal(msg[20:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotSum := fmt.Sprintf("%x", sum); gotSum != expectedSum {
+		t.Errorf("expected checksum %q; got %q", expectedSum, gotSum)
+	}
+
+	// Sum appends to its argument, rather than hashing it
+	prefix := []byte("prefix")
+	if got := h.Sum(prefix); !bytes.Equal(got, append([]byte("prefix"), sum...)) {
+		t.Errorf("expected %q followed by the checksum; got %q", prefix, got)
+	}
+	if len(h.Nodes()) != 5 {
+		t.Errorf("expected 5 nodes, got %d", len(h.Nodes()))
+	}
+
+	// writing after Finish starts a new block
+	if _, err := h.Write(msg[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Nodes()) != 6 {
+		t.Errorf("expected 6 nodes, got %d", len(h.Nodes()))
+	}
+
+	h.Reset()
+	if _, err := h.Finish(); err != ErrEmptyTree {
+		t.Errorf("expected %q, got %v", ErrEmptyTree, err)
+	}
+}
+
+func TestEmptyRoot(t *testing.T) {
+	// the checksum of no bytes
+	expected := "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+
+	h, err := New(DefaultHashMaker, 10, WithEmptyRoot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%x", h.Sum(nil)); got != expected {
+		t.Errorf("expected empty root %q; got %q", expected, got)
+	}
+	sum, err := h.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%x", sum); got != expected {
+		t.Errorf("expected empty root %q; got %q", expected, got)
+	}
+
+	tree, root, err := NewBuilder(DefaultHashMaker, 10, WithEmptyRoot()).Build(bytes.NewReader(nil), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%x", root); got != expected || len(tree.Nodes) != 0 {
+		t.Errorf("expected empty root %q and no nodes; got %q and %d nodes", expected, got, len(tree.Nodes))
+	}
+
+	// without the option, there is no root
+	if _, err := NewHash(DefaultHashMaker, 10).Finish(); err != ErrEmptyTree {
+		t.Errorf("expected %q, got %v", ErrEmptyTree, err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+
+	h, err := New(DefaultHashMaker, 10, WithMaxBytes(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	n, err := h.Write(msg)
+	if _, ok := err.(ErrLimitExceeded); !ok {
+		t.Errorf("expected ErrLimitExceeded, got %v", err)
+	}
+	if n != 0 {
+		t.Errorf("expected nothing written, got %d", n)
+	}
+	if gotSum := fmt.Sprintf("%x", h.Sum(nil)); gotSum != "48940c1c72636648ad40aa59c162f2208e835b38" {
+		t.Errorf("expected the rejected write to not be hashed, got %q", gotSum)
+	}
+
+	// the trailing partial block counts as a leaf
+	h, err = New(DefaultHashMaker, 10, WithMaxLeaves(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Write(msg[:40]); err != nil {
+		t.Fatal(err)
+	}
+	h.Sum(nil)
+	if _, err := h.Write(msg[40:]); err == nil {
+		t.Errorf("expected a fifth leaf to exceed the limit")
+	}
+
+	b := NewBuilder(DefaultHashMaker, 10, WithMaxLeaves(4))
+	if _, err := b.Write(msg); err == nil {
+		t.Errorf("expected the builder to exceed the limit")
+	}
+	if _, _, err := b.Build(bytes.NewReader(msg), int64(len(msg))); err == nil {
+		t.Errorf("expected the builder to exceed the limit")
+	}
+}
+
+func TestTotalLength(t *testing.T) {
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+
+	h := NewHash(DefaultHashMaker, 10)
+	for i := 0; i < 3; i++ {
+		if _, err := h.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		h.Sum(nil)
+	}
+	if h.TotalLength() != int64(3*len(msg)) {
+		t.Errorf("expected length %d, got %d", 3*len(msg), h.TotalLength())
+	}
+	h.Reset()
+	if h.TotalLength() != 0 {
+		t.Errorf("expected length 0 after Reset, got %d", h.TotalLength())
+	}
+
+	b := NewBuilder(DefaultHashMaker, 10)
+	tree, _, err := b.Build(bytes.NewReader(msg), int64(len(msg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.TotalLength() != int64(len(msg)) {
+		t.Errorf("expected length %d, got %d", len(msg), tree.TotalLength())
+	}
+	if _, err := b.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	tree, _, err = b.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.TotalLength() != int64(len(msg)) {
+		t.Errorf("expected length %d, got %d", len(msg), tree.TotalLength())
+	}
+}
+
+func TestStrictLifecycle(t *testing.T) {
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+
+	h, err := New(DefaultHashMaker, 10, WithStrictLifecycle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	expected := h.Sum(nil)
+	if _, err := h.Write(msg); err != ErrFinalized {
+		t.Errorf("expected %q, got %v", ErrFinalized, err)
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, expected) {
+		t.Errorf("expected the rejected write to not change the sum")
+	}
+	if _, err := h.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Write(msg); err != ErrFinalized {
+		t.Errorf("expected %q, got %v", ErrFinalized, err)
+	}
+
+	h.Reset()
+	if _, err := h.Write(msg); err != nil {
+		t.Errorf("expected writes after Reset, got %v", err)
+	}
+}
+
+// countdownHashMaker makes hashes that fail to Write once *countdown of them
+// have been made
+func countdownHashMaker(countdown *int) HashMaker {
+	return func() hash.Hash {
+		if *countdown == 0 {
+			return failingHash{DefaultHashMaker()}
+		}
+		*countdown--
+		return DefaultHashMaker()
+	}
+}
+
+func TestMerkleHashWriteError(t *testing.T) {
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+	expectedSum := "48940c1c72636648ad40aa59c162f2208e835b38"
+
+	// failing on the block joined with the prior partial block
+	countdown := -1
+	h := NewHash(countdownHashMaker(&countdown), 10)
+	if _, err := h.Write(msg[:5]); err != nil {
+		t.Fatal(err)
+	}
+	countdown = 0
+	n, err := h.Write(msg[5:])
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if n != 0 {
+		t.Errorf("expected nothing written, got %d", n)
+	}
+	countdown = -1
+	if _, err := h.Write(msg[n+5:]); err != nil {
+		t.Fatal(err)
+	}
+	if gotSum := fmt.Sprintf("%x", h.Sum(nil)); gotSum != expectedSum {
+		t.Errorf("expected checksum %q; got %q", expectedSum, gotSum)
+	}
+
+	// failing part way through the whole blocks
+	countdown = 2
+	h = NewHash(countdownHashMaker(&countdown), 10)
+	n, err = h.Write(msg)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if n != 20 {
+		t.Errorf("expected 20 written, got %d", n)
+	}
+	countdown = -1
+	if _, err := h.Write(msg[n:]); err != nil {
+		t.Fatal(err)
+	}
+	if gotSum := fmt.Sprintf("%x", h.Sum(nil)); gotSum != expectedSum {
+		t.Errorf("expected checksum %q; got %q", expectedSum, gotSum)
+	}
+}
+
 var benchDefault = NewHash(DefaultHashMaker, 8192)
 var benchSha256 = NewHash(func() hash.Hash { return sha256.New() }, 8192)
 var benchSha512 = NewHash(func() hash.Hash { return sha512.New() }, 8192)
@@ -190,3 +490,192 @@ func BenchmarkSha512Hash1K(b *testing.B) {
 func BenchmarkSha512Hash8K(b *testing.B) {
 	benchmarkSize(benchSha512, b, 8192)
 }
+
+func TestSumOf(t *testing.T) {
+	data := bytes.Repeat([]byte("abcdefg"), 100)
+	tree, err := SumOf(DefaultHashMaker, 64, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHash(DefaultHashMaker, 64)
+	h.Write(data)
+	expected, err := h.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := tree.RootChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root, expected) || len(tree.Nodes) != 11 || tree.TotalLength() != 700 {
+		t.Errorf("expected the tree of 11 leaves and root %x, got %d leaves and root %x", expected, len(tree.Nodes), root)
+	}
+	if _, err := SumOf(DefaultHashMaker, 64, nil); err != ErrEmptyTree {
+		t.Errorf("expected ErrEmptyTree for no data, got %v", err)
+	}
+	if _, err := SumOf(DefaultHashMaker, 0, data); err == nil {
+		t.Errorf("expected an invalid block length to fail")
+	}
+}
+
+func TestWriteStringReadFrom(t *testing.T) {
+	data := bytes.Repeat([]byte("abcdefg"), 1000)
+	h := NewHash(DefaultHashMaker, 64)
+	h.Write(data)
+	expected, err := h.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h = NewHash(DefaultHashMaker, 64)
+	if n, err := h.WriteString(string(data)); err != nil || n != len(data) {
+		t.Fatalf("expected %d bytes written, got %d %v", len(data), n, err)
+	}
+	if root, err := h.Finish(); err != nil || !bytes.Equal(root, expected) {
+		t.Errorf("WriteString: expected root %x, got %x %v", expected, root, err)
+	}
+
+	h = NewHash(DefaultHashMaker, 64)
+	// a reader of odd sized reads, not aligned to the blocks
+	r := iotest.HalfReader(bytes.NewReader(data))
+	if n, err := io.Copy(h, r); err != nil || n != int64(len(data)) {
+		t.Fatalf("expected %d bytes read, got %d %v", len(data), n, err)
+	}
+	if root, err := h.Finish(); err != nil || !bytes.Equal(root, expected) {
+		t.Errorf("ReadFrom: expected root %x, got %x %v", expected, root, err)
+	}
+}
+
+func TestHashParallel(t *testing.T) {
+	data := make([]byte, 100*64+10)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	expected := NewHash(DefaultHashMaker, 64)
+	expected.Write(data)
+	root, err := expected.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{1, 2, 4, 16} {
+		h := NewHashParallel(DefaultHashMaker, 64, workers)
+		// a partial block, then writes of many blocks not on a block boundary
+		for _, chunk := range [][]byte{data[:10], data[10:3000], data[3000:]} {
+			if _, err := h.Write(chunk); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := h.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, root) || len(h.Nodes()) != len(expected.Nodes()) {
+			t.Errorf("%d workers: expected the root %x of %d leaves, got %x of %d", workers, root, len(expected.Nodes()), got, len(h.Nodes()))
+		}
+		for i, n := range h.Nodes() {
+			if n.Index != i || n.Offset != int64(i)*64 {
+				t.Fatalf("%d workers: leaf %d positioned at %d, %d", workers, i, n.Index, n.Offset)
+			}
+		}
+
+		h.Reset()
+		if _, err := h.ReadFrom(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := h.Finish(); !bytes.Equal(got, root) {
+			t.Errorf("%d workers: expected the root %x from ReadFrom, got %x", workers, root, got)
+		}
+	}
+}
+
+func BenchmarkHashParallel(b *testing.B) {
+	data := make([]byte, 64*1024*1024)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			h := NewHashParallel(DefaultHashMaker, 8192, workers)
+			for i := 0; i < b.N; i++ {
+				h.Reset()
+				if _, err := h.ReadFrom(bytes.NewReader(data)); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := h.Finish(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSumIdempotent(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, 5000)
+	rnd.Read(data)
+
+	for round := 0; round < 200; round++ {
+		size := rnd.Intn(len(data))
+		opts := []Option{WithFinalBlockPolicy(FinalBlockLengthSuffixed)}
+		if round%2 == 0 {
+			opts = append(opts, WithLengthCommitment())
+		}
+		oneShot, _ := New(DefaultHashMaker, 64, opts...)
+		oneShot.Write(data[:size])
+		expected := oneShot.Sum(nil)
+
+		// writes of random lengths, with Sums of no consequence between
+		h, _ := New(DefaultHashMaker, 64, opts...)
+		for written := 0; written < size; {
+			n := rnd.Intn(200)
+			if written+n > size {
+				n = size - written
+			}
+			h.Write(data[written : written+n])
+			written += n
+			for sums := rnd.Intn(3); sums > 0; sums-- {
+				before := len(h.Nodes())
+				h.Sum(nil)
+				if len(h.Nodes()) != before {
+					t.Fatalf("round %d: Sum changed the tree from %d to %d leaves", round, before, len(h.Nodes()))
+				}
+			}
+		}
+		if got := h.Sum(nil); !bytes.Equal(got, expected) {
+			t.Fatalf("round %d: expected %x for %d bytes, got %x", round, expected, size, got)
+		}
+		if got := h.Sum(nil); !bytes.Equal(got, expected) {
+			t.Fatalf("round %d: expected a second Sum of %x, got %x", round, expected, got)
+		}
+		if size == 0 {
+			continue
+		}
+		if got, err := h.Finish(); err != nil || !bytes.Equal(got, expected) {
+			t.Fatalf("round %d: expected Finish to be %x, got %x, %v", round, expected, got, err)
+		}
+	}
+}
+
+func TestSumE(t *testing.T) {
+	failing := func() hash.Hash { return failingHash{DefaultHashMaker()} }
+	var handled []error
+	h, err := New(failing, 10, WithErrorHandler(func(err error) { handled = append(handled, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Write([]byte("short")) // a partial block, not yet hashed
+	if sum, err := h.SumE(nil); err == nil || sum != nil {
+		t.Errorf("expected the error of the partial block, got %x, %v", sum, err)
+	}
+	if sum := h.Sum(nil); sum != nil || len(handled) != 1 {
+		t.Errorf("expected Sum to report the error to the handler, got %x and %d errors", sum, len(handled))
+	}
+
+	ok := NewHash(DefaultHashMaker, 10)
+	ok.Write([]byte("the quick brown fox"))
+	sum, err := ok.SumE([]byte("prefix"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := ok.Sum([]byte("prefix")); !bytes.Equal(sum, expected) {
+		t.Errorf("expected SumE to be Sum, %x, got %x", expected, sum)
+	}
+}
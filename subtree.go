@@ -0,0 +1,194 @@
+package merkle
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// SubtreeSummary is the state of hashing the leaves [Start, End) of a tree,
+// as the checksums of the largest aligned complete subtrees covering those
+// leaves (the frontier), in order.
+//
+// Summaries of adjacent ranges combine into the summary of their union, so
+// separate workers, or machines, can each hash a range of one object and the
+// final root is assembled from their summaries.
+type SubtreeSummary struct {
+	Start    int      `json:"start"`
+	End      int      `json:"end"`
+	Frontier [][]byte `json:"frontier"`
+}
+
+// ErrMisalignedSubtrees is for summaries that can not be combined
+type ErrMisalignedSubtrees struct {
+	Msg string
+}
+
+// Error shows why the summaries are misaligned
+func (err ErrMisalignedSubtrees) Error() string {
+	return "misaligned subtrees: " + err.Msg
+}
+
+// SummarizeLeaves returns the summary of the leaf checksums sums, the first of
+// which is at index start of the whole tree
+func SummarizeLeaves(hm HashMaker, start int, sums [][]byte) (SubtreeSummary, error) {
+	s := SubtreeSummary{Start: start, End: start}
+	for _, sum := range sums {
+		leaf := SubtreeSummary{Start: s.End, End: s.End + 1, Frontier: [][]byte{sum}}
+		var err error
+		if s, err = CombineSubtrees(hm, s, leaf); err != nil {
+			return SubtreeSummary{}, err
+		}
+	}
+	return s, nil
+}
+
+// SummarizeReader reads r until EOF in blocks of blockLength, and returns the
+// summary of their leaves, the first of which is at index start of the whole
+// tree. Only the last block read may be short.
+func SummarizeReader(hm HashMaker, blockLength, start int, r io.Reader) (SubtreeSummary, error) {
+	var (
+		pooled = buffers.get(blockLength)
+		buf    = *pooled
+		sums   [][]byte
+	)
+	defer buffers.put(pooled)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			node, err := NewNodeHashBlock(hm, buf[:n])
+			if err != nil {
+				return SubtreeSummary{}, err
+			}
+			sums = append(sums, node.checksum())
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return SubtreeSummary{}, err
+		}
+	}
+	return SummarizeLeaves(hm, start, sums)
+}
+
+// CombineSubtrees returns the summary of the union of a and b, where b starts
+// at the leaf a ends on
+func CombineSubtrees(hm HashMaker, a, b SubtreeSummary) (SubtreeSummary, error) {
+	if err := a.validate(); err != nil {
+		return SubtreeSummary{}, err
+	}
+	if err := b.validate(); err != nil {
+		return SubtreeSummary{}, err
+	}
+	if a.End != b.Start {
+		return SubtreeSummary{}, ErrMisalignedSubtrees{Msg: fmt.Sprintf("[%d, %d) is not followed by [%d, %d)", a.Start, a.End, b.Start, b.End)}
+	}
+
+	type node struct {
+		level, index int
+		sum          []byte
+	}
+	var stack []node
+	for _, s := range []SubtreeSummary{a, b} {
+		for i, pos := range decompose(s.Start, s.End) {
+			n := node{level: pos[0], index: pos[1], sum: s.Frontier[i]}
+			// merge with the left sibling, as long as there is one
+			for len(stack) > 0 {
+				top := stack[len(stack)-1]
+				if top.level != n.level || top.index%2 != 0 || top.index+1 != n.index {
+					break
+				}
+				sum, err := hashChildren(hm, top.sum, n.sum)
+				if err != nil {
+					return SubtreeSummary{}, err
+				}
+				stack = stack[:len(stack)-1]
+				n = node{level: n.level + 1, index: top.index / 2, sum: sum}
+			}
+			stack = append(stack, n)
+		}
+	}
+
+	c := SubtreeSummary{Start: a.Start, End: b.End, Frontier: make([][]byte, len(stack))}
+	for i, n := range stack {
+		c.Frontier[i] = n.sum
+	}
+	return c, nil
+}
+
+// Root returns the root checksum of a summary that covers a whole tree
+func (s SubtreeSummary) Root(hm HashMaker) ([]byte, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	if s.Start != 0 {
+		return nil, ErrMisalignedSubtrees{Msg: fmt.Sprintf("[%d, %d) does not start at the first leaf", s.Start, s.End)}
+	}
+	if s.End == 0 {
+		return nil, ErrEmptyTree
+	}
+	return foldFrontier(hm, s.Frontier)
+}
+
+// foldFrontier is the root of a frontier of decreasing perfect subtrees, as of
+// a whole tree, where the smaller ones are pushed up the right edge
+func foldFrontier(hm HashMaker, frontier [][]byte) ([]byte, error) {
+	root := frontier[len(frontier)-1]
+	for i := len(frontier) - 2; i >= 0; i-- {
+		var err error
+		if root, err = hashChildren(hm, frontier[i], root); err != nil {
+			return nil, err
+		}
+	}
+	return root, nil
+}
+
+// AssembleRoot combines the summaries, in any order, into the root checksum of
+// the whole tree. The summaries must cover the leaves from the first, without
+// gaps or overlaps.
+func AssembleRoot(hm HashMaker, summaries ...SubtreeSummary) ([]byte, error) {
+	if len(summaries) == 0 {
+		return nil, ErrEmptyTree
+	}
+	sorted := append([]SubtreeSummary{}, summaries...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	whole := sorted[0]
+	for _, s := range sorted[1:] {
+		var err error
+		if whole, err = CombineSubtrees(hm, whole, s); err != nil {
+			return nil, err
+		}
+	}
+	return whole.Root(hm)
+}
+
+func (s SubtreeSummary) validate() error {
+	if s.Start < 0 || s.End < s.Start {
+		return ErrMisalignedSubtrees{Msg: fmt.Sprintf("invalid range [%d, %d)", s.Start, s.End)}
+	}
+	if expected := len(decompose(s.Start, s.End)); len(s.Frontier) != expected {
+		return ErrMisalignedSubtrees{Msg: fmt.Sprintf("[%d, %d) needs %d frontier checksums, got %d", s.Start, s.End, expected, len(s.Frontier))}
+	}
+	return nil
+}
+
+// decompose splits the leaves [begin, end) into the largest aligned complete
+// subtrees, as pairs of their level (0 for leaves) and index within the level
+func decompose(begin, end int) [][2]int {
+	var nodes [][2]int
+	for begin < end {
+		level := 0
+		for {
+			size := 1 << uint(level+1)
+			if begin%size != 0 || begin+size > end {
+				break
+			}
+			level++
+		}
+		nodes = append(nodes, [2]int{level, begin >> uint(level)})
+		begin += 1 << uint(level)
+	}
+	return nodes
+}
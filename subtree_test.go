@@ -0,0 +1,103 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestSubtreeSummaries(t *testing.T) {
+	for size := 1; size <= 33; size++ {
+		tree := testTree(t, size)
+		sums, err := tree.leafSums()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := tree.Root().Checksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for split := 1; split <= size; split++ {
+			// hash in ranges of split leaves, and assemble them out of order
+			var summaries []SubtreeSummary
+			for start := 0; start < size; start += split {
+				end := start + split
+				if end > size {
+					end = size
+				}
+				s, err := SummarizeLeaves(DefaultHashMaker, start, sums[start:end])
+				if err != nil {
+					t.Fatal(err)
+				}
+				// summaries travel between machines
+				buf, err := json.Marshal(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var s2 SubtreeSummary
+				if err := json.Unmarshal(buf, &s2); err != nil {
+					t.Fatal(err)
+				}
+				summaries = append([]SubtreeSummary{s2}, summaries...)
+			}
+			root, err := AssembleRoot(DefaultHashMaker, summaries...)
+			if err != nil {
+				t.Fatalf("size %d, split %d: %s", size, split, err)
+			}
+			if !bytes.Equal(root, expected) {
+				t.Errorf("size %d, split %d: expected root %x; got %x", size, split, expected, root)
+			}
+		}
+	}
+}
+
+func TestSubtreeSummaryMisaligned(t *testing.T) {
+	sums, err := testTree(t, 8).leafSums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := SummarizeLeaves(DefaultHashMaker, 0, sums[:3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := SummarizeLeaves(DefaultHashMaker, 4, sums[4:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CombineSubtrees(DefaultHashMaker, a, b); err == nil {
+		t.Errorf("expected an error combining a gap")
+	}
+	if _, err := AssembleRoot(DefaultHashMaker, b); err == nil {
+		t.Errorf("expected an error for summaries not starting at the first leaf")
+	}
+	b.Frontier = b.Frontier[:0]
+	if _, err := b.Root(DefaultHashMaker); err == nil {
+		t.Errorf("expected an error for a truncated frontier")
+	}
+}
+
+func TestSummarizeReader(t *testing.T) {
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	h := NewHash(DefaultHashMaker, 10)
+	if _, err := h.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	expected := h.Sum(nil)
+
+	a, err := SummarizeReader(DefaultHashMaker, 10, 0, bytes.NewReader(data[:20]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := SummarizeReader(DefaultHashMaker, 10, 2, bytes.NewReader(data[20:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := AssembleRoot(DefaultHashMaker, b, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root, expected) {
+		t.Errorf("expected root %x; got %x", expected, root)
+	}
+}
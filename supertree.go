@@ -0,0 +1,88 @@
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// SuperTree is a tree whose leaves are the roots of other trees, as of the
+// files of a release, the shards of an object or the epochs of a log. A block
+// of any of those trees is proven under the super-root with a ChainProof.
+type SuperTree struct {
+	Names []string // of the trees, in the order added
+	Roots [][]byte // of the trees, in the order added
+
+	hm HashMaker
+}
+
+// NewSuperTree returns an empty SuperTree, of trees checksummed with hm
+func NewSuperTree(hm HashMaker) *SuperTree {
+	return &SuperTree{hm: hm}
+}
+
+// Add adds the root of tree as the next leaf, and returns its index
+func (st *SuperTree) Add(name string, tree *Tree) (int, error) {
+	root, err := tree.RootChecksum()
+	if err != nil {
+		return 0, err
+	}
+	return st.AddRoot(name, root), nil
+}
+
+// AddRoot adds root as the next leaf, and returns its index
+func (st *SuperTree) AddRoot(name string, root []byte) int {
+	st.Names = append(st.Names, name)
+	st.Roots = append(st.Roots, root)
+	return len(st.Roots) - 1
+}
+
+// Root is the super-root, over the roots added
+func (st *SuperTree) Root() ([]byte, error) {
+	return subtreeHash(st.hm, st.Roots)
+}
+
+// ChainProof links a block to the root of its tree, and that root to the
+// super-root
+type ChainProof struct {
+	Name   string
+	Block  Proof // of the block's leaf in its tree
+	Member Proof // of the tree's root in the SuperTree
+}
+
+// Prove returns the ChainProof of the block at index of tree, which must be
+// the tree added at member
+func (st *SuperTree) Prove(member int, tree *Tree, index int) (ChainProof, error) {
+	if member < 0 || member >= len(st.Roots) {
+		return ChainProof{}, ErrIndexOutOfRange{Index: member, Size: len(st.Roots)}
+	}
+	root, err := tree.RootChecksum()
+	if err != nil {
+		return ChainProof{}, err
+	}
+	if !bytes.Equal(root, st.Roots[member]) {
+		return ChainProof{}, fmt.Errorf("tree is not the %q added at %d", st.Names[member], member)
+	}
+	block, err := tree.InclusionProof(index)
+	if err != nil {
+		return ChainProof{}, err
+	}
+	memberProof, err := auditPath(st.hm, member, st.Roots)
+	if err != nil {
+		return ChainProof{}, err
+	}
+	return ChainProof{
+		Name:   st.Names[member],
+		Block:  block,
+		Member: Proof{Index: member, TreeSize: len(st.Roots), Path: memberProof},
+	}, nil
+}
+
+// VerifyChain checks that leaf, the checksum of a block, is proven under
+// superRoot by p
+func VerifyChain(hm HashMaker, superRoot []byte, p ChainProof, leaf []byte) error {
+	root, err := rootFromProof(hm, p.Block, leaf)
+	if err != nil {
+		return err
+	}
+	return VerifyProof(hm, superRoot, p.Member, root)
+}
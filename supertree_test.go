@@ -0,0 +1,57 @@
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestSuperTree(t *testing.T) {
+	var (
+		st    = NewSuperTree(DefaultHashMaker)
+		trees []*Tree
+	)
+	for i := 0; i < 5; i++ {
+		data := bytes.Repeat([]byte(fmt.Sprintf("file %d;", i)), 10*(i+1))
+		tree, _, err := NewBuilder(DefaultHashMaker, 16).Build(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index, err := st.Add(fmt.Sprintf("file%d", i), tree); err != nil || index != i {
+			t.Fatalf("expected file %d added at %d, got %d %v", i, i, index, err)
+		}
+		trees = append(trees, tree)
+	}
+	root, err := st.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tree := range trees {
+		for j, n := range tree.Nodes {
+			p, err := st.Prove(i, tree, j)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Name != fmt.Sprintf("file%d", i) {
+				t.Errorf("unexpected name %q", p.Name)
+			}
+			if err := VerifyChain(DefaultHashMaker, root, p, n.checksum()); err != nil {
+				t.Errorf("file %d, block %d: %s", i, j, err)
+			}
+		}
+	}
+
+	p, err := st.Prove(1, trees[1], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyChain(DefaultHashMaker, root, p, trees[2].Nodes[0].checksum()); err != ErrTreeHashMismatch {
+		t.Errorf("expected a block of another file to mismatch, got %v", err)
+	}
+	if _, err := st.Prove(1, trees[2], 0); err == nil {
+		t.Errorf("expected a tree other than the member to fail")
+	}
+	if _, err := st.Prove(5, trees[0], 0); err == nil {
+		t.Errorf("expected a member beyond the super tree to fail")
+	}
+}
@@ -0,0 +1,92 @@
+package merkle
+
+import "sync"
+
+// SyncTree guards a Tree for concurrent use.
+//
+// Any number of readers may call Nodes, Len, RootChecksum and InclusionProof
+// while a writer calls Append; each sees the tree either before or after a
+// whole Append. RootChecksum and InclusionProof are of a Snapshot, so the lock
+// is held only to take it, and not while the checksums are computed. Root
+// links the Parent of the tree's nodes, so it excludes all other callers for
+// its duration.
+//
+// The wrapped Tree must not be used directly while it is shared this way.
+type SyncTree struct {
+	mu   sync.RWMutex
+	tree *Tree
+}
+
+// NewSyncTree wraps t for concurrent use
+func NewSyncTree(t *Tree) *SyncTree {
+	return &SyncTree{tree: t}
+}
+
+// Nodes returns a copy of the tree's leaf nodes
+func (st *SyncTree) Nodes() []*Node {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return append([]*Node{}, st.tree.Nodes...)
+}
+
+// NodeRange returns copies of the leaf nodes [start, end)
+func (st *SyncTree) NodeRange(start, end int) ([]*Node, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.tree.NodeRange(start, end)
+}
+
+// Len is the number of leaf nodes in the tree
+func (st *SyncTree) Len() int {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return len(st.tree.Nodes)
+}
+
+// Append adds nodes as leaves to the end of the tree
+func (st *SyncTree) Append(nodes ...*Node) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.tree.Append(nodes...)
+}
+
+// Root generates the hash tree on the current nodes, and returns its root
+func (st *SyncTree) Root() *Node {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.tree.Root()
+}
+
+// RootChecksum returns the checksum of the root of the current nodes, without
+// linking the nodes into a tree
+func (st *SyncTree) RootChecksum() ([]byte, error) {
+	return st.Snapshot().RootChecksum()
+}
+
+// InclusionProof returns the audit path for the leaf at index, at the current
+// size of the tree
+func (st *SyncTree) InclusionProof(index int) (Proof, error) {
+	return st.Snapshot().InclusionProof(index)
+}
+
+// Snapshot returns the tree as it is now, for roots and proofs that are
+// consistent with each other while the writer keeps appending. Appends only
+// add leaves past the end of the snapshot, so it shares the leaves, and
+// taking it is as cheap as copying a slice.
+//
+// The snapshot has no Bloom filter or leaf index, as those of the tree change
+// with each Append. Its Root links the Parent of the shared leaves, so is not
+// to be called while the SyncTree is in use.
+func (st *SyncTree) Snapshot() *Tree {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	n := len(st.tree.Nodes)
+	return &Tree{
+		// capped, so appending to the snapshot can not write over the
+		// leaves appended to the tree since
+		Nodes:       st.tree.Nodes[:n:n],
+		BlockLength: st.tree.BlockLength,
+		FinalBlock:  st.tree.FinalBlock,
+		length:      st.tree.length,
+	}
+}
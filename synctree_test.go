@@ -0,0 +1,103 @@
+package merkle
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestSyncTree(t *testing.T) {
+	var (
+		st    = NewSyncTree(&Tree{BlockLength: 1})
+		nodes = testTree(t, 64).Nodes
+		wg    sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, n := range nodes {
+			st.Append(n)
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for st.Len() < len(nodes) {
+				size := st.Len()
+				if size == 0 {
+					continue
+				}
+				if _, err := st.RootChecksum(); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := st.InclusionProof(size - 1); err != nil {
+					t.Error(err)
+					return
+				}
+				st.Root()
+			}
+		}()
+	}
+	wg.Wait()
+
+	expected, err := (&Tree{Nodes: nodes}).Root().Checksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := st.RootChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, got) {
+		t.Errorf("expected root %x; got %x", expected, got)
+	}
+	if len(st.Nodes()) != len(nodes) {
+		t.Errorf("expected %d nodes, got %d", len(nodes), len(st.Nodes()))
+	}
+}
+
+func TestSyncTreeSnapshot(t *testing.T) {
+	var (
+		st    = NewSyncTree(&Tree{BlockLength: 1})
+		nodes = testTree(t, 40).Nodes
+	)
+	st.Append(nodes[:20]...)
+	snap := st.Snapshot()
+	expected, err := (&Tree{Nodes: nodes[:20]}).RootChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, n := range nodes[20:] {
+			st.Append(n)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		root, err := snap.RootChecksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(root, expected) {
+			t.Fatalf("expected the root of the snapshot unchanged by appends")
+		}
+		if _, err := snap.InclusionProof(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	// appending to the snapshot leaves the tree as it is
+	snap.Append(nodes[0])
+	if got := st.Nodes()[20]; got != nodes[20] {
+		t.Error("expected the leaves of the tree unchanged by appending to a snapshot")
+	}
+	if st.Len() != 40 || len(snap.Nodes) != 21 {
+		t.Errorf("expected 40 and 21 leaves, got %d and %d", st.Len(), len(snap.Nodes))
+	}
+}
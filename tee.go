@@ -0,0 +1,60 @@
+package merkle
+
+import "io"
+
+// TeeHashWriter writes through to a destination while building the tree of
+// the bytes written, so the tree does not need a second pass over the data
+type TeeHashWriter struct {
+	dst     io.Writer
+	mh      *merkleHash
+	written int64
+	tree    *Tree
+}
+
+// NewTeeHashWriter returns a TeeHashWriter writing to dst, with a tree of
+// blockLen blocks checksummed by hm
+func NewTeeHashWriter(dst io.Writer, hm HashMaker, blockLen int) *TeeHashWriter {
+	return &TeeHashWriter{dst: dst, mh: newMerkleHash(hm, blockLen, newOptions(nil))}
+}
+
+// Write writes p to the destination, and hashes the bytes the destination
+// accepted
+func (tw *TeeHashWriter) Write(p []byte) (int, error) {
+	if tw.tree != nil {
+		return 0, ErrWriterClosed
+	}
+	n, err := tw.dst.Write(p)
+	if n > 0 {
+		if _, herr := tw.mh.Write(p[:n]); herr != nil && err == nil {
+			err = herr
+		}
+		tw.written += int64(n)
+	}
+	return n, err
+}
+
+// Close finishes the tree. The destination is not closed.
+func (tw *TeeHashWriter) Close() error {
+	if tw.tree != nil {
+		return nil
+	}
+	if _, err := tw.mh.Finish(); err != nil && err != ErrEmptyTree {
+		return err
+	}
+	tw.tree = &Tree{
+		Nodes:       append([]*Node{}, tw.mh.tree.Nodes...),
+		BlockLength: tw.mh.blockSize,
+		length:      tw.written,
+	}
+	return nil
+}
+
+// Written is the count of bytes written through to the destination
+func (tw *TeeHashWriter) Written() int64 {
+	return tw.written
+}
+
+// Tree is the finished tree of the bytes written, or nil before Close
+func (tw *TeeHashWriter) Tree() *Tree {
+	return tw.tree
+}
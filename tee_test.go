@@ -0,0 +1,47 @@
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestTeeHashWriter(t *testing.T) {
+	msg := "the quick brown fox jumps over the lazy dog"
+	expected := "48940c1c72636648ad40aa59c162f2208e835b38"
+
+	var dst bytes.Buffer
+	tw := NewTeeHashWriter(&dst, DefaultHashMaker, 10)
+	if tw.Tree() != nil {
+		t.Errorf("expected no tree before Close")
+	}
+	if _, err := io.Copy(tw, strings.NewReader(msg)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if dst.String() != msg {
+		t.Errorf("expected %q written through; got %q", msg, dst.String())
+	}
+	if tw.Written() != int64(len(msg)) {
+		t.Errorf("expected %d bytes written, got %d", len(msg), tw.Written())
+	}
+	tree := tw.Tree()
+	if len(tree.Nodes) != 5 {
+		t.Errorf("expected 5 nodes, got %d", len(tree.Nodes))
+	}
+	c, err := tree.Root().Checksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%x", c); got != expected {
+		t.Errorf("expected root %q; got %q", expected, got)
+	}
+	if _, err := tw.Write([]byte(msg)); err != ErrWriterClosed {
+		t.Errorf("expected %q, got %v", ErrWriterClosed, err)
+	}
+}
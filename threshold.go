@@ -0,0 +1,83 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+)
+
+// SignerPolicy is a k of n policy of the signers of a root: a SignedRoot or
+// Checkpoint is trusted once Threshold of the Signers, by name, have signed it
+type SignerPolicy struct {
+	Threshold int
+	Signers   map[string]crypto.PublicKey
+}
+
+// ErrThreshold is for a root signed validly by fewer than the Threshold of a
+// SignerPolicy
+type ErrThreshold struct {
+	Valid, Threshold int
+}
+
+// Error shows the count of valid signatures and the count needed
+func (err ErrThreshold) Error() string {
+	return fmt.Sprintf("%d valid signatures of the %d needed", err.Valid, err.Threshold)
+}
+
+// VerifySignedRoot checks that s is signed by enough of the signers
+func (p SignerPolicy) VerifySignedRoot(s SignedRoot) error {
+	if s.MediaType != MediaTypeSignedRoot {
+		return fmt.Errorf("unsupported signed root media type %q", s.MediaType)
+	}
+	return p.verify(s.SignedBody(), s.Signatures)
+}
+
+// VerifyCheckpoint checks that c is signed by enough of the signers
+func (p SignerPolicy) VerifyCheckpoint(c Checkpoint) error {
+	return p.verify(c.body(), c.Signatures)
+}
+
+// verify counts the signers of the policy with a valid signature of body, each
+// once however many signatures are under their name
+func (p SignerPolicy) verify(body []byte, sigs []CheckpointSignature) error {
+	if p.Threshold < 1 || p.Threshold > len(p.Signers) {
+		return fmt.Errorf("invalid threshold %d of %d signers", p.Threshold, len(p.Signers))
+	}
+	valid := map[string]bool{}
+	for _, sig := range sigs {
+		pub, ok := p.Signers[sig.Name]
+		if ok && !valid[sig.Name] && verifyMessage(pub, body, sig.Signature) {
+			valid[sig.Name] = true
+		}
+	}
+	if len(valid) < p.Threshold {
+		return ErrThreshold{Valid: len(valid), Threshold: p.Threshold}
+	}
+	return nil
+}
+
+// Merge returns s with the signatures of other, which must be of the same
+// root and parameters, so signers can each sign a copy to be gathered. A
+// signature by a name in both is that of other.
+func (s SignedRoot) Merge(other SignedRoot) (SignedRoot, error) {
+	if s.MediaType != other.MediaType || !bytes.Equal(s.SignedBody(), other.SignedBody()) {
+		return SignedRoot{}, fmt.Errorf("signed roots are of different roots or parameters")
+	}
+	merged := s
+	merged.Signatures = append([]CheckpointSignature{}, s.Signatures...)
+	for _, sig := range other.Signatures {
+		replaced := false
+		for i := range merged.Signatures {
+			if merged.Signatures[i].Name == sig.Name {
+				merged.Signatures[i], replaced = sig, true
+			}
+		}
+		if !replaced {
+			merged.Signatures = append(merged.Signatures, sig)
+		}
+	}
+	if merged.Timestamp == nil {
+		merged.Timestamp = other.Timestamp
+	}
+	return merged, nil
+}
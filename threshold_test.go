@@ -0,0 +1,90 @@
+package merkle
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+)
+
+func TestSignerPolicy(t *testing.T) {
+	tree := testTree(t, 4)
+	var (
+		names = []string{"alice", "bob", "carol"}
+		keys  = map[string]ed25519.PrivateKey{}
+		p     = SignerPolicy{Threshold: 2, Signers: map[string]crypto.PublicKey{}}
+	)
+	for _, name := range names {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[name] = key
+		p.Signers[name] = key.Public()
+	}
+
+	// each signer signs a copy, and the copies are merged
+	var merged SignedRoot
+	for i, name := range names[:2] {
+		s, err := NewSignedRoot(tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Sign(name, keys[name]); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			merged = *s
+			if err := p.VerifySignedRoot(merged); err != (ErrThreshold{Valid: 1, Threshold: 2}) {
+				t.Errorf("expected 1 of 2 signatures, got %v", err)
+			}
+			continue
+		}
+		if merged, err = merged.Merge(*s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.VerifySignedRoot(merged); err != nil {
+		t.Error(err)
+	}
+
+	// a signature by a signer not of the policy does not count
+	_, mallory, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSignedRoot(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Sign("alice", keys["alice"])
+	s.Sign("mallory", mallory)
+	s.Signatures = append(s.Signatures, CheckpointSignature{Name: "alice", Signature: s.Signatures[0].Signature})
+	if err := p.VerifySignedRoot(*s); err != (ErrThreshold{Valid: 1, Threshold: 2}) {
+		t.Errorf("expected 1 of 2 signatures, got %v", err)
+	}
+
+	other, err := NewSignedRoot(testTree(t, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := merged.Merge(*other); err == nil {
+		t.Errorf("expected signed roots of different trees not to merge")
+	}
+
+	c, err := NewCheckpoint("example.com/log", tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names[1:] {
+		if err := c.Sign(name, keys[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.VerifyCheckpoint(*c); err != nil {
+		t.Error(err)
+	}
+	if err := (SignerPolicy{Threshold: 4, Signers: p.Signers}).VerifyCheckpoint(*c); err == nil {
+		t.Errorf("expected a threshold of more than the signers to be invalid")
+	}
+}
@@ -1,11 +1,55 @@
 package merkle
 
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrEmptyTree is for operations that need at least one node in the tree
+var ErrEmptyTree = errors.New("tree has no nodes")
+
+// EmptyRoot is the canonical root of a tree with no leaves, the checksum of no
+// bytes (see RFC 6962 section 2.1), without the prefix of a DomainSeparated
+// leaf
+func EmptyRoot(hm HashMaker) []byte {
+	h, _ := unwrapHash(hm())
+	return h.Sum(nil)
+}
+
 // Tree is the information on the structure of a set of nodes
 //
 // TODO more docs here
 type Tree struct {
-	Nodes       []*Node `json:"pieces"`
-	BlockLength int     `json:"piece length"`
+	Nodes       []*Node          `json:"pieces"`
+	BlockLength int              `json:"piece length"`
+	FinalBlock  FinalBlockPolicy `json:"final block"`
+
+	length  int64          // bytes hashed into the leaves, when built from a stream
+	bloom   *BloomFilter   // of the leaf checksums, if built
+	indexes map[string]int // of the first leaf of each checksum, if built
+
+	interior *interiorCache // of the subtrees, if CacheInterior
+	perfect  atomic.Value   // of a *perfectProofs, of a power of two leaves
+
+	object string // as SetObjectID
+}
+
+// HashMaker is of the checksums of the leaves, or DefaultHashMaker for a tree
+// of none
+func (t *Tree) HashMaker() HashMaker {
+	return t.hashMaker()
+}
+
+// maxInt is the most leaves a tree can index on this platform
+const maxInt = int(^uint(0) >> 1)
+
+// TotalLength is the count of bytes hashed into the leaves of the tree, when
+// it was built from a stream, or 0 otherwise
+func (t *Tree) TotalLength() int64 {
+	return t.length
 }
 
 // Pieces returns the concatenation of hash values of all blocks
@@ -17,27 +61,270 @@ func (t *Tree) Pieces() []byte {
 	}
 	pieces := []byte{}
 	for _, n := range t.Nodes {
-		if n.checksum == nil || len(n.checksum) == 0 {
+		if len(n.checksum()) == 0 {
 			continue
 		}
-		pieces = append(pieces, n.checksum...)
+		pieces = append(pieces, n.checksum()...)
 	}
 	return pieces
 }
 
+// Append adds nodes as leaves to the end of the tree, and to its Bloom filter
+// and leaf index if it has them
+func (t *Tree) Append(nodes ...*Node) {
+	first := len(t.Nodes)
+	t.Nodes = append(t.Nodes, nodes...)
+	for i, n := range nodes {
+		if t.bloom != nil {
+			t.bloom.Add(n.checksum())
+		}
+		if t.indexes != nil {
+			t.indexLeaf(first+i, n.checksum())
+		}
+	}
+}
+
+// BuildLeafIndex indexes the leaves by their checksum, for FindLeaf. Leaves
+// appended after are indexed as they are appended.
+func (t *Tree) BuildLeafIndex() error {
+	t.indexes = make(map[string]int, len(t.Nodes))
+	for i, n := range t.Nodes {
+		sum, err := n.Checksum()
+		if err != nil {
+			t.indexes = nil
+			return err
+		}
+		t.indexLeaf(i, sum)
+	}
+	return nil
+}
+
+func (t *Tree) indexLeaf(i int, sum []byte) {
+	if _, ok := t.indexes[string(sum)]; !ok {
+		t.indexes[string(sum)] = i
+	}
+}
+
+// FindLeaf returns the index of the first leaf of the checksum sum. This is a
+// lookup with the leaf index (see BuildLeafIndex and WithLeafIndex), or a scan
+// of the leaves otherwise.
+func (t *Tree) FindLeaf(sum []byte) (int, bool) {
+	if t.indexes != nil {
+		i, ok := t.indexes[string(sum)]
+		return i, ok
+	}
+	for i, n := range t.Nodes {
+		if bytes.Equal(n.checksum(), sum) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// appendLeaf appends the leaf of a block of length bytes, positioned after the
+// block of the last leaf
+func (t *Tree) appendLeaf(n *Node, length int) {
+	var offset int64
+	if last := len(t.Nodes); last > 0 {
+		offset = t.Nodes[last-1].Offset + int64(t.Nodes[last-1].Length)
+	}
+	n.Index, n.Offset, n.Length = len(t.Nodes), offset, length
+	t.Append(n)
+}
+
+// setPositions positions the leaves as the blocks of BlockLength, of which
+// only the last may be short. Leaves past the length of the tree, as those
+// of Append, are of no length.
+func (t *Tree) setPositions() {
+	for i, n := range t.Nodes {
+		n.Index = i
+		n.Offset = int64(i) * int64(t.BlockLength)
+		n.Length = t.BlockLength
+		if rest := t.length - n.Offset; t.length > 0 && rest < int64(n.Length) {
+			if rest < 0 {
+				rest = 0
+			}
+			n.Length = int(rest)
+		}
+	}
+}
+
+// NodeRange returns copies of the leaf nodes [start, end), so a caller can page
+// through a large tree without holding, or being able to modify, its nodes
+func (t *Tree) NodeRange(start, end int) ([]*Node, error) {
+	if start < 0 || end > len(t.Nodes) || start > end {
+		return nil, ErrInvalidRange{Start: start, End: end, Size: len(t.Nodes)}
+	}
+	nodes := make([]*Node, end-start)
+	for i, n := range t.Nodes[start:end] {
+		nodes[i] = n.leafCopy()
+	}
+	return nodes, nil
+}
+
+// Subtree returns a tree of the leaves [start, end), whose root is that of the
+// node over those leaves in t. The range must be aligned to a node of t: a
+// power of two leaves starting at a multiple of that count, or a range of
+// the last leaves starting at a multiple of the next power of two. The leaves
+// are copies positioned from the start of the range.
+func (t *Tree) Subtree(start, end int) (*Tree, error) {
+	if start < 0 || end > len(t.Nodes) || start >= end || !alignedRange(start, end, len(t.Nodes)) {
+		return nil, ErrInvalidRange{Start: start, End: end, Size: len(t.Nodes)}
+	}
+	sub := &Tree{BlockLength: t.BlockLength, FinalBlock: t.FinalBlock}
+	base := t.Nodes[start].Offset
+	for i, n := range t.Nodes[start:end] {
+		c := n.leafCopy()
+		c.Index, c.Offset = i, c.Offset-base
+		sub.Nodes = append(sub.Nodes, c)
+		sub.length += int64(c.Length)
+	}
+	return sub, nil
+}
+
+// alignedRange is whether the leaves [start, end) of a tree of size leaves are
+// those under one node of the tree
+func alignedRange(start, end, size int) bool {
+	k := 1
+	for k < end-start {
+		k <<= 1
+	}
+	return start%k == 0 && (end-start == k || end == size)
+}
+
+// ErrInvalidRange is for a range of leaves that is not within the tree
+type ErrInvalidRange struct {
+	Start, End, Size int
+}
+
+// Error shows the range, and the size of the tree
+func (err ErrInvalidRange) Error() string {
+	return fmt.Sprintf("invalid range [%d, %d) for tree of size %d", err.Start, err.End, err.Size)
+}
+
+// Equal is whether other has the same parameters and hash, and the same leaves,
+// and so the same structure and root. Checksums are compared in constant time.
+func (t *Tree) Equal(other *Tree) bool {
+	if len(t.Nodes) != len(other.Nodes) || t.TotalLength() != other.TotalLength() {
+		return false
+	}
+	return t.SubtreeEqual(other, 0, len(t.Nodes))
+}
+
+// SubtreeEqual is whether the leaves [start, end) of other are the same as
+// those of t, for trees of the same parameters and hash. Checksums are
+// compared in constant time.
+func (t *Tree) SubtreeEqual(other *Tree, start, end int) bool {
+	if start < 0 || start > end || end > len(t.Nodes) || end > len(other.Nodes) {
+		return false
+	}
+	if t.BlockLength != other.BlockLength || t.FinalBlock != other.FinalBlock || !sameHash(t.hashMaker(), other.hashMaker()) {
+		return false
+	}
+	equal := 1
+	for i := start; i < end; i++ {
+		a, err := t.Nodes[i].Checksum()
+		if err != nil {
+			return false
+		}
+		b, err := other.Nodes[i].Checksum()
+		if err != nil {
+			return false
+		}
+		equal &= subtle.ConstantTimeCompare(a, b)
+	}
+	return equal == 1
+}
+
+// Iterator returns a NodeIterator over the leaf nodes of the tree
+func (t *Tree) Iterator() *NodeIterator {
+	return &NodeIterator{tree: t, index: -1}
+}
+
+// NodeIterator steps through copies of the leaf nodes of a Tree, in order
+//
+//	it := tree.Iterator()
+//	for it.Next() {
+//		process(it.Index(), it.Node())
+//	}
+type NodeIterator struct {
+	tree  *Tree
+	index int
+	node  *Node
+}
+
+// Next advances to the next node, and is false once there are no more
+func (it *NodeIterator) Next() bool {
+	if it.index+1 >= len(it.tree.Nodes) {
+		it.node = nil
+		return false
+	}
+	it.index++
+	it.node = it.tree.Nodes[it.index].leafCopy()
+	return true
+}
+
+// Node is a copy of the current node
+func (it *NodeIterator) Node() *Node {
+	return it.node
+}
+
+// Index is the position of the current node among the leaves
+func (it *NodeIterator) Index() int {
+	return it.index
+}
+
+// hashMaker is the HashMaker of the tree's nodes
+func (t *Tree) hashMaker() HashMaker {
+	if len(t.Nodes) == 0 {
+		return DefaultHashMaker
+	}
+	return t.Nodes[0].hashMaker()
+}
+
+// leafSums collects the checksums of the leaves, in order
+func (t *Tree) leafSums() ([][]byte, error) {
+	sums := make([][]byte, len(t.Nodes))
+	for i, n := range t.Nodes {
+		c, err := n.Checksum()
+		if err != nil {
+			return nil, err
+		}
+		sums[i] = c
+	}
+	return sums, nil
+}
+
 // Root generates a hash tree bash on the current nodes, and returns the root
-// of the tree
+// of the tree. The root of a tree of a single node is that node, and the root
+// of an empty tree is nil (for which Checksum is ErrEmptyTree).
 func (t *Tree) Root() *Node {
+	switch len(t.Nodes) {
+	case 0:
+		return nil
+	case 1:
+		return t.Nodes[0]
+	}
 	newNodes := t.Nodes
-	for {
+	for len(newNodes) > 1 {
 		newNodes = levelUp(newNodes)
-		if len(newNodes) == 1 {
-			break
-		}
 	}
 	return newNodes[0]
 }
 
+// RootChecksum returns the checksum of the root of the tree, without linking
+// the nodes into a tree. An empty tree is ErrEmptyTree.
+func (t *Tree) RootChecksum() ([]byte, error) {
+	if t.interior != nil {
+		return t.interior.root(t.hashMaker(), t.Nodes)
+	}
+	sums, err := t.leafSums()
+	if err != nil {
+		return nil, err
+	}
+	return subtreeHash(t.hashMaker(), sums)
+}
+
 func levelUp(nodes []*Node) []*Node {
 	var (
 		newNodes []*Node
@@ -52,8 +339,8 @@ func levelUp(nodes []*Node) []*Node {
 				newNodes = append(newNodes, nodes[i])
 				continue
 			}
-			//n := NewNodeHash(nodes[i].hash) // use the node's hash type
-			n := NewNode()
+			// of the node's hash type
+			n := &Node{sums: nodes[i].sums, slot: noSlot}
 			n.Left = nodes[i]
 			n.Left.Parent = n
 			newNodes = append(newNodes, n)
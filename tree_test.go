@@ -0,0 +1,247 @@
+package merkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNodeRange(t *testing.T) {
+	tree := testTree(t, 10)
+	nodes, err := tree.NodeRange(2, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 3 {
+		t.Fatalf("expected 3 nodes, got %d", len(nodes))
+	}
+	for i, n := range nodes {
+		if !bytes.Equal(n.checksum(), tree.Nodes[i+2].checksum()) {
+			t.Errorf("node %d does not match", i+2)
+		}
+	}
+
+	// modifying the copies does not touch the tree
+	expected := append([]byte{}, tree.Nodes[2].checksum()...)
+	nodes[0].checksum()[0]++
+	if !bytes.Equal(tree.Nodes[2].checksum(), expected) {
+		t.Errorf("the tree was modified through a copy of its node")
+	}
+
+	for _, r := range [][2]int{{-1, 2}, {5, 4}, {0, 11}} {
+		if _, err := tree.NodeRange(r[0], r[1]); err == nil {
+			t.Errorf("expected an error for [%d, %d)", r[0], r[1])
+		}
+	}
+}
+
+func TestNodeIterator(t *testing.T) {
+	tree := testTree(t, 5)
+	var count int
+	it := tree.Iterator()
+	for it.Next() {
+		if it.Index() != count {
+			t.Errorf("expected index %d, got %d", count, it.Index())
+		}
+		if !bytes.Equal(it.Node().checksum(), tree.Nodes[count].checksum()) {
+			t.Errorf("node %d does not match", count)
+		}
+		count++
+	}
+	if count != 5 {
+		t.Errorf("expected 5 nodes, got %d", count)
+	}
+	if it.Next() || it.Node() != nil {
+		t.Errorf("expected the iterator to stay exhausted")
+	}
+}
+
+func TestRootEmptyAndSingle(t *testing.T) {
+	var empty Tree
+	if empty.Root() != nil {
+		t.Errorf("expected no root for an empty tree")
+	}
+	if _, err := empty.Root().Checksum(); err != ErrEmptyTree {
+		t.Errorf("expected %q, got %v", ErrEmptyTree, err)
+	}
+	if _, err := empty.RootChecksum(); err != ErrEmptyTree {
+		t.Errorf("expected %q, got %v", ErrEmptyTree, err)
+	}
+
+	single := testTree(t, 1)
+	root := single.Root()
+	if root != single.Nodes[0] || root.Parent != nil {
+		t.Errorf("expected the single node to be the root")
+	}
+	c, err := single.RootChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c, single.Nodes[0].checksum()) {
+		t.Errorf("expected the root checksum to be of the single node")
+	}
+
+	tree := testTree(t, 7)
+	expected, err := tree.Root().Checksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tree.RootChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, got) {
+		t.Errorf("expected root %x; got %x", expected, got)
+	}
+}
+
+func TestLeafPositions(t *testing.T) {
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+	check := func(name string, nodes []*Node, blockLength int) {
+		var offset int64
+		for i, n := range nodes {
+			length := blockLength
+			if rest := len(msg) - int(offset); rest < length {
+				length = rest
+			}
+			if n.Index != i || n.Offset != offset || n.Length != length {
+				t.Errorf("%s: leaf %d at %d of %d bytes, got %d %d %d", name, i, offset, length, n.Index, n.Offset, n.Length)
+			}
+			offset += int64(n.Length)
+		}
+		if offset != int64(len(msg)) {
+			t.Errorf("%s: expected leaves over %d bytes, got %d", name, len(msg), offset)
+		}
+	}
+
+	h := NewHash(DefaultHashMaker, 8)
+	h.Write(msg[:13])
+	h.Write(msg[13:])
+	h.Finish()
+	check("stream", h.(*merkleHash).tree.Nodes, 8)
+
+	b := NewBuilder(DefaultHashMaker, 8)
+	b.Write(msg)
+	tree, _, err := b.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("builder", tree.Nodes, 8)
+
+	tree, _, err = NewBuilder(DefaultHashMaker, 8, WithHashWorkers(3)).Build(bytes.NewReader(msg), int64(len(msg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("build", tree.Nodes, 8)
+}
+
+func TestTreeEqual(t *testing.T) {
+	a, b := testTree(t, 7), testTree(t, 7)
+	if !a.Equal(b) || !a.Equal(a) {
+		t.Errorf("expected trees of the same leaves to be equal")
+	}
+	if a.Equal(testTree(t, 6)) {
+		t.Errorf("expected trees of different sizes not to be equal")
+	}
+
+	// the same leaves under another block length
+	c := testTree(t, 7)
+	c.BlockLength = 2
+	if a.Equal(c) || a.SubtreeEqual(c, 0, 3) {
+		t.Errorf("expected trees of different block lengths not to be equal")
+	}
+
+	d := testTree(t, 7)
+	d.Nodes[5] = newLeaf(DefaultHashMaker, make([]byte, 20))
+	if a.Equal(d) {
+		t.Errorf("expected trees of a different leaf not to be equal")
+	}
+	if !a.SubtreeEqual(d, 0, 5) || !a.SubtreeEqual(d, 6, 7) || a.SubtreeEqual(d, 4, 6) {
+		t.Errorf("expected only ranges without leaf 5 to be equal")
+	}
+	for _, r := range [][2]int{{-1, 2}, {3, 2}, {0, 8}} {
+		if a.SubtreeEqual(b, r[0], r[1]) {
+			t.Errorf("expected the invalid range %v not to be equal", r)
+		}
+	}
+}
+
+func TestSubtree(t *testing.T) {
+	tree := testTree(t, 7)
+	sums, err := tree.leafSums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range [][2]int{{0, 7}, {0, 4}, {4, 7}, {4, 6}, {6, 7}, {2, 4}, {3, 4}} {
+		sub, err := tree.Subtree(r[0], r[1])
+		if err != nil {
+			t.Errorf("range %v: %s", r, err)
+			continue
+		}
+		root, err := sub.RootChecksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := subtreeHash(DefaultHashMaker, sums[r[0]:r[1]])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(root, expected) {
+			t.Errorf("range %v: root %x, expected %x", r, root, expected)
+		}
+		if !sub.SubtreeEqual(sub, 0, r[1]-r[0]) || sub.Nodes[0].Index != 0 {
+			t.Errorf("range %v: expected leaves positioned from 0", r)
+		}
+	}
+	for _, r := range [][2]int{{1, 3}, {0, 3}, {2, 5}, {4, 4}, {-1, 1}, {6, 8}} {
+		if _, err := tree.Subtree(r[0], r[1]); err == nil {
+			t.Errorf("range %v: expected an unaligned range to fail", r)
+		}
+	}
+}
+
+func TestSubtreePositions(t *testing.T) {
+	b := NewBuilder(DefaultHashMaker, 4)
+	if _, err := b.Write([]byte("0123456789abcdefghij")); err != nil {
+		t.Fatal(err)
+	}
+	tree, _, err := b.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := tree.Subtree(4, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := sub.Nodes[0]; n.Index != 0 || n.Offset != 0 || n.Length != 4 || sub.TotalLength() != 4 {
+		t.Errorf("unexpected position %d %d %d of length %d", n.Index, n.Offset, n.Length, sub.TotalLength())
+	}
+}
+
+func TestFindLeaf(t *testing.T) {
+	data := []byte("aaaabbbbccccaaaadd")
+	for _, opts := range [][]Option{nil, {WithLeafIndex()}} {
+		tree, _, err := NewBuilder(DefaultHashMaker, 4, opts...).Build(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if indexed := tree.indexes != nil; indexed != (opts != nil) {
+			t.Errorf("expected the leaf index only WithLeafIndex, got %v", indexed)
+		}
+		for i, expected := range []int{0, 1, 2, 0, 4} {
+			if index, ok := tree.FindLeaf(tree.Nodes[i].checksum()); !ok || index != expected {
+				t.Errorf("leaf %d: expected the first leaf %d, got %d %v", i, expected, index, ok)
+			}
+		}
+		n, err := NewNodeHashBlock(DefaultHashMaker, []byte("eeee"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := tree.FindLeaf(n.checksum()); ok {
+			t.Errorf("expected a new checksum not to be found")
+		}
+		tree.Append(n)
+		if index, ok := tree.FindLeaf(n.checksum()); !ok || index != 5 {
+			t.Errorf("expected the appended leaf at 5, got %d %v", index, ok)
+		}
+	}
+}
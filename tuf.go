@@ -0,0 +1,115 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+)
+
+// TUFTarget is the fileinfo of a target in TUF targets metadata
+type TUFTarget struct {
+	Length int64             `json:"length"`
+	Hashes map[string]string `json:"hashes"`
+	Custom json.RawMessage   `json:"custom,omitempty"`
+}
+
+// TUFMerkle is the custom metadata of a target describing its tree, under the
+// "merkle" key of the target's custom object
+type TUFMerkle struct {
+	Root        string `json:"root"` // hex encoded
+	BlockLength int    `json:"block_length"`
+	Hash        string `json:"hash"` // as registered, see RegisterHash
+	// TreeTarget is the name of the target of the serialized tree (see
+	// Tree.MarshalBinary), which is verified by TUF as any other target
+	TreeTarget string `json:"tree,omitempty"`
+}
+
+type tufCustom struct {
+	Merkle *TUFMerkle `json:"merkle"`
+}
+
+// NewTUFTarget reads the target r, and returns its fileinfo, with its tree in
+// the custom metadata, along with the tree itself to publish as the target
+// named treeTarget
+func NewTUFTarget(r io.Reader, hm HashMaker, blockLength int, treeTarget string) (TUFTarget, *Tree, error) {
+	var (
+		digest = sha256.New()
+		b      = NewBuilder(hm, blockLength, WithEmptyRoot())
+	)
+	n, err := io.Copy(io.MultiWriter(digest, b), r)
+	if err != nil {
+		return TUFTarget{}, nil, err
+	}
+	tree, _, err := b.Finalize()
+	if err != nil {
+		return TUFTarget{}, nil, err
+	}
+	m, err := newTUFMerkle(tree)
+	if err != nil {
+		return TUFTarget{}, nil, err
+	}
+	m.TreeTarget = treeTarget
+	custom, err := json.Marshal(tufCustom{Merkle: m})
+	if err != nil {
+		return TUFTarget{}, nil, err
+	}
+	return TUFTarget{
+		Length: n,
+		Hashes: map[string]string{"sha256": hex.EncodeToString(digest.Sum(nil))},
+		Custom: custom,
+	}, tree, nil
+}
+
+func newTUFMerkle(t *Tree) (*TUFMerkle, error) {
+	annotations, err := LayerAnnotations(t)
+	if err != nil {
+		return nil, err
+	}
+	name, err := HashName(t.hashMaker())
+	if err != nil {
+		return nil, err
+	}
+	return &TUFMerkle{Root: annotations[AnnotationRoot], BlockLength: t.BlockLength, Hash: name}, nil
+}
+
+// Merkle returns the tree metadata of the target, or nil if it has none
+func (target TUFTarget) Merkle() (*TUFMerkle, error) {
+	if len(target.Custom) == 0 {
+		return nil, nil
+	}
+	var custom tufCustom
+	if err := json.Unmarshal(target.Custom, &custom); err != nil {
+		return nil, err
+	}
+	return custom.Merkle, nil
+}
+
+// NewTUFTargetReader returns a reader of the downloaded target r that verifies
+// each block against tree, once the tree, as downloaded from the target named
+// in the metadata, is checked against the target's metadata. A corrupt block
+// is found as soon as it is read, rather than by the hash of the whole target.
+func NewTUFTargetReader(r io.Reader, target TUFTarget, tree *Tree) (io.Reader, error) {
+	m, err := target.Merkle()
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, ErrAnnotationMismatch{Key: "merkle"}
+	}
+	expected, err := newTUFMerkle(tree)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case m.Hash != expected.Hash:
+		return nil, ErrAnnotationMismatch{Key: "merkle.hash"}
+	case m.BlockLength != expected.BlockLength:
+		return nil, ErrAnnotationMismatch{Key: "merkle.block_length"}
+	case m.Root != expected.Root:
+		return nil, ErrAnnotationMismatch{Key: "merkle.root"}
+	case target.Length != tree.TotalLength():
+		return nil, ErrAnnotationMismatch{Key: "length"}
+	}
+	return NewVerifyingReader(r, tree), nil
+}
@@ -0,0 +1,77 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+func TestTUFTarget(t *testing.T) {
+	data := bytes.Repeat([]byte("large artifact "), 1000)
+	target, tree, err := NewTUFTarget(bytes.NewReader(data), DefaultHashMaker, 1024, "artifact.merkle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Length != int64(len(data)) {
+		t.Errorf("expected length %d, got %d", len(data), target.Length)
+	}
+
+	// as the target is published in, and read from, the targets metadata
+	buf, err := json.Marshal(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var published TUFTarget
+	if err := json.Unmarshal(buf, &published); err != nil {
+		t.Fatal(err)
+	}
+	m, err := published.Merkle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.TreeTarget != "artifact.merkle" || m.BlockLength != 1024 || m.Hash != "sha1" {
+		t.Fatalf("unexpected custom metadata %+v", m)
+	}
+
+	blob, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var downloaded Tree
+	if err := downloaded.UnmarshalBinary(blob); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewTUFTargetReader(bytes.NewReader(data), published, &downloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("expected the target to read back")
+	}
+
+	corrupt := append([]byte{}, data...)
+	corrupt[5000]++
+	r, err = NewTUFTargetReader(bytes.NewReader(corrupt), published, &downloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); err != (ErrBlockMismatch{Index: 4}) {
+		t.Errorf("expected block 4 to fail, got %v", err)
+	}
+
+	other, _, err := NewTUFTarget(bytes.NewReader(data[1:]), DefaultHashMaker, 1024, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTUFTargetReader(bytes.NewReader(data), other, &downloaded); err == nil {
+		t.Errorf("expected the tree not to match other metadata")
+	}
+	if _, err := NewTUFTargetReader(bytes.NewReader(data), TUFTarget{Length: target.Length}, &downloaded); err == nil {
+		t.Errorf("expected an error for a target without tree metadata")
+	}
+}
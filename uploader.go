@@ -0,0 +1,179 @@
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// PartStore is an object store accepting an object in numbered parts, like an
+// S3 multipart upload. UploadPart returns the checksum the store computed of
+// the part, when it echoes one, or nil.
+type PartStore interface {
+	UploadPart(number int, data []byte) ([]byte, error)
+}
+
+// Uploader streams an object to a PartStore, uploading parts concurrently
+// while hashing them into the tree of the object, so the object is read once
+type Uploader struct {
+	Store       PartStore
+	PartSize    int // a multiple of the block length
+	Concurrency int // parts in flight, defaulting to 4
+	// EchoHash is the hash of the checksums echoed by the store, such as
+	// sha256 for S3's x-amz-checksum-sha256, or nil to not check them
+	EchoHash HashMaker
+	// Progress is called with the session of a resumed upload, as each part
+	// is done
+	Progress func(Session)
+
+	hm          HashMaker
+	blockLength int
+}
+
+// UploadResult is the tree of an uploaded object
+type UploadResult struct {
+	Tree       *Tree
+	Root       []byte
+	Serialized []byte // as from Tree.MarshalBinary
+	Parts      int
+}
+
+// NewUploader returns an Uploader of objects to store, in parts of partSize
+func NewUploader(store PartStore, hm HashMaker, blockLength, partSize int) *Uploader {
+	return &Uploader{Store: store, PartSize: partSize, hm: hm, blockLength: blockLength}
+}
+
+type uploadPart struct {
+	number int
+	data   []byte
+}
+
+// Upload reads r to its end, and uploads it in parts. The first failed part
+// stops the upload, and is returned.
+func (u *Uploader) Upload(r io.Reader) (*UploadResult, error) {
+	if u.blockLength < MinBlockSize || u.PartSize < u.blockLength || u.PartSize%u.blockLength != 0 {
+		return nil, fmt.Errorf("part size %d is not a multiple of block length %d", u.PartSize, u.blockLength)
+	}
+	workers := u.Concurrency
+	if workers < 1 {
+		workers = 4
+	}
+
+	var (
+		parts  = make(chan uploadPart)
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		leaves = map[int][]*Node{}
+		err    error
+		failed = make(chan struct{})
+		once   sync.Once
+	)
+	fail := func(e error) {
+		once.Do(func() {
+			mu.Lock()
+			err = e
+			mu.Unlock()
+			close(failed)
+		})
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range parts {
+				nodes, e := u.part(p)
+				if e != nil {
+					fail(e)
+					continue
+				}
+				mu.Lock()
+				leaves[p.number] = nodes
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var (
+		count  int
+		length int64
+		rerr   error
+	)
+read:
+	for {
+		buf := make([]byte, u.PartSize)
+		n, e := io.ReadFull(r, buf)
+		if n > 0 || count == 0 {
+			count++
+			length += int64(n)
+			select {
+			case parts <- uploadPart{number: count, data: buf[:n]}:
+			case <-failed:
+				break read
+			}
+		}
+		if e == io.EOF || e == io.ErrUnexpectedEOF {
+			break
+		}
+		if e != nil {
+			rerr = e
+			break
+		}
+	}
+	close(parts)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	tree := &Tree{BlockLength: u.blockLength, length: length}
+	for i := 1; i <= count; i++ {
+		tree.Append(leaves[i]...)
+	}
+	root, e := tree.RootChecksum()
+	if e == ErrEmptyTree {
+		root, e = EmptyRoot(u.hm), nil
+	}
+	if e != nil {
+		return nil, e
+	}
+	serialized, e := tree.MarshalBinary()
+	if e != nil {
+		return nil, e
+	}
+	return &UploadResult{Tree: tree, Root: root, Serialized: serialized, Parts: count}, nil
+}
+
+// part hashes the blocks of a part and uploads it, checking any checksum the
+// store echoes
+func (u *Uploader) part(p uploadPart) ([]*Node, error) {
+	var nodes []*Node
+	for i := 0; i < len(p.data); i += u.blockLength {
+		end := i + u.blockLength
+		if end > len(p.data) {
+			end = len(p.data)
+		}
+		n, err := NewNodeHashBlock(u.hm, p.data[i:end])
+		if err != nil {
+			return nil, err
+		}
+		n.Offset = int64(p.number-1)*int64(u.PartSize) + int64(i)
+		n.Index, n.Length = int(n.Offset/int64(u.blockLength)), end-i
+		nodes = append(nodes, n)
+	}
+	echoed, err := u.Store.UploadPart(p.number, p.data)
+	if err != nil {
+		return nil, fmt.Errorf("part %d: %s", p.number, err)
+	}
+	if u.EchoHash != nil && echoed != nil {
+		h := u.EchoHash()
+		h.Write(p.data)
+		if !bytes.Equal(h.Sum(nil), echoed) {
+			return nil, ErrPartMismatch{Number: p.number}
+		}
+	}
+	return nodes, nil
+}
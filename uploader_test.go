@@ -0,0 +1,98 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+type memPartStore struct {
+	mu      sync.Mutex
+	parts   map[int][]byte
+	corrupt int // part number to echo a wrong checksum for
+	fail    int // part number to fail
+}
+
+func (s *memPartStore) UploadPart(number int, data []byte) ([]byte, error) {
+	if number == s.fail {
+		return nil, errors.New("upload failed")
+	}
+	s.mu.Lock()
+	s.parts[number] = append([]byte{}, data...)
+	s.mu.Unlock()
+	sum := sha256.Sum256(data)
+	if number == s.corrupt {
+		sum[0]++
+	}
+	return sum[:], nil
+}
+
+func (s *memPartStore) object() []byte {
+	var buf bytes.Buffer
+	for i := 1; i <= len(s.parts); i++ {
+		buf.Write(s.parts[i])
+	}
+	return buf.Bytes()
+}
+
+func TestUploader(t *testing.T) {
+	data := make([]byte, 100*1024+77)
+	rand.New(rand.NewSource(6)).Read(data)
+	echo := func() hash.Hash { return sha256.New() }
+
+	store := &memPartStore{parts: map[int][]byte{}}
+	u := NewUploader(store, DefaultHashMaker, 1024, 16*1024)
+	u.EchoHash = echo
+	res, err := u.Upload(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Parts != 7 || !bytes.Equal(store.object(), data) {
+		t.Errorf("expected the object uploaded in 7 parts, got %d", res.Parts)
+	}
+	_, root, err := NewBuilder(DefaultHashMaker, 1024).Build(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res.Root, root) {
+		t.Errorf("expected root %x, got %x", root, res.Root)
+	}
+	var decoded Tree
+	if err := decoded.UnmarshalBinary(res.Serialized); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.TotalLength() != int64(len(data)) {
+		t.Errorf("expected the serialized tree of %d bytes, got %d", len(data), decoded.TotalLength())
+	}
+
+	store = &memPartStore{parts: map[int][]byte{}, corrupt: 3}
+	u = NewUploader(store, DefaultHashMaker, 1024, 16*1024)
+	u.EchoHash = echo
+	if _, err := u.Upload(bytes.NewReader(data)); err != (ErrPartMismatch{Number: 3}) {
+		t.Errorf("expected part 3 to mismatch its echoed checksum, got %v", err)
+	}
+
+	store = &memPartStore{parts: map[int][]byte{}, fail: 2}
+	if _, err := NewUploader(store, DefaultHashMaker, 1024, 16*1024).Upload(bytes.NewReader(data)); err == nil {
+		t.Errorf("expected a failed part to fail the upload")
+	}
+
+	if _, err := NewUploader(store, DefaultHashMaker, 1024, 1000).Upload(bytes.NewReader(data)); err == nil {
+		t.Errorf("expected an error for parts that are not whole blocks")
+	}
+}
+
+func TestUploaderEmpty(t *testing.T) {
+	store := &memPartStore{parts: map[int][]byte{}}
+	res, err := NewUploader(store, DefaultHashMaker, 1024, 4096).Upload(bytes.NewReader(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Parts != 1 || !bytes.Equal(res.Root, EmptyRoot(DefaultHashMaker)) {
+		t.Errorf("expected a single empty part and the empty root, got %+v", res)
+	}
+}
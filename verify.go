@@ -0,0 +1,255 @@
+package merkle
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrBlockMismatch is for a block whose checksum does not match the leaf of
+// the expected tree
+type ErrBlockMismatch struct {
+	Index int
+}
+
+// Error shows the index of the block that failed
+func (err ErrBlockMismatch) Error() string {
+	return fmt.Sprintf("block %d does not match the expected checksum", err.Index)
+}
+
+// ErrLengthMismatch is for input that is shorter or longer than the expected
+// tree accounts for
+type ErrLengthMismatch struct {
+	Blocks, Expected int
+}
+
+// Error shows the count of blocks, against the expected count
+func (err ErrLengthMismatch) Error() string {
+	return fmt.Sprintf("input of %d blocks does not match the expected %d", err.Blocks, err.Expected)
+}
+
+// blockVerifier checks blocks, in order, against the leaves of an expected
+// tree
+type blockVerifier struct {
+	tree  *Tree
+	hm    HashMaker
+	index int // of the next block
+	start time.Time
+	pace  *throttle
+}
+
+func newBlockVerifier(expected *Tree) *blockVerifier {
+	return &blockVerifier{tree: expected, hm: expected.hashMaker(), start: time.Now()}
+}
+
+// next is the length of the next block, the BlockLength of the tree or, of a
+// tree of no BlockLength as of BuildChunks, the length of its leaf. Past the
+// last leaf it is 1, for any more input to be an ErrLengthMismatch.
+func (bv *blockVerifier) next() (int, error) {
+	switch {
+	case bv.tree.BlockLength > 0:
+		return bv.tree.BlockLength, nil
+	case bv.index >= len(bv.tree.Nodes):
+		return 1, nil
+	case bv.tree.Nodes[bv.index].Length > 0:
+		return bv.tree.Nodes[bv.index].Length, nil
+	}
+	return 0, ErrNoBlockLength
+}
+
+// verify checks the next block. Only the last block of the tree may be short.
+func (bv *blockVerifier) verify(b []byte) error {
+	if bv.index >= len(bv.tree.Nodes) {
+		return bv.audit(ErrLengthMismatch{Blocks: bv.index + 1, Expected: len(bv.tree.Nodes)})
+	}
+	bv.pace.wait(len(b))
+	if err := verifyBlock(bv.tree, bv.hm, bv.index, b); err != nil {
+		return bv.audit(err)
+	}
+	bv.index++
+	return nil
+}
+
+// verifyBlock checks the block at index against the leaf of tree
+func verifyBlock(tree *Tree, hm HashMaker, index int, b []byte) error {
+	var (
+		n   *Node
+		err error
+	)
+	if len(b) < tree.BlockLength && index == len(tree.Nodes)-1 {
+		n, err = tree.FinalBlock.NewNode(hm, tree.BlockLength, b)
+	} else {
+		n, err = NewNodeHashBlock(hm, b)
+	}
+	if err != nil {
+		return err
+	}
+	expected, err := tree.Nodes[index].Checksum()
+	if err != nil {
+		return err
+	}
+	if !equalChecksums(n.checksum(), expected) {
+		return ErrBlockMismatch{Index: index}
+	}
+	return nil
+}
+
+// done checks that every block of the tree was verified
+func (bv *blockVerifier) done() error {
+	if bv.index != len(bv.tree.Nodes) {
+		return bv.audit(ErrLengthMismatch{Blocks: bv.index, Expected: len(bv.tree.Nodes)})
+	}
+	return bv.audit(nil)
+}
+
+// audit is err, sent as the outcome of verifying the blocks, of the index of
+// the block that failed
+func (bv *blockVerifier) audit(err error) error {
+	if sink := auditing(); sink != nil {
+		index := -1
+		if err != nil {
+			index = bv.index
+		}
+		audit(sink, AuditEvent{Kind: "blocks", Object: bv.tree.object, Root: auditRoot(bv.tree), Index: index}, bv.start, err)
+	}
+	return err
+}
+
+// NewVerifyingReader returns a reader of r that verifies each block against
+// the leaves of expected before any of its bytes are returned. The first
+// corrupt block is an ErrBlockMismatch, and input of a different length than
+// the tree is an ErrLengthMismatch, rather than io.EOF. A tree of no
+// BlockLength is read by the lengths of its leaves, and without them is an
+// ErrNoBlockLength.
+//
+// WithRateLimit, the blocks are read and verified no faster than the rates.
+// Any other option fails the first Read with an ErrUnsupportedOption.
+func NewVerifyingReader(r io.Reader, expected *Tree, opts ...Option) io.Reader {
+	bv := newBlockVerifier(expected)
+	o := newOptions(opts)
+	bv.pace = o.throttle()
+	return &verifyingReader{r: r, bv: bv, err: o.supported("NewVerifyingReader", verifyOptions)}
+}
+
+type verifyingReader struct {
+	r     io.Reader
+	bv    *blockVerifier
+	block []byte
+	buf   []byte // verified bytes not yet read
+	err   error
+}
+
+func (vr *verifyingReader) Read(p []byte) (int, error) {
+	for len(vr.buf) == 0 {
+		if vr.err != nil {
+			return 0, vr.err
+		}
+		size, err := vr.bv.next()
+		if err != nil {
+			vr.err = err
+			return 0, err
+		}
+		if cap(vr.block) < size {
+			vr.block = make([]byte, size)
+		}
+		n, err := io.ReadFull(vr.r, vr.block[:size])
+		if n > 0 {
+			if verr := vr.bv.verify(vr.block[:n]); verr != nil {
+				vr.err = verr
+				return 0, verr
+			}
+			vr.buf = vr.block[:n]
+		}
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			vr.err = io.EOF
+			if derr := vr.bv.done(); derr != nil {
+				vr.err = derr
+			}
+		default:
+			vr.err = err
+		}
+	}
+	n := copy(p, vr.buf)
+	vr.buf = vr.buf[n:]
+	return n, nil
+}
+
+// NewVerifyingHash returns a writer that checksums each block with hm as it
+// is written, and fails the Write that completes a block diverging from the
+// leaf of expected with an ErrBlockMismatch, so a download can be aborted at
+// the first corrupt block rather than at the root. Writes after a failure
+// fail the same.
+//
+// The writer is an io.Closer too, whose Close checks any trailing short block
+// and that the input was of the length of the tree, as an ErrLengthMismatch.
+// A tree of no BlockLength is verified by the lengths of its leaves, and
+// without them the writes are an ErrNoBlockLength. WithRateLimit, the blocks
+// are verified no faster than the rates. Any other option fails the first
+// Write with an ErrUnsupportedOption.
+func NewVerifyingHash(hm HashMaker, expected *Tree, opts ...Option) io.Writer {
+	bv := newBlockVerifier(expected)
+	bv.hm = hm
+	o := newOptions(opts)
+	bv.pace = o.throttle()
+	return &verifyingWriter{bv: bv, err: o.supported("NewVerifyingHash", verifyOptions)}
+}
+
+type verifyingWriter struct {
+	bv     *blockVerifier
+	block  []byte // of the block being written, of the length of the next
+	err    error
+	closed bool
+}
+
+func (vw *verifyingWriter) Write(p []byte) (int, error) {
+	if vw.closed {
+		return 0, ErrFinalized
+	}
+	if vw.err != nil {
+		return 0, vw.err
+	}
+	var n int
+	for len(p) > 0 {
+		if len(vw.block) == 0 {
+			size, err := vw.bv.next()
+			if err != nil {
+				vw.err = err
+				return n, err
+			}
+			if cap(vw.block) != size {
+				vw.block = make([]byte, 0, size)
+			}
+		}
+		c := copy(vw.block[len(vw.block):cap(vw.block)], p)
+		vw.block = vw.block[:len(vw.block)+c]
+		p, n = p[c:], n+c
+		if len(vw.block) == cap(vw.block) {
+			if err := vw.bv.verify(vw.block); err != nil {
+				vw.err = err
+				return n, err
+			}
+			vw.block = vw.block[:0]
+		}
+	}
+	return n, nil
+}
+
+// Close checks the trailing short block, if any, and that every block of the
+// tree was written
+func (vw *verifyingWriter) Close() error {
+	if vw.err != nil || vw.closed {
+		return vw.err
+	}
+	if len(vw.block) > 0 {
+		if err := vw.bv.verify(vw.block); err != nil {
+			vw.err = err
+			return err
+		}
+		vw.block = vw.block[:0]
+	}
+	vw.err = vw.bv.done()
+	vw.closed = true
+	return vw.err
+}
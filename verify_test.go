@@ -0,0 +1,95 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestVerifyingHash(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	tree, err := SumOf(sha256.New, 64, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewVerifyingHash(sha256.New, tree)
+	for _, chunk := range [][]byte{data[:10], data[10:500], data[500:]} {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Errorf("expected the data to verify, got %v", err)
+	}
+	if _, err := w.Write(data[:1]); err != ErrFinalized {
+		t.Errorf("expected ErrFinalized after Close, got %v", err)
+	}
+
+	corrupt := append([]byte{}, data...)
+	corrupt[300] ^= 0xff // of block 4
+	w = NewVerifyingHash(sha256.New, tree)
+	n, err := w.Write(corrupt)
+	var mismatch ErrBlockMismatch
+	if !errors.As(err, &mismatch) || mismatch.Index != 4 {
+		t.Fatalf("expected ErrBlockMismatch of block 4, got %v", err)
+	}
+	if n != 320 {
+		t.Errorf("expected the write to stop at the end of block 4, got %d", n)
+	}
+	if _, err := w.Write(data[320:]); !errors.As(err, &mismatch) {
+		t.Errorf("expected later writes to fail, got %v", err)
+	}
+
+	w = NewVerifyingHash(sha256.New, tree)
+	w.Write(data[:14*64])
+	if err := w.(io.Closer).Close(); !errors.As(err, new(ErrLengthMismatch)) {
+		t.Errorf("expected ErrLengthMismatch for short input, got %v", err)
+	}
+}
+
+func TestVerifyChunks(t *testing.T) {
+	chunks := [][]byte{[]byte("abc"), []byte("defgh"), []byte("i")}
+	tree, _, err := NewBuilder(DefaultHashMaker, 0).BuildChunks(chunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Join(chunks, nil)
+
+	// by the lengths of the leaves, as there is no BlockLength
+	if got, err := ioutil.ReadAll(NewVerifyingReader(bytes.NewReader(data), tree)); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("expected the chunks read, got %q %v", got, err)
+	}
+	if _, err := ioutil.ReadAll(NewVerifyingReader(bytes.NewReader(append(data, 'x')), tree)); err == nil {
+		t.Errorf("expected more input than the chunks to fail")
+	}
+	w := NewVerifyingHash(DefaultHashMaker, tree)
+	for _, b := range data {
+		if _, err := w.Write([]byte{b}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Errorf("expected the chunks written, got %v", err)
+	}
+	corrupt := append([]byte{}, data...)
+	corrupt[4] ^= 1
+	if _, err := NewVerifyingHash(DefaultHashMaker, tree).Write(corrupt); err != (ErrBlockMismatch{Index: 1}) {
+		t.Errorf("expected the second chunk to fail, got %v", err)
+	}
+
+	// and without them, an error rather than no progress
+	unknown := &Tree{}
+	for _, n := range tree.Nodes {
+		unknown.Append(newLeaf(n.hashMaker(), n.checksum()))
+	}
+	if _, err := ioutil.ReadAll(NewVerifyingReader(bytes.NewReader(data), unknown)); err != ErrNoBlockLength {
+		t.Errorf("expected ErrNoBlockLength reading, got %v", err)
+	}
+	if _, err := NewVerifyingHash(DefaultHashMaker, unknown).Write(data); err != ErrNoBlockLength {
+		t.Errorf("expected ErrNoBlockLength writing, got %v", err)
+	}
+}
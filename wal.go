@@ -0,0 +1,117 @@
+package merkle
+
+import "fmt"
+
+// WAL is a tamper evident record of a database: the records of each segment
+// of its write-ahead log are the leaves of a tree of the segment, and the
+// roots of the segments sealed, and of the snapshots of its tables, are the
+// leaves of a SuperTree. A record or row is proven under the super-root by a
+// ChainProof, for audits that the log was not changed after the fact.
+type WAL struct {
+	Super *SuperTree
+
+	hm             HashMaker
+	segmentRecords int
+	trees          []*Tree // of each member of the Super
+	segments       []int   // member of each segment sealed
+	open           *Tree   // of the records of the segment not yet sealed
+	snapshots      map[string]int
+}
+
+// WALRecord locates a record by the number of its segment, and its index in
+// the segment
+type WALRecord struct {
+	Segment, Index int
+}
+
+// NewWAL returns an empty WAL of trees checksummed with hm. A segment is
+// sealed after segmentRecords records, or 0 to only Seal them by hand, as at
+// the end of each segment file.
+func NewWAL(hm HashMaker, segmentRecords int) *WAL {
+	return &WAL{Super: NewSuperTree(hm), hm: hm, segmentRecords: segmentRecords, snapshots: map[string]int{}}
+}
+
+// Append adds record as the next leaf of the open segment
+func (w *WAL) Append(record []byte) (WALRecord, error) {
+	n, err := NewNodeHashBlock(w.hm, record)
+	if err != nil {
+		return WALRecord{}, err
+	}
+	if w.open == nil {
+		w.open = &Tree{}
+	}
+	w.open.appendLeaf(n, len(record))
+	w.open.length += int64(len(record))
+	rec := WALRecord{Segment: len(w.segments), Index: len(w.open.Nodes) - 1}
+	if w.segmentRecords > 0 && len(w.open.Nodes) >= w.segmentRecords {
+		if _, err := w.Seal(); err != nil {
+			return WALRecord{}, err
+		}
+	}
+	return rec, nil
+}
+
+// Seal adds the root of the open segment to the Super, and returns its index
+// there. The records appended after are of the next segment.
+func (w *WAL) Seal() (int, error) {
+	if w.open == nil {
+		return 0, ErrEmptyTree
+	}
+	member, err := w.Super.Add(fmt.Sprintf("segment/%d", len(w.segments)), w.open)
+	if err != nil {
+		return 0, err
+	}
+	w.trees = append(w.trees, w.open)
+	w.segments = append(w.segments, member)
+	w.open = nil
+	return member, nil
+}
+
+// SnapshotTable adds the root of the tree of the rows of table, as of a
+// periodic snapshot in a canonical order, to the Super, and returns its index
+// there
+func (w *WAL) SnapshotTable(table string, rows [][]byte) (int, error) {
+	tree, _, err := NewBuilder(w.hm, 0).BuildChunks(rows)
+	if err != nil {
+		return 0, err
+	}
+	member, err := w.Super.Add(fmt.Sprintf("snapshot/%s/%d", table, w.snapshots[table]), tree)
+	if err != nil {
+		return 0, err
+	}
+	w.snapshots[table]++
+	w.trees = append(w.trees, tree)
+	return member, nil
+}
+
+// Root is the super-root, over the segments sealed and snapshots taken
+func (w *WAL) Root() ([]byte, error) {
+	return w.Super.Root()
+}
+
+// ProveRecord returns the ChainProof of a record of a sealed segment
+func (w *WAL) ProveRecord(rec WALRecord) (ChainProof, error) {
+	if rec.Segment < 0 || rec.Segment >= len(w.segments) {
+		return ChainProof{}, fmt.Errorf("segment %d is not sealed", rec.Segment)
+	}
+	return w.ProveRow(w.segments[rec.Segment], rec.Index)
+}
+
+// ProveRow returns the ChainProof of the leaf at index of the member of the
+// Super, as returned by SnapshotTable or Seal
+func (w *WAL) ProveRow(member, index int) (ChainProof, error) {
+	if member < 0 || member >= len(w.trees) {
+		return ChainProof{}, ErrIndexOutOfRange{Index: member, Size: len(w.trees)}
+	}
+	return w.Super.Prove(member, w.trees[member], index)
+}
+
+// VerifyRecord checks that record, a record of a WAL or row of a snapshot, is
+// proven under superRoot by p
+func VerifyRecord(hm HashMaker, superRoot []byte, p ChainProof, record []byte) error {
+	n, err := NewNodeHashBlock(hm, record)
+	if err != nil {
+		return err
+	}
+	return VerifyChain(hm, superRoot, p, n.checksum())
+}
@@ -0,0 +1,61 @@
+package merkle
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWAL(t *testing.T) {
+	w := NewWAL(DefaultHashMaker, 4)
+	var recs []WALRecord
+	for i := 0; i < 10; i++ {
+		rec, err := w.Append([]byte(fmt.Sprintf("INSERT %d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	if recs[5] != (WALRecord{Segment: 1, Index: 1}) {
+		t.Errorf("expected the sixth record second of the second segment, got %+v", recs[5])
+	}
+	rows := [][]byte{[]byte("1,alice"), []byte("2,bob"), []byte("3,carol")}
+	member, err := w.SnapshotTable("users", rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Seal(); err != nil {
+		t.Fatal(err)
+	}
+	if w.Super.Names[member] != "snapshot/users/0" || len(w.Super.Roots) != 4 {
+		t.Errorf("expected the snapshot between the segments, got %v", w.Super.Names)
+	}
+	root, err := w.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, rec := range recs {
+		p, err := w.ProveRecord(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyRecord(DefaultHashMaker, root, p, []byte(fmt.Sprintf("INSERT %d", i))); err != nil {
+			t.Errorf("record %d: %s", i, err)
+		}
+		if err := VerifyRecord(DefaultHashMaker, root, p, []byte("DELETE")); err == nil {
+			t.Errorf("record %d: expected another record to fail", i)
+		}
+	}
+	p, err := w.ProveRow(member, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyRecord(DefaultHashMaker, root, p, rows[1]); err != nil {
+		t.Error(err)
+	}
+
+	w.Append([]byte("UPDATE"))
+	if _, err := w.ProveRecord(WALRecord{Segment: 3}); err == nil {
+		t.Errorf("expected a record of an open segment not to be proven")
+	}
+}
@@ -0,0 +1,175 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Witness is a client of a transparency witness, which cosigns a checkpoint
+// of a log once it has checked the checkpoint is consistent with the last of
+// the log it cosigned. Verifiers that require the cosignatures of witnesses
+// can not be shown a split view, without the witnesses seeing it too.
+//
+// The witness's add-checkpoint endpoint takes a POST of the size of the last
+// checkpoint it cosigned and the consistency proof from it, and the signed
+// checkpoint:
+//
+//	old 42
+//	<base64 of each checksum of the proof, a line each>
+//
+//	<the checkpoint, as MarshalText>
+//
+// and responds with the lines of its cosignature, or 409 Conflict and the size
+// it last cosigned. A cosignature is a signature of the body of the
+// checkpoint, as of Checkpoint.Sign. This is the shape of the C2SP
+// tlog-witness protocol, but not its signed notes, whose signature lines
+// carry a hash of the key, nor its cosignatures, which are of a timestamp
+// too, so it does not interoperate with witnesses of that protocol.
+type Witness struct {
+	Client *http.Client
+	URL    string // of the add-checkpoint endpoint
+	Name   string // of the witness's cosignatures
+	Key    crypto.PublicKey
+
+	mu   sync.Mutex
+	size int // of the last checkpoint cosigned, as known
+}
+
+// ErrWitnessConflict is for a witness that last cosigned a checkpoint of
+// another size than the one the consistency proof was from
+type ErrWitnessConflict struct {
+	Witness string
+	Size    int
+}
+
+// Error shows the size the witness last cosigned
+func (err ErrWitnessConflict) Error() string {
+	return fmt.Sprintf("witness %q last cosigned a checkpoint of size %d", err.Witness, err.Size)
+}
+
+// ConsistencyFunc returns the proof that a tree of oldSize leaves is a prefix
+// of the tree of a checkpoint
+type ConsistencyFunc func(oldSize int) ([][]byte, error)
+
+// AddCheckpoint submits c with the proof from the size the witness last
+// cosigned, and returns its cosignature, checked against its Key. A witness
+// that last cosigned another size is asked again, once, with the proof from
+// that size.
+func (w *Witness) AddCheckpoint(c Checkpoint, prove ConsistencyFunc) (CheckpointSignature, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	sig, err := w.add(c, prove)
+	if conflict, ok := err.(ErrWitnessConflict); ok && conflict.Size != w.size {
+		w.size = conflict.Size
+		sig, err = w.add(c, prove)
+	}
+	if err != nil {
+		return CheckpointSignature{}, err
+	}
+	w.size = c.Size
+	return sig, nil
+}
+
+func (w *Witness) add(c Checkpoint, prove ConsistencyFunc) (CheckpointSignature, error) {
+	var proof [][]byte
+	if w.size > 0 {
+		var err error
+		if proof, err = prove(w.size); err != nil {
+			return CheckpointSignature{}, err
+		}
+	}
+	text, err := c.MarshalText()
+	if err != nil {
+		return CheckpointSignature{}, err
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "old %d\n", w.size)
+	for _, sum := range proof {
+		fmt.Fprintln(&body, base64.StdEncoding.EncodeToString(sum))
+	}
+	body.WriteString("\n")
+	body.Write(text)
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(w.URL, "text/plain; charset=utf-8", &body)
+	if err != nil {
+		return CheckpointSignature{}, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return CheckpointSignature{}, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusConflict:
+		size, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil || size < 0 {
+			return CheckpointSignature{}, fmt.Errorf("POST %s: %s of no size", w.URL, resp.Status)
+		}
+		return CheckpointSignature{}, ErrWitnessConflict{Witness: w.Name, Size: size}
+	default:
+		return CheckpointSignature{}, fmt.Errorf("POST %s: %s", w.URL, resp.Status)
+	}
+
+	// the cosignature is among the lines of signatures of the response
+	var cosigned Checkpoint
+	if err := cosigned.UnmarshalText(append(c.body(), append([]byte("\n"), data...)...)); err != nil {
+		return CheckpointSignature{}, err
+	}
+	for _, sig := range cosigned.Signatures {
+		if sig.Name == w.Name && verifyMessage(w.Key, c.body(), sig.Signature) {
+			return sig, nil
+		}
+	}
+	return CheckpointSignature{}, ErrCheckpointSignature
+}
+
+// Cosign submits c to the witnesses at once, and returns c with the
+// cosignatures of those that accepted it, once they meet policy, which is of
+// the names and keys of the witnesses. The errors of the witnesses that did
+// not are returned with it otherwise.
+func Cosign(c Checkpoint, witnesses []*Witness, policy SignerPolicy, prove ConsistencyFunc) (Checkpoint, error) {
+	var (
+		wg   sync.WaitGroup
+		sigs = make([]CheckpointSignature, len(witnesses))
+		errs = make([]error, len(witnesses))
+	)
+	for i, w := range witnesses {
+		wg.Add(1)
+		go func(i int, w *Witness) {
+			defer wg.Done()
+			sigs[i], errs[i] = w.AddCheckpoint(c, prove)
+		}(i, w)
+	}
+	wg.Wait()
+
+	cosigned := c
+	cosigned.Signatures = append([]CheckpointSignature{}, c.Signatures...)
+	var failed []string
+	for i, sig := range sigs {
+		if errs[i] != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", witnesses[i].Name, errs[i]))
+			continue
+		}
+		cosigned.addSignature(sig)
+	}
+	if err := policy.VerifyCheckpoint(cosigned); err != nil {
+		if len(failed) > 0 {
+			return Checkpoint{}, fmt.Errorf("%s (%s)", err, strings.Join(failed, "; "))
+		}
+		return Checkpoint{}, err
+	}
+	return cosigned, nil
+}
@@ -0,0 +1,134 @@
+package merkle
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testWitness cosigns checkpoints of any proof, remembering the size of the
+// last, or refuses all when down
+type testWitness struct {
+	name string
+	key  ed25519.PrivateKey
+	down bool
+
+	mu     sync.Mutex
+	size   int
+	proofs []int // the checksums of each proof
+}
+
+func (tw *testWitness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.down {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+		return
+	}
+	br := bufio.NewReader(r.Body)
+	var old int
+	if _, err := fmt.Fscanf(br, "old %d\n", &old); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if old != tw.size {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintln(w, tw.size)
+		return
+	}
+	proof := 0
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if line == "\n" {
+			break
+		}
+		proof++
+	}
+	var text strings.Builder
+	br.WriteTo(&text)
+	var c Checkpoint
+	if err := c.UnmarshalText([]byte(text.String())); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tw.size = c.Size
+	tw.proofs = append(tw.proofs, proof)
+	fmt.Fprintf(w, "— %s %s\n", tw.name, base64.StdEncoding.EncodeToString(ed25519.Sign(tw.key, c.body())))
+}
+
+func TestCosign(t *testing.T) {
+	var (
+		witnesses []*Witness
+		servers   []*testWitness
+		policy    = SignerPolicy{Threshold: 2, Signers: map[string]crypto.PublicKey{}}
+	)
+	for _, name := range []string{"w1", "w2", "w3"} {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw := &testWitness{name: name, key: key}
+		srv := httptest.NewServer(tw)
+		defer srv.Close()
+		servers = append(servers, tw)
+		witnesses = append(witnesses, &Witness{URL: srv.URL, Name: name, Key: key.Public()})
+		policy.Signers[name] = key.Public()
+	}
+	_, logKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prove := func(oldSize int) ([][]byte, error) {
+		return [][]byte{make([]byte, 20)}, nil
+	}
+
+	// the third witness last cosigned a size the client does not know of
+	servers[2].size = 2
+	servers[1].down = true
+	for _, size := range []int{3, 5} {
+		c, err := NewCheckpoint("example.com/log", testTree(t, size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Sign("log", logKey); err != nil {
+			t.Fatal(err)
+		}
+		cosigned, err := Cosign(*c, witnesses, policy, prove)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cosigned.VerifyWith("log", logKey.Public()); err != nil {
+			t.Error(err)
+		}
+		if len(cosigned.Signatures) != 3 {
+			t.Errorf("expected the signature of the log and of 2 witnesses, got %d", len(cosigned.Signatures))
+		}
+	}
+	if got := servers[0].proofs; len(got) != 2 || got[0] != 0 || got[1] != 1 {
+		t.Errorf("expected no proof for the first checkpoint and one after, got %v", got)
+	}
+	if got := servers[2].proofs; len(got) != 2 || got[0] != 1 {
+		t.Errorf("expected a proof from the size of the conflict, got %v", got)
+	}
+
+	servers[0].down = true
+	c, err := NewCheckpoint("example.com/log", testTree(t, 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Cosign(*c, witnesses, policy, prove); err == nil || !strings.Contains(err.Error(), "1 valid signatures of the 2 needed") {
+		t.Errorf("expected too few cosignatures, got %v", err)
+	}
+}